@@ -0,0 +1,713 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// With -memory=arena, C memory lives in a byte slice managed by package libc
+// (see libc/arena.go), and pointers are translated as uintptr offsets into
+// it. Loads and stores become calls to libc.ArenaLoad* and libc.ArenaStore*,
+// getelementptr becomes integer arithmetic using the target's struct layout,
+// and globals are allocated in the arena by an init function. This is slower
+// and less idiomatic than the default, but it handles C code that depends on
+// pointers being numbers: pointers stored in integers, compared across
+// objects, or hashed by address.
+//
+// Function pointers are still translated as Go func values, so they can't be
+// stored in arena memory.
+
+// arenaMode reports whether the arena memory model is in use.
+func arenaMode() bool {
+	return *memoryModel == "arena"
+}
+
+// checkMemoryModel returns an error if model is not a valid value for the
+// -memory flag.
+func checkMemoryModel(model string) error {
+	switch model {
+	case "go", "arena":
+		return nil
+	}
+	return fmt.Errorf("invalid value for -memory: %q (want go or arena)", model)
+}
+
+// arenaFunctions replace the entries in libraryFunctions for functions that
+// deal with memory.
+var arenaFunctions = map[string]string{
+	"calloc":  "libc.ArenaCalloc",
+	"free":    "libc.ArenaFree",
+	"malloc":  "libc.ArenaMalloc",
+	"memcpy":  "libc.ArenaMemmove",
+	"memmove": "libc.ArenaMemmove",
+	"memset":  "libc.ArenaMemset",
+	"realloc": "libc.ArenaRealloc",
+	"strlen":  "libc.ArenaStrlen",
+}
+
+// UseArenaFunctions switches libraryFunctions to the arena versions of the
+// memory functions.
+func UseArenaFunctions() {
+	for c, g := range arenaFunctions {
+		libraryFunctions[c] = g
+	}
+}
+
+// isDataPointer reports whether t is a pointer to something other than a
+// function.
+func isDataPointer(t types.Type) bool {
+	pt, ok := t.(*types.PointerType)
+	if !ok {
+		return false
+	}
+	_, isFunc := pt.ElemType.(*types.FuncType)
+	return !isFunc
+}
+
+// layoutAligns holds the ABI alignments (in bytes) of integer ("i"),
+// floating-point ("f"), vector ("v"), and pointer ("p") types, by size in
+// bits, as given by the module's data layout (see SetArenaLayout). The
+// defaults are LLVM's, with i64 aligned to 4 bytes (x86-64 layouts specify
+// i64:64, but i386 ones rely on the default). LLVM has no default for
+// x86_fp80, which gets its x86-64 alignment.
+var layoutAligns = map[byte]map[uint64]int64{
+	'i': {1: 1, 8: 1, 16: 2, 32: 4, 64: 4},
+	'f': {16: 2, 32: 4, 64: 8, 80: 16, 128: 16},
+	'v': {64: 8, 128: 16},
+	'p': {},
+}
+
+// aggregateAlign is the minimum alignment of structs, from the data layout's
+// "a" specification.
+var aggregateAlign int64 = 1
+
+// SetArenaLayout reads the type alignments for -memory=arena from an LLVM
+// data layout string. The arena is always little-endian, so it returns an
+// error for a big-endian layout.
+func SetArenaLayout(dataLayout string) error {
+	for _, spec := range strings.Split(dataLayout, "-") {
+		if spec == "E" {
+			return fmt.Errorf("-memory=arena doesn't support big-endian data layouts (%q)", dataLayout)
+		}
+		if spec == "" {
+			continue
+		}
+		// The specifications look like i64:64, f80:128, v128:128, a:0:64,
+		// and p:32:32 (or p0:32:32), with sizes and alignments in bits,
+		// and possibly a preferred alignment after the ABI alignment.
+		kind, fields := spec[0], strings.Split(spec[1:], ":")
+		var size, abi uint64
+		var err error
+		switch kind {
+		case 'i', 'f', 'v':
+			if len(fields) < 2 {
+				continue
+			}
+			size, err = strconv.ParseUint(fields[0], 10, 64)
+			if err == nil {
+				abi, err = strconv.ParseUint(fields[1], 10, 64)
+			}
+		case 'a':
+			if len(fields) < 2 {
+				continue
+			}
+			abi, err = strconv.ParseUint(fields[1], 10, 64)
+		case 'p':
+			if fields[0] != "" && fields[0] != "0" || len(fields) < 3 {
+				continue
+			}
+			size, err = strconv.ParseUint(fields[1], 10, 64)
+			if err == nil {
+				abi, err = strconv.ParseUint(fields[2], 10, 64)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("invalid data layout specification %q: %v", spec, err)
+		}
+		if kind == 'a' {
+			if abi >= 8 {
+				aggregateAlign = int64(abi / 8)
+			}
+			continue
+		}
+		layoutAligns[kind][size] = int64(abi / 8)
+	}
+	return nil
+}
+
+// intAlign returns the alignment of an integer type with the given number of
+// bits. As in LLVM, a size that the data layout doesn't list gets the
+// alignment of the next larger size that it does (or of the largest one).
+func intAlign(bits uint64) int64 {
+	aligns := layoutAligns['i']
+	if a, ok := aligns[bits]; ok {
+		return a
+	}
+	var best, largest uint64
+	for size := range aligns {
+		if size > bits && (best == 0 || size < best) {
+			best = size
+		}
+		if size > largest {
+			largest = size
+		}
+	}
+	if best == 0 {
+		best = largest
+	}
+	return aligns[best]
+}
+
+// alignTo rounds n up to a multiple of align.
+func alignTo(n, align int64) int64 {
+	return (n + align - 1) / align * align
+}
+
+// arenaLayout returns the size and alignment of t in the arena, which are
+// those given by the module's data layout (see SetArenaLayout). As in LLVM,
+// the size includes the padding needed to keep the elements of an array
+// aligned.
+func arenaLayout(t types.Type) (size, align int64, err error) {
+	switch t := t.(type) {
+	case *types.IntType:
+		align = intAlign(t.BitSize)
+		return alignTo((int64(t.BitSize)+7)/8, align), align, nil
+	case *types.FloatType:
+		switch t.Kind {
+		case types.FloatKindFloat:
+			size = 4
+		case types.FloatKindDouble:
+			size = 8
+		case types.FloatKindX86_FP80:
+			size = 10
+		case types.FloatKindFP128:
+			size = 16
+		default:
+			return 0, 0, fmt.Errorf("unsupported floating-point type: %v", t.Kind)
+		}
+		align, ok := layoutAligns['f'][uint64(size*8)]
+		if !ok {
+			align = size
+		}
+		return alignTo(size, align), align, nil
+	case *types.PointerType:
+		n := int64(pointerSize / 8)
+		align, ok := layoutAligns['p'][uint64(pointerSize)]
+		if !ok {
+			align = n
+		}
+		return alignTo(n, align), align, nil
+	case *types.ArrayType:
+		size, align, err := arenaLayout(t.ElemType)
+		return size * int64(t.Len), align, err
+	case *types.VectorType:
+		size, _, err := arenaLayout(t.ElemType)
+		if err != nil {
+			return 0, 0, err
+		}
+		size *= int64(t.Len)
+		// A vector is aligned to its size, rounded up to a power of two,
+		// unless the data layout says otherwise.
+		align, ok := layoutAligns['v'][uint64(size*8)]
+		if !ok {
+			align = 1
+			for align < size {
+				align *= 2
+			}
+		}
+		return alignTo(size, align), align, nil
+	case *types.StructType:
+		_, size, align, err := structLayout(t)
+		return size, align, err
+	}
+	return 0, 0, fmt.Errorf("type has no layout in arena memory: %v", t)
+}
+
+// structLayout returns the offsets of the fields of t, and its size and
+// alignment.
+func structLayout(t *types.StructType) (offsets []int64, size, align int64, err error) {
+	if recursiveTypes[t] {
+		return nil, 0, 0, fmt.Errorf("%%%s contains itself (not through a pointer)", t.Name())
+	}
+	align = aggregateAlign
+	if t.Packed {
+		align = 1
+	}
+	for i, f := range t.Fields {
+		fs, fa, err := arenaLayout(f)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("error laying out field %d: %v", i, err)
+		}
+		if t.Packed {
+			fa = 1
+		}
+		size = (size + fa - 1) / fa * fa
+		offsets = append(offsets, size)
+		size += fs
+		if fa > align {
+			align = fa
+		}
+	}
+	size = (size + align - 1) / align * align
+	return offsets, size, align, nil
+}
+
+// arenaAccessor returns the suffix of the libc.ArenaLoad and ArenaStore
+// functions for values of type t.
+func arenaAccessor(t types.Type) (string, error) {
+	switch t := t.(type) {
+	case *types.IntType:
+		switch {
+		case t.BitSize == 1:
+			return "Bool", nil
+		case t.BitSize <= 8:
+			return "Byte", nil
+		case t.BitSize == 16, t.BitSize == 32, t.BitSize == 64:
+			return fmt.Sprintf("Int%d", t.BitSize), nil
+		}
+	case *types.FloatType:
+		switch t.Kind {
+		case types.FloatKindFloat:
+			return "Float32", nil
+		case types.FloatKindDouble, types.FloatKindX86_FP80, types.FloatKindFP128:
+			return "Float64", nil
+		}
+	case *types.PointerType:
+		if !isDataPointer(t) {
+			return "", fmt.Errorf("function pointers can't be stored in arena memory")
+		}
+		if pointerSize == 32 {
+			return "Ptr32", nil
+		}
+		return "Ptr", nil
+	}
+	return "", fmt.Errorf("unsupported type for arena memory: %v", t)
+}
+
+// offsetAddr returns the expression for addr plus off bytes.
+func offsetAddr(addr string, off int64) string {
+	switch {
+	case off > 0:
+		return fmt.Sprintf("%s+%d", addr, off)
+	case off < 0:
+		return fmt.Sprintf("%s-%d", addr, -off)
+	}
+	return addr
+}
+
+// arenaLoad returns an expression that loads a value of type t from off bytes
+// past addr. Structs and arrays are loaded a field or element at a time.
+func arenaLoad(t types.Type, addr string, off int64) (string, error) {
+	switch t := t.(type) {
+	case *types.StructType:
+		offsets, _, _, err := structLayout(t)
+		if err != nil {
+			return "", err
+		}
+		fields := make([]string, len(t.Fields))
+		for i, f := range t.Fields {
+			if fields[i], err = arenaLoad(f, addr, off+offsets[i]); err != nil {
+				return "", err
+			}
+		}
+		return compositeLoad(t, fields)
+	case *types.ArrayType:
+		return arrayLoad(t, t.ElemType, t.Len, addr, off)
+	case *types.VectorType:
+		return arrayLoad(t, t.ElemType, t.Len, addr, off)
+	}
+	acc, err := arenaAccessor(t)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("libc.ArenaLoad%s(%s)", acc, offsetAddr(addr, off)), nil
+}
+
+// maxArenaElems is the largest array that is loaded or stored element by
+// element.
+const maxArenaElems = 64
+
+func arrayLoad(t, elem types.Type, n uint64, addr string, off int64) (string, error) {
+	if n > maxArenaElems {
+		return "", fmt.Errorf("array too large to load from arena memory: %v", t)
+	}
+	size, _, err := arenaLayout(elem)
+	if err != nil {
+		return "", err
+	}
+	elems := make([]string, n)
+	for i := range elems {
+		if elems[i], err = arenaLoad(elem, addr, off+int64(i)*size); err != nil {
+			return "", err
+		}
+	}
+	return compositeLoad(t, elems)
+}
+
+func compositeLoad(t types.Type, elems []string) (string, error) {
+	spec, err := TypeSpec(t)
+	if err != nil {
+		return "", fmt.Errorf("error translating type (%v): %v", t, err)
+	}
+	return fmt.Sprintf("%s{%s}", spec, strings.Join(elems, ", ")), nil
+}
+
+// arenaStore returns the statements that store val, of type t, at off bytes
+// past addr.
+func arenaStore(t types.Type, addr string, off int64, val string) ([]string, error) {
+	switch t := t.(type) {
+	case *types.StructType:
+		offsets, _, _, err := structLayout(t)
+		if err != nil {
+			return nil, err
+		}
+		var stmts []string
+		for i, f := range t.Fields {
+			s, err := arenaStore(f, addr, off+offsets[i], fmt.Sprintf("%s.F%d", val, i))
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, s...)
+		}
+		return stmts, nil
+	case *types.ArrayType:
+		return arrayStore(t, t.ElemType, t.Len, addr, off, val)
+	case *types.VectorType:
+		return arrayStore(t, t.ElemType, t.Len, addr, off, val)
+	}
+	acc, err := arenaAccessor(t)
+	if err != nil {
+		return nil, err
+	}
+	return []string{fmt.Sprintf("libc.ArenaStore%s(%s, %s)", acc, offsetAddr(addr, off), val)}, nil
+}
+
+func arrayStore(t, elem types.Type, n uint64, addr string, off int64, val string) ([]string, error) {
+	if n > maxArenaElems {
+		return nil, fmt.Errorf("array too large to store to arena memory: %v", t)
+	}
+	size, _, err := arenaLayout(elem)
+	if err != nil {
+		return nil, err
+	}
+	var stmts []string
+	for i := int64(0); i < int64(n); i++ {
+		s, err := arenaStore(elem, addr, off+i*size, fmt.Sprintf("%s[%d]", val, i))
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, s...)
+	}
+	return stmts, nil
+}
+
+// ArenaGEP translates a getelementptr as arithmetic on an arena address.
+func ArenaGEP(elemType types.Type, src value.Value, indices []value.Value) (string, error) {
+	base, err := FormatValue(src)
+	if err != nil {
+		return "", fmt.Errorf("error translating source pointer (%v): %v", src, err)
+	}
+	var terms []string
+	var off int64
+	current := elemType
+	for i, index := range indices {
+		if ci, ok := index.(*constant.Index); ok {
+			index = ci.Constant
+		}
+		if i > 0 {
+			if st, ok := current.(*types.StructType); ok {
+				ci, ok := index.(*constant.Int)
+				if !ok {
+					return "", fmt.Errorf("non-constant index into struct: %v", index)
+				}
+				offsets, _, _, err := structLayout(st)
+				if err != nil {
+					return "", err
+				}
+				off += offsets[ci.X.Int64()]
+				current = st.Fields[ci.X.Int64()]
+				continue
+			}
+			switch t := current.(type) {
+			case *types.ArrayType:
+				current = t.ElemType
+			case *types.VectorType:
+				current = t.ElemType
+			default:
+				return "", fmt.Errorf("unsupported type to index into: %v", current)
+			}
+		}
+		size, _, err := arenaLayout(current)
+		if err != nil {
+			return "", err
+		}
+		if ci, ok := index.(*constant.Int); ok {
+			off += ci.X.Int64() * size
+			continue
+		}
+		x, err := FormatSigned(index)
+		if err != nil {
+			return "", fmt.Errorf("error translating index %d (%v): %v", i, index, err)
+		}
+		term := fmt.Sprintf("uintptr(%s)", x)
+		if size != 1 {
+			term += fmt.Sprintf("*%d", size)
+		}
+		terms = append(terms, term)
+	}
+	result := base
+	for _, t := range terms {
+		result += " + " + t
+	}
+	switch {
+	case off > 0:
+		result += fmt.Sprintf(" + %d", off)
+	case off < 0:
+		result += fmt.Sprintf(" - %d", -off)
+	}
+	return result, nil
+}
+
+// ArenaInstruction translates the instructions that deal with memory when the
+// arena memory model is in use. For other instructions, it returns ok ==
+// false.
+func ArenaInstruction(inst ir.Instruction) (result string, ok bool, err error) {
+	switch inst := inst.(type) {
+	case *ir.InstAlloca:
+		size, _, err := arenaLayout(inst.ElemType)
+		if err != nil {
+			return "", true, err
+		}
+		n := fmt.Sprint(size)
+		if inst.NElems != nil {
+			nElems, err := FormatValue(inst.NElems)
+			if err != nil {
+				return "", true, fmt.Errorf("error translating NElems (%v): %v", inst.NElems, err)
+			}
+			n = fmt.Sprintf("int64(%s)*%d", nElems, size)
+		}
+		return fmt.Sprintf("%s = libc.ArenaAlloca(%s)", VariableName(inst), n), true, nil
+
+	case *ir.InstLoad:
+		src, err := FormatValue(inst.Src)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating source (%v): %v", inst.Src, err)
+		}
+		load, err := arenaLoad(inst.ElemType, src, 0)
+		if err != nil {
+			return "", true, err
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), load), true, nil
+
+	case *ir.InstStore:
+		dest, err := FormatValue(inst.Dst)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating destination (%v): %v", inst.Dst, err)
+		}
+		src, err := FormatValue(inst.Src)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating source (%v): %v", inst.Src, err)
+		}
+		stmts, err := arenaStore(inst.Src.Type(), dest, 0, src)
+		if err != nil {
+			return "", true, err
+		}
+		return strings.Join(stmts, "; "), true, nil
+
+	case *ir.InstGetElementPtr:
+		result, err := ArenaGEP(inst.ElemType, inst.Src, inst.Indices)
+		if err != nil {
+			return "", true, err
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), result), true, nil
+
+	case *ir.InstBitCast:
+		if !isDataPointer(inst.From.Type()) || !isDataPointer(inst.To) {
+			return "", false, nil
+		}
+		from, err := FormatValue(inst.From)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating source (%v): %v", inst.From, err)
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), from), true, nil
+
+	case *ir.InstPtrToInt:
+		if !isDataPointer(inst.From.Type()) {
+			return "", false, nil
+		}
+		from, err := FormatValue(inst.From)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating source (%v): %v", inst.From, err)
+		}
+		to, err := TypeSpec(inst.To)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating type (%v): %v", inst.To, err)
+		}
+		return fmt.Sprintf("%s = %s(%s)", VariableName(inst), to, from), true, nil
+
+	case *ir.InstIntToPtr:
+		if !isDataPointer(inst.To) {
+			return "", false, nil
+		}
+		from, err := FormatValue(inst.From)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating source (%v): %v", inst.From, err)
+		}
+		return fmt.Sprintf("%s = uintptr(%s)", VariableName(inst), from), true, nil
+
+	case *ir.InstCall:
+		f, ok := inst.Callee.(*ir.Func)
+		if !ok {
+			return "", false, nil
+		}
+		var fn string
+		switch name := f.Name(); {
+		case strings.HasPrefix(name, "llvm.memcpy."), strings.HasPrefix(name, "llvm.memmove."):
+			fn = "libc.ArenaMemmove(%s, %s, int64(%s))"
+		case strings.HasPrefix(name, "llvm.memset."):
+			fn = "libc.ArenaMemset(%s, int32(%s), int64(%s))"
+		default:
+			return "", false, nil
+		}
+		if len(inst.Args) < 3 {
+			return "", true, fmt.Errorf("too few arguments to %s", f.Name())
+		}
+		args := make([]interface{}, 3)
+		for i, a := range inst.Args[:3] {
+			v, err := FormatValue(a)
+			if err != nil {
+				return "", true, fmt.Errorf("error translating argument %d (%v): %v", i, a, err)
+			}
+			args[i] = v
+		}
+		return fmt.Sprintf(fn, args...), true, nil
+	}
+	return "", false, nil
+}
+
+// hasAlloca reports whether f allocates any stack variables.
+func hasAlloca(f *ir.Func) bool {
+	for _, b := range f.Blocks {
+		for _, inst := range b.Insts {
+			if _, ok := inst.(*ir.InstAlloca); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ArenaGlobals returns the declarations of the module's global variables, as
+// arena addresses, and an init function that allocates and initializes them.
+func ArenaGlobals(m *ir.Module, errs *ErrorList) string {
+	var names, allocs, inits []string
+	for _, g := range m.Globals {
+		if g.Init == nil {
+			continue
+		}
+		size, _, err := arenaLayout(g.ContentType)
+		if err == nil {
+			var stmts []string
+			stmts, err = arenaInit(VariableName(g), 0, g.Init)
+			inits = append(inits, stmts...)
+		}
+		if err != nil {
+			errs.Add("", g.LLString(), fmt.Errorf("error translating initializer (%v): %v", g.Init, err))
+			continue
+		}
+		names = append(names, VariableName(g))
+		allocs = append(allocs, fmt.Sprintf("%s = libc.ArenaMalloc(%d)", VariableName(g), size))
+	}
+	if len(names) == 0 {
+		return ""
+	}
+
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "var %s uintptr\n\n", strings.Join(names, ", "))
+	b.WriteString("func init() {\n")
+	for _, s := range allocs {
+		fmt.Fprintf(b, "\t%s\n", s)
+	}
+	for _, s := range inits {
+		fmt.Fprintf(b, "\t%s\n", s)
+	}
+	b.WriteString("}\n\n")
+	return b.String()
+}
+
+// arenaInit returns the statements that store the initializer c at off bytes
+// past addr. Zero values are skipped, since arena memory starts out zeroed.
+func arenaInit(addr string, off int64, c constant.Constant) ([]string, error) {
+	switch c := c.(type) {
+	case *constant.ZeroInitializer, *constant.Null, *constant.Undef:
+		return nil, nil
+
+	case *constant.CharArray:
+		s := strings.TrimRight(string(c.X), "\x00")
+		if s == "" {
+			return nil, nil
+		}
+		return []string{fmt.Sprintf("libc.ArenaWriteString(%s, %s)", offsetAddr(addr, off), strconv.Quote(s))}, nil
+
+	case *constant.Array:
+		size, _, err := arenaLayout(c.Typ.ElemType)
+		if err != nil {
+			return nil, err
+		}
+		return elemInits(addr, off, size, c.Elems)
+
+	case *constant.Vector:
+		size, _, err := arenaLayout(c.Typ.ElemType)
+		if err != nil {
+			return nil, err
+		}
+		return elemInits(addr, off, size, c.Elems)
+
+	case *constant.Struct:
+		offsets, _, _, err := structLayout(c.Typ)
+		if err != nil {
+			return nil, err
+		}
+		var stmts []string
+		for i, f := range c.Fields {
+			s, err := arenaInit(addr, off+offsets[i], f)
+			if err != nil {
+				return nil, fmt.Errorf("error translating field %d (%v): %v", i, f, err)
+			}
+			stmts = append(stmts, s...)
+		}
+		return stmts, nil
+
+	case *constant.Int:
+		if c.X.Sign() == 0 {
+			return nil, nil
+		}
+	}
+
+	val, err := FormatValue(c)
+	if err != nil {
+		return nil, err
+	}
+	return arenaStore(c.Type(), addr, off, val)
+}
+
+func elemInits(addr string, off, size int64, elems []constant.Constant) ([]string, error) {
+	var stmts []string
+	for i, e := range elems {
+		s, err := arenaInit(addr, off+int64(i)*size, e)
+		if err != nil {
+			return nil, fmt.Errorf("error translating element %d (%v): %v", i, e, err)
+		}
+		stmts = append(stmts, s...)
+	}
+	return stmts, nil
+}
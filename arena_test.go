@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestArena(t *testing.T) {
+	t.Parallel()
+	src := `
+target datalayout = "e-m:e-i64:64-n32:64-S128"
+
+%node = type { i32, %node* }
+
+@greeting = global [6 x i8] c"hello\00"
+@head = global %node* null
+@values = global [3 x i16] [i16 1, i16 2, i16 3]
+
+declare i8* @malloc(i64)
+declare void @free(i8*)
+declare i64 @strlen(i8*)
+declare i8* @memset(i8*, i32, i64)
+
+define void @push(i32 %v) {
+  %m = call i8* @malloc(i64 16)
+  %n = bitcast i8* %m to %node*
+  %vp = getelementptr %node, %node* %n, i32 0, i32 0
+  store i32 %v, i32* %vp
+  %h = load %node*, %node** @head
+  %np = getelementptr %node, %node* %n, i32 0, i32 1
+  store %node* %h, %node** %np
+  store %node* %n, %node** @head
+  ret void
+}
+
+define i32 @sum() {
+entry:
+  %h = load %node*, %node** @head
+  br label %loop
+
+loop:
+  %p = phi %node* [ %h, %entry ], [ %next, %body ]
+  %s = phi i32 [ 0, %entry ], [ %s1, %body ]
+  %done = icmp eq %node* %p, null
+  br i1 %done, label %exit, label %body
+
+body:
+  %vp = getelementptr %node, %node* %p, i32 0, i32 0
+  %v = load i32, i32* %vp
+  %s1 = add i32 %s, %v
+  %np = getelementptr %node, %node* %p, i32 0, i32 1
+  %next = load %node*, %node** %np
+  br label %loop
+
+exit:
+  ret i32 %s
+}
+
+; The difference between the addresses of two elements, which depends on
+; pointers being numbers.
+define i64 @distance() {
+  %a = ptrtoint i16* getelementptr ([3 x i16], [3 x i16]* @values, i64 0, i64 0) to i64
+  %b = ptrtoint i16* getelementptr ([3 x i16], [3 x i16]* @values, i64 0, i64 2) to i64
+  %d = sub i64 %b, %a
+  ret i64 %d
+}
+
+define i64 @greetingLength() {
+  %n = call i64 @strlen(i8* getelementptr ([6 x i8], [6 x i8]* @greeting, i64 0, i64 0))
+  ret i64 %n
+}
+
+define i16 @zero() {
+  %p = call i8* @memset(i8* bitcast ([3 x i16]* @values to i8*), i32 0, i64 4)
+  %last = load i16, i16* getelementptr ([3 x i16], [3 x i16]* @values, i64 0, i64 2)
+  %first = load i16, i16* getelementptr ([3 x i16], [3 x i16]* @values, i64 0, i64 0)
+  %r = add i16 %first, %last
+  ret i16 %r
+}
+`
+	code, _ := translate(t, src, "-memory=arena")
+	if !strings.Contains(code, "libc.ArenaLoadInt32(") {
+		t.Errorf("loads don't use the arena:\n%s", numberLines(code))
+	}
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	push(1)
+	push(20)
+	push(300)
+	fmt.Println(sum(), distance(), greetingLength(), zero())
+}
+`
+	if got, want := runGo(t, code, mainSrc), "321 4 5 3\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestMemoryModelFlag(t *testing.T) {
+	t.Parallel()
+	output := translateError(t, "", "-memory=segmented")
+	if !strings.Contains(output, `invalid value for -memory: "segmented"`) {
+		t.Errorf("output: %s", output)
+	}
+}
+
+func TestArenaFlagConflicts(t *testing.T) {
+	t.Parallel()
+	for _, flag := range []string{"-instance", "-long-double=big", "-out-params", "-out-param=f:0"} {
+		output := translateError(t, "", "-memory=arena", flag)
+		if !strings.Contains(output, "-memory=arena can't be used with") {
+			t.Errorf("%s: output: %s", flag, output)
+		}
+	}
+}
+
+func TestArenaDataLayout(t *testing.T) {
+	t.Parallel()
+	// The field offsets and size of %rec, as globals laid out end to end.
+	src := `
+target datalayout = "%s"
+
+%%rec = type { i8, i64, double, x86_fp80, i16 }
+
+@r = global [2 x %%rec] zeroinitializer
+
+define i%[2]d @field(i32 %%i) {
+  %%base = ptrtoint [2 x %%rec]* @r to i%[2]d
+  switch i32 %%i, label %%size [ i32 1, label %%f1
+                                i32 2, label %%f2
+                                i32 3, label %%f3
+                                i32 4, label %%f4 ]
+
+f1:
+  %%p1 = getelementptr [2 x %%rec], [2 x %%rec]* @r, i32 0, i32 0, i32 1
+  %%a1 = ptrtoint i64* %%p1 to i%[2]d
+  %%o1 = sub i%[2]d %%a1, %%base
+  ret i%[2]d %%o1
+
+f2:
+  %%p2 = getelementptr [2 x %%rec], [2 x %%rec]* @r, i32 0, i32 0, i32 2
+  %%a2 = ptrtoint double* %%p2 to i%[2]d
+  %%o2 = sub i%[2]d %%a2, %%base
+  ret i%[2]d %%o2
+
+f3:
+  %%p3 = getelementptr [2 x %%rec], [2 x %%rec]* @r, i32 0, i32 0, i32 3
+  %%a3 = ptrtoint x86_fp80* %%p3 to i%[2]d
+  %%o3 = sub i%[2]d %%a3, %%base
+  ret i%[2]d %%o3
+
+f4:
+  %%p4 = getelementptr [2 x %%rec], [2 x %%rec]* @r, i32 0, i32 0, i32 4
+  %%a4 = ptrtoint i16* %%p4 to i%[2]d
+  %%o4 = sub i%[2]d %%a4, %%base
+  ret i%[2]d %%o4
+
+size:
+  %%p5 = getelementptr [2 x %%rec], [2 x %%rec]* @r, i32 0, i32 1
+  %%a5 = ptrtoint %%rec* %%p5 to i%[2]d
+  %%o5 = sub i%[2]d %%a5, %%base
+  ret i%[2]d %%o5
+}
+`
+	mainSrc := mainCalling("field(1), field(2), field(3), field(4), field(0)")
+	for _, c := range []struct {
+		layout string
+		bits   int
+		want   string
+	}{
+		// x86-64
+		{"e-m:e-p270:32:32-p271:32:32-p272:64:64-i64:64-i128:128-f80:128-n8:16:32:64-S128", 64, "8 16 32 48 64\n"},
+		// i386, where i64 and double are only 4-byte aligned, and
+		// x86_fp80 takes 12 bytes.
+		{"e-m:e-p:32:32-p270:32:32-p271:32:32-p272:64:64-i128:128-f64:32:64-f80:32-n8:16:32-S128", 32, "4 12 20 32 36\n"},
+	} {
+		checkProgram(t, fmt.Sprintf(src, c.layout, c.bits), mainSrc, c.want, "-memory=arena")
+	}
+
+	output := translateError(t, fmt.Sprintf(src, "E-m:e-i64:64-n32:64", 64), "-memory=arena")
+	if !strings.Contains(output, "-memory=arena doesn't support big-endian data layouts") {
+		t.Errorf("output doesn't reject the big-endian layout:\n%s", output)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+)
+
+// Atomic read-modify-write operations are translated to calls to the
+// sync/atomic package. Add, sub, and xchg on 32- and 64-bit integers map
+// directly to atomic.Add and atomic.Swap; the other operations are done with
+// a loop that loads the old value and retries atomic.CompareAndSwap until no
+// other goroutine has changed it in the meantime. The sync/atomic functions
+// are sequentially consistent, which is at least as strong as any ordering
+// LLVM can ask for.
+
+// atomicSuffix returns the suffix of the sync/atomic functions that operate
+// on values of type t (such as "Int32" for i32).
+func atomicSuffix(t types.Type) (string, error) {
+	switch t := t.(type) {
+	case *types.IntType:
+		switch t.BitSize {
+		case 32:
+			return "Int32", nil
+		case 64:
+			return "Int64", nil
+		}
+	case *types.FloatType:
+		switch t.Kind {
+		case types.FloatKindFloat:
+			return "Uint32", nil
+		case types.FloatKindDouble:
+			return "Uint64", nil
+		}
+	case *types.PointerType:
+		if !types.IsFunc(t.ElemType) {
+			return "Pointer", nil
+		}
+	}
+	return "", fmt.Errorf("unsupported type for atomic operation: %v", t)
+}
+
+// pointerAddr converts addr, the address of a pointer, to the
+// *unsafe.Pointer that the sync/atomic pointer functions take.
+func pointerAddr(addr string) string {
+	return fmt.Sprintf("(*unsafe.Pointer)(unsafe.Pointer(%s))", addr)
+}
+
+// AtomicRMW translates an atomicrmw instruction.
+func AtomicRMW(inst *ir.InstAtomicRMW) (string, error) {
+	if arenaMode() {
+		return "", fmt.Errorf("atomic operations aren't supported with -memory=arena")
+	}
+	t := inst.X.Type()
+	suffix, err := atomicSuffix(t)
+	if err != nil {
+		return "", err
+	}
+	addr, err := FormatValue(inst.Dst)
+	if err != nil {
+		return "", fmt.Errorf("error translating destination (%v): %v", inst.Dst, err)
+	}
+	x, err := FormatValue(inst.X)
+	if err != nil {
+		return "", fmt.Errorf("error translating operand (%v): %v", inst.X, err)
+	}
+	r := VariableName(inst)
+
+	switch t := t.(type) {
+	case *types.FloatType:
+		// Floats are updated by swapping their bit patterns.
+		bits := "32"
+		if t.Kind == types.FloatKindDouble {
+			bits = "64"
+		}
+		addr = fmt.Sprintf("(*uint%s)(unsafe.Pointer(%s))", bits, addr)
+		var op string
+		switch inst.Op {
+		case enum.AtomicOpXChg:
+			return fmt.Sprintf("%s = math.Float%sfrombits(atomic.Swap%s(%s, math.Float%sbits(%s)))", r, bits, suffix, addr, bits, x), nil
+		case enum.AtomicOpFAdd:
+			op = "+"
+		case enum.AtomicOpFSub:
+			op = "-"
+		default:
+			return "", fmt.Errorf("unsupported atomicrmw operation on %v: %v", t, inst.Op)
+		}
+		// Converting a value from bits and back preserves its bit pattern,
+		// so the comparison is against exactly what was loaded.
+		return fmt.Sprintf("for { %s = math.Float%sfrombits(atomic.Load%s(%s)); if atomic.CompareAndSwap%s(%s, math.Float%sbits(%s), math.Float%sbits(%s %s %s)) { break } }", r, bits, suffix, addr, suffix, addr, bits, r, bits, r, op, parenthesize(x)), nil
+
+	case *types.PointerType:
+		if inst.Op != enum.AtomicOpXChg {
+			return "", fmt.Errorf("unsupported atomicrmw operation on %v: %v", t, inst.Op)
+		}
+		ts, err := TypeSpec(t)
+		if err != nil {
+			return "", fmt.Errorf("error translating type (%v): %v", t, err)
+		}
+		return fmt.Sprintf("%s = (%s)(atomic.SwapPointer(%s, unsafe.Pointer(%s)))", r, ts, pointerAddr(addr), x), nil
+	}
+
+	it := t.(*types.IntType)
+	switch inst.Op {
+	case enum.AtomicOpAdd:
+		// atomic.Add returns the new value, but atomicrmw returns the old one.
+		return fmt.Sprintf("%s = atomic.Add%s(%s, %s) - %s", r, suffix, addr, x, parenthesize(x)), nil
+	case enum.AtomicOpSub:
+		return fmt.Sprintf("%s = atomic.Add%s(%s, -%s) + %s", r, suffix, addr, parenthesize(x), parenthesize(x)), nil
+	case enum.AtomicOpXChg:
+		return fmt.Sprintf("%s = atomic.Swap%s(%s, %s)", r, suffix, addr, x), nil
+	}
+
+	// The remaining operations load the old value into r, and retry until
+	// they can replace it with the new one.
+	loop := func(cond string) string {
+		return fmt.Sprintf("for { %s = atomic.Load%s(%s); if %s { break } }", r, suffix, addr, cond)
+	}
+	cas := func(n string) string {
+		return fmt.Sprintf("atomic.CompareAndSwap%s(%s, %s, %s)", suffix, addr, r, n)
+	}
+	y := parenthesize(x)
+	switch inst.Op {
+	case enum.AtomicOpAnd:
+		return loop(cas(fmt.Sprintf("%s & %s", r, y))), nil
+	case enum.AtomicOpNAnd:
+		return loop(cas(fmt.Sprintf("^(%s & %s)", r, y))), nil
+	case enum.AtomicOpOr:
+		return loop(cas(fmt.Sprintf("%s | %s", r, y))), nil
+	case enum.AtomicOpXor:
+		return loop(cas(fmt.Sprintf("%s ^ %s", r, y))), nil
+	// For min and max, there is nothing to store if the old value wins.
+	case enum.AtomicOpMax:
+		return loop(fmt.Sprintf("%s >= %s || %s", r, y, cas(x))), nil
+	case enum.AtomicOpMin:
+		return loop(fmt.Sprintf("%s <= %s || %s", r, y, cas(x))), nil
+	case enum.AtomicOpUMax, enum.AtomicOpUMin:
+		// The comparison needs the operand as unsigned (a negative constant
+		// can't be converted), but the CAS stores it as it is.
+		ux, err := FormatUnsigned(inst.X)
+		if err != nil {
+			return "", fmt.Errorf("error translating operand (%v): %v", inst.X, err)
+		}
+		cmp := ">="
+		if inst.Op == enum.AtomicOpUMin {
+			cmp = "<="
+		}
+		return loop(fmt.Sprintf("uint%d(%s) %s %s || %s", it.BitSize, r, cmp, ux, cas(x))), nil
+	}
+	return "", fmt.Errorf("unsupported atomicrmw operation on %v: %v", t, inst.Op)
+}
+
+// CmpXchg translates a cmpxchg instruction. Its result is a struct holding
+// the value that was loaded and whether it was replaced.
+func CmpXchg(inst *ir.InstCmpXchg) (string, error) {
+	if arenaMode() {
+		return "", fmt.Errorf("atomic operations aren't supported with -memory=arena")
+	}
+	t := inst.Cmp.Type()
+	suffix, err := atomicSuffix(t)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := t.(*types.FloatType); ok {
+		return "", fmt.Errorf("unsupported type for cmpxchg: %v", t)
+	}
+	addr, err := FormatValue(inst.Ptr)
+	if err != nil {
+		return "", fmt.Errorf("error translating address (%v): %v", inst.Ptr, err)
+	}
+	cmp, err := FormatValue(inst.Cmp)
+	if err != nil {
+		return "", fmt.Errorf("error translating comparison value (%v): %v", inst.Cmp, err)
+	}
+	newValue, err := FormatValue(inst.New)
+	if err != nil {
+		return "", fmt.Errorf("error translating new value (%v): %v", inst.New, err)
+	}
+	r := VariableName(inst)
+
+	load := fmt.Sprintf("atomic.Load%s(%s)", suffix, addr)
+	swap := fmt.Sprintf("atomic.CompareAndSwap%s(%s, %s, %s)", suffix, addr, cmp, newValue)
+	if _, ok := t.(*types.PointerType); ok {
+		ts, err := TypeSpec(t)
+		if err != nil {
+			return "", fmt.Errorf("error translating type (%v): %v", t, err)
+		}
+		load = fmt.Sprintf("(%s)(atomic.LoadPointer(%s))", ts, pointerAddr(addr))
+		swap = fmt.Sprintf("atomic.CompareAndSwapPointer(%s, unsafe.Pointer(%s), unsafe.Pointer(%s))", pointerAddr(addr), cmp, newValue)
+	}
+
+	if inst.Weak {
+		// A weak cmpxchg may fail even if the value matched, so the value
+		// can be loaded again after a failed swap.
+		return fmt.Sprintf("%s.F1 = %s; %s.F0 = %s; if !%s.F1 { %s.F0 = %s }", r, swap, r, cmp, r, r, load), nil
+	}
+	// A strong cmpxchg only fails if the value it loaded didn't match, so
+	// the swap is retried if the value changed back in the meantime.
+	return fmt.Sprintf("for { %s.F0 = %s; if %s.F0 != %s { %s.F1 = false; break }; if %s { %s.F1 = true; break } }", r, load, r, parenthesize(cmp), r, swap, r), nil
+}
+
+// Fence translates a fence instruction. Since sync/atomic only provides
+// sequentially-consistent operations, every ordering gets the same fence.
+func Fence(inst *ir.InstFence) (string, error) {
+	if inst.SyncScope == "singlethread" {
+		// A fence that only orders accesses with respect to signal handlers
+		// running on the same thread has nothing to do in Go.
+		return "", nil
+	}
+	switch inst.Ordering {
+	case enum.AtomicOrderingAcquire, enum.AtomicOrderingRelease, enum.AtomicOrderingAcqRel, enum.AtomicOrderingSeqCst:
+		return "libc.Fence()", nil
+	}
+	return "", fmt.Errorf("invalid ordering for fence: %v", inst.Ordering)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAtomicRMW(t *testing.T) {
+	t.Parallel()
+	ops := []string{"add", "sub", "xchg", "and", "nand", "or", "xor", "max", "min", "umax", "umin"}
+	src := new(strings.Builder)
+	var exprs []string
+	for _, op := range ops {
+		fmt.Fprintf(src, "define i32 @%s32(i32* %%p, i32 %%x) {\n  %%r = atomicrmw %s i32* %%p, i32 %%x seq_cst\n  ret i32 %%r\n}\n\n", op, op)
+		exprs = append(exprs, fmt.Sprintf("try(%s32, -6)", op))
+	}
+	src.WriteString(`
+define i64 @add64(i64* %p, i64 %x) {
+  %r = atomicrmw add i64* %p, i64 %x monotonic
+  ret i64 %r
+}
+
+define double @fadd(double* %p, double %x) {
+  %r = atomicrmw fadd double* %p, double %x seq_cst
+  ret double %r
+}
+
+define float @fxchg(float* %p, float %x) {
+  %r = atomicrmw xchg float* %p, float %x acq_rel
+  ret float %r
+}
+
+define i8* @pxchg(i8** %p, i8* %x) {
+  %r = atomicrmw xchg i8** %p, i8* %x seq_cst
+  ret i8* %r
+}
+`)
+	mainSrc := `package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// try applies f to a variable holding 5, and returns the old value and the
+// new one.
+func try(f func(*int32, int32) int32, x int32) string {
+	v := int32(5)
+	old := f(&v, x)
+	return fmt.Sprint(old, v)
+}
+
+func main() {
+	var wg sync.WaitGroup
+	var total int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				add64(&total, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	fmt.Println(total)
+
+	d := 1.5
+	fmt.Println(fadd(&d, 2), d)
+	f := float32(1)
+	fmt.Println(fxchg(&f, 3), f)
+	a, b := byte(1), byte(2)
+	p := &a
+	fmt.Println(pxchg(&p, &b) == &a, p == &b)
+` + mainCallingBody(exprs) + `}
+`
+	want := "8000\n1.5 3.5\n1 3\ntrue true\n" +
+		"5 -1\n5 11\n5 -6\n5 0\n5 -1\n5 -1\n5 -1\n5 5\n5 -6\n5 -6\n5 5\n"
+	checkProgram(t, src.String(), mainSrc, want)
+}
+
+// mainCallingBody returns statements that print the results of exprs, for
+// the body of a main function.
+func mainCallingBody(exprs []string) string {
+	b := new(strings.Builder)
+	for _, e := range exprs {
+		fmt.Fprintf(b, "\tfmt.Println(%s)\n", e)
+	}
+	return b.String()
+}
+
+func TestAtomicUnsignedConstants(t *testing.T) {
+	t.Parallel()
+	// The negative constants are the largest values when compared unsigned.
+	src := `
+define i32 @umax(i32* %p) {
+  %r = atomicrmw umax i32* %p, i32 -1 seq_cst
+  ret i32 %r
+}
+
+define i32 @umin(i32* %p) {
+  %r = atomicrmw umin i32* %p, i32 -2 seq_cst
+  ret i32 %r
+}
+`
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	a := int32(5)
+	fmt.Println(umax(&a), a)
+	b := int32(-1)
+	fmt.Println(umin(&b), b)
+	c := int32(5)
+	fmt.Println(umin(&c), c)
+}
+`
+	checkProgram(t, src, mainSrc, "5 -1\n-1 -2\n5 5\n")
+}
+
+func TestCmpXchg(t *testing.T) {
+	t.Parallel()
+	src := `
+define i32 @cas(i32* %p, i32 %old, i32 %new) {
+  %r = cmpxchg i32* %p, i32 %old, i32 %new seq_cst seq_cst
+  %v = extractvalue { i32, i1 } %r, 0
+  %ok = extractvalue { i32, i1 } %r, 1
+  %k = zext i1 %ok to i32
+  %s = mul i32 %k, 100
+  %t = add i32 %s, %v
+  ret i32 %t
+}
+
+define i64 @weak(i64* %p, i64 %old, i64 %new) {
+  %r = cmpxchg weak i64* %p, i64 %old, i64 %new acq_rel monotonic
+  %v = extractvalue { i64, i1 } %r, 0
+  ret i64 %v
+}
+
+define i1 @pcas(i8** %p, i8* %old, i8* %new) {
+  %r = cmpxchg i8** %p, i8* %old, i8* %new seq_cst seq_cst
+  %ok = extractvalue { i8*, i1 } %r, 1
+  ret i1 %ok
+}
+
+; increment adds 1 to *%p with a weak cmpxchg loop.
+define void @increment(i32* %p) {
+entry:
+  %x = load atomic i32, i32* %p monotonic, align 4
+  br label %loop
+
+loop:
+  %old = phi i32 [ %x, %entry ], [ %seen, %loop ]
+  %new = add i32 %old, 1
+  %r = cmpxchg weak i32* %p, i32 %old, i32 %new seq_cst monotonic
+  %seen = extractvalue { i32, i1 } %r, 0
+  %ok = extractvalue { i32, i1 } %r, 1
+  br i1 %ok, label %exit, label %loop
+
+exit:
+  ret void
+}
+`
+	mainSrc := `package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+func main() {
+	v := int32(5)
+	fmt.Println(cas(&v, 5, 7), v)
+	fmt.Println(cas(&v, 5, 9), v)
+	w := int64(1)
+	fmt.Println(weak(&w, 2, 3), w)
+	fmt.Println(weak(&w, 1, 3), w)
+	a, b := byte(1), byte(2)
+	p := &a
+	fmt.Println(pcas(&p, &b, &b), p == &a)
+	fmt.Println(pcas(&p, &a, &b), p == &b)
+
+	var wg sync.WaitGroup
+	var n int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				increment(&n)
+			}
+		}()
+	}
+	wg.Wait()
+	fmt.Println(n)
+}
+`
+	checkProgram(t, src, mainSrc, "105 7\n7 7\n1 1\n1 3\nfalse true\ntrue true\n8000\n")
+}
+
+func TestFence(t *testing.T) {
+	t.Parallel()
+	src := `
+@data = global i32 0
+@flag = global i32 0
+
+define void @publish(i32 %x) {
+  store i32 %x, i32* @data
+  fence release
+  store atomic i32 1, i32* @flag monotonic, align 4
+  ret void
+}
+
+define i32 @consume() {
+entry:
+  br label %wait
+
+wait:
+  %f = load atomic i32, i32* @flag monotonic, align 4
+  %ready = icmp ne i32 %f, 0
+  br i1 %ready, label %done, label %wait
+
+done:
+  fence acquire
+  %x = load i32, i32* @data
+  ret i32 %x
+}
+
+define void @signal() {
+  fence syncscope("singlethread") seq_cst
+  fence acq_rel
+  fence seq_cst
+  ret void
+}
+`
+	code, _ := translate(t, src)
+	if n := strings.Count(code, "libc.Fence()"); n != 4 {
+		t.Errorf("%d fences, want 4 (none for the singlethread one):\n%s", n, numberLines(code))
+	}
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	done := make(chan int32)
+	go func() {
+		done <- consume()
+	}()
+	signal()
+	publish(42)
+	fmt.Println(<-done)
+}
+`
+	if got, want := runGo(t, code, mainSrc), "42\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
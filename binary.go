@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// byteOrder is the name of the encoding/binary byte order that matches the
+// module's data layout.
+var byteOrder = "LittleEndian"
+
+// SetByteOrder sets byteOrder from an LLVM data layout string.
+func SetByteOrder(dataLayout string) {
+	for _, spec := range strings.Split(dataLayout, "-") {
+		switch spec {
+		case "e":
+			byteOrder = "LittleEndian"
+		case "E":
+			byteOrder = "BigEndian"
+		}
+	}
+}
+
+// reinterpretedBytes checks whether ptr is a byte pointer that has been
+// bitcast to a pointer to a wider integer or floating-point type. If so, it
+// returns the byte pointer and the type it is being reinterpreted as.
+func reinterpretedBytes(ptr value.Value) (value.Value, types.Type, bool) {
+	var from value.Value
+	var to types.Type
+	switch p := ptr.(type) {
+	case *ir.InstBitCast:
+		from, to = p.From, p.To
+	case *constant.ExprBitCast:
+		from, to = p.From, p.To
+	default:
+		return nil, nil, false
+	}
+	if !types.Equal(from.Type(), types.I8Ptr) {
+		return nil, nil, false
+	}
+	pt, ok := to.(*types.PointerType)
+	if !ok {
+		return nil, nil, false
+	}
+	switch t := pt.ElemType.(type) {
+	case *types.IntType:
+		if t.BitSize == 16 || t.BitSize == 32 || t.BitSize == 64 {
+			return from, t, true
+		}
+	case *types.FloatType:
+		if t.Kind == types.FloatKindFloat || t.Kind == types.FloatKindDouble {
+			return from, t, true
+		}
+	}
+	return nil, nil, false
+}
+
+// bitSize returns the size in bits of an integer or floating-point type.
+func bitSize(t types.Type) int {
+	switch t := t.(type) {
+	case *types.IntType:
+		return int(t.BitSize)
+	case *types.FloatType:
+		if t.Kind == types.FloatKindFloat {
+			return 32
+		}
+	}
+	return 64
+}
+
+// BinaryLoad translates a load that reinterprets bytes as a wider type, using
+// encoding/binary instead of an unsafe pointer conversion. If the load isn't
+// of that kind, it returns ok == false.
+func BinaryLoad(inst *ir.InstLoad) (result string, ok bool, err error) {
+	src, t, ok := reinterpretedBytes(inst.Src)
+	if !ok {
+		return "", false, nil
+	}
+	b, err := FormatValue(src)
+	if err != nil {
+		return "", true, fmt.Errorf("error translating source (%v): %v", src, err)
+	}
+	size := bitSize(t)
+	bits := fmt.Sprintf("binary.%s.Uint%d(libc.ByteSlice(%s, %d))", byteOrder, size, b, size/8)
+	if _, isFloat := t.(*types.FloatType); isFloat {
+		return fmt.Sprintf("%s = math.Float%dfrombits(%s)", VariableName(inst), size, bits), true, nil
+	}
+	return fmt.Sprintf("%s = int%d(%s)", VariableName(inst), size, bits), true, nil
+}
+
+// BinaryStore is like BinaryLoad, but for stores.
+func BinaryStore(inst *ir.InstStore) (result string, ok bool, err error) {
+	dst, t, ok := reinterpretedBytes(inst.Dst)
+	if !ok {
+		return "", false, nil
+	}
+	b, err := FormatValue(dst)
+	if err != nil {
+		return "", true, fmt.Errorf("error translating destination (%v): %v", dst, err)
+	}
+	size := bitSize(t)
+	var v string
+	if _, isFloat := t.(*types.FloatType); isFloat {
+		v, err = FormatValue(inst.Src)
+		v = fmt.Sprintf("math.Float%dbits(%s)", size, v)
+	} else {
+		// A negative constant can't be converted to uint%d directly.
+		v, err = FormatUnsigned(inst.Src)
+	}
+	if err != nil {
+		return "", true, fmt.Errorf("error translating source (%v): %v", inst.Src, err)
+	}
+	return fmt.Sprintf("binary.%s.PutUint%d(libc.ByteSlice(%s, %d), %s)", byteOrder, size, b, size/8, v), true, nil
+}
+
+// binaryOnlyBitcasts is the set of bitcast instructions whose only uses are
+// loads and stores that BinaryLoad and BinaryStore translate. They don't need
+// to be translated at all.
+var binaryOnlyBitcasts = make(map[*ir.InstBitCast]bool)
+
+// FindBinaryOnlyBitcasts adds the qualifying bitcasts in f to
+// binaryOnlyBitcasts.
+func FindBinaryOnlyBitcasts(f *ir.Func) {
+	otherUses := make(map[*ir.InstBitCast]bool)
+	var candidates []*ir.InstBitCast
+	for _, b := range f.Blocks {
+		for _, inst := range b.Insts {
+			if bc, ok := inst.(*ir.InstBitCast); ok {
+				if _, _, ok := reinterpretedBytes(bc); ok {
+					candidates = append(candidates, bc)
+				}
+			}
+			var skip value.Value
+			switch inst := inst.(type) {
+			case *ir.InstLoad:
+				skip = inst.Src
+			case *ir.InstStore:
+				skip = inst.Dst
+			}
+			for _, v := range References(inst) {
+				if bc, ok := v.(*ir.InstBitCast); ok && v != skip {
+					otherUses[bc] = true
+				}
+			}
+		}
+		for _, v := range References(b.Term) {
+			if bc, ok := v.(*ir.InstBitCast); ok {
+				otherUses[bc] = true
+			}
+		}
+	}
+	for _, bc := range candidates {
+		if !otherUses[bc] {
+			binaryOnlyBitcasts[bc] = true
+		}
+	}
+}
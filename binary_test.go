@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const binarySource = `
+@buf = global [16 x i8] c"\01\02\03\04\00\00\00\00\00\00\00\00\00\00\00\00"
+
+define i32 @read32() {
+  %p = getelementptr [16 x i8], [16 x i8]* @buf, i64 0, i64 0
+  %q = bitcast i8* %p to i32*
+  %x = load i32, i32* %q
+  ret i32 %x
+}
+
+define double @roundtrip(double %d) {
+  %p = getelementptr [16 x i8], [16 x i8]* @buf, i64 0, i64 8
+  %q = bitcast i8* %p to double*
+  store double %d, double* %q
+  %r = load double, double* %q
+  ret double %r
+}
+
+define i32 @storeNegative() {
+  %p = getelementptr [16 x i8], [16 x i8]* @buf, i64 0, i64 4
+  %q = bitcast i8* %p to i32*
+  store i32 -2, i32* %q
+  %x = load i32, i32* %q
+  ret i32 %x
+}
+
+define i8 @byte8() {
+  %p = getelementptr [16 x i8], [16 x i8]* @buf, i64 0, i64 15
+  %x = load i8, i8* %p
+  ret i8 %x
+}
+`
+
+func TestBinary(t *testing.T) {
+	t.Parallel()
+	for _, c := range []struct {
+		layout, order, want string
+	}{
+		{"e-m:e-i64:64-n8:16:32:64-S128", "LittleEndian", "67305985\n1.5\n-2\n63\n"},
+		{"E-m:e-i64:64-n8:16:32:64-S128", "BigEndian", "16909060\n1.5\n-2\n0\n"},
+	} {
+		src := "target datalayout = \"" + c.layout + "\"\n" + binarySource
+		code, _ := translate(t, src, "-binary")
+		for _, s := range []string{"binary." + c.order + ".Uint32(", "binary." + c.order + ".PutUint64(", "math.Float64frombits("} {
+			if !strings.Contains(code, s) {
+				t.Errorf("%s: generated code doesn't contain %q:\n%s", c.order, s, numberLines(code))
+			}
+		}
+		if got := runGo(t, code, mainCalling("read32()", "roundtrip(1.5)", "storeNegative()", "byte8()")); got != c.want {
+			t.Errorf("%s: output:\n%s\nwant:\n%s\ngenerated code:\n%s", c.order, got, c.want, numberLines(code))
+		}
+	}
+}
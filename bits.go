@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+)
+
+// bitIntrinsics maps the names of the bit-counting, bit-reversing, and
+// byte-swapping intrinsics (without the llvm. prefix and type suffix) to the
+// math/bits functions that implement them. The second argument of llvm.ctlz
+// and llvm.cttz says whether the result is poison for zero; it doesn't
+// matter, since the math/bits functions return the width of the type, which
+// is what LLVM returns when it isn't.
+var bitIntrinsics = map[string]string{
+	"bitreverse": "Reverse",
+	"bswap":      "ReverseBytes",
+	"ctlz":       "LeadingZeros",
+	"cttz":       "TrailingZeros",
+	"ctpop":      "OnesCount",
+}
+
+// intrinsicBase returns the name of the intrinsic called name, without the
+// llvm. prefix and the type suffixes (ctlz for llvm.ctlz.i32), or the empty
+// string if name isn't an intrinsic.
+func intrinsicBase(name string) string {
+	if !strings.HasPrefix(name, "llvm.") {
+		return ""
+	}
+	name = name[len("llvm."):]
+	if i := strings.Index(name, "."); i != -1 {
+		name = name[:i]
+	}
+	return name
+}
+
+// bitsWidth returns the bit size of it, if math/bits has functions for
+// integers of that size.
+func bitsWidth(it *types.IntType) (uint64, error) {
+	switch it.BitSize {
+	case 8, 16, 32, 64:
+		return it.BitSize, nil
+	}
+	return 0, fmt.Errorf("unsupported integer type for bit operation: %v", it)
+}
+
+// unsignedElem converts the element of an integer vector with type it (held
+// in a variable named elem) to unsigned.
+func unsignedElem(it *types.IntType, elem string) string {
+	if it.BitSize == 8 {
+		return elem
+	}
+	return fmt.Sprintf("uint%d(%s)", it.BitSize, elem)
+}
+
+// BitIntrinsic translates calls to the intrinsics in bitIntrinsics and to
+// the funnel shifts. If name is not one of them, it returns ok == false.
+func BitIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	base := intrinsicBase(name)
+	if base == "fshl" || base == "fshr" {
+		result, err := FunnelShift(inst, base == "fshl")
+		return result, true, err
+	}
+	fn, ok := bitIntrinsics[base]
+	if !ok {
+		return "", false, nil
+	}
+	if len(inst.Args) < 1 {
+		return "", true, fmt.Errorf("too few arguments to %s", name)
+	}
+	arg := inst.Args[0]
+	t := arg.Type()
+	vt, isVector := t.(*types.VectorType)
+	if isVector {
+		t = vt.ElemType
+	}
+	it, ok := t.(*types.IntType)
+	if !ok {
+		return "", true, fmt.Errorf("unsupported type for %s: %v", name, arg.Type())
+	}
+	width, err := bitsWidth(it)
+	if err != nil {
+		return "", true, err
+	}
+	if fn == "ReverseBytes" && width == 8 {
+		return "", true, fmt.Errorf("can't swap the bytes of a single byte")
+	}
+	rt, err := TypeSpec(it)
+	if err != nil {
+		return "", true, err
+	}
+	r := VariableName(inst)
+
+	if isVector {
+		x, err := FormatValue(arg)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating operand (%v): %v", arg, err)
+		}
+		return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = %s(bits.%s%d(%s)) }", x, r, rt, fn, width, unsignedElem(it, "lane_v")), true, nil
+	}
+	x, err := FormatUnsigned(arg)
+	if err != nil {
+		return "", true, fmt.Errorf("error translating operand (%v): %v", arg, err)
+	}
+	return fmt.Sprintf("%s = %s(bits.%s%d(%s))", r, rt, fn, width, x), true, nil
+}
+
+// FunnelShift translates a call to llvm.fshl (if left is true) or llvm.fshr.
+// A funnel shift concatenates its first two operands, shifts them by the
+// third operand (modulo the bit width), and keeps the high half (for fshl) or
+// the low half (for fshr). When the first two operands are the same, that is
+// a rotation.
+func FunnelShift(inst *ir.InstCall, left bool) (string, error) {
+	if len(inst.Args) != 3 {
+		return "", fmt.Errorf("wrong number of arguments to funnel shift: %d", len(inst.Args))
+	}
+	t := inst.Args[0].Type()
+	vt, isVector := t.(*types.VectorType)
+	if isVector {
+		t = vt.ElemType
+	}
+	it, ok := t.(*types.IntType)
+	if !ok {
+		return "", fmt.Errorf("unsupported type for funnel shift: %v", inst.Args[0].Type())
+	}
+	width, err := bitsWidth(it)
+	if err != nil {
+		return "", err
+	}
+	rt, err := TypeSpec(it)
+	if err != nil {
+		return "", err
+	}
+	r := VariableName(inst)
+
+	if isVector {
+		var operands [3]string
+		for i, arg := range inst.Args {
+			operands[i], err = FormatValue(arg)
+			if err != nil {
+				return "", fmt.Errorf("error translating operand %d (%v): %v", i, arg, err)
+			}
+		}
+		hi := unsignedElem(it, operands[0]+"[lane_i]")
+		lo := unsignedElem(it, operands[1]+"[lane_i]")
+		amount := unsignedElem(it, operands[2]+"[lane_i]")
+		if operands[0] == operands[1] {
+			lo = hi
+		}
+		return fmt.Sprintf("for lane_i := range %s { %s[lane_i] = %s(%s) }", r, r, rt, funnelShiftExpr(hi, lo, amount, width, left)), nil
+	}
+
+	var operands [3]string
+	for i, arg := range inst.Args {
+		operands[i], err = FormatUnsigned(arg)
+		if err != nil {
+			return "", fmt.Errorf("error translating operand %d (%v): %v", i, arg, err)
+		}
+	}
+	amount := operands[2]
+	if c, ok := inst.Args[2].(*constant.Int); ok {
+		amount = fmt.Sprint(new(big.Int).Mod(c.X, new(big.Int).SetUint64(width)))
+	}
+	return fmt.Sprintf("%s = %s(%s)", r, rt, funnelShiftExpr(operands[0], operands[1], amount, width, left)), nil
+}
+
+// funnelShiftExpr returns an unsigned expression for a funnel shift of the
+// width-bit unsigned expressions hi and lo by amount.
+func funnelShiftExpr(hi, lo, amount string, width uint64, left bool) string {
+	// complement is the shift amount for the other operand.
+	var complement string
+	if n, err := strconv.ParseUint(amount, 10, 64); err != nil {
+		amount = fmt.Sprintf("%s%%%d", amount, width)
+		complement = fmt.Sprintf("(%d-%s)", width, amount)
+	} else if n == 0 {
+		if left {
+			return hi
+		}
+		return lo
+	} else {
+		complement = fmt.Sprint(width - n)
+	}
+	if hi == lo {
+		if left {
+			return fmt.Sprintf("bits.RotateLeft%d(%s, int(%s))", width, hi, amount)
+		}
+		return fmt.Sprintf("bits.RotateLeft%d(%s, -int(%s))", width, hi, amount)
+	}
+	// Go shifts by the full width give 0, so a shift amount of 0 leaves the
+	// selected operand unchanged, as it should.
+	if left {
+		return fmt.Sprintf("%s<<%s | %s>>%s", hi, parenthesize(amount), lo, complement)
+	}
+	return fmt.Sprintf("%s>>%s | %s<<%s", lo, parenthesize(amount), hi, complement)
+}
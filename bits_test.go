@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBitCounts(t *testing.T) {
+	t.Parallel()
+	src := new(strings.Builder)
+	var exprs []string
+	for _, fn := range []string{"ctlz", "cttz", "ctpop"} {
+		for _, bits := range []int{8, 16, 32, 64} {
+			extra, extraDecl := "", ""
+			if fn != "ctpop" {
+				extra, extraDecl = ", i1 false", ", i1"
+			}
+			fmt.Fprintf(src, "declare i%[1]d @llvm.%[2]s.i%[1]d(i%[1]d%[3]s)\n\n", bits, fn, extraDecl)
+			fmt.Fprintf(src, "define i%[1]d @%[2]s%[1]d(i%[1]d %%x) {\n  %%r = call i%[1]d @llvm.%[2]s.i%[1]d(i%[1]d %%x%[3]s)\n  ret i%[1]d %%r\n}\n\n", bits, fn, extra)
+			exprs = append(exprs, fmt.Sprintf("%s%d(0), %s%d(1), %s%d(-1), %s%d(6)", fn, bits, fn, bits, fn, bits, fn, bits))
+		}
+	}
+	src.WriteString(`
+declare <4 x i16> @llvm.ctpop.v4i16(<4 x i16>)
+
+define <4 x i16> @ctpopv(<4 x i16> %x) {
+  %r = call <4 x i16> @llvm.ctpop.v4i16(<4 x i16> %x)
+  ret <4 x i16> %r
+}
+
+declare <2 x i32> @llvm.ctlz.v2i32(<2 x i32>, i1)
+
+define <2 x i32> @ctlzv(<2 x i32> %x) {
+  %r = call <2 x i32> @llvm.ctlz.v2i32(<2 x i32> %x, i1 true)
+  ret <2 x i32> %r
+}
+`)
+	exprs = append(exprs,
+		"ctpopv([4]int16{0, 7, -1, 0x100})",
+		"ctlzv([2]int32{1, -1})",
+	)
+	// Unsigned byte arguments can't be -1.
+	mainSrc := strings.Replace(mainCalling(exprs...), "8(-1)", "8(255)", -1)
+	want := "8 7 0 5\n16 15 0 13\n32 31 0 29\n64 63 0 61\n" +
+		"8 0 0 1\n16 0 0 1\n32 0 0 1\n64 0 0 1\n" +
+		"0 1 8 2\n0 1 16 2\n0 1 32 2\n0 1 64 2\n" +
+		"[0 3 16 1]\n[31 0]\n"
+	checkProgram(t, src.String(), mainSrc, want)
+
+	output := translateError(t, `
+declare i128 @llvm.ctpop.i128(i128)
+
+define i128 @wide(i128 %x) {
+  %r = call i128 @llvm.ctpop.i128(i128 %x)
+  ret i128 %r
+}
+`, "-color=never")
+	if !strings.Contains(output, "unsupported integer type for bit operation: i128") {
+		t.Errorf("output doesn't mention i128:\n%s", output)
+	}
+}
+
+func TestByteSwap(t *testing.T) {
+	t.Parallel()
+	src := `
+declare i16 @llvm.bswap.i16(i16)
+declare i32 @llvm.bswap.i32(i32)
+declare i64 @llvm.bswap.i64(i64)
+declare <2 x i32> @llvm.bswap.v2i32(<2 x i32>)
+
+define i16 @swap16(i16 %x) {
+  %r = call i16 @llvm.bswap.i16(i16 %x)
+  ret i16 %r
+}
+
+define i32 @swap32(i32 %x) {
+  %r = call i32 @llvm.bswap.i32(i32 %x)
+  ret i32 %r
+}
+
+define i64 @swap64(i64 %x) {
+  %r = call i64 @llvm.bswap.i64(i64 %x)
+  ret i64 %r
+}
+
+define <2 x i32> @swapv(<2 x i32> %x) {
+  %r = call <2 x i32> @llvm.bswap.v2i32(<2 x i32> %x)
+  ret <2 x i32> %r
+}
+`
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	fmt.Printf("%#x\n", uint16(swap16(0x1280)))
+	fmt.Printf("%#x\n", uint32(swap32(0x12345680)))
+	fmt.Printf("%#x\n", uint64(swap64(0x0102030405060780)))
+	fmt.Printf("%#x\n", swapv([2]int32{0x01020304, -1}))
+}
+`
+	checkProgram(t, src, mainSrc, "0x8012\n0x80563412\n0x8007060504030201\n[0x4030201 -0x1]\n")
+
+	output := translateError(t, `
+declare i8 @llvm.bswap.i8(i8)
+
+define i8 @swap8(i8 %x) {
+  %r = call i8 @llvm.bswap.i8(i8 %x)
+  ret i8 %r
+}
+`, "-color=never")
+	if !strings.Contains(output, "can't swap the bytes of a single byte") {
+		t.Errorf("output doesn't mention the byte:\n%s", output)
+	}
+}
+
+func TestFunnelShifts(t *testing.T) {
+	t.Parallel()
+	// Each function is checked against a funnel shift done with math/big:
+	// variable amounts, constant ones (including 0 and ones wider than the
+	// type), and rotations, where both operands are the same.
+	src, checks := new(strings.Builder), new(strings.Builder)
+	for _, bits := range []int{8, 16, 32, 64} {
+		gt := fmt.Sprintf("int%d", bits)
+		if bits == 8 {
+			gt = "byte"
+		}
+		for _, fn := range []string{"fshl", "fshr"} {
+			fmt.Fprintf(src, "declare i%[1]d @llvm.%[2]s.i%[1]d(i%[1]d, i%[1]d, i%[1]d)\n\n", bits, fn)
+			fmt.Fprintf(src, "define i%[1]d @%[2]s%[1]d(i%[1]d %%x, i%[1]d %%y, i%[1]d %%n) {\n  %%r = call i%[1]d @llvm.%[2]s.i%[1]d(i%[1]d %%x, i%[1]d %%y, i%[1]d %%n)\n  ret i%[1]d %%r\n}\n\n", bits, fn)
+			fmt.Fprintf(src, "define i%[1]d @%[2]s%[1]drot(i%[1]d %%x, i%[1]d %%n) {\n  %%r = call i%[1]d @llvm.%[2]s.i%[1]d(i%[1]d %%x, i%[1]d %%x, i%[1]d %%n)\n  ret i%[1]d %%r\n}\n\n", bits, fn)
+			fmt.Fprintf(checks, "\tfor _, x := range values {\n\t\tfor _, y := range values {\n\t\t\tfor n := 0; n < %d; n++ {\n", 2*bits+1)
+			fmt.Fprintf(checks, "\t\t\t\tcheck(%[1]q, %[2]d, x, y, n, int64(%[1]s%[2]d(%[3]s(x), %[3]s(y), %[3]s(n))))\n", fn, bits, gt)
+			fmt.Fprintf(checks, "\t\t\t\tcheck(%[1]q, %[2]d, x, x, n, int64(%[1]s%[2]drot(%[3]s(x), %[3]s(n))))\n", fn, bits, gt)
+			fmt.Fprintf(checks, "\t\t\t}\n\t\t}\n\t}\n")
+			for _, n := range []int{0, 3, bits + 5} {
+				name := fmt.Sprintf("%s%dby%d", fn, bits, n)
+				fmt.Fprintf(src, "define i%[1]d @%[3]s(i%[1]d %%x, i%[1]d %%y) {\n  %%r = call i%[1]d @llvm.%[2]s.i%[1]d(i%[1]d %%x, i%[1]d %%y, i%[1]d %[4]d)\n  ret i%[1]d %%r\n}\n\n", bits, fn, name, n)
+				fmt.Fprintf(checks, "\tfor _, x := range values {\n\t\tfor _, y := range values {\n\t\t\tcheck(%q, %d, x, y, %d, int64(%s(%s(x), %s(y))))\n\t\t}\n\t}\n", fn, bits, n, name, gt, gt)
+			}
+		}
+	}
+	src.WriteString(`
+declare <2 x i16> @llvm.fshl.v2i16(<2 x i16>, <2 x i16>, <2 x i16>)
+
+define <2 x i16> @fshlv(<2 x i16> %x, <2 x i16> %y, <2 x i16> %n) {
+  %r = call <2 x i16> @llvm.fshl.v2i16(<2 x i16> %x, <2 x i16> %y, <2 x i16> %n)
+  ret <2 x i16> %r
+}
+
+declare <2 x i32> @llvm.fshr.v2i32(<2 x i32>, <2 x i32>, <2 x i32>)
+
+define <2 x i32> @rotrv(<2 x i32> %x) {
+  %r = call <2 x i32> @llvm.fshr.v2i32(<2 x i32> %x, <2 x i32> %x, <2 x i32> <i32 4, i32 36>)
+  ret <2 x i32> %r
+}
+`)
+	mainSrc := `package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+var values = []int64{0, 1, -1, 0x5a, 0x1234, -0x789abcdf, 0x0123456789abcdef}
+
+var failures int
+
+// check compares r with the result of the funnel shift fn on the low bits of
+// x, y, and n.
+func check(fn string, bits uint, x, y int64, n int, r int64) {
+	low := func(v int64) *big.Int {
+		return new(big.Int).SetUint64(uint64(v) << (64 - bits) >> (64 - bits))
+	}
+	concat := new(big.Int).Lsh(low(x), bits)
+	concat.Or(concat, low(y))
+	shift := uint(n) % bits
+	mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits), big.NewInt(1))
+	var want *big.Int
+	if fn == "fshl" {
+		want = new(big.Int).Rsh(new(big.Int).Lsh(concat, shift), bits)
+	} else {
+		want = new(big.Int).Rsh(concat, shift)
+	}
+	want.And(want, mask)
+	if got := uint64(r) << (64 - bits) >> (64 - bits); got != want.Uint64() {
+		failures++
+		fmt.Printf("%s%d(%#x, %#x, %d) = %#x, want %#x\n", fn, bits, low(x), low(y), n, got, want)
+	}
+}
+
+func main() {
+` + checks.String() + `	fmt.Println(failures, "failures")
+	fmt.Printf("%#x\n", fshlv([2]int16{0x1234, 0x1234}, [2]int16{0x5678, 0x5678}, [2]int16{4, 20}))
+	fmt.Printf("%#x\n", rotrv([2]int32{0x12345678, 0x12345678}))
+}
+`
+	checkProgram(t, src.String(), mainSrc, "0 failures\n[0x2345 0x2345]\n[-0x7edcba99 -0x7edcba99]\n")
+}
+
+func TestBitReverse(t *testing.T) {
+	t.Parallel()
+	src := new(strings.Builder)
+	for _, bits := range []int{8, 16, 32, 64} {
+		fmt.Fprintf(src, "declare i%[1]d @llvm.bitreverse.i%[1]d(i%[1]d)\n\n", bits)
+		fmt.Fprintf(src, "define i%[1]d @reverse%[1]d(i%[1]d %%x) {\n  %%r = call i%[1]d @llvm.bitreverse.i%[1]d(i%[1]d %%x)\n  ret i%[1]d %%r\n}\n\n", bits)
+	}
+	src.WriteString(`
+declare <2 x i8> @llvm.bitreverse.v2i8(<2 x i8>)
+
+define <2 x i8> @reversev(<2 x i8> %x) {
+  %r = call <2 x i8> @llvm.bitreverse.v2i8(<2 x i8> %x)
+  ret <2 x i8> %r
+}
+`)
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	fmt.Printf("%#x\n", reverse8(0x01))
+	fmt.Printf("%#x\n", uint16(reverse16(0x0003)))
+	fmt.Printf("%#x\n", uint32(reverse32(0x12345678)))
+	fmt.Printf("%#x\n", uint64(reverse64(1)))
+	fmt.Println(reversev([2]byte{0xf0, 0x81}))
+}
+`
+	checkProgram(t, src.String(), mainSrc, "0x80\n0xc000\n0x1e6a2c48\n0x8000000000000000\n[15 129]\n")
+}
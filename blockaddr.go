@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/value"
+)
+
+// Go doesn't have computed goto, so the address of a block (from a
+// blockaddress constant) is translated as the address of a package-level
+// variable that stands for the block, and an indirectbr instruction becomes a
+// switch over the addresses of the blocks it can branch to.
+
+// blockAddrVars holds the names of the variables that stand for blocks whose
+// addresses are taken, keyed by function and block identifiers.
+var blockAddrVars = make(map[string]string)
+
+// blockAddrVar returns the name of the variable that stands for block b in
+// function f, declaring it if necessary.
+func blockAddrVar(f, b value.Named) string {
+	key := f.Ident() + " " + b.Ident()
+	if name, ok := blockAddrVars[key]; ok {
+		return name
+	}
+	name := uniquePackageName(fmt.Sprintf("blockaddr_%s_%s", valueName(f.Name()), labelName(b.Name())))
+	blockAddrVars[key] = name
+	UseHelper(name, fmt.Sprintf("var %s byte\n", name))
+	return name
+}
+
+// BlockAddress translates a blockaddress constant.
+func BlockAddress(c *constant.BlockAddress) (string, error) {
+	f, ok := c.Func.(value.Named)
+	if !ok {
+		return "", fmt.Errorf("unsupported function in blockaddress: %v", c.Func)
+	}
+	addr := "&" + blockAddrVar(f, c.Block)
+	if arenaMode() {
+		return fmt.Sprintf("uintptr(unsafe.Pointer(%s))", addr), nil
+	}
+	return addr, nil
+}
+
+// translateIndirectBr writes the translation of term, which is the
+// terminator of block b in function f.
+func translateIndirectBr(out io.Writer, f *ir.Func, b *ir.Block, term *ir.TermIndirectBr) error {
+	addr, err := FormatValue(term.Addr)
+	if err != nil {
+		return fmt.Errorf("error translating address (%v): %v", term.Addr, err)
+	}
+	fmt.Fprintf(out, "\tswitch %s {\n", addr)
+	seen := make(map[value.Value]bool)
+	for _, t := range term.ValidTargets {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		target, ok := t.(*ir.Block)
+		if !ok {
+			return fmt.Errorf("indirectbr target is not a block: %v", t)
+		}
+		v, err := BlockAddress(constant.NewBlockAddress(f, target))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "\tcase %s:\n", v)
+		if err := branch(out, b, target, "\t\t"); err != nil {
+			return err
+		}
+	}
+	fmt.Fprint(out, "\t}\n")
+	fmt.Fprintf(out, "\tpanic(%q)\n", panicPrefix(term)+"indirectbr to an address that is not one of its targets")
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import "testing"
+
+const blockAddrSource = `
+@ops = global [3 x i8*] [i8* blockaddress(@run, %inc), i8* blockaddress(@run, %double), i8* blockaddress(@run, %done)]
+
+; run interprets a program of opcodes (0 to increment, 1 to double, and 2 to
+; stop) with computed goto, starting from 1.
+define i32 @run(i32* %prog) {
+entry:
+  br label %dispatch
+
+dispatch:
+  %pc = phi i64 [ 0, %entry ], [ %pc1, %inc ], [ %pc1, %double ]
+  %acc = phi i32 [ 1, %entry ], [ %acc.inc, %inc ], [ %acc.double, %double ]
+  %op.addr = getelementptr i32, i32* %prog, i64 %pc
+  %op = load i32, i32* %op.addr
+  %op64 = sext i32 %op to i64
+  %target.addr = getelementptr [3 x i8*], [3 x i8*]* @ops, i64 0, i64 %op64
+  %target = load i8*, i8** %target.addr
+  %pc1 = add i64 %pc, 1
+  indirectbr i8* %target, [label %inc, label %double, label %done, label %inc]
+
+inc:
+  %acc.inc = add i32 %acc, 1
+  br label %dispatch
+
+double:
+  %acc.double = mul i32 %acc, 2
+  br label %dispatch
+
+done:
+  ret i32 %acc
+}
+
+; wrong branches to an address that isn't one of the targets.
+define void @wrong() {
+entry:
+  indirectbr i8* blockaddress(@run, %done), [label %other]
+
+other:
+  ret void
+}
+`
+
+func TestIndirectBr(t *testing.T) {
+	t.Parallel()
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(run(&[]int32{0, 1, 1, 0, 2}[0]))
+	fmt.Println(run(&[]int32{2}[0]))
+	defer func() {
+		fmt.Println(recover())
+	}()
+	wrong()
+}
+`
+	checkProgram(t, blockAddrSource, mainSrc, "9\n1\nindirectbr to an address that is not one of its targets\n")
+}
+
+func TestIndirectBrArena(t *testing.T) {
+	t.Parallel()
+	mainSrc := `package main
+
+import (
+	"fmt"
+
+	"github.com/andybalholm/leaven/libc"
+)
+
+func main() {
+	prog := libc.ArenaMalloc(16)
+	for i, op := range []int32{1, 0, 1, 2} {
+		libc.ArenaStoreInt32(prog+uintptr(4*i), op)
+	}
+	fmt.Println(run(prog))
+}
+`
+	checkProgram(t, blockAddrSource, mainSrc, "6\n", "-memory=arena")
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// Values of type i1 are always Go bools, whatever instruction produces them,
+// so that they can be used directly as conditions. Arithmetic on them is
+// translated with the logical operators that give the same result modulo 2,
+// and they are converted to other integer types (with boolToInt) and back
+// (with x&1 != 0, the low bit) only where an instruction changes the type.
+// BoolInstruction handles all of those instructions.
+
+// boolComparisons gives the expressions for comparisons of i1 values, in
+// terms of the operands x and y. As an unsigned integer, true is 1; as a
+// signed integer, it is -1.
+var boolComparisons = map[enum.IPred]string{
+	enum.IPredEQ:  "%[1]s == %[2]s",
+	enum.IPredNE:  "%[1]s != %[2]s",
+	enum.IPredULT: "!%[1]s && %[2]s",
+	enum.IPredULE: "!%[1]s || %[2]s",
+	enum.IPredUGT: "%[1]s && !%[2]s",
+	enum.IPredUGE: "%[1]s || !%[2]s",
+	enum.IPredSLT: "%[1]s && !%[2]s",
+	enum.IPredSLE: "%[1]s || !%[2]s",
+	enum.IPredSGT: "!%[1]s && %[2]s",
+	enum.IPredSGE: "!%[1]s || %[2]s",
+}
+
+// isTrue reports whether v is the i1 constant true.
+func isTrue(v value.Value) bool {
+	c, ok := v.(*constant.Int)
+	return ok && c.Typ.BitSize == 1 && c.X.Sign() != 0
+}
+
+// isFalse reports whether v is the i1 constant false.
+func isFalse(v value.Value) bool {
+	c, ok := v.(*constant.Int)
+	return ok && c.Typ.BitSize == 1 && c.X.Sign() == 0
+}
+
+// boolOperands formats the operands of an instruction on i1 values, with
+// parentheses so that they can be used with the logical operators.
+func boolOperands(x, y value.Value) (xs, ys string, err error) {
+	xs, err = FormatValue(x)
+	if err != nil {
+		return "", "", fmt.Errorf("error translating left operand (%v): %v", x, err)
+	}
+	ys, err = FormatValue(y)
+	if err != nil {
+		return "", "", fmt.Errorf("error translating right operand (%v): %v", y, err)
+	}
+	return parenthesize(xs), parenthesize(ys), nil
+}
+
+// boolBinary translates a binary instruction on i1 values, in terms of the
+// logical operator op. For the shifts and divisions, which leave x unchanged
+// (or are poison), op is empty.
+func boolBinary(dest value.Named, t types.Type, op string, x, y value.Value) (string, bool, error) {
+	if !types.Equal(t, types.I1) {
+		return "", false, nil
+	}
+	xs, ys, err := boolOperands(x, y)
+	if err != nil {
+		return "", true, err
+	}
+	if op == "!=" {
+		// Clang writes logical negation as xor with true.
+		switch {
+		case isTrue(y):
+			return fmt.Sprintf("%s = !%s", VariableName(dest), xs), true, nil
+		case isTrue(x):
+			return fmt.Sprintf("%s = !%s", VariableName(dest), ys), true, nil
+		}
+	}
+	if op == "" {
+		return fmt.Sprintf("%s = %s", VariableName(dest), xs), true, nil
+	}
+	return fmt.Sprintf("%s = %s %s %s", VariableName(dest), xs, op, ys), true, nil
+}
+
+// BoolInstruction translates the instructions that operate on i1 values, or
+// convert between i1 and other integer types. For other instructions, it
+// returns ok == false.
+func BoolInstruction(inst ir.Instruction) (result string, ok bool, err error) {
+	switch inst := inst.(type) {
+	case *ir.InstAdd:
+		return boolBinary(inst, inst.Typ, "!=", inst.X, inst.Y)
+	case *ir.InstSub:
+		return boolBinary(inst, inst.Typ, "!=", inst.X, inst.Y)
+	case *ir.InstXor:
+		return boolBinary(inst, inst.Typ, "!=", inst.X, inst.Y)
+	case *ir.InstMul:
+		return boolBinary(inst, inst.Typ, "&&", inst.X, inst.Y)
+	case *ir.InstAnd:
+		return boolBinary(inst, inst.Typ, "&&", inst.X, inst.Y)
+	case *ir.InstOr:
+		return boolBinary(inst, inst.Typ, "||", inst.X, inst.Y)
+	case *ir.InstShl:
+		return boolBinary(inst, inst.Typ, "", inst.X, inst.Y)
+	case *ir.InstLShr:
+		return boolBinary(inst, inst.Typ, "", inst.X, inst.Y)
+	case *ir.InstAShr:
+		return boolBinary(inst, inst.Typ, "", inst.X, inst.Y)
+	case *ir.InstUDiv:
+		return boolBinary(inst, inst.Typ, "", inst.X, inst.Y)
+	case *ir.InstSDiv:
+		return boolBinary(inst, inst.Typ, "", inst.X, inst.Y)
+	case *ir.InstURem:
+		return boolRemainder(inst, inst.Typ)
+	case *ir.InstSRem:
+		return boolRemainder(inst, inst.Typ)
+
+	case *ir.InstICmp:
+		if !types.Equal(inst.X.Type(), types.I1) {
+			return "", false, nil
+		}
+		expr, ok := boolComparisons[inst.Pred]
+		if !ok {
+			return "", true, fmt.Errorf("unsupported comparison predicate: %v", inst.Pred)
+		}
+		x, y, err := boolOperands(inst.X, inst.Y)
+		if err != nil {
+			return "", true, err
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), fmt.Sprintf(expr, x, y)), true, nil
+
+	case *ir.InstSelect:
+		// Since LLVM 12, a && b and a || b are written as selects, so that
+		// b isn't evaluated when it's not needed.
+		if !types.Equal(inst.Typ, types.I1) || !types.Equal(inst.Cond.Type(), types.I1) {
+			return "", false, nil
+		}
+		var op string
+		var other value.Value
+		switch {
+		case isFalse(inst.ValueFalse):
+			op, other = "&&", inst.ValueTrue
+		case isTrue(inst.ValueTrue):
+			op, other = "||", inst.ValueFalse
+		default:
+			return "", false, nil
+		}
+		cond, y, err := boolOperands(inst.Cond, other)
+		if err != nil {
+			return "", true, err
+		}
+		return fmt.Sprintf("%s = %s %s %s", VariableName(inst), cond, op, y), true, nil
+
+	case *ir.InstZExt:
+		return boolExtension(inst, inst.From, inst.To, false)
+	case *ir.InstSExt:
+		return boolExtension(inst, inst.From, inst.To, true)
+
+	case *ir.InstTrunc:
+		if !types.Equal(inst.To, types.I1) {
+			return "", false, nil
+		}
+		x, err := FormatValue(inst.From)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating source (%v): %v", inst.From, err)
+		}
+		return fmt.Sprintf("%s = %s&1 != 0", VariableName(inst), parenthesize(x)), true, nil
+	}
+	return "", false, nil
+}
+
+// boolRemainder translates a remainder instruction on i1 values. The divisor
+// can only be true (1, or -1 when signed), so the remainder is always 0.
+func boolRemainder(dest value.Named, t types.Type) (string, bool, error) {
+	if !types.Equal(t, types.I1) {
+		return "", false, nil
+	}
+	return fmt.Sprintf("%s = false", VariableName(dest)), true, nil
+}
+
+// boolExtension translates a zext or sext instruction from i1 to the integer
+// type to.
+func boolExtension(dest value.Named, from value.Value, to types.Type, signed bool) (string, bool, error) {
+	if !types.Equal(from.Type(), types.I1) {
+		return "", false, nil
+	}
+	t, err := TypeSpec(to)
+	if err != nil {
+		return "", true, fmt.Errorf("error translating type (%v): %v", to, err)
+	}
+	x, err := FormatValue(from)
+	if err != nil {
+		return "", true, fmt.Errorf("error translating source (%v): %v", from, err)
+	}
+	conv := fmt.Sprintf("%s(%s)", boolToInt(t), x)
+	if signed {
+		// As a signed integer, true is -1.
+		conv = "-" + conv
+	}
+	return fmt.Sprintf("%s = %s", VariableName(dest), conv), true, nil
+}
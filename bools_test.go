@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestBoolInstructions(t *testing.T) {
+	t.Parallel()
+	src := new(strings.Builder)
+	var exprs []string
+	want := new(strings.Builder)
+
+	// Each binary operation and comparison is checked against the same
+	// operation on the values as 1-bit integers (0 and 1 unsigned, 0 and -1
+	// signed), for the combinations of operands where the result is defined.
+	binary := map[string]func(x, y int) (int, bool){
+		"add":  func(x, y int) (int, bool) { return (x + y) & 1, true },
+		"sub":  func(x, y int) (int, bool) { return (x - y) & 1, true },
+		"mul":  func(x, y int) (int, bool) { return x * y, true },
+		"and":  func(x, y int) (int, bool) { return x & y, true },
+		"or":   func(x, y int) (int, bool) { return x | y, true },
+		"xor":  func(x, y int) (int, bool) { return x ^ y, true },
+		"shl":  func(x, y int) (int, bool) { return x, y == 0 },
+		"lshr": func(x, y int) (int, bool) { return x, y == 0 },
+		"ashr": func(x, y int) (int, bool) { return x, y == 0 },
+		"udiv": func(x, y int) (int, bool) { return x, y == 1 },
+		"sdiv": func(x, y int) (int, bool) { return x, y == 1 && x == 0 },
+		"urem": func(x, y int) (int, bool) { return 0, y == 1 },
+		"srem": func(x, y int) (int, bool) { return 0, y == 1 },
+	}
+	compare := map[string]func(x, y int) bool{
+		"eq":  func(x, y int) bool { return x == y },
+		"ne":  func(x, y int) bool { return x != y },
+		"ult": func(x, y int) bool { return x < y },
+		"ule": func(x, y int) bool { return x <= y },
+		"ugt": func(x, y int) bool { return x > y },
+		"uge": func(x, y int) bool { return x >= y },
+		"slt": func(x, y int) bool { return -x < -y },
+		"sle": func(x, y int) bool { return -x <= -y },
+		"sgt": func(x, y int) bool { return -x > -y },
+		"sge": func(x, y int) bool { return -x >= -y },
+	}
+	for _, op := range []string{"add", "sub", "mul", "and", "or", "xor", "shl", "lshr", "ashr", "udiv", "sdiv", "urem", "srem"} {
+		fmt.Fprintf(src, "define i1 @bool_%[1]s(i1 %%x, i1 %%y) {\n  %%r = %[1]s i1 %%x, %%y\n  ret i1 %%r\n}\n\n", op)
+		for x := 0; x < 2; x++ {
+			for y := 0; y < 2; y++ {
+				if r, ok := binary[op](x, y); ok {
+					exprs = append(exprs, fmt.Sprintf("bool_%s(%v, %v)", op, x == 1, y == 1))
+					fmt.Fprintln(want, r == 1)
+				}
+			}
+		}
+	}
+	for _, pred := range []string{"eq", "ne", "ult", "ule", "ugt", "uge", "slt", "sle", "sgt", "sge"} {
+		fmt.Fprintf(src, "define i1 @cmp_%[1]s(i1 %%x, i1 %%y) {\n  %%r = icmp %[1]s i1 %%x, %%y\n  ret i1 %%r\n}\n\n", pred)
+		for x := 0; x < 2; x++ {
+			for y := 0; y < 2; y++ {
+				exprs = append(exprs, fmt.Sprintf("cmp_%s(%v, %v)", pred, x == 1, y == 1))
+				fmt.Fprintln(want, compare[pred](x, y))
+			}
+		}
+	}
+
+	src.WriteString(`
+define i1 @not(i1 %x) {
+  %r = xor i1 %x, true
+  ret i1 %r
+}
+
+define i1 @andThen(i1 %x, i1 %y) {
+  %r = select i1 %x, i1 %y, i1 false
+  ret i1 %r
+}
+
+define i1 @orElse(i1 %x, i1 %y) {
+  %r = select i1 %x, i1 true, i1 %y
+  ret i1 %r
+}
+
+define i32 @extend(i1 %x) {
+  %z = zext i1 %x to i32
+  %s = sext i1 %x to i32
+  %m = mul i32 %z, 10
+  %r = add i32 %m, %s
+  ret i32 %r
+}
+
+define i8 @extendByte(i1 %x) {
+  %r = sext i1 %x to i8
+  ret i8 %r
+}
+
+define i1 @lowBit(i32 %x) {
+  %r = trunc i32 %x to i1
+  ret i1 %r
+}
+`)
+	exprs = append(exprs,
+		"not(true), not(false)",
+		"andThen(true, false), andThen(true, true), andThen(false, true)",
+		"orElse(false, false), orElse(false, true), orElse(true, false)",
+		"extend(true), extend(false)",
+		"extendByte(true)",
+		"lowBit(6), lowBit(7)",
+	)
+	want.WriteString("false true\nfalse true false\nfalse true true\n9 0\n255\nfalse true\n")
+
+	code, _ := translate(t, src.String())
+	for _, f := range regexp.MustCompile(`(?ms)^func (bool|cmp)_.*?^}`).FindAllString(code, -1) {
+		if strings.Contains(f, "b2i") || strings.Contains(f, "&1") {
+			t.Errorf("bools are converted to integers for arithmetic:\n%s", f)
+		}
+	}
+	if got := runGo(t, code, mainCalling(exprs...)); got != want.String() {
+		t.Errorf("output:\n%s\nwant:\n%s\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
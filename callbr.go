@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/types"
+)
+
+// A callbr instruction is what asm goto compiles to. Inline assembly can't be
+// translated, so callbr gets a degraded translation: the assembly is left
+// out, the result (if any) is the zero value, and execution always continues
+// at the default destination, as it does when the assembly doesn't jump (as
+// with a Linux static key that is turned off). Each one gets a warning.
+
+// translateCallBr writes the translation of term, which is the terminator of
+// block b in function f.
+func translateCallBr(out io.Writer, f *ir.Func, b *ir.Block, term *ir.TermCallBr) error {
+	if _, ok := term.Callee.(*ir.InlineAsm); ok {
+		Warn(f, term, "inline assembly left out; always continuing at the default destination")
+		if !types.Equal(term.Type(), types.Void) {
+			zero, err := zeroValue(term.Type())
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "\t%s = %s\n", VariableName(term), zero)
+		}
+	} else {
+		Warn(f, term, "always continuing at the default destination")
+		call := ir.NewCall(term.Callee, term.Args...)
+		call.CallingConv = term.CallingConv
+		call.FuncAttrs = term.FuncAttrs
+		valueNames[call] = VariableName(term)
+		stmt, err := TranslateInstruction(call)
+		if err != nil {
+			return err
+		}
+		if stmt != "" {
+			fmt.Fprintf(out, "\t%s\n", stmt)
+		}
+	}
+	return branch(out, b, term.NormalRetTarget, "\t")
+}
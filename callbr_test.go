@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCallBr(t *testing.T) {
+	t.Parallel()
+	src := `
+declare void @hook(i32)
+
+define i32 @key(i32 %x) {
+entry:
+  callbr void asm sideeffect "jmp ${0:l}", "X"(i8* blockaddress(@key, %on))
+          to label %off [label %on]
+
+off:
+  %r = callbr i32 asm "", "=r,X"(i8* blockaddress(@key, %on))
+          to label %next [label %on]
+
+next:
+  callbr void @hook(i32 %x)
+          to label %done [label %on]
+
+done:
+  %s = add i32 %r, %x
+  ret i32 %s
+
+on:
+  ret i32 -1
+}
+`
+	code, output := translate(t, src)
+	if n := strings.Count(output, "inline assembly left out; always continuing at the default destination"); n != 2 {
+		t.Errorf("%d warnings about inline assembly, want 2:\n%s", n, output)
+	}
+	if !strings.Contains(output, "callbr void @hook(i32 %x) to label %done [label %on]: always continuing at the default destination") {
+		t.Errorf("no warning about the call to @hook:\n%s", output)
+	}
+	mainSrc := `package main
+
+import "fmt"
+
+func hook(x int32) {
+	fmt.Println("hook", x)
+}
+
+func main() {
+	fmt.Println(key(5))
+}
+`
+	if got, want := runGo(t, code, mainSrc), "hook 5\n5\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// The LLVM IR parser understands the syntax of LLVM 9 or so. Newer versions of
+// LLVM write things it doesn't know about, most notably opaque pointers (ptr)
+// and a steady stream of new attributes. NormalizeIR rewrites those into
+// forms the parser accepts, and NormalizeModule then fixes up the type
+// mismatches that result from treating every opaque pointer as an i8*.
+
+// parserVersion is the newest version of LLVM whose IR can be parsed without
+// normalization.
+const parserVersion = 9
+
+var (
+	identVersion = regexp.MustCompile(`!"(?:[^"]*\s)?(?:clang|LLVM|flang) version (\d+)`)
+
+	// Features that appeared in particular versions, for modules without an
+	// identification string.
+	versionFeatures = []struct {
+		version int
+		re      *regexp.Regexp
+	}{
+		{19, regexp.MustCompile(`#dbg_(?:value|declare|assign|label)\(`)},
+		{16, regexp.MustCompile(`\bmemory\((?:none|read|write|readwrite|argmem|inaccessiblemem)`)},
+		{15, regexp.MustCompile(`(?:^|[^\w%@!.$"-])ptr\b`)},
+		{12, regexp.MustCompile(`\bmustprogress\b`)},
+		{12, regexp.MustCompile(`\b(?:sret|byval)\(`)},
+		{11, regexp.MustCompile(`\bnoundef\b`)},
+		{10, regexp.MustCompile(`= freeze\b`)},
+	}
+)
+
+// DetectLLVMVersion returns the major version of LLVM that produced src, as
+// given by the module's identification metadata or else guessed from the
+// features it uses. It returns 0 if there is no sign of a version newer than
+// the parser supports.
+func DetectLLVMVersion(src string) int {
+	if m := identVersion.FindStringSubmatch(src); m != nil {
+		if v, err := strconv.Atoi(m[1]); err == nil {
+			return v
+		}
+	}
+	src, _ = maskLiterals(src)
+	for _, f := range versionFeatures {
+		if f.re.MatchString(src) {
+			return f.version
+		}
+	}
+	return 0
+}
+
+// irRewrites are the textual changes made by NormalizeIR. None of them adds or
+// removes lines, so that line numbers in diagnostics still match the input.
+var irRewrites = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// Debug records replace calls to llvm.dbg.*. The ones that describe
+	// variables become calls again, for -debug-names; the rest are dropped.
+	{regexp.MustCompile(`(?m)^([ \t]*)#dbg_(value|declare)\(([^!].*), (!\d+), (!DIExpression\([^()]*\)), (!\d+)\)[ \t]*$`), "${1}call void @llvm.dbg.${2}(metadata ${3}, metadata ${4}, metadata ${5}), !dbg ${6}"},
+	{regexp.MustCompile(`(?m)^[ \t]*#dbg_\w+\(.*$`), ""},
+
+	// Opaque pointers become i8*.
+	{regexp.MustCompile(`(^|[^\w%@!.$"-])ptr addrspace\((\d+)\)`), "${1}i8 addrspace(${2})*"},
+	{regexp.MustCompile(`(^|[^\w%@!.$"-])ptr\b`), "${1}i8*"},
+
+	// Attributes that the parser doesn't know about, or that now take
+	// arguments.
+	{regexp.MustCompile(`\b(?:noundef|mustprogress|nocallback|nosanitize_coverage|nosanitize_bounds|allocptr|dead_on_unwind|writable|null_pointer_is_valid|nounwind_if_not_throwing)\b ?`), ""},
+	{regexp.MustCompile(`\b(?:memory|allockind|vscale_range|captures|initializes|range|nofpclass|elementtype)\((?:[^()]|\([^()]*\))*\) ?`), ""},
+	{regexp.MustCompile(`\b(uwtable|sret|inalloca|preallocated)\((?:[^()]|\([^()]*\))*\)`), "$1"},
+
+	// The parser doesn't know the freeze instruction. Freezing a value only
+	// makes a difference if it is undef or poison, whose translations are
+	// already ordinary values, so it becomes a bitcast to the same type (which
+	// is translated as a copy).
+	{regexp.MustCompile(`(?m)= freeze (.+?) ([%@]?[-\w.$]+|%"[^"]*")((?:, !.*)?)$`), "= bitcast $1 $2 to $1$3"},
+
+	// Flags on instructions that didn't used to take them.
+	{regexp.MustCompile(`\b(zext|uitofp) nneg\b`), "$1"},
+	{regexp.MustCompile(`\bor disjoint\b`), "or"},
+	{regexp.MustCompile(`\bicmp samesign\b`), "icmp"},
+	{regexp.MustCompile(`\btrunc (?:nuw |nsw )+`), "trunc "},
+	{regexp.MustCompile(`\bgetelementptr (inbounds )?(?:nusw |nuw |inrange\(-?\d+, ?-?\d+\) )+`), "getelementptr $1"},
+}
+
+// NormalizeIR rewrites constructs from LLVM versions newer than the parser
+// supports, based on the version of LLVM that produced src.
+func NormalizeIR(src string, version int) string {
+	if version <= parserVersion {
+		return src
+	}
+	src, unmask := maskLiterals(src)
+	for _, r := range irRewrites {
+		src = r.re.ReplaceAllString(src, r.repl)
+	}
+	src = fixConstantGEPs(src)
+
+	// Intrinsics overloaded on pointer types are named by address space
+	// instead of pointee type (llvm.memcpy.p0.p0.i64 instead of
+	// llvm.memcpy.p0i8.p0i8.i64).
+	src = intrinsicName.ReplaceAllStringFunc(src, func(name string) string {
+		return pointerSuffix.ReplaceAllString(name, "${1}i8")
+	})
+
+	// The debug records that became calls need their intrinsics declared.
+	// The declarations go at the start of the first line, so that the other
+	// lines keep their numbers.
+	for _, name := range []string{"@llvm.dbg.value(", "@llvm.dbg.declare("} {
+		if strings.Contains(src, "call void "+name) && !strings.Contains(src, "declare void "+name) {
+			src = "declare void " + name + "metadata, metadata, metadata) " + src
+		}
+	}
+	return unmask(src)
+}
+
+var (
+	// literal matches the parts of the source that NormalizeIR leaves alone:
+	// quoted strings (string constants, metadata strings, and quoted names)
+	// and comments.
+	literal     = regexp.MustCompile(`"[^"\n]*"|;.*`)
+	placeholder = regexp.MustCompile(`\x00(\d+)\x00`)
+)
+
+// maskLiterals replaces the contents of the strings and comments in src with
+// numbered placeholders, so that the rewrites can't change them (a string
+// constant that says "ptr" has to stay that way). Strings with the same
+// contents get the same placeholder, so quoted names still match each other.
+// It returns the masked text and a function that puts the contents back.
+func maskLiterals(src string) (masked string, unmask func(string) string) {
+	var contents []string
+	index := make(map[string]int)
+	masked = literal.ReplaceAllStringFunc(src, func(lit string) string {
+		start, end := 1, len(lit)
+		if lit[0] == '"' {
+			end--
+		}
+		c := lit[start:end]
+		n, ok := index[c]
+		if !ok {
+			n = len(contents)
+			index[c] = n
+			contents = append(contents, c)
+		}
+		return lit[:start] + "\x00" + strconv.Itoa(n) + "\x00" + lit[end:]
+	})
+	unmask = func(s string) string {
+		return placeholder.ReplaceAllStringFunc(s, func(p string) string {
+			n, _ := strconv.Atoi(p[1 : len(p)-1])
+			return contents[n]
+		})
+	}
+	return masked, unmask
+}
+
+var (
+	intrinsicName = regexp.MustCompile(`@llvm\.[\w.]+`)
+	pointerSuffix = regexp.MustCompile(`(\.p\d+)\b`)
+)
+
+// NormalizeFile reads inFile and writes a normalized copy of it to a
+// temporary file if it needs one, returning the name of the file to parse. If
+// version is 0, it is detected from the file's contents.
+func NormalizeFile(inFile string, version int) (string, error) {
+	b, err := ioutil.ReadFile(inFile)
+	if err != nil {
+		return "", err
+	}
+	src := string(b)
+	if version == 0 {
+		version = DetectLLVMVersion(src)
+	}
+	normalized := NormalizeIR(src, version)
+	if normalized == src {
+		return inFile, nil
+	}
+
+	tmp, err := ioutil.TempFile("", "leaven-*.ll")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.WriteString(normalized); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	return tmp.Name(), tmp.Close()
+}
+
+// NormalizeModule inserts bitcasts where a pointer is used as a pointer to a
+// different type than its own, as happens when opaque pointers have been
+// replaced by i8*. The rest of the translator can then assume that pointer
+// types are consistent, as they are in IR from older versions of LLVM. It also
+// corrects the result types of cmpxchg instructions.
+func NormalizeModule(m *ir.Module) {
+	for _, g := range m.Globals {
+		if g.Init != nil {
+			g.Init = castConstant(g.Init, g.ContentType)
+		}
+	}
+
+	for _, f := range m.Funcs {
+		for _, b := range f.Blocks {
+			var insts []ir.Instruction
+			// castTo converts v to type t if they are different pointer types.
+			castTo := func(v value.Value, t types.Type) value.Value {
+				if !isPointerMismatch(v.Type(), t) {
+					return v
+				}
+				if c, ok := v.(constant.Constant); ok {
+					return constant.NewBitCast(c, t)
+				}
+				bc := ir.NewBitCast(v, t)
+				bc.SetName("cast")
+				insts = append(insts, bc)
+				return bc
+			}
+			// cast converts v to a pointer to elem.
+			cast := func(v value.Value, elem types.Type) value.Value {
+				pt, ok := v.Type().(*types.PointerType)
+				if !ok {
+					return v
+				}
+				want := types.NewPointer(elem)
+				want.AddrSpace = pt.AddrSpace
+				return castTo(v, want)
+			}
+
+			for _, inst := range b.Insts {
+				switch inst := inst.(type) {
+				case *ir.InstLoad:
+					inst.Src = cast(inst.Src, inst.ElemType)
+				case *ir.InstStore:
+					inst.Dst = cast(inst.Dst, inst.Src.Type())
+				case *ir.InstGetElementPtr:
+					inst.Src = cast(inst.Src, inst.ElemType)
+				case *ir.InstCall:
+					if _, ok := calleeSig(inst.Callee); !ok {
+						// An indirect call through an opaque pointer. The
+						// parser doesn't keep the function type written in
+						// the call, so the signature comes from the result
+						// and argument types. (That loses the varargs of a
+						// variadic callee.)
+						params := make([]types.Type, len(inst.Args))
+						for i, a := range inst.Args {
+							params[i] = a.Type()
+						}
+						inst.Callee = cast(inst.Callee, types.NewFunc(inst.Typ, params...))
+					}
+					if sig, ok := calleeSig(inst.Callee); ok {
+						for i, a := range inst.Args {
+							if i >= len(sig.Params) {
+								break
+							}
+							pt, ok := sig.Params[i].(*types.PointerType)
+							if !ok {
+								continue
+							}
+							if arg, ok := a.(*ir.Arg); ok {
+								arg.Value = cast(arg.Value, pt.ElemType)
+							} else {
+								inst.Args[i] = cast(a, pt.ElemType)
+							}
+						}
+					}
+				case *ir.InstICmp:
+					inst.Y = castTo(inst.Y, inst.X.Type())
+				case *ir.InstSelect:
+					inst.ValueTrue = castTo(inst.ValueTrue, inst.Type())
+					inst.ValueFalse = castTo(inst.ValueFalse, inst.Type())
+				case *ir.InstCmpXchg:
+					// The parser gives the result type as { T, i8 } instead
+					// of { T, i1 }.
+					inst.Typ = types.NewStruct(inst.New.Type(), types.I1)
+				}
+				insts = append(insts, inst)
+			}
+			if ret, ok := b.Term.(*ir.TermRet); ok && ret.X != nil {
+				ret.X = castTo(ret.X, f.Sig.RetType)
+			}
+			b.Insts = insts
+		}
+
+		// Values coming into phi nodes are converted at the end of the
+		// predecessor block.
+		for _, b := range f.Blocks {
+			for _, inst := range b.Insts {
+				phi, ok := inst.(*ir.InstPhi)
+				if !ok {
+					break
+				}
+				for _, inc := range phi.Incs {
+					if !isPointerMismatch(inc.X.Type(), phi.Typ) {
+						continue
+					}
+					if c, ok := inc.X.(constant.Constant); ok {
+						inc.X = constant.NewBitCast(c, phi.Typ)
+						continue
+					}
+					pred, ok := inc.Pred.(*ir.Block)
+					if !ok {
+						continue
+					}
+					bc := ir.NewBitCast(inc.X, phi.Typ)
+					bc.SetName("cast")
+					pred.Insts = append(pred.Insts, bc)
+					inc.X = bc
+				}
+			}
+		}
+	}
+}
+
+// isPointerMismatch reports whether a and b are different pointer types.
+func isPointerMismatch(a, b types.Type) bool {
+	_, ok1 := a.(*types.PointerType)
+	_, ok2 := b.(*types.PointerType)
+	return ok1 && ok2 && !types.Equal(a, b)
+}
+
+// castConstant converts pointers in c to the types they have in t, which is
+// the type c is supposed to have.
+func castConstant(c constant.Constant, t types.Type) constant.Constant {
+	if isPointerMismatch(c.Type(), t) {
+		return constant.NewBitCast(c, t)
+	}
+	switch c := c.(type) {
+	case *constant.Struct:
+		if st, ok := t.(*types.StructType); ok && len(st.Fields) == len(c.Fields) {
+			for i, f := range c.Fields {
+				c.Fields[i] = castConstant(f, st.Fields[i])
+			}
+		}
+	case *constant.Array:
+		if at, ok := t.(*types.ArrayType); ok {
+			for i, e := range c.Elems {
+				c.Elems[i] = castConstant(e, at.ElemType)
+			}
+		}
+	}
+	return c
+}
+
+// calleeSig returns the signature of the function called through v.
+func calleeSig(v value.Value) (*types.FuncType, bool) {
+	pt, ok := v.Type().(*types.PointerType)
+	if !ok {
+		return nil, false
+	}
+	sig, ok := pt.ElemType.(*types.FuncType)
+	return sig, ok
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNewerIR(t *testing.T) {
+	t.Parallel()
+	src := `
+@table = global [4 x i32] [i32 10, i32 20, i32 30, i32 40]
+
+define noundef i32 @get(ptr noundef %p, i32 noundef %i) #0 {
+  %idx = zext nneg i32 %i to i64
+  %q = getelementptr inbounds nuw i32, ptr %p, i64 %idx
+  %x = load i32, ptr %q, align 4
+  %f = freeze i32 %x
+    #dbg_label(!10, !11)
+  %y = or disjoint i32 %f, 1
+  ret i32 %y
+}
+
+define i32 @third() {
+  %x = load i32, ptr getelementptr inbounds ([4 x i32], ptr @table, i64 0, i64 2), align 4
+  ret i32 %x
+}
+
+define void @copy(ptr %dst, ptr %src) {
+  call void @llvm.memcpy.p0.p0.i64(ptr %dst, ptr %src, i64 8, i1 false)
+  ret void
+}
+
+declare void @llvm.memcpy.p0.p0.i64(ptr, ptr, i64, i1)
+
+attributes #0 = { mustprogress nounwind memory(argmem: read) uwtable(sync) }
+`
+	checkProgram(t, src, `package main
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+func main() {
+	// Opaque pointers are translated as *byte.
+	fmt.Println(get((*byte)(unsafe.Pointer(&table[0])), 3))
+	fmt.Println(third())
+	a, b := [2]int32{}, [2]int32{5, 6}
+	_copy((*byte)(unsafe.Pointer(&a)), (*byte)(unsafe.Pointer(&b)))
+	fmt.Println(a)
+}
+`, "41\n30\n[5 6]\n")
+}
+
+func TestNewerIRStrings(t *testing.T) {
+	t.Parallel()
+	src := `
+; A comment about a ptr noundef argument.
+@.str = private constant [11 x i8] c"a ptr here\00"
+@"a ptr" = global i32 noundef 7
+
+define ptr @message() {
+  ret ptr @.str
+}
+
+define i32 @quoted() {
+  %x = load i32, ptr @"a ptr"
+  ret i32 %x
+}
+`
+	checkProgram(t, src, `package main
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+func main() {
+	fmt.Printf("%q\n", (*[11]byte)(unsafe.Pointer(message()))[:])
+	fmt.Println(quoted())
+}
+`, "\"a ptr here\\x00\"\n7\n", "-llvm-version=15")
+}
+
+func TestTypedAttributes(t *testing.T) {
+	t.Parallel()
+	// The only sign of a newer LLVM is the type on sret and byval.
+	src := `
+%pair = type { i32, i32 }
+
+define void @make(%pair* sret(%pair) %r, i32 %a) {
+  %p = getelementptr %pair, %pair* %r, i32 0, i32 1
+  store i32 %a, i32* %p
+  ret void
+}
+
+define i32 @second(%pair* byval(%pair) %p) {
+  %q = getelementptr %pair, %pair* %p, i32 0, i32 1
+  %v = load i32, i32* %q
+  ret i32 %v
+}
+
+define i32 @roundtrip(i32 %a) {
+  %p = alloca %pair
+  call void @make(%pair* sret(%pair) %p, i32 %a)
+  %v = call i32 @second(%pair* byval(%pair) %p)
+  ret i32 %v
+}
+`
+	checkProgram(t, src, mainCalling("roundtrip(7)"), "7\n")
+}
+
+func TestDebugRecords(t *testing.T) {
+	t.Parallel()
+	// debugNamesSource, with debug records instead of calls, and with blank
+	// lines before a record.
+	src := strings.NewReplacer(
+		"call void @llvm.dbg.value(metadata i32 %0, metadata !11, metadata !DIExpression()), !dbg !14", "#dbg_value(i32 %0, !11, !DIExpression(), !14)",
+		"call void @llvm.dbg.value(metadata i32 %1, metadata !12, metadata !DIExpression()), !dbg !14", "\n\n  #dbg_value(i32 %1, !12, !DIExpression(), !14)",
+		"call void @llvm.dbg.declare(metadata i32* %3, metadata !13, metadata !DIExpression()), !dbg !14", "#dbg_declare(ptr %3, !13, !DIExpression(), !14)",
+		"call void @llvm.dbg.value(metadata i32 %6, metadata !11, metadata !DIExpression()), !dbg !14", "#dbg_value(i32 %6, !11, !DIExpression(), !14)",
+		"call void @llvm.dbg.label(metadata !15), !dbg !14", "#dbg_label(!15, !14)",
+		"declare void @llvm.dbg.declare(metadata, metadata, metadata)\n", "",
+		"declare void @llvm.dbg.value(metadata, metadata, metadata)\n", "",
+		"declare void @llvm.dbg.label(metadata)\n", "",
+		"  %7 = sub i32 %6, 1\n", "  %7 = sub i32 %6, 1\n  %v = alloca <vscale x 4 x i32>\n",
+		"i32* %3", "ptr %3",
+	).Replace(debugNamesSource)
+	output := translateError(t, src, "-debug-names", "-color=never")
+	line := 1 + strings.Count(src[:strings.Index(src, "%v = alloca")], "\n")
+	if want := fmt.Sprintf("test.ll:%d: error: @area: ", line); !strings.Contains(output, want) {
+		t.Errorf("output doesn't contain %q:\n%s", want, output)
+	}
+
+	src = strings.Replace(src, "  %v = alloca <vscale x 4 x i32>\n", "", 1)
+	code, _ := translate(t, src, "-debug-names")
+	for _, s := range []string{"func area(width int32, height int32) int32 {", "result = ", "width_1 = "} {
+		if !strings.Contains(code, s) {
+			t.Errorf("generated code doesn't contain %q:\n%s", s, numberLines(code))
+		}
+	}
+	if got, want := runGo(t, code, mainCalling("area(6, 7)")), "42\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	t.Parallel()
+	src := `
+define i32 @pick(i1 %c, i32 %x) {
+  %u = freeze i32 undef
+  %f = freeze i32 %x, !tag !0
+  %a = select i1 %c, i32 %f, i32 %u
+  ret i32 %a
+}
+
+define <2 x i32> @vec(<2 x i32> %v) {
+  %f = freeze <2 x i32> %v
+  ret <2 x i32> %f
+}
+
+define { i32, i8 } @agg({ i32, i8 } %s) {
+  %f = freeze { i32, i8 } %s
+  ret { i32, i8 } %f
+}
+
+define i8* @ptr(i8* %"p.q") {
+  %f = freeze i8* %"p.q"
+  ret i8* %f
+}
+
+!0 = !{}
+`
+	checkProgram(t, src, `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(pick(true, 7))
+	fmt.Println(vec([2]int32{1, 2}))
+	fmt.Println(agg(anon{F0: 3, F1: 4}))
+	b := byte(1)
+	fmt.Println(ptr(&b) == &b)
+}
+`, "7\n[1 2]\n{3 4}\ntrue\n")
+}
+
+func TestOpaqueIndirectCalls(t *testing.T) {
+	t.Parallel()
+	src := `
+%struct.ops = type { ptr, ptr }
+
+@ops = global %struct.ops { ptr @inc, ptr @scale }
+
+define i32 @inc(i32 %x) {
+  %r = add i32 %x, 1
+  ret i32 %r
+}
+
+define i64 @scale(i64 %x, i32 %by) {
+  %b = sext i32 %by to i64
+  %r = mul i64 %x, %b
+  ret i64 %r
+}
+
+; apply calls both functions in @ops through their opaque pointers.
+define i64 @apply(i32 %x) {
+  %f = load ptr, ptr @ops
+  %y = call i32 %f(i32 %x)
+  %gp = getelementptr inbounds %struct.ops, ptr @ops, i32 0, i32 1
+  %g = load ptr, ptr %gp
+  %y64 = zext i32 %y to i64
+  %r = call i64 %g(i64 %y64, i32 3)
+  ret i64 %r
+}
+`
+	checkProgram(t, src, mainCalling("apply(13)"), "42\n")
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/llir/llvm/asm"
+	"github.com/llir/llvm/ir/types"
+)
+
+// With opaque pointers, a getelementptr constant expression has the type ptr,
+// like everything else that points somewhere. Once ptr has become i8*, that
+// no longer matches the type the parser works out for it (a pointer to the
+// indexed element), and the parser rejects it. So fixConstantGEPs wraps each
+// expression in a bitcast to i8*, and converts its source to a pointer to the
+// source element type, which is what the translation of getelementptr
+// expects.
+
+var (
+	constantGEP = regexp.MustCompile(`\bgetelementptr (?:inbounds )?\(`)
+	typeDefLine = regexp.MustCompile(`(?m)^(?:%[-\w.$]+|%"[^"]*") = type .*$`)
+	opaqueSrc   = regexp.MustCompile(`^i8( addrspace\(\d+\))?\* `)
+)
+
+// fixConstantGEPs rewrites the getelementptr constant expressions in src,
+// whose opaque pointers have already been replaced by i8*.
+func fixConstantGEPs(src string) string {
+	if !constantGEP.MatchString(src) {
+		return src
+	}
+
+	// Have the parser work out the element types, declaring a global of each
+	// one.
+	var elems []string
+	index := make(map[string]int)
+	rewriteGEPs(src, func(prefix string, args []string) string {
+		elem := strings.TrimSpace(args[0])
+		if _, ok := index[elem]; !ok {
+			index[elem] = len(elems)
+			elems = append(elems, elem)
+		}
+		return prefix + strings.Join(args, ",") + ")"
+	})
+	decls := new(strings.Builder)
+	for _, def := range typeDefLine.FindAllString(src, -1) {
+		fmt.Fprintln(decls, def)
+	}
+	for i, elem := range elems {
+		fmt.Fprintf(decls, "@leaven.gep.%d = external global %s\n", i, elem)
+	}
+	m, err := asm.ParseString("", decls.String())
+	if err != nil || len(m.Globals) != len(elems) {
+		return src
+	}
+
+	return rewriteGEPs(src, func(prefix string, args []string) string {
+		original := prefix + strings.Join(args, ",") + ")"
+		if len(args) < 2 {
+			return original
+		}
+		elem := strings.TrimSpace(args[0])
+		source := strings.TrimSpace(args[1])
+		sm := opaqueSrc.FindStringSubmatch(source)
+		if sm == nil {
+			return original
+		}
+		ptr := sm[1] + "*"
+		t, ok := gepResultType(m.Globals[index[elem]].ContentType, args[2:])
+		if !ok {
+			return original
+		}
+		args[1] = fmt.Sprintf(" %s%s bitcast (%s to %s%s)", elem, ptr, source, elem, ptr)
+		gep := prefix + strings.Join(args, ",") + ")"
+		if types.Equal(t, types.I8) {
+			return gep
+		}
+		return fmt.Sprintf("bitcast (%v%s %s to i8%s)", t, ptr, gep, ptr)
+	})
+}
+
+// gepResultType returns the type pointed to by the result of a getelementptr
+// with source element type elem and the given indices (as text, including
+// their types).
+func gepResultType(elem types.Type, indices []string) (types.Type, bool) {
+	if len(indices) == 0 {
+		return nil, false
+	}
+	t := elem
+	for _, index := range indices[1:] {
+		switch tt := t.(type) {
+		case *types.StructType:
+			fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(index), "inrange "))
+			if len(fields) != 2 {
+				return nil, false
+			}
+			i, err := strconv.Atoi(fields[1])
+			if err != nil || i < 0 || i >= len(tt.Fields) {
+				return nil, false
+			}
+			t = tt.Fields[i]
+		case *types.ArrayType:
+			t = tt.ElemType
+		case *types.VectorType:
+			t = tt.ElemType
+		default:
+			return nil, false
+		}
+	}
+	return t, true
+}
+
+// rewriteGEPs replaces each getelementptr constant expression in s with the
+// result of calling f with the text up to its opening parenthesis and its
+// comma-separated arguments. Nested expressions are replaced first.
+func rewriteGEPs(s string, f func(prefix string, args []string) string) string {
+	b := new(strings.Builder)
+	for {
+		loc := constantGEP.FindStringIndex(s)
+		if loc == nil {
+			break
+		}
+		end := closingParen(s, loc[1])
+		if end < 0 {
+			break
+		}
+		b.WriteString(s[:loc[0]])
+		inner := rewriteGEPs(s[loc[1]:end], f)
+		b.WriteString(f(s[loc[0]:loc[1]], splitArgs(inner)))
+		s = s[end+1:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// closingParen returns the index of the parenthesis that closes the one just
+// before s[start], or -1 if there isn't one.
+func closingParen(s string, start int) int {
+	depth := 1
+	inString := false
+	for i := start; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		case c == '\n':
+			return -1
+		}
+	}
+	return -1
+}
+
+// splitArgs splits s at the commas that aren't nested in brackets of any
+// kind.
+func splitArgs(s string) []string {
+	var args []string
+	depth := 0
+	inString := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '(' || c == '[' || c == '{' || c == '<':
+			depth++
+		case c == ')' || c == ']' || c == '}' || c == '>':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(args, s[start:])
+}
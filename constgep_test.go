@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestOpaqueConstantGEPs(t *testing.T) {
+	t.Parallel()
+	src := `
+%struct.pair = type { i32, [3 x i16] }
+
+@pair = global %struct.pair { i32 7, [3 x i16] [i16 1, i16 2, i16 3] }
+@bytes = global [4 x i8] c"abcd"
+
+; Globals initialized with constant GEPs, of a struct field, an i8 element,
+; and a GEP of a GEP.
+@second = global ptr getelementptr inbounds (%struct.pair, ptr @pair, i32 0, i32 1, i64 1)
+@third = global ptr getelementptr inbounds ([4 x i8], ptr @bytes, i64 0, i64 2)
+@last = global ptr getelementptr (i16, ptr getelementptr (%struct.pair, ptr @pair, i32 0, i32 1), i64 2)
+
+define i32 @sum() {
+  %p = load ptr, ptr @second
+  %a = load i16, ptr %p
+  %q = load ptr, ptr @third
+  %b = load i8, ptr %q
+  %r = load ptr, ptr @last
+  %c = load i16, ptr %r
+  %d = load i32, ptr getelementptr inbounds (%struct.pair, ptr @pair, i32 0, i32 0)
+  %a32 = zext i16 %a to i32
+  %b32 = zext i8 %b to i32
+  %c32 = zext i16 %c to i32
+  %s1 = add i32 %a32, %b32
+  %s2 = add i32 %s1, %c32
+  %s3 = add i32 %s2, %d
+  ret i32 %s3
+}
+`
+	// 2 + 'c' + 3 + 7
+	checkProgram(t, src, mainCalling("sum()"), "111\n")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+)
+
+// ConstGlobals is the set of global variables that are translated as Go
+// constants instead of variables.
+var ConstGlobals = make(map[*ir.Global]bool)
+
+// FindConstGlobals fills in ConstGlobals. A global qualifies if it is marked
+// constant, its initializer is an integer or finite floating-point value, and
+// it is only ever loaded from (since a Go constant has no address).
+func FindConstGlobals(m *ir.Module) {
+	for _, g := range m.Globals {
+		if g.Immutable && isScalarConstant(g.Init) {
+			ConstGlobals[g] = true
+		}
+	}
+	if len(ConstGlobals) == 0 {
+		return
+	}
+
+	addressTaken := func(x interface{}) {
+		for _, v := range References(x) {
+			if g, ok := v.(*ir.Global); ok {
+				delete(ConstGlobals, g)
+			}
+		}
+	}
+	for _, g := range m.Globals {
+		if g.Init != nil {
+			addressTaken(g.Init)
+		}
+	}
+	for _, f := range m.Funcs {
+		for _, b := range f.Blocks {
+			for _, inst := range b.Insts {
+				if load, ok := inst.(*ir.InstLoad); ok && !load.Volatile && !load.Atomic {
+					if _, ok := load.Src.(*ir.Global); ok {
+						continue
+					}
+				}
+				addressTaken(inst)
+			}
+			addressTaken(b.Term)
+		}
+	}
+}
+
+// isScalarConstant reports whether c can be written as a Go constant
+// expression. Wide integers and big long doubles are translated as structs,
+// and a Go constant can't be negative zero, so those are left as variables.
+func isScalarConstant(c constant.Constant) bool {
+	switch c := c.(type) {
+	case *constant.Int:
+		return c.Typ.BitSize <= 64
+	case *constant.Float:
+		if _, ok := bigLongDouble(c.Typ); ok {
+			return false
+		}
+		return !c.NaN && !c.X.IsInf() && !(c.X.Sign() == 0 && c.X.Signbit())
+	}
+	return false
+}
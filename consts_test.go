@@ -0,0 +1,73 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+const constGlobalsSource = `
+@size = constant i32 42
+@scale = constant double 2.5
+@negzero = constant double -0.0
+@wide = constant i128 12345678901234567890123
+@ld = constant x86_fp80 0xK3FFF8000000000000000
+@counter = global i32 7
+
+define i32 @get_size() {
+  %x = load i32, i32* @size
+  %y = load i32, i32* @counter
+  %r = add i32 %x, %y
+  ret i32 %r
+}
+
+define double @get_scale() {
+  %x = load double, double* @scale
+  ret double %x
+}
+
+define double @recip_negzero() {
+  %x = load double, double* @negzero
+  %r = fdiv double 1.0, %x
+  ret double %r
+}
+
+define i64 @wide_high() {
+  %x = load i128, i128* @wide
+  %s = lshr i128 %x, 64
+  %r = trunc i128 %s to i64
+  ret i64 %r
+}
+
+define double @get_ld() {
+  %x = load x86_fp80, x86_fp80* @ld
+  %r = fptrunc x86_fp80 %x to double
+  ret double %r
+}
+`
+
+func TestConstGlobals(t *testing.T) {
+	t.Parallel()
+	for _, flags := range [][]string{nil, {"-long-double=big"}} {
+		code, _ := translate(t, constGlobalsSource, flags...)
+		for _, re := range []string{
+			`(?m)^const size int32 = 42$`,
+			`(?m)^const scale float64 = `,
+			`(?m)^var counter int32 = 7$`,
+			// Negative zero and the struct types can't be constants.
+			`(?m)^var negzero float64 = `,
+			`(?m)^var wide `,
+		} {
+			if !regexp.MustCompile(re).MatchString(code) {
+				t.Errorf("%v: no match for %s in generated code:\n%s", flags, re, numberLines(code))
+			}
+		}
+		if len(flags) > 0 && !regexp.MustCompile(`(?m)^var ld libc\.LongDouble = `).MatchString(code) {
+			t.Errorf("%v: ld isn't a libc.LongDouble variable:\n%s", flags, numberLines(code))
+		}
+		got := runGo(t, code, mainCalling("get_size()", "get_scale()", "recip_negzero()", "wide_high()", "get_ld()"))
+		want := "49\n2.5\n-Inf\n669\n1\n"
+		if got != want {
+			t.Errorf("%v: output:\n%s\nwant:\n%s\ngenerated code:\n%s", flags, got, want, numberLines(code))
+		}
+	}
+}
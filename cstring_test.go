@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestCStrings calls translated code with C strings made by the helpers in
+// libc/cstring.go.
+func TestCStrings(t *testing.T) {
+	t.Parallel()
+	src := `
+declare i64 @strlen(i8*)
+
+define void @upcase(i8* %s) {
+entry:
+  br label %loop
+
+loop:
+  %p = phi i8* [ %s, %entry ], [ %next, %body ]
+  %c = load i8, i8* %p
+  %done = icmp eq i8 %c, 0
+  br i1 %done, label %exit, label %body
+
+body:
+  %lower = icmp uge i8 %c, 97
+  %notz = icmp ule i8 %c, 122
+  %is = and i1 %lower, %notz
+  %d = sub i8 %c, 32
+  %e = select i1 %is, i8 %d, i8 %c
+  store i8 %e, i8* %p
+  %next = getelementptr i8, i8* %p, i64 1
+  br label %loop
+
+exit:
+  ret void
+}
+
+define i64 @length(i8* %s) {
+  %n = call i64 @strlen(i8* %s)
+  ret i64 %n
+}
+`
+	mainSrc := `package main
+
+import (
+	"fmt"
+
+	"github.com/andybalholm/leaven/libc"
+)
+
+func main() {
+	s := libc.CString("hello, world")
+	upcase(s)
+	fmt.Println(libc.GoString(s), length(s))
+	fmt.Println(libc.GoStringN(s, 5))
+	libc.WithCString("abc", func(p *byte) { fmt.Println(length(p)) })
+}
+`
+	checkProgram(t, src, mainSrc, "HELLO, WORLD 12\nHELLO\n3\n")
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/value"
+)
+
+// With -roots, only the functions and global variables that can be reached
+// from the root functions are translated. That makes it practical to
+// translate a large C library when only part of it is needed: everything the
+// roots don't use (directly or indirectly) is left out, along with the
+// declarations of the external functions that only the unused code called.
+//
+// The roots are a comma-separated list of C function names. The special name
+// "exported" stands for every function that is visible outside the module
+// (not static).
+//
+// Anything that module-level inline assembly mentions by name is kept as
+// well, since leaven doesn't know what the assembly does with it; in
+// particular, that keeps the targets of .set and .symver aliases. An alias
+// in the IR keeps its aliasee.
+
+// checkRoots returns an error if roots isn't a valid value for -roots.
+func checkRoots(roots string) error {
+	for _, r := range strings.Split(roots, ",") {
+		if strings.TrimSpace(r) == "" {
+			return fmt.Errorf("-roots: empty function name in %q", roots)
+		}
+	}
+	return nil
+}
+
+// isExported reports whether f is defined in the module and visible outside
+// it.
+func isExported(f *ir.Func) bool {
+	if f.Blocks == nil {
+		return false
+	}
+	return f.Linkage != enum.LinkageInternal && f.Linkage != enum.LinkagePrivate
+}
+
+// EliminateDeadCode removes the functions and global variables that can't be
+// reached from the functions listed in roots from m.
+func EliminateDeadCode(m *ir.Module, roots string) error {
+	funcs := make(map[string]*ir.Func)
+	for _, f := range m.Funcs {
+		funcs[f.Name()] = f
+	}
+	aliases := make(map[string]*ir.Alias)
+	for _, a := range m.Aliases {
+		aliases[a.Name()] = a
+	}
+
+	var queue []value.Value
+	for _, r := range strings.Split(roots, ",") {
+		r = strings.TrimSpace(r)
+		if r == "exported" {
+			for _, f := range m.Funcs {
+				if isExported(f) {
+					queue = append(queue, f)
+				}
+			}
+			continue
+		}
+		if a, ok := aliases[r]; ok {
+			queue = append(queue, a)
+			continue
+		}
+		f, ok := funcs[r]
+		if !ok || f.Blocks == nil {
+			return fmt.Errorf("-roots: the module doesn't define a function named %s", r)
+		}
+		queue = append(queue, f)
+	}
+	queue = append(queue, asmSymbols(m)...)
+
+	live := make(map[value.Value]bool)
+	for len(queue) > 0 {
+		v := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if live[v] {
+			continue
+		}
+		live[v] = true
+
+		var refs []value.Value
+		switch v := v.(type) {
+		case *ir.Func:
+			for _, b := range v.Blocks {
+				for _, inst := range b.Insts {
+					refs = append(refs, References(inst)...)
+				}
+				refs = append(refs, References(b.Term)...)
+			}
+		case *ir.Global:
+			if v.Init != nil {
+				refs = References(v.Init)
+			}
+		case *ir.Alias:
+			refs = References(v.Aliasee)
+		case *ir.IFunc:
+			refs = References(v.Resolver)
+		}
+		for _, r := range refs {
+			if isGlobalValue(r) && !live[r] {
+				queue = append(queue, r)
+			}
+		}
+	}
+
+	keptFuncs := m.Funcs[:0]
+	for _, f := range m.Funcs {
+		if live[f] {
+			keptFuncs = append(keptFuncs, f)
+		}
+	}
+	m.Funcs = keptFuncs
+
+	keptGlobals := m.Globals[:0]
+	for _, g := range m.Globals {
+		if live[g] {
+			keptGlobals = append(keptGlobals, g)
+		}
+	}
+	m.Globals = keptGlobals
+
+	keptAliases := m.Aliases[:0]
+	for _, a := range m.Aliases {
+		if live[a] {
+			keptAliases = append(keptAliases, a)
+		}
+	}
+	m.Aliases = keptAliases
+	return nil
+}
+
+// asmSymbols returns the functions, global variables, and aliases in m whose
+// names appear in its module-level inline assembly.
+func asmSymbols(m *ir.Module) []value.Value {
+	if len(m.ModuleAsms) == 0 {
+		return nil
+	}
+	named := make(map[string]bool)
+	for _, blob := range m.ModuleAsms {
+		for _, word := range strings.FieldsFunc(blob, func(r rune) bool {
+			return !(r == '_' || r == '.' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r))
+		}) {
+			named[word] = true
+		}
+	}
+
+	var symbols []value.Value
+	for _, f := range m.Funcs {
+		if named[f.Name()] {
+			symbols = append(symbols, f)
+		}
+	}
+	for _, g := range m.Globals {
+		if named[g.Name()] {
+			symbols = append(symbols, g)
+		}
+	}
+	for _, a := range m.Aliases {
+		if named[a.Name()] {
+			symbols = append(symbols, a)
+		}
+	}
+	return symbols
+}
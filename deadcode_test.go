@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const deadCodeSource = `
+module asm ".symver impl_v2, api@@V2"
+module asm ".globl asm_only"
+
+@table = global [2 x i32] [i32 10, i32 20]
+@unused_table = global [2 x i32] [i32 1, i32 2]
+
+declare i32 @api(i32)
+declare i32 @external_unused()
+
+define i32 @impl_v2(i32 %x) {
+  %r = mul i32 %x, 2
+  ret i32 %r
+}
+
+define i32 @asm_only() {
+  ret i32 7
+}
+
+define i32 @lookup(i32 %i) {
+  %p = getelementptr [2 x i32], [2 x i32]* @table, i32 0, i32 %i
+  %v = load i32, i32* %p
+  %r = call i32 @api(i32 %v)
+  ret i32 %r
+}
+
+define internal i32 @helper() {
+  %r = call i32 @external_unused()
+  ret i32 %r
+}
+
+define i32 @unused() {
+  %p = getelementptr [2 x i32], [2 x i32]* @unused_table, i32 0, i32 0
+  %v = load i32, i32* %p
+  %h = call i32 @helper()
+  %r = add i32 %v, %h
+  ret i32 %r
+}
+
+define i32 @aliased() {
+  ret i32 3
+}
+
+@other_name = alias i32 (), i32 ()* @aliased
+`
+
+func TestRoots(t *testing.T) {
+	t.Parallel()
+	code, _ := translate(t, deadCodeSource, "-roots=lookup")
+	for _, s := range []string{"func lookup(", "func impl_v2(", "func asm_only(", "var api = impl_v2", "table"} {
+		if !strings.Contains(code, s) {
+			t.Errorf("-roots=lookup: %q was removed:\n%s", s, numberLines(code))
+		}
+	}
+	for _, s := range []string{"func unused(", "func helper(", "unused_table", "external_unused", "func aliased("} {
+		if strings.Contains(code, s) {
+			t.Errorf("-roots=lookup: %q was kept:\n%s", s, numberLines(code))
+		}
+	}
+	if got, want := runGo(t, code, mainCalling("lookup(1)", "asm_only()")), "40\n7\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+
+	// An alias keeps its aliasee.
+	code, _ = translate(t, deadCodeSource, "-roots=other_name")
+	if !strings.Contains(code, "func aliased(") {
+		t.Errorf("-roots=other_name: aliasee was removed:\n%s", numberLines(code))
+	}
+	if strings.Contains(code, "func unused(") {
+		t.Errorf("-roots=other_name: unused was kept:\n%s", numberLines(code))
+	}
+	if got := runGo(t, code, mainCalling("aliased()")); got != "3\n" {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, "3\n", numberLines(code))
+	}
+
+	// exported keeps everything that isn't static, and what it uses.
+	code, _ = translate(t, deadCodeSource, "-roots=exported")
+	mainSrc := mainCalling("lookup(0)", "unused()") + "\nfunc external_unused() int32 { return 100 }\n"
+	if got, want := runGo(t, code, mainSrc), "20\n101\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestRootsErrors(t *testing.T) {
+	t.Parallel()
+	for _, c := range []struct{ roots, want string }{
+		{"nonexistent", "the module doesn't define a function named nonexistent"},
+		{"api", "the module doesn't define a function named api"},
+		{"lookup,,unused", "empty function name"},
+	} {
+		output := translateError(t, deadCodeSource, "-roots="+c.roots)
+		if !strings.Contains(output, c.want) {
+			t.Errorf("-roots=%s: output doesn't contain %q:\n%s", c.roots, c.want, output)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/metadata"
+	"github.com/llir/llvm/ir/value"
+)
+
+// The C types of values, as far as they can be determined from the debug
+// metadata. valueDITypes holds the types of the values themselves, and
+// contentDITypes holds the types of what pointers (globals and allocas)
+// point to.
+var (
+	valueDITypes   = make(map[value.Value]metadata.Field)
+	contentDITypes = make(map[value.Value]metadata.Field)
+	returnDITypes  = make(map[*ir.Func]metadata.Field)
+)
+
+// CollectDebugTypes fills in valueDITypes and contentDITypes from the debug
+// metadata in m.
+func CollectDebugTypes(m *ir.Module) {
+	for _, g := range m.Globals {
+		if gve, ok := attachment(g.Metadata, "dbg").(*metadata.DIGlobalVariableExpression); ok && gve.Var != nil {
+			contentDITypes[g] = gve.Var.Type
+		}
+	}
+
+	for _, f := range m.Funcs {
+		if sp, ok := attachment(f.Metadata, "dbg").(*metadata.DISubprogram); ok {
+			if st, ok := sp.Type.(*metadata.DISubroutineType); ok && st.Types != nil {
+				// The first element is the return type.
+				for i, t := range st.Types.Fields {
+					switch {
+					case i == 0:
+						returnDITypes[f] = t
+					case i <= len(f.Params):
+						valueDITypes[f.Params[i-1]] = t
+					}
+				}
+			}
+		}
+
+		for _, b := range f.Blocks {
+			for _, inst := range b.Insts {
+				switch inst := inst.(type) {
+				case *ir.InstCall:
+					callee, ok := inst.Callee.(*ir.Func)
+					if !ok || len(inst.Args) < 2 {
+						continue
+					}
+					v, ok := metadataValue(inst.Args[0]).(value.Value)
+					if !ok {
+						continue
+					}
+					lv, ok := metadataValue(inst.Args[1]).(*metadata.DILocalVariable)
+					if !ok {
+						continue
+					}
+					switch callee.Name() {
+					case "llvm.dbg.declare":
+						contentDITypes[v] = lv.Type
+					case "llvm.dbg.value":
+						valueDITypes[v] = lv.Type
+					}
+
+				case *ir.InstLoad:
+					if t, ok := contentDITypes[inst.Src]; ok {
+						valueDITypes[inst] = t
+					}
+				}
+			}
+		}
+	}
+}
+
+// DebugIntrinsic translates calls to llvm.dbg.declare, llvm.dbg.value, and
+// llvm.dbg.label, which only describe the program for debuggers, to nothing.
+// (With -debug-names, they are used in naming variables; see
+// DebugVariableNames.) If name is not one of them, it returns ok == false.
+func DebugIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	if intrinsicBase(name) != "dbg" {
+		return "", false, nil
+	}
+	return "", true, nil
+}
+
+// DebugVariableNames returns the names of the C variables that the values in
+// f hold, according to the llvm.dbg.declare calls (for allocas) and the
+// llvm.dbg.value calls (for other values). A value that is described by more
+// than one call gets the name from the first one.
+func DebugVariableNames(f *ir.Func) map[value.Value]string {
+	names := make(map[value.Value]string)
+	for _, b := range f.Blocks {
+		for _, inst := range b.Insts {
+			call, ok := inst.(*ir.InstCall)
+			if !ok || len(call.Args) < 2 {
+				continue
+			}
+			callee, ok := call.Callee.(*ir.Func)
+			if !ok || callee.Name() != "llvm.dbg.declare" && callee.Name() != "llvm.dbg.value" {
+				continue
+			}
+			v, ok := metadataValue(call.Args[0]).(value.Named)
+			if !ok {
+				continue
+			}
+			lv, ok := metadataValue(call.Args[1]).(*metadata.DILocalVariable)
+			if !ok || lv.Name == "" {
+				continue
+			}
+			if _, ok := names[v]; !ok {
+				names[v] = lv.Name
+			}
+		}
+	}
+	return names
+}
+
+// attachment returns the metadata node attached to a value with the given
+// name, or nil.
+func attachment(md ir.Metadata, name string) metadata.MDNode {
+	for _, a := range md {
+		if a.Name == name {
+			return a.Node
+		}
+	}
+	return nil
+}
+
+// metadataValue unwraps a metadata argument to an intrinsic function.
+func metadataValue(v value.Value) interface{} {
+	if mv, ok := v.(*metadata.Value); ok {
+		return mv.Value
+	}
+	return nil
+}
+
+// underlyingDIType strips typedefs and qualifiers from a debug type.
+func underlyingDIType(t metadata.Field) metadata.Field {
+	for {
+		dt, ok := t.(*metadata.DIDerivedType)
+		if !ok {
+			return t
+		}
+		switch dt.Tag {
+		case enum.DwarfTagTypedef, enum.DwarfTagConstType, enum.DwarfTagVolatileType:
+			t = dt.BaseType
+		default:
+			return t
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const debugNamesSource = `
+declare void @llvm.dbg.declare(metadata, metadata, metadata)
+declare void @llvm.dbg.value(metadata, metadata, metadata)
+declare void @llvm.dbg.label(metadata)
+
+define i32 @area(i32 %0, i32 %1) !dbg !6 {
+  call void @llvm.dbg.value(metadata i32 %0, metadata !11, metadata !DIExpression()), !dbg !14
+  call void @llvm.dbg.value(metadata i32 %1, metadata !12, metadata !DIExpression()), !dbg !14
+  %3 = alloca i32
+  call void @llvm.dbg.declare(metadata i32* %3, metadata !13, metadata !DIExpression()), !dbg !14
+  %4 = mul i32 %0, %1
+  store i32 %4, i32* %3
+  call void @llvm.dbg.label(metadata !15), !dbg !14
+  %5 = load i32, i32* %3
+  ; The second value for the same C variable gets a name of its own.
+  %6 = add i32 %5, 1
+  call void @llvm.dbg.value(metadata i32 %6, metadata !11, metadata !DIExpression()), !dbg !14
+  %7 = sub i32 %6, 1
+  ret i32 %7
+}
+
+!llvm.dbg.cu = !{!0}
+!llvm.module.flags = !{!3, !4}
+
+!0 = distinct !DICompileUnit(language: DW_LANG_C99, file: !1, producer: "clang", isOptimized: true, runtimeVersion: 0, emissionKind: FullDebug, enums: !2)
+!1 = !DIFile(filename: "area.c", directory: "/tmp")
+!2 = !{}
+!3 = !{i32 2, !"Dwarf Version", i32 4}
+!4 = !{i32 2, !"Debug Info Version", i32 3}
+!6 = distinct !DISubprogram(name: "area", scope: !1, file: !1, line: 1, type: !7, scopeLine: 1, flags: DIFlagPrototyped, spFlags: DISPFlagDefinition, unit: !0, retainedNodes: !2)
+!7 = !DISubroutineType(types: !8)
+!8 = !{!9, !9, !9}
+!9 = !DIBasicType(name: "int", size: 32, encoding: DW_ATE_signed)
+!11 = !DILocalVariable(name: "width", arg: 1, scope: !6, file: !1, line: 1, type: !9)
+!12 = !DILocalVariable(name: "height", arg: 2, scope: !6, file: !1, line: 1, type: !9)
+!13 = !DILocalVariable(name: "result", scope: !6, file: !1, line: 2, type: !9)
+!14 = !DILocation(line: 2, column: 3, scope: !6)
+!15 = !DILabel(scope: !6, name: "done", file: !1, line: 3)
+`
+
+func TestDebugIntrinsics(t *testing.T) {
+	t.Parallel()
+	code, _ := translate(t, debugNamesSource)
+	if strings.Contains(code, "dbg") {
+		t.Errorf("llvm.dbg calls aren't dropped:\n%s", numberLines(code))
+	}
+	if strings.Contains(code, "width") {
+		t.Errorf("variables are named after the C variables without -debug-names:\n%s", numberLines(code))
+	}
+	if got, want := runGo(t, code, mainCalling("area(6, 7)")), "42\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestDebugNames(t *testing.T) {
+	t.Parallel()
+	code, _ := translate(t, debugNamesSource, "-debug-names")
+	for _, s := range []string{"func area(width int32, height int32) int32 {", "result = ", "width_1 = "} {
+		if !strings.Contains(code, s) {
+			t.Errorf("generated code doesn't contain %q:\n%s", s, numberLines(code))
+		}
+	}
+	if got, want := runGo(t, code, mainCalling("area(6, 7)")), "42\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/metadata"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// ANSI escape sequences for colored diagnostics.
+const (
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[1;31m"
+	ansiGreen = "\x1b[1;32m"
+	ansiReset = "\x1b[0m"
+)
+
+// Diagnostics prints translation errors with the lines of LLVM IR (and of C
+// source code, if there is debug info) that they refer to.
+type Diagnostics struct {
+	irFile  string
+	irLines []string
+	color   bool
+
+	// sources caches the contents of C source files, split into lines. A nil
+	// entry means the file couldn't be read.
+	sources map[string][]string
+}
+
+// NewDiagnostics returns a Diagnostics for errors in the IR from irFile.
+// displayName is the name to show for the file.
+func NewDiagnostics(irFile, displayName string, color bool) *Diagnostics {
+	d := &Diagnostics{
+		irFile:  displayName,
+		color:   color,
+		sources: make(map[string][]string),
+	}
+	if data, err := ioutil.ReadFile(irFile); err == nil {
+		d.irLines = strings.Split(string(data), "\n")
+	}
+	return d
+}
+
+// UseColor reports whether diagnostics should be colored, according to the
+// value of the -color flag.
+func UseColor(mode string) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("TERM") == "dumb" || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := os.Stderr.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (d *Diagnostics) paint(code, s string) string {
+	if !d.color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// Print writes a diagnostic for e to w.
+func (d *Diagnostics) Print(w io.Writer, e *TranslationError) {
+	line := d.findIRLine(e)
+	loc := d.irFile
+	if line >= 0 {
+		loc = fmt.Sprintf("%s:%d", d.irFile, line+1)
+	}
+	where := ""
+	if e.Func != "" {
+		where = "@" + e.Func + ": "
+	}
+	fmt.Fprintf(w, "%s %s %s%v\n", d.paint(ansiBold, loc+":"), d.paint(ansiRed, "error:"), where, e.Err)
+
+	if line >= 0 {
+		d.printLine(w, d.irLines[line], -1)
+	} else if e.Source != "" {
+		fmt.Fprintf(w, "\t%s\n", strings.TrimSpace(e.Source))
+	}
+
+	if dl := debugLocation(e.node); dl != nil {
+		file := scopeFile(dl.Scope)
+		if file == nil {
+			return
+		}
+		name := sourcePath(file)
+		fmt.Fprintf(w, "%s note: from C source\n", d.paint(ansiBold, fmt.Sprintf("%s:%d:%d:", file.Filename, dl.Line, dl.Column)))
+		lines := d.sourceLines(name)
+		if dl.Line > 0 && int(dl.Line) <= len(lines) {
+			d.printLine(w, lines[dl.Line-1], int(dl.Column)-1)
+		}
+	}
+}
+
+// printLine writes a line of source code, followed by a line with a caret
+// under column col. If col is negative, the whole line is underlined.
+func (d *Diagnostics) printLine(w io.Writer, line string, col int) {
+	line = strings.Replace(line, "\t", " ", -1)
+	fmt.Fprintf(w, "    %s\n", line)
+	var marker string
+	if col < 0 {
+		start := len(line) - len(strings.TrimLeft(line, " "))
+		n := len(strings.TrimSpace(line))
+		if n == 0 {
+			return
+		}
+		marker = strings.Repeat(" ", start) + "^" + strings.Repeat("~", n-1)
+	} else {
+		if col > len(line) {
+			col = len(line)
+		}
+		marker = strings.Repeat(" ", col) + "^"
+	}
+	fmt.Fprintf(w, "    %s\n", d.paint(ansiGreen, marker))
+}
+
+func (d *Diagnostics) sourceLines(name string) []string {
+	lines, ok := d.sources[name]
+	if !ok {
+		if data, err := ioutil.ReadFile(name); err == nil {
+			lines = strings.Split(string(data), "\n")
+		}
+		d.sources[name] = lines
+	}
+	return lines
+}
+
+// findIRLine returns the (0-based) index of the line in the IR file that e
+// refers to, or -1 if it can't be found.
+func (d *Diagnostics) findIRLine(e *TranslationError) int {
+	if e.fn == nil || d.irLines == nil {
+		return -1
+	}
+	start := -1
+	for i, line := range d.irLines {
+		if strings.HasPrefix(line, "define ") && strings.Contains(line, e.fn.Ident()+"(") {
+			start = i
+			break
+		}
+	}
+	if start < 0 || e.node == nil {
+		return start
+	}
+
+	if v, ok := e.node.(value.Named); ok && !isVoid(v) {
+		prefix := v.Ident() + " = "
+		for i := start + 1; i < len(d.irLines) && d.irLines[i] != "}"; i++ {
+			if strings.HasPrefix(strings.TrimSpace(d.irLines[i]), prefix) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	want := strings.Join(strings.Fields(e.node.LLString()), " ")
+	for i := start + 1; i < len(d.irLines) && d.irLines[i] != "}"; i++ {
+		if strings.Join(strings.Fields(d.irLines[i]), " ") == want {
+			return i
+		}
+	}
+	return -1
+}
+
+func isVoid(v value.Value) bool {
+	return types.Equal(v.Type(), types.Void)
+}
+
+// debugLocation returns the !dbg location attached to an instruction or
+// terminator, or nil.
+func debugLocation(node llNode) *metadata.DILocation {
+	md, ok := node.(interface{ MDAttachments() []*metadata.Attachment })
+	if !ok {
+		return nil
+	}
+	dl, _ := attachment(ir.Metadata(md.MDAttachments()), "dbg").(*metadata.DILocation)
+	return dl
+}
+
+// panicPrefix returns the C source location of node, formatted to go at the
+// start of a panic message ("file.c:12: "), or the empty string if node has no
+// debug location.
+func panicPrefix(node llNode) string {
+	dl := debugLocation(node)
+	if dl == nil || dl.Line == 0 {
+		return ""
+	}
+	file := scopeFile(dl.Scope)
+	if file == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d: ", file.Filename, dl.Line)
+}
+
+// sourcePath returns the path of a source file named in debug info.
+func sourcePath(file *metadata.DIFile) string {
+	name := file.Filename
+	if !filepath.IsAbs(name) && file.Directory != "" {
+		name = filepath.Join(file.Directory, name)
+	}
+	return name
+}
+
+// scopeFile returns the source file of a debug scope.
+func scopeFile(scope metadata.Field) *metadata.DIFile {
+	for i := 0; i < 100 && scope != nil; i++ {
+		switch s := scope.(type) {
+		case *metadata.DIFile:
+			return s
+		case *metadata.DISubprogram:
+			return s.File
+		case *metadata.DILexicalBlock:
+			if s.File != nil {
+				return s.File
+			}
+			scope = s.Scope
+		case *metadata.DILexicalBlockFile:
+			if s.File != nil {
+				return s.File
+			}
+			scope = s.Scope
+		default:
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const diagnosticsSource = `define i32 @f(i32 %x) !dbg !6 {
+  %y = add i32 %x, 1, !dbg !10
+  %a = alloca <vscale x 4 x i32>, !dbg !11
+  ret i32 %y, !dbg !11
+}
+
+!llvm.dbg.cu = !{!0}
+!llvm.module.flags = !{!3, !4}
+
+!0 = distinct !DICompileUnit(language: DW_LANG_C99, file: !1, producer: "clang", isOptimized: false, runtimeVersion: 0, emissionKind: FullDebug, enums: !2)
+!1 = !DIFile(filename: "f.c", directory: "")
+!2 = !{}
+!3 = !{i32 2, !"Dwarf Version", i32 4}
+!4 = !{i32 2, !"Debug Info Version", i32 3}
+!6 = distinct !DISubprogram(name: "f", scope: !1, file: !1, line: 1, type: !7, scopeLine: 1, flags: DIFlagPrototyped, spFlags: DISPFlagDefinition, unit: !0, retainedNodes: !2)
+!7 = !DISubroutineType(types: !8)
+!8 = !{!9, !9}
+!9 = !DIBasicType(name: "int", size: 32, encoding: DW_ATE_signed)
+!10 = !DILocation(line: 2, column: 12, scope: !6)
+!11 = !DILocation(line: 3, column: 5, scope: !6)
+`
+
+const diagnosticsC = `int f(int x) {
+	int y = x + 1;
+	svint32_t a;
+	return y;
+}
+`
+
+func TestDiagnostics(t *testing.T) {
+	t.Parallel()
+	code, output, ok := runLeaven(t, diagnosticsSource, map[string]string{"f.c": diagnosticsC}, "-color=never")
+	if ok {
+		t.Fatal("leaven succeeded; want an error")
+	}
+	for _, s := range []string{
+		"test.ll:3: error: @f: ",
+		"\n      %a = alloca <vscale x 4 x i32>, !dbg !11\n      ^~~~~",
+		"\nf.c:3:5: note: from C source\n     svint32_t a;\n        ^\n",
+	} {
+		if !strings.Contains(output, s) {
+			t.Errorf("diagnostics don't contain %q:\n%s", s, output)
+		}
+	}
+	if strings.Contains(output, "\x1b[") {
+		t.Errorf("diagnostics are colored with -color=never:\n%s", output)
+	}
+
+	_, output, _ = runLeaven(t, diagnosticsSource, nil, "-color=always")
+	if !strings.Contains(output, ansiRed+"error:"+ansiReset) {
+		t.Errorf("diagnostics aren't colored with -color=always:\n%s", output)
+	}
+
+	// The panic for the untranslated instruction gives the C source location.
+	got := runGo(t, code, `package main
+
+import "fmt"
+
+func main() {
+	defer func() {
+		fmt.Println(recover())
+	}()
+	f(1)
+}
+`)
+	if want := "f.c:3: untranslated: %a = alloca <vscale x 4 x i32>, !dbg !11\n"; got != want {
+		t.Errorf("output: %q, want %q", got, want)
+	}
+}
+
+func TestPanicLocations(t *testing.T) {
+	t.Parallel()
+	src := `@.str = private constant [6 x i8] c"x > 0\00"
+@.file = private constant [4 x i8] c"g.c\00"
+@.func = private constant [2 x i8] c"g\00"
+
+declare void @__assert_fail(i8*, i8*, i32, i8*)
+
+define i32 @g(i32 %x, i32* %p) !dbg !6 {
+  %pos = icmp sgt i32 %x, 0, !dbg !10
+  br i1 %pos, label %ok, label %fail, !dbg !10
+
+fail:
+  call void @__assert_fail(i8* getelementptr ([6 x i8], [6 x i8]* @.str, i64 0, i64 0), i8* getelementptr ([4 x i8], [4 x i8]* @.file, i64 0, i64 0), i32 2, i8* getelementptr ([2 x i8], [2 x i8]* @.func, i64 0, i64 0)), !dbg !10
+  unreachable, !dbg !10
+
+ok:
+  %big = icmp sgt i32 %x, 100, !dbg !11
+  br i1 %big, label %never, label %load, !dbg !11
+
+never:
+  unreachable, !dbg !11
+
+load:
+  %y = load i32, i32* %p, !dbg !12
+  %z = add nsw i32 %y, %x, !dbg !13
+  ret i32 %z, !dbg !13
+}
+
+!llvm.dbg.cu = !{!0}
+!llvm.module.flags = !{!3, !4}
+
+!0 = distinct !DICompileUnit(language: DW_LANG_C99, file: !1, producer: "clang", isOptimized: false, runtimeVersion: 0, emissionKind: FullDebug, enums: !2)
+!1 = !DIFile(filename: "g.c", directory: "")
+!2 = !{}
+!3 = !{i32 2, !"Dwarf Version", i32 4}
+!4 = !{i32 2, !"Debug Info Version", i32 3}
+!6 = distinct !DISubprogram(name: "g", scope: !1, file: !1, line: 1, type: !7, scopeLine: 1, flags: DIFlagPrototyped, spFlags: DISPFlagDefinition, unit: !0, retainedNodes: !2)
+!7 = !DISubroutineType(types: !8)
+!8 = !{!9, !9}
+!9 = !DIBasicType(name: "int", size: 32, encoding: DW_ATE_signed)
+!10 = !DILocation(line: 2, column: 2, scope: !6)
+!11 = !DILocation(line: 3, column: 2, scope: !6)
+!12 = !DILocation(line: 4, column: 10, scope: !6)
+!13 = !DILocation(line: 5, column: 11, scope: !6)
+`
+	mainSrc := `package main
+
+import "fmt"
+
+func try(f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+		}
+	}()
+	f()
+}
+
+func main() {
+	x := int32(5)
+	try(func() { fmt.Println(g(1, &x)) })
+	try(func() { fmt.Println(g(0, &x)) })
+	try(func() { fmt.Println(g(101, &x)) })
+	try(func() { fmt.Println(g(1, nil)) })
+	big := int32(2147483647)
+	try(func() { fmt.Println(g(1, &big)) })
+}
+`
+	want := `6
+g.c:2: g: assertion failed: x > 0
+g.c:3: unreachable code reached
+g.c:4: load from nil pointer
+g.c:5: signed overflow in add
+`
+	checkProgram(t, src, mainSrc, want, "-ub-checks")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/metadata"
+	"github.com/llir/llvm/ir/value"
+)
+
+// An Enum is a C enumeration type recovered from the debug metadata.
+type Enum struct {
+	Name        string
+	Enumerators []Enumerator
+
+	// byValue maps values to enumerator names. If several enumerators have
+	// the same value, the first one is used.
+	byValue map[int64]string
+}
+
+// An Enumerator is one of the named constants of an Enum.
+type Enumerator struct {
+	Name  string // the Go name
+	Value int64
+}
+
+// Enums lists the enumeration types in the module, in the order they appear
+// in the metadata.
+var Enums []*Enum
+
+var enumsByType = make(map[*metadata.DICompositeType]*Enum)
+
+// CollectEnums fills in Enums from the debug metadata in m, and chooses Go
+// names for the enumerators.
+func CollectEnums(m *ir.Module) {
+	for _, md := range m.MetadataDefs {
+		ct, ok := md.(*metadata.DICompositeType)
+		if !ok || ct.Tag != enum.DwarfTagEnumerationType || ct.Elements == nil {
+			continue
+		}
+		e := &Enum{
+			Name:    ct.Name,
+			byValue: make(map[int64]string),
+		}
+		for _, f := range ct.Elements.Fields {
+			de, ok := f.(*metadata.DIEnumerator)
+			if !ok {
+				continue
+			}
+			name := packageScope.unique(valueName(de.Name))
+			e.Enumerators = append(e.Enumerators, Enumerator{Name: name, Value: de.Value})
+			if _, ok := e.byValue[de.Value]; !ok {
+				e.byValue[de.Value] = name
+			}
+		}
+		Enums = append(Enums, e)
+		enumsByType[ct] = e
+	}
+}
+
+// EnumDecls returns the constant declarations for the enums in the module.
+func EnumDecls() string {
+	b := new(bytes.Buffer)
+	for _, e := range Enums {
+		if len(e.Enumerators) == 0 {
+			continue
+		}
+		if e.Name != "" {
+			fmt.Fprintf(b, "// enum %s\n", e.Name)
+		}
+		b.WriteString("const (\n")
+		for _, c := range e.Enumerators {
+			fmt.Fprintf(b, "\t%s = %d\n", c.Name, c.Value)
+		}
+		b.WriteString(")\n\n")
+	}
+	return b.String()
+}
+
+// enumOf returns the enumeration type of v, or nil if v is not known to have
+// one.
+func enumOf(v value.Value) *Enum {
+	t, ok := valueDITypes[v]
+	if !ok {
+		return nil
+	}
+	ct, ok := underlyingDIType(t).(*metadata.DICompositeType)
+	if !ok {
+		return nil
+	}
+	return enumsByType[ct]
+}
+
+// FormatEnumValue formats c, which is being compared with v. If v is of an
+// enumeration type that has an enumerator with the value of c, it returns the
+// enumerator's name. Otherwise it formats c like FormatValue.
+func FormatEnumValue(c value.Value, v value.Value) (string, error) {
+	if ci, ok := c.(*constant.Int); ok && ci.X.IsInt64() {
+		if e := enumOf(v); e != nil {
+			if name, ok := e.byValue[ci.X.Int64()]; ok {
+				return name, nil
+			}
+		}
+	}
+	return FormatValue(c)
+}
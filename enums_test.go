@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const enumSource = `
+define i32 @is_green(i32 %c) !dbg !6 {
+  %r = icmp eq i32 %c, 1
+  %z = zext i1 %r to i32
+  ret i32 %z
+}
+
+define i32 @weight(i32 %c) !dbg !15 {
+  switch i32 %c, label %other [
+    i32 0, label %red
+    i32 2, label %blue
+  ]
+
+red:
+  ret i32 10
+
+blue:
+  ret i32 30
+
+other:
+  ret i32 0
+}
+
+!llvm.dbg.cu = !{!0}
+!llvm.module.flags = !{!3, !4}
+
+!0 = distinct !DICompileUnit(language: DW_LANG_C99, file: !1, producer: "clang", isOptimized: false, runtimeVersion: 0, emissionKind: FullDebug, enums: !10)
+!1 = !DIFile(filename: "color.c", directory: "/tmp")
+!2 = !{}
+!3 = !{i32 2, !"Dwarf Version", i32 4}
+!4 = !{i32 2, !"Debug Info Version", i32 3}
+!6 = distinct !DISubprogram(name: "is_green", scope: !1, file: !1, line: 3, type: !7, scopeLine: 3, flags: DIFlagPrototyped, spFlags: DISPFlagDefinition, unit: !0, retainedNodes: !2)
+!7 = !DISubroutineType(types: !8)
+!8 = !{!9, !11}
+!9 = !DIBasicType(name: "int", size: 32, encoding: DW_ATE_signed)
+!10 = !{!11}
+!11 = !DICompositeType(tag: DW_TAG_enumeration_type, name: "color", file: !1, line: 1, baseType: !12, size: 32, elements: !13)
+!12 = !DIBasicType(name: "unsigned int", size: 32, encoding: DW_ATE_unsigned)
+!13 = !{!14, !16, !17}
+!14 = !DIEnumerator(name: "RED", value: 0, isUnsigned: true)
+!15 = distinct !DISubprogram(name: "weight", scope: !1, file: !1, line: 4, type: !7, scopeLine: 4, flags: DIFlagPrototyped, spFlags: DISPFlagDefinition, unit: !0, retainedNodes: !2)
+!16 = !DIEnumerator(name: "GREEN", value: 1, isUnsigned: true)
+!17 = !DIEnumerator(name: "BLUE", value: 2, isUnsigned: true)
+`
+
+func TestEnums(t *testing.T) {
+	t.Parallel()
+	code, _ := translate(t, enumSource)
+	for _, s := range []string{"// enum color\nconst (\n\tRED = 0\n\tGREEN = 1\n\tBLUE = 2\n)", "c == GREEN", "case RED:", "case BLUE:"} {
+		if !strings.Contains(code, s) {
+			t.Errorf("generated code doesn't contain %q:\n%s", s, numberLines(code))
+		}
+	}
+	got := runGo(t, code, mainCalling("is_green(GREEN), is_green(RED)", "weight(RED), weight(GREEN), weight(BLUE)"))
+	want := "1 0\n10 0 30\n"
+	if got != want {
+		t.Errorf("output:\n%s\nwant:\n%s\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+)
+
+// A TranslationError describes a part of the module that could not be
+// translated.
+type TranslationError struct {
+	// Func is the name of the function being translated, or the empty string
+	// for module-level definitions.
+	Func string
+
+	// Source is the LLVM assembly of whatever failed to translate.
+	Source string
+
+	Err error
+
+	// fn and node are the function and the instruction or terminator that
+	// failed, if known. They are used to find the source lines to show in
+	// diagnostics.
+	fn   *ir.Func
+	node llNode
+}
+
+// An llNode is an instruction or terminator.
+type llNode interface {
+	LLString() string
+}
+
+func (e *TranslationError) Error() string {
+	if e.Func == "" {
+		return fmt.Sprintf("%s: %v", e.Source, e.Err)
+	}
+	return fmt.Sprintf("@%s: %s: %v", e.Func, e.Source, e.Err)
+}
+
+// An ErrorList collects the errors encountered while translating a module, so
+// that they can be reported together at the end of the run instead of stopping
+// at the first one.
+type ErrorList []*TranslationError
+
+// Add appends an error to the list.
+func (l *ErrorList) Add(funcName, source string, err error) {
+	*l = append(*l, &TranslationError{
+		Func:   funcName,
+		Source: source,
+		Err:    err,
+	})
+}
+
+// AddAt appends an error about node, which is an instruction or terminator in
+// f, to the list. If node is nil, the error is about f as a whole.
+func (l *ErrorList) AddAt(f *ir.Func, node llNode, err error) {
+	e := &TranslationError{
+		Func: f.Name(),
+		Err:  err,
+		fn:   f,
+		node: node,
+	}
+	if node != nil {
+		e.Source = node.LLString()
+	} else {
+		e.Source = "function " + f.Ident()
+	}
+	*l = append(*l, e)
+}
+
+// failed reports whether l already has an error about node.
+func (l ErrorList) failed(node llNode) bool {
+	for _, e := range l {
+		if e.node == node {
+			return true
+		}
+	}
+	return false
+}
+
+// Report writes a summary of the errors in l to w. If d is not nil, it is
+// used to show the source lines where the errors occurred.
+func (l ErrorList) Report(w io.Writer, d *Diagnostics) {
+	if len(l) == 0 {
+		return
+	}
+	funcs := make(map[string]bool)
+	for _, e := range l {
+		if d != nil {
+			d.Print(w, e)
+		} else {
+			fmt.Fprintln(w, e)
+		}
+		if e.Func != "" {
+			funcs[e.Func] = true
+		}
+	}
+	fmt.Fprintf(w, "%d errors (in %d functions)\n", len(l), len(funcs))
+}
+
+// Warnings holds messages about parts of the module that were translated, but
+// not faithfully. They are printed after the module has been translated.
+var Warnings []string
+
+// currentFunc is the function whose body is being translated, so that
+// instructions can be warned about.
+var currentFunc *ir.Func
+
+// Warn adds a warning about node, which is an instruction or terminator in f.
+func Warn(f *ir.Func, node llNode, msg string) {
+	Warnings = append(Warnings, fmt.Sprintf("@%s: %s: %s", f.Name(), strings.Join(strings.Fields(node.LLString()), " "), msg))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const partlyUnsupported = `
+define i32 @good(i32 %x) {
+  %y = add i32 %x, 1
+  ret i32 %y
+}
+
+define void @bad1() {
+  %a = alloca <vscale x 4 x i32>
+  ret void
+}
+
+define i32 @bad2(i32 %x) {
+  %a = alloca <vscale x 2 x i64>
+  ret i32 %x
+}
+`
+
+func TestErrorsCollected(t *testing.T) {
+	t.Parallel()
+	code, output, ok := runLeaven(t, partlyUnsupported, nil, "-color=never")
+	if ok {
+		t.Fatal("leaven succeeded; want an error")
+	}
+	if !strings.Contains(output, "2 errors (in 2 functions)") {
+		t.Errorf("output doesn't count both errors:\n%s", output)
+	}
+	for _, name := range []string{"@bad1", "@bad2"} {
+		if !strings.Contains(output, name) {
+			t.Errorf("output doesn't mention %s:\n%s", name, output)
+		}
+	}
+
+	// The rest of the module is still translated, and the stand-ins for the
+	// untranslated instructions panic when they are reached.
+	got := runGo(t, code, `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(good(41))
+	defer func() {
+		fmt.Println(recover())
+	}()
+	bad2(1)
+}
+`)
+	want := "42\nuntranslated: %a = alloca <vscale x 2 x i64>\n"
+	if got != want {
+		t.Errorf("output:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// LLVM's exceptions are translated to Go panics. An invoke instruction
+// becomes a call wrapped in libc.Invoke, which recovers from a panic and
+// returns a pointer standing for it. That pointer becomes the first field of
+// the landing pad's value (and the selector, in the second field, is 0, since
+// a Go panic doesn't match any of the C++ catch clauses); resume uses it to
+// panic again with the same value. The type IDs that selectors are compared
+// with (from llvm.eh.typeid.for) are positive, so the code for a catch
+// clause with a type is skipped, but a catch-all clause catches the panic.
+//
+// Throwing a C++ exception (__cxa_throw and its relatives) is left to the
+// runtime library that the translated code is linked with.
+
+// exceptionDest returns the variable that receives the exception pointer when
+// an exception unwinds to block b, and any statement needed to finish
+// setting up the value of the pad that b starts with. The pad may be a
+// landingpad, or one of the pads used for Windows exceptions.
+func exceptionDest(b value.Value) (dest, setup string, err error) {
+	block, ok := b.(*ir.Block)
+	if !ok {
+		return "", "", fmt.Errorf("unwind destination is not a block: %v", b)
+	}
+	for _, inst := range block.Insts {
+		switch inst := inst.(type) {
+		case *ir.InstPhi:
+			continue
+		case *ir.InstLandingPad:
+			if err := checkLandingPadType(inst.Type()); err != nil {
+				return "", "", err
+			}
+			return VariableName(inst) + ".F0", VariableName(inst) + ".F1 = 0", nil
+		case *ir.InstCleanupPad:
+			return VariableName(inst), "", nil
+		}
+		return "", "", fmt.Errorf("unwind destination %s doesn't start with an exception pad", block.Ident())
+	}
+	if cs, ok := block.Term.(*ir.TermCatchSwitch); ok {
+		return VariableName(cs), "", nil
+	}
+	return "", "", fmt.Errorf("unwind destination %s doesn't start with an exception pad", block.Ident())
+}
+
+// unwind writes the statements that pass the exception pointer exc to the
+// pad at the start of block to, and branch there from block from.
+func unwind(out io.Writer, from, to value.Value, exc, indent string) error {
+	dest, setup, err := exceptionDest(to)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s%s = %s\n", indent, dest, exc)
+	if setup != "" {
+		fmt.Fprintf(out, "%s%s\n", indent, setup)
+	}
+	return branch(out, from, to, indent)
+}
+
+// checkLandingPadType returns an error if t is not the { i8*, i32 } that
+// landing pads get their values as.
+func checkLandingPadType(t types.Type) error {
+	st, ok := t.(*types.StructType)
+	if ok && len(st.Fields) == 2 && types.Equal(st.Fields[0], types.I8Ptr) && types.Equal(st.Fields[1], types.I32) {
+		return nil
+	}
+	return fmt.Errorf("unsupported type for landing pad: %v", t)
+}
+
+// translateInvoke writes the translation of term, which is the terminator of
+// block b.
+func translateInvoke(out io.Writer, b *ir.Block, term *ir.TermInvoke) error {
+	if arenaMode() {
+		return fmt.Errorf("exceptions aren't supported with -memory=arena")
+	}
+	dest, setup, err := exceptionDest(term.ExceptionRetTarget)
+	if err != nil {
+		return err
+	}
+
+	// Translate the call as if it were a call instruction with the same
+	// result.
+	call := ir.NewCall(term.Invokee, term.Args...)
+	call.CallingConv = term.CallingConv
+	call.FuncAttrs = term.FuncAttrs
+	call.Metadata = term.Metadata
+	valueNames[call] = VariableName(term)
+	stmt, err := TranslateInstruction(call)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\tif %s = libc.Invoke(func() { %s }); %s != nil {\n", dest, stmt, dest)
+	if setup != "" {
+		fmt.Fprintf(out, "\t\t%s\n", setup)
+	}
+	if err := branch(out, b, term.ExceptionRetTarget, "\t\t"); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "\t}")
+	return branch(out, b, term.NormalRetTarget, "\t")
+}
+
+// translateResume translates a resume instruction.
+func translateResume(term *ir.TermResume) (string, error) {
+	if err := checkLandingPadType(term.X.Type()); err != nil {
+		return "", err
+	}
+	x, err := FormatValue(term.X)
+	if err != nil {
+		return "", fmt.Errorf("error translating exception (%v): %v", term.X, err)
+	}
+	return fmt.Sprintf("\tpanic(libc.PanicValue(%s.F0))\n", parenthesize(x)), nil
+}
+
+// typeIDs holds the numbers that llvm.eh.typeid.for returns, keyed by the
+// type info value.
+var typeIDs = make(map[string]int)
+
+// EHIntrinsic translates calls to llvm.eh.typeid.for. Each type info gets a
+// different type ID, starting from 1. If name is not llvm.eh.typeid.for, it
+// returns ok == false.
+func EHIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	if name != "llvm.eh.typeid.for" && !strings.HasPrefix(name, "llvm.eh.typeid.for.") {
+		return "", false, nil
+	}
+	if len(inst.Args) != 1 {
+		return "", true, fmt.Errorf("wrong number of arguments to %s: %d", name, len(inst.Args))
+	}
+	// The argument is usually a global, or a bitcast of one, so its
+	// translation identifies the type.
+	ti, err := FormatValue(inst.Args[0])
+	if err != nil {
+		return "", true, fmt.Errorf("error translating type info (%v): %v", inst.Args[0], err)
+	}
+	id, ok := typeIDs[ti]
+	if !ok {
+		id = len(typeIDs) + 1
+		typeIDs[ti] = id
+	}
+	return fmt.Sprintf("%s = %d", VariableName(inst), id), true, nil
+}
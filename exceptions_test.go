@@ -0,0 +1,188 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const invokeSource = `
+@cleanups = global i32 0
+
+declare i32 @mayThrow(i32)
+declare i32 @__gxx_personality_v0(...)
+
+; twice calls mayThrow twice, counting the cleanups that run when it panics.
+define i32 @twice(i32 %x) personality i32 (...)* @__gxx_personality_v0 {
+entry:
+  %a = invoke i32 @mayThrow(i32 %x)
+          to label %next unwind label %cleanup
+
+next:
+  %y = add i32 %x, 1
+  %b = invoke i32 @mayThrow(i32 %y)
+          to label %done unwind label %cleanup
+
+done:
+  %r = add i32 %a, %b
+  ret i32 %r
+
+cleanup:
+  %lp = landingpad { i8*, i32 }
+          cleanup
+  %n = load i32, i32* @cleanups
+  %n1 = add i32 %n, 1
+  store i32 %n1, i32* @cleanups
+  resume { i8*, i32 } %lp
+}
+
+; caught returns -1 instead of unwinding past it.
+define i32 @caught(i32 %x) personality i32 (...)* @__gxx_personality_v0 {
+entry:
+  %a = invoke i32 @twice(i32 %x)
+          to label %done unwind label %catch
+
+done:
+  ret i32 %a
+
+catch:
+  %lp = landingpad { i8*, i32 }
+          catch i8* null
+  ret i32 -1
+}
+`
+
+func TestInvoke(t *testing.T) {
+	t.Parallel()
+	mainSrc := `package main
+
+import "fmt"
+
+// mayThrow panics if x is 3.
+func mayThrow(x int32) int32 {
+	if x == 3 {
+		panic(fmt.Sprint("thrown ", x))
+	}
+	return x * 10
+}
+
+func main() {
+	fmt.Println(twice(5), cleanups)
+	fmt.Println(caught(2), cleanups)
+	fmt.Println(caught(3), cleanups)
+	defer func() {
+		fmt.Println(recover(), cleanups)
+	}()
+	twice(2)
+}
+`
+	checkProgram(t, invokeSource, mainSrc, "110 0\n-1 1\n-1 2\nthrown 3 3\n")
+}
+
+func TestInvokeErrors(t *testing.T) {
+	t.Parallel()
+	src := `
+declare void @f()
+declare i32 @__gxx_personality_v0(...)
+
+define void @g() personality i32 (...)* @__gxx_personality_v0 {
+entry:
+  invoke void @f()
+          to label %done unwind label %lpad
+
+done:
+  ret void
+
+lpad:
+  %lp = landingpad { i8*, i64 }
+          cleanup
+  ret void
+}
+`
+	output := translateError(t, src, "-color=never")
+	if !strings.Contains(output, "unsupported type for landing pad") {
+		t.Errorf("output doesn't mention the landing pad type:\n%s", output)
+	}
+
+	output = translateError(t, invokeSource, "-color=never", "-memory=arena")
+	if !strings.Contains(output, "exceptions aren't supported with -memory=arena") {
+		t.Errorf("output doesn't mention -memory=arena:\n%s", output)
+	}
+}
+
+func TestTypeIDs(t *testing.T) {
+	t.Parallel()
+	src := `
+@_ZTIi = external constant i8*
+@_ZTIPKc = external constant i8*
+
+declare i32 @mayThrow(i32)
+declare i32 @__gxx_personality_v0(...)
+declare i32 @llvm.eh.typeid.for(i8*)
+
+; handle is try { mayThrow(x) } catch (int) { return 1; }
+; catch (const char *) { return 2; } catch (...) { return 3; }
+define i32 @handle(i32 %x) personality i32 (...)* @__gxx_personality_v0 {
+entry:
+  %r = invoke i32 @mayThrow(i32 %x)
+          to label %ok unwind label %lpad
+
+ok:
+  ret i32 %r
+
+lpad:
+  %lp = landingpad { i8*, i32 }
+          catch i8* bitcast (i8** @_ZTIi to i8*)
+          catch i8* bitcast (i8** @_ZTIPKc to i8*)
+          catch i8* null
+  %sel = extractvalue { i8*, i32 } %lp, 1
+  %int = call i32 @llvm.eh.typeid.for(i8* bitcast (i8** @_ZTIi to i8*))
+  %isInt = icmp eq i32 %sel, %int
+  br i1 %isInt, label %catchInt, label %next
+
+next:
+  %str = call i32 @llvm.eh.typeid.for(i8* bitcast (i8** @_ZTIPKc to i8*))
+  %isStr = icmp eq i32 %sel, %str
+  br i1 %isStr, label %catchStr, label %catchAll
+
+catchInt:
+  ret i32 1
+
+catchStr:
+  ret i32 2
+
+catchAll:
+  ret i32 3
+}
+
+define i32 @ids() {
+  %a = call i32 @llvm.eh.typeid.for(i8* bitcast (i8** @_ZTIi to i8*))
+  %b = call i32 @llvm.eh.typeid.for(i8* bitcast (i8** @_ZTIPKc to i8*))
+  %c = call i32 @llvm.eh.typeid.for(i8* bitcast (i8** @_ZTIi to i8*))
+  %ab = mul i32 %a, 100
+  %abc = add i32 %ab, %b
+  %abc1 = mul i32 %abc, 10
+  %r = add i32 %abc1, %c
+  ret i32 %r
+}
+`
+	mainSrc := `package main
+
+import "fmt"
+
+var _ZTIi, _ZTIPKc *byte
+
+func mayThrow(x int32) int32 {
+	if x == 3 {
+		panic(x)
+	}
+	return x * 10
+}
+
+func main() {
+	// A Go panic is only caught by the catch-all clause.
+	fmt.Println(handle(1), handle(3))
+	fmt.Println(ids())
+}
+`
+	checkProgram(t, src, mainSrc, "10 3\n1021\n")
+}
@@ -44,6 +44,15 @@ func GetElementPtr(elemType types.Type, src value.Value, indices []value.Value)
 	}
 	result := source
 
+	if !zeroFirstIndex && *noUnsafe && len(indices) == 1 && types.Equal(elemType, types.I8) && !negativeFirstIndex {
+		// Index into a byte slice instead of doing pointer arithmetic.
+		index, err := FormatValue(indices[0])
+		if err != nil {
+			return "", fmt.Errorf("error translating index (%v): %v", indices[0], err)
+		}
+		return fmt.Sprintf("&libc.ByteSlice(%s, int(%s)+1)[%s]", source, index, index), nil
+	}
+
 	if !zeroFirstIndex {
 		firstIndex, err := FormatValue(indices[0])
 		if err != nil {
@@ -87,8 +96,21 @@ func GetElementPtr(elemType types.Type, src value.Value, indices []value.Value)
 			if !ok {
 				return "", fmt.Errorf("non-constant index into struct: %v %T", index, index)
 			}
-			result = fmt.Sprintf("%s.F%v", result, ci.X)
-			currentType = ct.Fields[ci.X.Int64()]
+			i := int(ci.X.Int64())
+			if i < 0 || i >= len(ct.Fields) {
+				return "", fmt.Errorf("index %d out of range for %v", i, ct)
+			}
+			currentType = ct.Fields[i]
+			if isMisaligned(ct, i) {
+				// The pointer conversion gives the address already.
+				result, err = misalignedFieldPointer(result, ct, i)
+				if err != nil {
+					return "", err
+				}
+				takeAddress = false
+				break
+			}
+			result = fmt.Sprintf("%s.F%d", result, i)
 			takeAddress = true
 
 		default:
@@ -102,3 +124,122 @@ func GetElementPtr(elemType types.Type, src value.Value, indices []value.Value)
 
 	return result, nil
 }
+
+// IntToPtr returns an expression that converts the integer from to the
+// pointer type to. Like inttoptr, it zero-extends an integer that is narrower
+// than a pointer. The address must not point into the Go heap, since the
+// garbage collector doesn't see an address held as an integer.
+func IntToPtr(from value.Value, to types.Type) (string, error) {
+	if c, ok := from.(*constant.Int); ok && c.X.Sign() == 0 && !arenaMode() {
+		return "nil", nil
+	}
+	// Converting the unsigned value to uintptr zero-extends it.
+	x, err := FormatUnsigned(from)
+	if err != nil {
+		return "", fmt.Errorf("error translating source (%v): %v", from, err)
+	}
+	if arenaMode() {
+		return fmt.Sprintf("uintptr(%s)", x), nil
+	}
+	t, err := TypeSpec(to)
+	if err != nil {
+		return "", fmt.Errorf("error translating type (%v): %v", to, err)
+	}
+	if isFuncPointer(to) {
+		return fmt.Sprintf("*(*%s)(libc.PointerCell(unsafe.Pointer(uintptr(%s))))", t, x), nil
+	}
+	return fmt.Sprintf("(%s)(unsafe.Pointer(uintptr(%s)))", t, x), nil
+}
+
+// foreignAddrSpaces describes the address spaces whose pointers can't be
+// treated as ordinary pointers in Go. Pointers in other address spaces are
+// assumed to point into the same memory as address space 0 (as those used by
+// garbage-collected frontends do).
+var foreignAddrSpaces = map[types.AddrSpace]string{
+	256: "the x86 GS segment",
+	257: "the x86 FS segment",
+	258: "the x86 SS segment",
+	270: "for 32-bit sign-extended pointers (__ptr32 __sptr)",
+	271: "for 32-bit zero-extended pointers (__ptr32 __uptr)",
+	272: "for 64-bit pointers (__ptr64)",
+}
+
+// AddrSpaceCast returns an expression that converts the pointer from to the
+// pointer type to, which is in a different address space.
+func AddrSpaceCast(from value.Value, to types.Type) (string, error) {
+	fromType, ok := from.Type().(*types.PointerType)
+	if !ok {
+		return "", fmt.Errorf("unsupported source type for addrspacecast: %v", from.Type())
+	}
+	toType, ok := to.(*types.PointerType)
+	if !ok {
+		return "", fmt.Errorf("unsupported destination type for addrspacecast: %v", to)
+	}
+	for _, as := range []types.AddrSpace{fromType.AddrSpace, toType.AddrSpace} {
+		if desc, ok := foreignAddrSpaces[as]; ok {
+			return "", fmt.Errorf("can't cast from address space %d to %d: address space %d is %s", fromType.AddrSpace, toType.AddrSpace, as, desc)
+		}
+	}
+
+	x, err := FormatValue(from)
+	if err != nil {
+		return "", fmt.Errorf("error translating source (%v): %v", from, err)
+	}
+	if arenaMode() {
+		return x, nil
+	}
+	ft, err := TypeSpec(fromType)
+	if err != nil {
+		return "", fmt.Errorf("error translating type (%v): %v", fromType, err)
+	}
+	t, err := TypeSpec(toType)
+	if err != nil {
+		return "", fmt.Errorf("error translating type (%v): %v", to, err)
+	}
+	if ft == t {
+		// The Go types don't record the address space.
+		return x, nil
+	}
+	if types.IsFunc(fromType.ElemType) || types.IsFunc(toType.ElemType) {
+		return "", fmt.Errorf("can't cast between function and data pointers (%v to %v)", fromType, toType)
+	}
+	return fmt.Sprintf("(%s)(unsafe.Pointer(%s))", t, x), nil
+}
+
+// AggregateElement returns an expression for the value at indices in x (an
+// aggregate of type t, as used by extractvalue and insertvalue), like
+// x.F1[2], and the type of that value. If the path goes through a misaligned
+// field of a packed struct, x must be addressable.
+func AggregateElement(x string, t types.Type, indices []uint64) (string, types.Type, error) {
+	// If deref is true, x is a pointer to the value, rather than the value
+	// itself. (Selectors and indexes work the same either way.)
+	deref := false
+	for _, index := range indices {
+		switch ct := t.(type) {
+		case *types.StructType:
+			if index >= uint64(len(ct.Fields)) {
+				return "", nil, fmt.Errorf("index %d out of range for %v", index, t)
+			}
+			t = ct.Fields[index]
+			if isMisaligned(ct, int(index)) {
+				p, err := misalignedFieldPointer(x, ct, int(index))
+				if err != nil {
+					return "", nil, err
+				}
+				x, deref = p, true
+				continue
+			}
+			x = fmt.Sprintf("%s.F%d", x, index)
+		case *types.ArrayType:
+			x = fmt.Sprintf("%s[%d]", x, index)
+			t = ct.ElemType
+		default:
+			return "", nil, fmt.Errorf("unsupported type to index into: %v", t)
+		}
+		deref = false
+	}
+	if deref {
+		x = "*" + x
+	}
+	return x, t, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddrSpaceCast(t *testing.T) {
+	t.Parallel()
+	src := `
+@counter = global i32 5
+
+define i32 @readVia1() {
+  %p = addrspacecast i32* @counter to i32 addrspace(1)*
+  %v = load i32, i32 addrspace(1)* %p
+  ret i32 %v
+}
+
+define i32 @readVia1Const() {
+  %v = load i32, i32 addrspace(1)* addrspacecast (i32* @counter to i32 addrspace(1)*)
+  ret i32 %v
+}
+
+define i8 @firstByte(i32 addrspace(1)* %p) {
+  %q = addrspacecast i32 addrspace(1)* %p to i8*
+  %b = load i8, i8* %q
+  ret i8 %b
+}
+`
+	checkProgram(t, src, mainCalling("readVia1()", "readVia1Const()", "firstByte(&counter)"), "5\n5\n5\n")
+
+	for _, c := range []struct{ as, want string }{
+		{"256", "address space 256 is the x86 GS segment"},
+		{"271", "address space 271 is for 32-bit zero-extended pointers"},
+	} {
+		output := translateError(t, `
+define i32 @seg(i32 addrspace(`+c.as+`)* %p) {
+  %q = addrspacecast i32 addrspace(`+c.as+`)* %p to i32*
+  %v = load i32, i32* %q
+  ret i32 %v
+}
+`, "-color=never")
+		if !strings.Contains(output, c.want) {
+			t.Errorf("addrspace(%s): output doesn't contain %q:\n%s", c.as, c.want, output)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/types"
+)
+
+// With -extern-map, functions that the module declares but doesn't define can
+// be bound to existing Go functions, such as hash/crc32.ChecksumIEEE, instead
+// of a shim written for the purpose. Each line of the file gives the name of
+// the C function, the Go function (qualified by its import path), and the Go
+// function's type:
+//
+//	my_hash  hash/crc32.ChecksumIEEE  func([]byte) uint32
+//
+// leaven generates a wrapper with the C function's signature that converts
+// the arguments and result. A []byte parameter takes two C arguments (a
+// pointer and a length), a string takes a NUL-terminated char *, and an
+// error result is converted to a status code by libc.StatusCode.
+
+// An externBinding is a Go function to call in place of an external C
+// function.
+type externBinding struct {
+	Func string // the package name and function, like crc32.ChecksumIEEE
+	Type *ast.FuncType
+	Line string // where the binding came from, for error messages
+}
+
+// externBindings holds the bindings from -extern-map, keyed by the C
+// function's name as sanitized by valueName.
+var externBindings = make(map[string]externBinding)
+
+// LoadExternMap reads a file of bindings from C functions to Go functions.
+// Lines starting with # are comments.
+func LoadExternMap(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return fmt.Errorf("%s:%d: expected a C function name, a Go function, and its type", file, i+1)
+		}
+		sig := strings.Join(fields[2:], " ")
+		e, err := parser.ParseExpr(sig)
+		ft, ok := e.(*ast.FuncType)
+		if err != nil || !ok {
+			return fmt.Errorf("%s:%d: invalid function type: %s", file, i+1, sig)
+		}
+		name := valueName(fields[0])
+		AddImport(fields[1][:strings.LastIndex(fields[1], ".")])
+		externBindings[name] = externBinding{
+			Func: path.Base(fields[1]),
+			Type: ft,
+			Line: fmt.Sprintf("%s:%d", file, i+1),
+		}
+		// The binding takes precedence over leaven's own mapping.
+		delete(libraryFunctions, name)
+	}
+	return nil
+}
+
+// ExternWrappers generates the wrappers for the external functions in m that
+// have bindings, and adds them to the helper functions.
+func ExternWrappers(m *ir.Module, errs *ErrorList) {
+	for _, f := range m.Funcs {
+		if f.Blocks != nil {
+			continue
+		}
+		b, ok := externBindings[valueName(f.Name())]
+		if !ok {
+			continue
+		}
+		src, err := externWrapper(f, b)
+		if err != nil {
+			errs.Add("", f.LLString(), fmt.Errorf("error binding to %s (%s): %v", b.Func, b.Line, err))
+			continue
+		}
+		UseHelper(VariableName(f), src)
+	}
+}
+
+// externWrapper returns the source of a function with the name and signature
+// of f that calls the Go function in b.
+func externWrapper(f *ir.Func, b externBinding) (string, error) {
+	var params []string
+	for i, p := range f.Params {
+		t, err := TypeSpec(p.Type())
+		if err != nil {
+			return "", fmt.Errorf("error translating type of parameter %d (%v): %v", i, p.Type(), err)
+		}
+		params = append(params, fmt.Sprintf("p%d %s", i, t))
+	}
+	if f.Sig.Variadic {
+		return "", fmt.Errorf("can't bind a variadic function")
+	}
+
+	var args []string
+	next := 0
+	cParam := func() (string, types.Type, error) {
+		if next >= len(f.Params) {
+			return "", nil, fmt.Errorf("the C function has only %d parameters", len(f.Params))
+		}
+		next++
+		return fmt.Sprintf("p%d", next-1), f.Params[next-1].Type(), nil
+	}
+	for _, field := range b.Type.Params.List {
+		goType := exprString(field.Type)
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for j := 0; j < n; j++ {
+			p, ct, err := cParam()
+			if err != nil {
+				return "", err
+			}
+			switch goType {
+			case "string":
+				args = append(args, fmt.Sprintf("libc.GoString(%s)", p))
+			case "[]byte":
+				length, lt, err := cParam()
+				if err != nil {
+					return "", err
+				}
+				if _, ok := lt.(*types.IntType); !ok {
+					return "", fmt.Errorf("the length for a []byte parameter must be an integer, not %v", lt)
+				}
+				args = append(args, fmt.Sprintf("libc.ByteSlice(%s, int(%s))", p, length))
+			case "bool":
+				if types.Equal(ct, types.I1) {
+					args = append(args, p)
+				} else {
+					args = append(args, p+" != 0")
+				}
+			case "unsafe.Pointer":
+				args = append(args, fmt.Sprintf("unsafe.Pointer(%s)", p))
+			default:
+				cType, err := TypeSpec(ct)
+				if err != nil {
+					return "", err
+				}
+				switch {
+				case goType == cType:
+					args = append(args, p)
+				case strings.HasPrefix(goType, "*"):
+					args = append(args, fmt.Sprintf("(%s)(unsafe.Pointer(%s))", goType, p))
+				default:
+					args = append(args, fmt.Sprintf("%s(%s)", goType, p))
+				}
+			}
+		}
+	}
+	if next != len(f.Params) {
+		return "", fmt.Errorf("the Go function uses %d of the C function's %d parameters", next, len(f.Params))
+	}
+
+	call := fmt.Sprintf("%s(%s)", b.Func, strings.Join(args, ", "))
+	var results []string
+	if b.Type.Results != nil {
+		for _, field := range b.Type.Results.List {
+			n := len(field.Names)
+			if n == 0 {
+				n = 1
+			}
+			for j := 0; j < n; j++ {
+				results = append(results, exprString(field.Type))
+			}
+		}
+	}
+	if len(results) > 1 {
+		return "", fmt.Errorf("can't bind a function with %d results", len(results))
+	}
+
+	ret := ""
+	var body string
+	if types.Equal(f.Sig.RetType, types.Void) {
+		body = call
+	} else {
+		var err error
+		ret, err = TypeSpec(f.Sig.RetType)
+		if err != nil {
+			return "", fmt.Errorf("error translating return type (%v): %v", f.Sig.RetType, err)
+		}
+		ret = " " + ret
+		if len(results) == 0 {
+			return "", fmt.Errorf("the Go function has no result for the C function to return")
+		}
+		switch results[0] {
+		case "bool":
+			if types.Equal(f.Sig.RetType, types.I1) {
+				body = "return " + call
+			} else {
+				body = fmt.Sprintf("if %s {\n\t\treturn 1\n\t}\n\treturn 0", call)
+			}
+		case "string":
+			body = fmt.Sprintf("return libc.CString(%s)", call)
+		case "error":
+			body = fmt.Sprintf("return%s(libc.StatusCode(%s))", ret, call)
+			if ret == " int32" {
+				body = fmt.Sprintf("return libc.StatusCode(%s)", call)
+			}
+		case "unsafe.Pointer":
+			body = fmt.Sprintf("return (%s)(%s)", strings.TrimSpace(ret), call)
+		default:
+			switch {
+			case " "+results[0] == ret:
+				body = "return " + call
+			case strings.HasPrefix(results[0], "*"):
+				body = fmt.Sprintf("return (%s)(unsafe.Pointer(%s))", strings.TrimSpace(ret), call)
+			default:
+				body = fmt.Sprintf("return%s(%s)", ret, call)
+			}
+		}
+	}
+
+	return fmt.Sprintf("// %s calls %s.\nfunc %s(%s)%s {\n\t%s\n}\n", VariableName(f), b.Func, VariableName(f), strings.Join(params, ", "), ret, body), nil
+}
+
+// exprString returns the source code for e.
+func exprString(e ast.Expr) string {
+	b := new(bytes.Buffer)
+	printer.Fprint(b, token.NewFileSet(), e)
+	return b.String()
+}
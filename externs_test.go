@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const externMap = `# Bindings for TestExternMap.
+c_upper    strings.ToUpper  func(string) string
+c_contains strings.Contains func(s, substr string) bool
+c_count    bytes.Count      func([]byte, []byte) int
+c_chdir    os.Chdir         func(string) error
+`
+
+func TestExternMap(t *testing.T) {
+	t.Parallel()
+	src := `
+@hello = private constant [6 x i8] c"hello\00"
+@ell = private constant [4 x i8] c"ell\00"
+@missing = private constant [13 x i8] c"/nonexistent\00"
+
+declare i8* @c_upper(i8*)
+declare i32 @c_contains(i8*, i8*)
+declare i64 @c_count(i8*, i64, i8*, i64)
+declare i32 @c_chdir(i8*)
+
+define i8* @upper() {
+  %r = call i8* @c_upper(i8* getelementptr ([6 x i8], [6 x i8]* @hello, i64 0, i64 0))
+  ret i8* %r
+}
+
+define i32 @contains() {
+  %r = call i32 @c_contains(i8* getelementptr ([6 x i8], [6 x i8]* @hello, i64 0, i64 0), i8* getelementptr ([4 x i8], [4 x i8]* @ell, i64 0, i64 0))
+  ret i32 %r
+}
+
+define i64 @count() {
+  %r = call i64 @c_count(i8* getelementptr ([6 x i8], [6 x i8]* @hello, i64 0, i64 0), i64 5, i8* getelementptr ([4 x i8], [4 x i8]* @ell, i64 0, i64 2), i64 1)
+  ret i64 %r
+}
+
+define i32 @chdir() {
+  %r = call i32 @c_chdir(i8* getelementptr ([13 x i8], [13 x i8]* @missing, i64 0, i64 0))
+  ret i32 %r
+}
+`
+	code, output, ok := runLeaven(t, src, map[string]string{"extern.map": externMap}, "-extern-map=extern.map")
+	if !ok {
+		t.Fatalf("leaven failed:\n%s", output)
+	}
+	for _, s := range []string{`"bytes"`, `"os"`, `"strings"`, "// c_upper calls strings.ToUpper."} {
+		if !strings.Contains(code, s) {
+			t.Errorf("generated code doesn't contain %s:\n%s", s, numberLines(code))
+		}
+	}
+	mainSrc := `package main
+
+import (
+	"fmt"
+
+	"github.com/andybalholm/leaven/libc"
+)
+
+func main() {
+	fmt.Println(libc.GoString(upper()))
+	fmt.Println(contains(), count(), chdir())
+}
+`
+	if got, want := runGo(t, code, mainSrc), "HELLO\n1 2 -1\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestExternMapErrors(t *testing.T) {
+	t.Parallel()
+	src := `
+declare i32 @c_atoi(i8*)
+declare i32 @c_sum(i32, ...)
+
+define i32 @f() {
+  %a = call i32 @c_atoi(i8* null)
+  %b = call i32 (i32, ...) @c_sum(i32 1, i32 2)
+  %r = add i32 %a, %b
+  ret i32 %r
+}
+`
+	_, output, ok := runLeaven(t, src, map[string]string{
+		"extern.map": "c_atoi strconv.Atoi func(string) (int, error)\nc_sum fmt.Print func(...interface{}) (int, error)\n",
+	}, "-extern-map=extern.map", "-color=never")
+	if ok {
+		t.Fatal("leaven succeeded; want an error")
+	}
+	for _, s := range []string{"can't bind a function with 2 results", "can't bind a variadic function", "extern.map:1", "extern.map:2"} {
+		if !strings.Contains(output, s) {
+			t.Errorf("output doesn't contain %q:\n%s", s, output)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/types"
+)
+
+// mathIntrinsics maps the names of the floating-point intrinsics (without
+// the llvm. prefix and type suffix) to the math package functions that
+// implement them. Since LLVM code runs in the default rounding mode unless it
+// uses the constrained intrinsics, rint and nearbyint round to even. The
+// IEEE 754-2019 minimum and maximum propagate NaNs and order -0 before +0,
+// like math.Min and math.Max.
+var mathIntrinsics = map[string]string{
+	"ceil":      "math.Ceil",
+	"cos":       "math.Cos",
+	"exp":       "math.Exp",
+	"exp2":      "math.Exp2",
+	"fabs":      "math.Abs",
+	"floor":     "math.Floor",
+	"fma":       "math.FMA",
+	"log":       "math.Log",
+	"log10":     "math.Log10",
+	"log2":      "math.Log2",
+	"maximum":   "math.Max",
+	"minimum":   "math.Min",
+	"nearbyint": "math.RoundToEven",
+	"pow":       "math.Pow",
+	"powi":      "math.Pow",
+	"rint":      "math.RoundToEven",
+	"round":     "math.Round",
+	"roundeven": "math.RoundToEven",
+	"sin":       "math.Sin",
+	"sqrt":      "math.Sqrt",
+	"trunc":     "math.Trunc",
+}
+
+// MathIntrinsic translates calls to the intrinsics in mathIntrinsics, to
+// llvm.fmuladd, and to llvm.minnum and llvm.maxnum. If name is not one of
+// them, it returns ok == false.
+func MathIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	base := intrinsicBase(name)
+	fn, ok := mathIntrinsics[base]
+	if !ok && base != "fmuladd" && base != "minnum" && base != "maxnum" {
+		return "", false, nil
+	}
+	if len(inst.Args) == 0 {
+		return "", true, fmt.Errorf("too few arguments to %s", name)
+	}
+	t := inst.Args[0].Type()
+	vt, isVector := t.(*types.VectorType)
+	if isVector {
+		t = vt.ElemType
+	}
+	if _, ok := t.(*types.FloatType); !ok {
+		return "", true, fmt.Errorf("unsupported type for %s: %v", name, inst.Args[0].Type())
+	}
+	if _, ok := bigLongDouble(t); ok || isHalf(t) {
+		// The math package can't work with them directly.
+		return "", true, fmt.Errorf("unsupported type for %s: %v", name, inst.Args[0].Type())
+	}
+	elem, err := TypeSpec(t)
+	if err != nil {
+		return "", true, fmt.Errorf("error translating type (%v): %v", t, err)
+	}
+	r := VariableName(inst)
+
+	switch {
+	case base == "fmuladd" && len(inst.Args) != 3, (base == "minnum" || base == "maxnum") && len(inst.Args) != 2:
+		return "", true, fmt.Errorf("wrong number of arguments to %s: %d", name, len(inst.Args))
+	}
+
+	// The math package only works with float64, so the arguments are
+	// converted to float64 and the result back to float32 when necessary.
+	operands := make([]string, len(inst.Args))
+	args := make([]string, len(inst.Args))
+	for i, a := range inst.Args {
+		x, err := FormatValue(a)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating argument %d (%v): %v", i, a, err)
+		}
+		if base == "powi" && i == 1 {
+			// The exponent is an integer, and isn't a vector even when the
+			// base is.
+			args[i] = fmt.Sprintf("float64(%s)", x)
+			continue
+		}
+		if isVector {
+			x = parenthesize(x) + "[lane_i]"
+		}
+		operands[i] = x
+		args[i] = x
+		if elem != "float64" {
+			args[i] = fmt.Sprintf("float64(%s)", x)
+		}
+	}
+	if base == "minnum" || base == "maxnum" {
+		// The IEEE 754-2008 minNum and maxNum return the other operand when
+		// one of them is NaN.
+		op := "<"
+		if base == "maxnum" {
+			op = ">"
+		}
+		dest := r
+		if isVector {
+			dest = r + "[lane_i]"
+		}
+		x, y := parenthesize(operands[0]), parenthesize(operands[1])
+		result := fmt.Sprintf("%s = %s; if %s %s %s || %s != %s { %s = %s }", dest, operands[0], y, op, x, x, x, dest, operands[1])
+		if isVector {
+			result = fmt.Sprintf("for lane_i := range %s { %s }", r, result)
+		}
+		return result, true, nil
+	}
+	var call string
+	switch {
+	case base == "fmuladd":
+		// Fusing is optional for fmuladd, and the Go compiler may fuse x*y + z
+		// on its own, just as LLVM may.
+		call = fmt.Sprintf("%s*%s + %s", parenthesize(operands[0]), parenthesize(operands[1]), parenthesize(operands[2]))
+	case base == "fma" && elem == "float32":
+		// Rounding math.FMA's result to float32 would round twice.
+		call = fmt.Sprintf("libc.FMA32(%s)", strings.Join(operands, ", "))
+	case elem == "float64":
+		call = fmt.Sprintf("%s(%s)", fn, strings.Join(args, ", "))
+	default:
+		call = fmt.Sprintf("%s(%s(%s))", elem, fn, strings.Join(args, ", "))
+	}
+	if isVector {
+		return fmt.Sprintf("for lane_i := range %s { %s[lane_i] = %s }", r, r, call), true, nil
+	}
+	return fmt.Sprintf("%s = %s", r, call), true, nil
+}
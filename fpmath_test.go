@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRoundingIntrinsics(t *testing.T) {
+	t.Parallel()
+	src := new(strings.Builder)
+	var exprs []string
+	for _, fn := range []string{"ceil", "fabs", "floor", "nearbyint", "rint", "round", "roundeven", "sqrt", "trunc"} {
+		for _, typ := range []struct{ ir, suffix, goType string }{
+			{"float", "f32", "float32"},
+			{"double", "f64", "float64"},
+		} {
+			name := fmt.Sprintf("%s_%s", fn, typ.suffix)
+			fmt.Fprintf(src, "declare %[1]s @llvm.%[2]s.%[3]s(%[1]s)\n\n", typ.ir, fn, typ.suffix)
+			fmt.Fprintf(src, "define %[1]s @%[4]s(%[1]s %%x) {\n  %%r = call %[1]s @llvm.%[2]s.%[3]s(%[1]s %%x)\n  ret %[1]s %%r\n}\n\n", typ.ir, fn, typ.suffix, name)
+			exprs = append(exprs, fmt.Sprintf("%[1]s(2.5), %[1]s(-2.5), %[1]s(3.5), %[1]s(-0.25), %[1]s(16)", name))
+		}
+	}
+	src.WriteString(`
+declare <4 x double> @llvm.floor.v4f64(<4 x double>)
+
+define <4 x double> @floorv(<4 x double> %x) {
+  %r = call <4 x double> @llvm.floor.v4f64(<4 x double> %x)
+  ret <4 x double> %r
+}
+
+declare <2 x float> @llvm.sqrt.v2f32(<2 x float>)
+
+define <2 x float> @sqrtv(<2 x float> %x) {
+  %r = call <2 x float> @llvm.sqrt.v2f32(<2 x float> %x)
+  ret <2 x float> %r
+}
+`)
+	exprs = append(exprs,
+		"floorv([4]float64{1.5, -1.5, 2, -0.5})",
+		"sqrtv([2]float32{9, 2.25})",
+	)
+	// Each line is printed once for float and once for double.
+	var want strings.Builder
+	for _, l := range []string{
+		"3 -2 4 -0 16",        // ceil
+		"2.5 2.5 3.5 0.25 16", // fabs
+		"2 -3 3 -1 16",        // floor
+		"2 -2 4 -0 16",        // nearbyint
+		"2 -2 4 -0 16",        // rint
+		"3 -3 4 -0 16",        // round
+		"2 -2 4 -0 16",        // roundeven
+		"",                    // sqrt
+		"2 -2 3 -0 16",        // trunc
+	} {
+		if l == "" {
+			want.WriteString("1.5811388 NaN 1.8708287 NaN 4\n1.5811388300841898 NaN 1.8708286933869707 NaN 4\n")
+			continue
+		}
+		want.WriteString(l + "\n" + l + "\n")
+	}
+	want.WriteString("[1 -2 2 -1]\n[3 1.5]\n")
+	checkProgram(t, src.String(), mainCalling(exprs...), want.String())
+
+	output := translateError(t, `
+declare half @llvm.sqrt.f16(half)
+
+define half @sqrt16(half %x) {
+  %r = call half @llvm.sqrt.f16(half %x)
+  ret half %r
+}
+`, "-color=never")
+	if !strings.Contains(output, "unsupported type for llvm.sqrt.f16: half") {
+		t.Errorf("output doesn't mention half:\n%s", output)
+	}
+}
+
+func TestTranscendentalIntrinsics(t *testing.T) {
+	t.Parallel()
+	src := new(strings.Builder)
+	var exprs []string
+	for _, fn := range []string{"cos", "exp", "exp2", "log", "log10", "log2", "sin"} {
+		for _, typ := range []struct{ ir, suffix string }{{"float", "f32"}, {"double", "f64"}} {
+			name := fmt.Sprintf("%s_%s", fn, typ.suffix)
+			fmt.Fprintf(src, "declare %[1]s @llvm.%[2]s.%[3]s(%[1]s)\n\n", typ.ir, fn, typ.suffix)
+			fmt.Fprintf(src, "define %[1]s @%[4]s(%[1]s %%x) {\n  %%r = call %[1]s @llvm.%[2]s.%[3]s(%[1]s %%x)\n  ret %[1]s %%r\n}\n\n", typ.ir, fn, typ.suffix, name)
+			exprs = append(exprs, fmt.Sprintf(`fmt.Sprintf("%%.5g %%.5g", %[1]s(0), %[1]s(2))`, name))
+		}
+	}
+	src.WriteString(`
+declare float @llvm.pow.f32(float, float)
+declare double @llvm.pow.f64(double, double)
+declare double @llvm.powi.f64.i32(double, i32)
+declare <2 x float> @llvm.powi.v2f32.i32(<2 x float>, i32)
+
+define float @pow_f32(float %x, float %y) {
+  %r = call float @llvm.pow.f32(float %x, float %y)
+  ret float %r
+}
+
+define double @pow_f64(double %x, double %y) {
+  %r = call double @llvm.pow.f64(double %x, double %y)
+  ret double %r
+}
+
+define double @powi(double %x, i32 %n) {
+  %r = call double @llvm.powi.f64.i32(double %x, i32 %n)
+  ret double %r
+}
+
+define <2 x float> @powiv(<2 x float> %x, i32 %n) {
+  %r = call <2 x float> @llvm.powi.v2f32.i32(<2 x float> %x, i32 %n)
+  ret <2 x float> %r
+}
+`)
+	exprs = append(exprs,
+		"pow_f32(2, 0.5), pow_f64(9, 0.5)",
+		"powi(2, 10), powi(2, -2)",
+		"powiv([2]float32{3, -2}, 3)",
+	)
+	want := "1 -0.41615\n1 -0.41615\n" +
+		"1 7.3891\n1 7.3891\n" +
+		"1 4\n1 4\n" +
+		"-Inf 0.69315\n-Inf 0.69315\n" +
+		"-Inf 0.30103\n-Inf 0.30103\n" +
+		"-Inf 1\n-Inf 1\n" +
+		"0 0.9093\n0 0.9093\n" +
+		"1.4142135 3\n1024 0.25\n[27 -8]\n"
+	checkProgram(t, src.String(), mainCalling(exprs...), want)
+}
+
+func TestFMA(t *testing.T) {
+	t.Parallel()
+	src := `
+declare double @llvm.fma.f64(double, double, double)
+declare float @llvm.fma.f32(float, float, float)
+declare <2 x double> @llvm.fma.v2f64(<2 x double>, <2 x double>, <2 x double>)
+declare double @llvm.fmuladd.f64(double, double, double)
+declare <2 x float> @llvm.fmuladd.v2f32(<2 x float>, <2 x float>, <2 x float>)
+
+define double @fma64(double %x, double %y, double %z) {
+  %r = call double @llvm.fma.f64(double %x, double %y, double %z)
+  ret double %r
+}
+
+define float @fma32(float %x, float %y, float %z) {
+  %r = call float @llvm.fma.f32(float %x, float %y, float %z)
+  ret float %r
+}
+
+define <2 x double> @fmav(<2 x double> %x, <2 x double> %y, <2 x double> %z) {
+  %r = call <2 x double> @llvm.fma.v2f64(<2 x double> %x, <2 x double> %y, <2 x double> %z)
+  ret <2 x double> %r
+}
+
+; muladd is only given values where fusing makes no difference.
+define double @muladd(double %x, double %y, double %z) {
+  %s = fadd double %z, 1.0
+  %r = call double @llvm.fmuladd.f64(double %x, double %y, double %s)
+  ret double %r
+}
+
+define <2 x float> @muladdv(<2 x float> %x, <2 x float> %y, <2 x float> %z) {
+  %r = call <2 x float> @llvm.fmuladd.v2f32(<2 x float> %x, <2 x float> %y, <2 x float> %z)
+  ret <2 x float> %r
+}
+`
+	// fma64(0.1, 10, -1) is the rounding error in 0.1 * 10, which is 0
+	// without fusing. In the second fma32 call, the product is halfway
+	// between two float32 values, and z tips it up; rounding to float64 first
+	// would lose z and round down to even.
+	mainSrc := mainCalling(
+		"fma64(0.1, 10, -1)",
+		"fma32(2, 3, 4)",
+		"fma32(1+0x1p-12, 1+0x1p-12, 0x1p-80) == 1+0x1p-11+0x1p-23",
+		"fmav([2]float64{0.1, 2}, [2]float64{10, 3}, [2]float64{-1, 1})",
+		"muladd(2, 3, 4)",
+		"muladdv([2]float32{1.5, -2}, [2]float32{2, 4}, [2]float32{0.5, 1})",
+	)
+	checkProgram(t, src, mainSrc, "5.551115123125783e-17\n10\ntrue\n[5.551115123125783e-17 7]\n11\n[3.5 -7]\n")
+}
+
+func TestFloatMinMax(t *testing.T) {
+	t.Parallel()
+	src := new(strings.Builder)
+	for _, fn := range []string{"minnum", "maxnum", "minimum", "maximum"} {
+		fmt.Fprintf(src, "declare double @llvm.%[1]s.f64(double, double)\n\n", fn)
+		fmt.Fprintf(src, "define double @%[1]s(double %%x, double %%y) {\n  %%r = call double @llvm.%[1]s.f64(double %%x, double %%y)\n  ret double %%r\n}\n\n", fn)
+	}
+	src.WriteString(`
+declare <2 x float> @llvm.maxnum.v2f32(<2 x float>, <2 x float>)
+
+define <2 x float> @maxnumv(<2 x float> %x, <2 x float> %y) {
+  %r = call <2 x float> @llvm.maxnum.v2f32(<2 x float> %x, <2 x float> %y)
+  ret <2 x float> %r
+}
+
+declare float @llvm.minimum.f32(float, float)
+
+define float @minimum32(float %x, float %y) {
+  %r = call float @llvm.minimum.f32(float %x, float %y)
+  ret float %r
+}
+`)
+	mainSrc := `package main
+
+import (
+	"fmt"
+	"math"
+)
+
+func main() {
+	nan := math.NaN()
+	negZero := math.Copysign(0, -1)
+	for _, f := range []func(float64, float64) float64{minnum, maxnum, minimum, maximum} {
+		fmt.Println(f(1, 2), f(2, 1), f(nan, 3), f(3, nan))
+	}
+	// minnum and maxnum may return either zero, but minimum and maximum
+	// order -0 before +0.
+	fmt.Println(minimum(negZero, 0), minimum(0, negZero), maximum(negZero, 0), maximum(0, negZero))
+	fmt.Println(maxnumv([2]float32{1, float32(nan)}, [2]float32{float32(nan), 2}))
+	fmt.Println(minimum32(-1, 1), minimum32(float32(nan), 1))
+}
+`
+	want := "1 1 3 3\n2 2 3 3\n1 1 NaN NaN\n2 2 NaN NaN\n" +
+		"-0 -0 0 0\n[1 2]\n-1 NaN\n"
+	checkProgram(t, src.String(), mainSrc, want)
+}
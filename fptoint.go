@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// When a floating-point value is out of range for the integer type it is
+// being converted to (or is NaN), the result of fptosi and fptoui is poison
+// in LLVM, and the result of a Go conversion depends on the architecture.
+// With -fp-to-int=saturate, the conversions clamp to the integer type's range
+// and turn NaN into 0 instead, which is what LLVM's llvm.fptosi.sat and
+// llvm.fptoui.sat intrinsics do (and so what Rust's as operator does). The
+// intrinsics themselves are always translated that way. Half and long double
+// values are converted to float64 first, and clamped from there.
+
+// checkFPToIntMode returns an error if mode is not a valid value for the
+// -fp-to-int flag.
+func checkFPToIntMode(mode string) error {
+	switch mode {
+	case "go", "saturate":
+		return nil
+	}
+	return fmt.Errorf("invalid value for -fp-to-int: %q (want go or saturate)", mode)
+}
+
+// floatToInt translates a conversion of from to the integer type to (an
+// fptosi or fptoui instruction, according to signed), and stores the result
+// in dest. If saturate is true, out-of-range values are clamped.
+func floatToInt(dest value.Named, from value.Value, to types.Type, signed, saturate bool) (string, error) {
+	fromType, toType := from.Type(), to
+	vt, isVector := to.(*types.VectorType)
+	if isVector {
+		toType = vt.ElemType
+		if ft, ok := fromType.(*types.VectorType); ok {
+			fromType = ft.ElemType
+		}
+	}
+	it, ok := toType.(*types.IntType)
+	if !ok {
+		return "", fmt.Errorf("unsupported destination type for float-to-int conversion: %v", to)
+	}
+	ft, ok := fromType.(*types.FloatType)
+	if !ok {
+		return "", fmt.Errorf("unsupported source type for float-to-int conversion: %v", from.Type())
+	}
+	x, err := FormatValue(from)
+	if err != nil {
+		return "", fmt.Errorf("error translating source (%v): %v", from, err)
+	}
+	elem := x
+	if isVector {
+		elem = "lane_v"
+	}
+	elem, ft = doubleSource(ft, elem)
+
+	conv, err := floatToIntConversion(ft, it, elem, signed, saturate)
+	if err != nil {
+		return "", err
+	}
+	if isVector {
+		return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = %s }", x, VariableName(dest), conv), nil
+	}
+	return fmt.Sprintf("%s = %s", VariableName(dest), conv), nil
+}
+
+// doubleSource converts elem, a value of type ft, to float64 if ft is half or
+// a long double type, so that the conversion to an integer can be done from
+// float64. It returns the expression and its type.
+func doubleSource(ft *types.FloatType, elem string) (string, *types.FloatType) {
+	switch ft.Kind {
+	case types.FloatKindHalf:
+		return fmt.Sprintf("float64(%s.Float32())", elem), types.Double
+	case types.FloatKindX86_FP80, types.FloatKindFP128:
+		if _, ok := bigLongDouble(ft); ok {
+			return elem + ".Float64()", types.Double
+		}
+		// Already translated as float64.
+		return elem, types.Double
+	}
+	return elem, ft
+}
+
+// floatToIntConversion returns an expression that converts elem (a value of
+// the floating-point type ft) to the integer type it.
+func floatToIntConversion(ft *types.FloatType, it *types.IntType, elem string, signed, saturate bool) (string, error) {
+	switch {
+	case it.BitSize == 1:
+		// Only 0 and -1 (or 1, for fptoui) are in range.
+		return fmt.Sprintf("%s != 0", elem), nil
+	case saturate:
+		name, err := saturatingConversion(ft, it, signed)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s(%s)", name, elem), nil
+	case signed && it.BitSize == 8:
+		return fmt.Sprintf("byte(int8(%s))", elem), nil
+	case !signed && it.BitSize > 8:
+		return fmt.Sprintf("int%d(uint%d(%s))", it.BitSize, it.BitSize, elem), nil
+	}
+	t, err := TypeSpec(it)
+	if err != nil {
+		return "", fmt.Errorf("error translating type (%v): %v", it, err)
+	}
+	return fmt.Sprintf("%s(%s)", t, elem), nil
+}
+
+// saturatingConversion returns the name of a helper function that converts
+// from the floating-point type ft to the integer type it, clamping
+// out-of-range values.
+func saturatingConversion(ft *types.FloatType, it *types.IntType, signed bool) (string, error) {
+	var from string
+	switch ft.Kind {
+	case types.FloatKindFloat:
+		from = "float32"
+	case types.FloatKindDouble:
+		from = "float64"
+	default:
+		return "", fmt.Errorf("unsupported source type for saturating conversion: %v", ft)
+	}
+	bits := it.BitSize
+	if bits > 64 && bits != 128 {
+		return "", fmt.Errorf("unsupported destination type for saturating conversion: %v", it)
+	}
+	to, err := TypeSpec(it)
+	if err != nil {
+		return "", err
+	}
+
+	kind := "I"
+	if !signed {
+		kind = "U"
+	}
+	name := fmt.Sprintf("satF%s%s%d", from[len("float"):], kind, bits)
+
+	var body string
+	switch {
+	case bits == 128:
+		// The limits don't fit in a float32, so the comparisons are done in
+		// float64.
+		if signed {
+			body = `	f := float64(x)
+	switch {
+	case f != f:
+		return libc.Int128{}
+	case f <= -0x1p127:
+		return libc.Int128{Hi: 1 << 63}
+	case f >= 0x1p127:
+		return libc.Int128{Lo: math.MaxUint64, Hi: math.MaxInt64}
+	}
+	return libc.Int128FromFloat64(f)
+`
+		} else {
+			body = `	f := float64(x)
+	switch {
+	case f != f || f <= 0:
+		return libc.Int128{}
+	case f >= 0x1p128:
+		return libc.Int128{Lo: math.MaxUint64, Hi: math.MaxUint64}
+	}
+	return libc.Int128FromFloat64(f)
+`
+		}
+
+	case intContainer(bits) != bits:
+		// An odd width, kept in a wider Go type with the bits above its
+		// width normalized (see normalizeOdd).
+		c := intContainer(bits)
+		if signed {
+			min, max := -(int64(1) << (bits - 1)), int64(1)<<(bits-1)-1
+			minResult, result := fmt.Sprint(min), fmt.Sprintf("int%d(x)", c)
+			if c == 8 {
+				minResult, result = fmt.Sprint(uint64(1)<<(bits-1)), normalizeOdd("byte(int8(x))", it)
+			}
+			body = fmt.Sprintf(`	switch {
+	case x != x:
+		return 0
+	case x <= %d:
+		return %s
+	case x >= %d:
+		return %d
+	}
+	return %s
+`, min, minResult, max, max, result)
+		} else {
+			maxResult, result := "-1", normalizeOdd(fmt.Sprintf("int%d(uint%d(x))", c, c), it)
+			if c == 8 {
+				maxResult, result = fmt.Sprint(oddMask(it)), "byte(x)"
+			}
+			body = fmt.Sprintf(`	switch {
+	case x != x || x <= 0:
+		return 0
+	case x >= %d:
+		return %s
+	}
+	return %s
+`, oddMask(it), maxResult, result)
+		}
+
+	case signed:
+		min, max, result := fmt.Sprintf("math.MinInt%d", bits), fmt.Sprintf("math.MaxInt%d", bits), fmt.Sprintf("int%d(x)", bits)
+		if bits == 8 {
+			min, result = "0x80", "byte(int8(x))"
+		}
+		body = fmt.Sprintf(`	switch {
+	case x != x:
+		return 0
+	case x <= math.MinInt%d:
+		return %s
+	case x >= math.MaxInt%d:
+		return %s
+	}
+	return %s
+`, bits, min, bits, max, result)
+
+	default:
+		max, result := "-1", fmt.Sprintf("int%d(uint%d(x))", bits, bits)
+		if bits == 8 {
+			max, result = "math.MaxUint8", "byte(x)"
+		}
+		body = fmt.Sprintf(`	switch {
+	case x != x || x <= 0:
+		return 0
+	case x >= math.MaxUint%d:
+		return %s
+	}
+	return %s
+`, bits, max, result)
+	}
+	return UseHelper(name, fmt.Sprintf("func %s(x %s) %s {\n%s}\n", name, from, to, body)), nil
+}
+
+// SaturatingIntrinsic translates calls to llvm.fptosi.sat and
+// llvm.fptoui.sat. If name is neither, it returns ok == false.
+func SaturatingIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	var signed bool
+	switch {
+	case strings.HasPrefix(name, "llvm.fptosi.sat."):
+		signed = true
+	case strings.HasPrefix(name, "llvm.fptoui.sat."):
+	default:
+		return "", false, nil
+	}
+	if len(inst.Args) != 1 {
+		return "", true, fmt.Errorf("wrong number of arguments to %s", name)
+	}
+	result, err = floatToInt(inst, inst.Args[0], inst.Type(), signed, true)
+	return result, true, err
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const fpToIntSource = `
+define i32 @toi32(double %x) {
+  %r = fptosi double %x to i32
+  ret i32 %r
+}
+
+define i8 @tou8(float %x) {
+  %r = fptoui float %x to i8
+  ret i8 %r
+}
+
+define i32 @tou32(double %x) {
+  %r = fptoui double %x to i32
+  ret i32 %r
+}
+
+define <2 x i16> @tov16(<2 x float> %x) {
+  %r = fptosi <2 x float> %x to <2 x i16>
+  ret <2 x i16> %r
+}
+`
+
+func TestFPToInt(t *testing.T) {
+	t.Parallel()
+	checkProgram(t, fpToIntSource, mainCalling("toi32(-2.75)", "tou8(200.5)", "tou32(3e9)", "tov16([2]float32{-7.9, 300.2})"),
+		"-2\n200\n-1294967296\n[-7 300]\n")
+
+	// With -fp-to-int=saturate, out-of-range values and NaN are clamped.
+	mainSrc := `package main
+
+import (
+	"fmt"
+	"math"
+)
+
+func main() {
+	fmt.Println(toi32(1e10), toi32(-1e10), toi32(math.NaN()), toi32(-2.75))
+	fmt.Println(tou8(300), tou8(-5), tou32(5e9), tou32(-1))
+	fmt.Println(tov16([2]float32{1e6, -1e6}))
+}
+`
+	checkProgram(t, fpToIntSource, mainSrc, "2147483647 -2147483648 0 -2\n255 0 -1 0\n[32767 -32768]\n", "-fp-to-int=saturate")
+
+	// That includes long double values, with -long-double=big.
+	src := `
+define i16 @from80(double %x) {
+  %l = fpext double %x to x86_fp80
+  %r = fptosi x86_fp80 %l to i16
+  ret i16 %r
+}
+`
+	checkProgram(t, src, mainCalling("from80(1e9)", "from80(-1e9)", "from80(-3.5)"), "32767\n-32768\n-3\n", "-fp-to-int=saturate", "-long-double=big")
+}
+
+const saturatingIntrinsics = `
+declare i32 @llvm.fptosi.sat.i32.f64(double)
+declare i8 @llvm.fptoui.sat.i8.f32(float)
+declare i16 @llvm.fptosi.sat.i16.f16(half)
+declare i32 @llvm.fptoui.sat.i32.f80(x86_fp80)
+declare i64 @llvm.fptosi.sat.i64.f128(fp128)
+
+define i32 @sat32(double %x) {
+  %r = call i32 @llvm.fptosi.sat.i32.f64(double %x)
+  ret i32 %r
+}
+
+define i8 @satu8(float %x) {
+  %r = call i8 @llvm.fptoui.sat.i8.f32(float %x)
+  ret i8 %r
+}
+
+define i16 @sathalf(double %x) {
+  %h = fptrunc double %x to half
+  %r = call i16 @llvm.fptosi.sat.i16.f16(half %h)
+  ret i16 %r
+}
+
+define i32 @sat80(double %x) {
+  %l = fpext double %x to x86_fp80
+  %r = call i32 @llvm.fptoui.sat.i32.f80(x86_fp80 %l)
+  ret i32 %r
+}
+
+define i64 @sat128(double %x) {
+  %l = fpext double %x to fp128
+  %r = call i64 @llvm.fptosi.sat.i64.f128(fp128 %l)
+  ret i64 %r
+}
+`
+
+func TestSaturatingIntrinsics(t *testing.T) {
+	t.Parallel()
+	mainSrc := `package main
+
+import (
+	"fmt"
+	"math"
+)
+
+func main() {
+	fmt.Println(sat32(1e10), sat32(math.NaN()), satu8(-3), satu8(254.9))
+	fmt.Println(sathalf(40000), sathalf(-40000), sathalf(-12.5), sathalf(math.NaN()))
+	fmt.Println(sat80(5e9), sat80(-1), sat80(123.9))
+	fmt.Println(sat128(1e30), sat128(-1e30), sat128(-42.5))
+}
+`
+	want := "2147483647 0 0 254\n32767 -32768 -12 0\n-1 0 123\n9223372036854775807 -9223372036854775808 -42\n"
+	for _, flags := range [][]string{nil, {"-long-double=big"}} {
+		code, _ := translate(t, saturatingIntrinsics, flags...)
+		if got := runGo(t, code, mainSrc); got != want {
+			t.Errorf("%s: output:\n%s\nwant:\n%s\ngenerated code:\n%s", strings.Join(flags, " "), got, want, numberLines(code))
+		}
+	}
+}
+
+func TestFPToIntFlag(t *testing.T) {
+	t.Parallel()
+	output := translateError(t, "", "-fp-to-int=wrap")
+	if !strings.Contains(output, `invalid value for -fp-to-int: "wrap"`) {
+		t.Errorf("output: %s", output)
+	}
+}
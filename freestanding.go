@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+)
+
+// In freestanding mode (for code compiled with -ffreestanding), calls are not
+// mapped to the libc package or to Go's standard library. The module is
+// expected to define every function it calls, apart from LLVM intrinsics; as
+// in C, that includes memcpy, memmove, and memset, which the memory
+// intrinsics are lowered to.
+
+// runtimeFuncs holds the module's definitions of the functions that
+// freestanding C code must provide.
+var runtimeFuncs = make(map[string]*ir.Func)
+
+// leavenBuiltins are the external functions declared by leaven's own headers,
+// which are available even in freestanding mode.
+var leavenBuiltins = map[string]bool{
+	"leaven_va_start": true,
+	"leaven_va_arg":   true,
+	"leaven_va_end":   true,
+	"leaven_va_copy":  true,
+}
+
+// FindRuntimeFuncs records the definitions of memcpy, memmove, and memset in
+// m.
+func FindRuntimeFuncs(m *ir.Module) {
+	for _, f := range m.Funcs {
+		switch f.Name() {
+		case "memcpy", "memmove", "memset":
+			if f.Blocks != nil {
+				runtimeFuncs[f.Name()] = f
+			}
+		}
+	}
+}
+
+// isIntrinsic reports whether f is an LLVM intrinsic or one of leaven's own
+// builtins.
+func isIntrinsic(f *ir.Func) bool {
+	return strings.HasPrefix(f.Name(), "llvm.") || leavenBuiltins[f.Name()]
+}
+
+// checkFreestandingCall returns an error if f is an external function that
+// isn't available in freestanding mode.
+func checkFreestandingCall(f *ir.Func) error {
+	if f.Blocks != nil || isIntrinsic(f) {
+		return nil
+	}
+	return fmt.Errorf("call to external function %s in freestanding mode", f.Ident())
+}
+
+// freestandingMemCall translates a call to one of the memory intrinsics
+// into a call to the module's own implementation of fn.
+func freestandingMemCall(fn string, args []string) (string, error) {
+	f, ok := runtimeFuncs[fn]
+	if !ok {
+		return "", fmt.Errorf("freestanding module doesn't define %s", fn)
+	}
+	if fn == "memset" {
+		// The intrinsic takes the byte as an i8; memset takes an int.
+		args[1] = fmt.Sprintf("int32(%s)", args[1])
+	}
+	return fmt.Sprintf("%s(%s)", GlobalRef(f), strings.Join(args[:3], ", ")), nil
+}
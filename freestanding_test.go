@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const freestandingSource = `
+@calls = global i32 0
+
+define i8* @memcpy(i8* %d, i8* %s, i64 %n) {
+entry:
+  %c = load i32, i32* @calls
+  %c1 = add i32 %c, 1
+  store i32 %c1, i32* @calls
+  br label %loop
+
+loop:
+  %i = phi i64 [ 0, %entry ], [ %i1, %body ]
+  %done = icmp eq i64 %i, %n
+  br i1 %done, label %exit, label %body
+
+body:
+  %sp = getelementptr i8, i8* %s, i64 %i
+  %dp = getelementptr i8, i8* %d, i64 %i
+  %b = load i8, i8* %sp
+  store i8 %b, i8* %dp
+  %i1 = add i64 %i, 1
+  br label %loop
+
+exit:
+  ret i8* %d
+}
+
+define i64 @strlen(i8* %s) {
+  ret i64 99
+}
+
+define i64 @copy(i8* %a, i8* %b) {
+  call void @llvm.memcpy.p0i8.p0i8.i64(i8* %a, i8* %b, i64 4, i1 false)
+  %n = call i64 @strlen(i8* %a)
+  ret i64 %n
+}
+
+declare void @llvm.memcpy.p0i8.p0i8.i64(i8*, i8*, i64, i1)
+`
+
+func TestFreestanding(t *testing.T) {
+	t.Parallel()
+	code, _ := translate(t, freestandingSource, "-freestanding")
+	if strings.Contains(code, "libc.") {
+		t.Errorf("freestanding code uses the libc package:\n%s", numberLines(code))
+	}
+	// The module's own memcpy and strlen are used.
+	got := runGo(t, code, `package main
+
+import "fmt"
+
+func main() {
+	a, b := []byte("xxxx"), []byte("abcd")
+	fmt.Println(_copy(&a[0], &b[0]), string(a), calls)
+}
+`)
+	if want := "99 abcd 1\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+
+	output := translateError(t, `
+declare i32 @putchar(i32)
+
+define void @f() {
+  %r = call i32 @putchar(i32 65)
+  ret void
+}
+`, "-freestanding", "-color=never")
+	if !strings.Contains(output, "call to external function @putchar in freestanding mode") {
+		t.Errorf("call to putchar wasn't reported:\n%s", output)
+	}
+}
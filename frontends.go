@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/types"
+)
+
+// Support for the runtime calls emitted by frontends other than Clang.
+//
+// Swift code is full of calls to its reference-counting runtime. Since Go has
+// a garbage collector, retains just return their argument (swift_tryRetain
+// returns true) and releases do nothing. Objects are allocated with
+// libc.Calloc and never freed, and swift_isUniquelyReferenced always reports
+// false, so that copy-on-write values are copied rather than being modified
+// in place.
+//
+// Zig's error unions are ordinary structs ({ T, i16 }), so they need nothing
+// special; but a call to its panic handler becomes a Go panic with the
+// handler's message.
+
+var (
+	swiftRetains = map[string]bool{
+		"swift_retain":                  true,
+		"swift_retain_n":                true,
+		"swift_nonatomic_retain":        true,
+		"swift_nonatomic_retain_n":      true,
+		"swift_unknownObjectRetain":     true,
+		"swift_unknownObjectRetain_n":   true,
+		"swift_bridgeObjectRetain":      true,
+		"swift_bridgeObjectRetain_n":    true,
+		"swift_unownedRetain":           true,
+		"swift_unownedRetainStrong":     true,
+		"swift_nonatomic_unownedRetain": true,
+	}
+
+	swiftNoOps = map[string]bool{
+		"swift_release":                    true,
+		"swift_release_n":                  true,
+		"swift_nonatomic_release":          true,
+		"swift_nonatomic_release_n":        true,
+		"swift_unknownObjectRelease":       true,
+		"swift_unknownObjectRelease_n":     true,
+		"swift_bridgeObjectRelease":        true,
+		"swift_bridgeObjectRelease_n":      true,
+		"swift_unownedRelease":             true,
+		"swift_nonatomic_unownedRelease":   true,
+		"swift_deallocObject":              true,
+		"swift_deallocClassInstance":       true,
+		"swift_deallocUninitializedObject": true,
+		"swift_beginAccess":                true,
+		"swift_endAccess":                  true,
+		"__zig_probe_stack":                true,
+	}
+
+	zigPanicHandlers = map[string]bool{
+		"builtin.default_panic":     true,
+		"std.builtin.default_panic": true,
+		"debug.defaultPanic":        true,
+		"std.debug.defaultPanic":    true,
+		"zig_panic":                 true,
+	}
+)
+
+// FrontendCall translates calls to the Swift and Zig runtime functions that
+// leaven knows about. If name is not one of them, it returns ok == false.
+func FrontendCall(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	isVoid := types.Equal(inst.Type(), types.Void)
+	switch {
+	case swiftRetains[name]:
+		if len(inst.Args) == 0 {
+			return "", false, nil
+		}
+		if isVoid {
+			return "", true, nil
+		}
+		p, err := formatPointerAs(inst.Args[0], inst.Type())
+		if err != nil {
+			return "", true, fmt.Errorf("error translating argument 0 (%v): %v", inst.Args[0], err)
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), p), true, nil
+
+	case swiftNoOps[name]:
+		if !isVoid {
+			if _, ok := inst.Type().(*types.PointerType); ok && len(inst.Args) > 0 {
+				// swift_beginAccess and friends may return their object.
+				p, err := formatPointerAs(inst.Args[0], inst.Type())
+				if err != nil {
+					return "", true, fmt.Errorf("error translating argument 0 (%v): %v", inst.Args[0], err)
+				}
+				return fmt.Sprintf("%s = %s", VariableName(inst), p), true, nil
+			}
+			return "", false, nil
+		}
+		return "", true, nil
+
+	case name == "swift_allocObject":
+		if len(inst.Args) != 3 || isVoid {
+			return "", false, nil
+		}
+		md, err := FormatValue(inst.Args[0])
+		if err != nil {
+			return "", true, fmt.Errorf("error translating argument 0 (%v): %v", inst.Args[0], err)
+		}
+		size, err := FormatValue(inst.Args[1])
+		if err != nil {
+			return "", true, fmt.Errorf("error translating argument 1 (%v): %v", inst.Args[1], err)
+		}
+		t, err := TypeSpec(inst.Type())
+		if err != nil {
+			return "", true, fmt.Errorf("error translating type (%v): %v", inst.Type(), err)
+		}
+		// The object header starts with a pointer to its metadata.
+		obj := VariableName(inst)
+		return fmt.Sprintf("%s = (%s)(unsafe.Pointer(libc.Calloc(1, int64(%s)))); *(*unsafe.Pointer)(unsafe.Pointer(%s)) = unsafe.Pointer(%s)", obj, t, size, obj, md), true, nil
+
+	case name == "swift_tryRetain":
+		// Without reference counting, an object is never being deallocated,
+		// so retaining it always succeeds.
+		if isVoid {
+			return "", true, nil
+		}
+		return fmt.Sprintf("%s = true", VariableName(inst)), true, nil
+
+	case strings.HasPrefix(name, "swift_isUniquelyReferenced"):
+		if isVoid {
+			return "", false, nil
+		}
+		return fmt.Sprintf("%s = false", VariableName(inst)), true, nil
+
+	case name == "swift_once":
+		if len(inst.Args) < 2 {
+			return "", false, nil
+		}
+		f, err := directCallee(inst.Args[1])
+		if err != nil {
+			return "", true, err
+		}
+		token, err := FormatValue(inst.Args[0])
+		if err != nil {
+			return "", true, fmt.Errorf("error translating argument 0 (%v): %v", inst.Args[0], err)
+		}
+		call, err := formatCall(f, inst.Args[2:])
+		if err != nil {
+			return "", true, err
+		}
+		if strings.HasPrefix(token, "&") {
+			token = strings.TrimPrefix(token, "&")
+		} else {
+			token = "*" + token
+		}
+		return fmt.Sprintf("if %s != -1 { %s = -1; %s }", token, token, call), true, nil
+
+	case zigPanicHandlers[name]:
+		if !isZigPanic(inst) {
+			return "", false, nil
+		}
+		msg, err := FormatValue(inst.Args[0])
+		if err != nil {
+			return "", true, fmt.Errorf("error translating argument 0 (%v): %v", inst.Args[0], err)
+		}
+		n, err := FormatValue(inst.Args[1])
+		if err != nil {
+			return "", true, fmt.Errorf("error translating argument 1 (%v): %v", inst.Args[1], err)
+		}
+		return fmt.Sprintf("panic(libc.GoStringN(%s, int(%s)))", msg, n), true, nil
+	}
+	return "", false, nil
+}
+
+// isZigPanic reports whether call is a call to a Zig panic handler, with a
+// message pointer and length as its first arguments.
+func isZigPanic(call *ir.InstCall) bool {
+	f, ok := call.Callee.(*ir.Func)
+	if !ok || !zigPanicHandlers[f.Name()] || len(call.Args) < 2 {
+		return false
+	}
+	if pt, ok := call.Args[0].Type().(*types.PointerType); !ok || !types.Equal(pt.ElemType, types.I8) {
+		return false
+	}
+	_, ok = call.Args[1].Type().(*types.IntType)
+	return ok
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSwiftRuntime(t *testing.T) {
+	t.Parallel()
+	src := `
+%swift.refcounted = type { %swift.type*, i64 }
+%swift.type = type { i64 }
+%Counter = type { %swift.refcounted, i64 }
+
+@metadata = global %swift.type { i64 7 }
+
+declare %swift.refcounted* @swift_allocObject(%swift.type*, i64, i64)
+declare %swift.refcounted* @swift_retain(%swift.refcounted*)
+declare void @swift_release(%swift.refcounted*)
+declare i1 @swift_tryRetain(%swift.refcounted*)
+declare i1 @swift_isUniquelyReferenced_nonNull_native(%swift.refcounted*)
+
+define i64 @counter(i64 %start) {
+  %obj = call %swift.refcounted* @swift_allocObject(%swift.type* @metadata, i64 24, i64 7)
+  %c = bitcast %swift.refcounted* %obj to %Counter*
+  %v = getelementptr %Counter, %Counter* %c, i32 0, i32 1
+  store i64 %start, i64* %v
+  %r = call %swift.refcounted* @swift_retain(%swift.refcounted* %obj)
+  %ok = call i1 @swift_tryRetain(%swift.refcounted* %r)
+  %unique = call i1 @swift_isUniquelyReferenced_nonNull_native(%swift.refcounted* %r)
+  call void @swift_release(%swift.refcounted* %r)
+  %mp = getelementptr %swift.refcounted, %swift.refcounted* %r, i32 0, i32 0
+  %m = load %swift.type*, %swift.type** %mp
+  %kp = getelementptr %swift.type, %swift.type* %m, i32 0, i32 0
+  %k = load i64, i64* %kp
+  %x = load i64, i64* %v
+  %sum = add i64 %x, %k
+  %a = select i1 %ok, i64 100, i64 0
+  %b = select i1 %unique, i64 1000, i64 0
+  %s1 = add i64 %sum, %a
+  %s2 = add i64 %s1, %b
+  ret i64 %s2
+}
+
+define void @zig_fail() {
+  call void @std.builtin.default_panic(i8* getelementptr inbounds ([9 x i8], [9 x i8]* @msg, i64 0, i64 0), i64 8, i8* null)
+  unreachable
+}
+
+@msg = constant [9 x i8] c"overflow\00"
+
+declare void @std.builtin.default_panic(i8*, i64, i8*)
+`
+	checkProgram(t, src, `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(counter(5))
+	defer func() {
+		fmt.Println(recover())
+	}()
+	zig_fail()
+}
+`, "112\noverflow\n")
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/value"
+)
+
+// Modules compiled for Windows use funclet-based exception handling
+// (catchswitch, catchpad, catchret, cleanuppad, and cleanupret) instead of
+// landingpad. These are translated with the same panic and recover scheme as
+// landingpad (see exceptions.go). The token that each pad produces is a
+// variable holding the exception pointer from libc.Invoke, so that an
+// exception that isn't caught can be passed on with the same panic value.
+//
+// A Go panic is a foreign exception to C++ (and to SEH filters), so a
+// catchswitch always branches to its first catch-all handler, or unwinds
+// further if it has none. A catch-all handler is one whose catchpad has no
+// type descriptor (catch (...) in C++, or __except with a constant filter).
+
+// isPad reports whether v is one of the Windows exception pads, whose values
+// are exception pointers.
+func isPad(v value.Value) bool {
+	switch v.(type) {
+	case *ir.InstCatchPad, *ir.InstCleanupPad, *ir.TermCatchSwitch:
+		return true
+	}
+	return false
+}
+
+// catchAll reports whether a catchpad (with arguments args) catches any
+// exception.
+func catchAll(args []value.Value) bool {
+	if len(args) == 0 {
+		return true
+	}
+	_, ok := args[0].(*constant.Null)
+	return ok
+}
+
+// catchSwitchTarget returns the block that term branches to for a Go panic:
+// its first catch-all handler, or its unwind destination (nil for the
+// caller).
+func catchSwitchTarget(term *ir.TermCatchSwitch) value.Value {
+	for _, h := range term.Handlers {
+		block, ok := h.(*ir.Block)
+		if !ok {
+			continue
+		}
+		for _, inst := range block.Insts {
+			if _, ok := inst.(*ir.InstPhi); ok {
+				continue
+			}
+			if cp, ok := inst.(*ir.InstCatchPad); ok && catchAll(cp.Args) {
+				return block
+			}
+			break
+		}
+	}
+	return term.DefaultUnwindTarget
+}
+
+// translateCatchSwitch writes the translation of term, which is the
+// terminator of block b.
+func translateCatchSwitch(out io.Writer, b *ir.Block, term *ir.TermCatchSwitch) error {
+	exc := VariableName(term)
+	target := catchSwitchTarget(term)
+	switch {
+	case target == nil:
+		fmt.Fprintf(out, "\tpanic(libc.PanicValue(%s))\n", exc)
+		return nil
+	case target == term.DefaultUnwindTarget:
+		return unwind(out, b, target, exc, "\t")
+	}
+	// The handler's catchpad takes the exception pointer from the
+	// catchswitch.
+	return branch(out, b, target, "\t")
+}
+
+// translateCleanupRet writes the translation of term, which is the
+// terminator of block b.
+func translateCleanupRet(out io.Writer, b *ir.Block, term *ir.TermCleanupRet) error {
+	exc, err := FormatValue(term.CleanupPad)
+	if err != nil {
+		return fmt.Errorf("error translating cleanup pad (%v): %v", term.CleanupPad, err)
+	}
+	if term.UnwindTarget == nil {
+		fmt.Fprintf(out, "\tpanic(libc.PanicValue(%s))\n", exc)
+		return nil
+	}
+	return unwind(out, b, term.UnwindTarget, exc, "\t")
+}
@@ -0,0 +1,116 @@
+package main
+
+import "testing"
+
+func TestFunclets(t *testing.T) {
+	t.Parallel()
+	src := `
+@cleanups = global i32 0
+@intType = global i8 0
+
+declare i32 @mayThrow(i32)
+declare i32 @__CxxFrameHandler3(...)
+
+; guarded runs a cleanup when mayThrow panics, and then catches the panic with
+; its catch (...) handler, not the one for a particular type.
+define i32 @guarded(i32 %x) personality i32 (...)* @__CxxFrameHandler3 {
+entry:
+  %r = invoke i32 @mayThrow(i32 %x)
+          to label %ok unwind label %cleanup
+
+ok:
+  ret i32 %r
+
+cleanup:
+  %cp = cleanuppad within none []
+  %n = load i32, i32* @cleanups
+  %n1 = add i32 %n, 1
+  store i32 %n1, i32* @cleanups
+  cleanupret from %cp unwind label %dispatch
+
+dispatch:
+  %cs = catchswitch within none [label %typed, label %all] unwind to caller
+
+typed:
+  %tp = catchpad within %cs [i8* @intType, i32 0, i8* null]
+  catchret from %tp to label %wrong
+
+all:
+  %ap = catchpad within %cs [i8* null, i32 64, i8* null]
+  catchret from %ap to label %caught
+
+caught:
+  ret i32 -1
+
+wrong:
+  ret i32 -2
+}
+
+; typedOnly has no handler that catches a panic, so it unwinds to its caller.
+define i32 @typedOnly(i32 %x) personality i32 (...)* @__CxxFrameHandler3 {
+entry:
+  %r = invoke i32 @mayThrow(i32 %x)
+          to label %ok unwind label %dispatch
+
+ok:
+  ret i32 %r
+
+dispatch:
+  %cs = catchswitch within none [label %typed] unwind to caller
+
+typed:
+  %tp = catchpad within %cs [i8* @intType, i32 0, i8* null]
+  catchret from %tp to label %wrong
+
+wrong:
+  ret i32 -2
+}
+
+; cleanupOnly runs a cleanup, then continues unwinding.
+define i32 @cleanupOnly(i32 %x) personality i32 (...)* @__CxxFrameHandler3 {
+entry:
+  %r = invoke i32 @mayThrow(i32 %x)
+          to label %ok unwind label %cleanup
+
+ok:
+  ret i32 %r
+
+cleanup:
+  %cp = cleanuppad within none []
+  %n = load i32, i32* @cleanups
+  %n1 = add i32 %n, 10
+  store i32 %n1, i32* @cleanups
+  cleanupret from %cp unwind to caller
+}
+`
+	mainSrc := `package main
+
+import "fmt"
+
+// mayThrow panics if x is 3.
+func mayThrow(x int32) int32 {
+	if x == 3 {
+		panic(fmt.Sprint("thrown ", x))
+	}
+	return x * 10
+}
+
+// try calls f, and returns what it panicked with, if anything.
+func try(f func(int32) int32, x int32) (result interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = r
+		}
+	}()
+	return f(x)
+}
+
+func main() {
+	fmt.Println(guarded(1), cleanups)
+	fmt.Println(guarded(3), cleanups)
+	fmt.Println(try(typedOnly, 2), try(typedOnly, 3))
+	fmt.Println(try(cleanupOnly, 3), cleanups)
+}
+`
+	checkProgram(t, src, mainSrc, "10 0\n-1 1\n20 thrown 3\nthrown 3 11\n")
+}
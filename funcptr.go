@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// Function pointers are translated as Go func values, which can't be
+// converted with unsafe.Pointer like other pointers. Conversions to and from
+// them go through libc.FuncToPointer and libc.PointerCell instead.
+
+// isFuncPointer reports whether t is a pointer to a function.
+func isFuncPointer(t types.Type) bool {
+	pt, ok := t.(*types.PointerType)
+	return ok && types.IsFunc(pt.ElemType)
+}
+
+// isNull reports whether v is a null pointer constant.
+func isNull(v value.Value) bool {
+	_, ok := v.(*constant.Null)
+	return ok
+}
+
+// funcPointerCast returns an expression that converts x from the pointer type
+// from to the pointer type to, when at least one of them is a function
+// pointer. If neither is, it returns ok == false.
+func funcPointerCast(x string, from, to types.Type) (result string, ok bool, err error) {
+	if !isFuncPointer(from) && !isFuncPointer(to) {
+		return "", false, nil
+	}
+	if arenaMode() {
+		return "", true, fmt.Errorf("can't convert between function and data pointers (%v to %v) with -memory=arena", from, to)
+	}
+	t, err := TypeSpec(to)
+	if err != nil {
+		return "", true, fmt.Errorf("error translating type (%v): %v", to, err)
+	}
+	if ft, err := TypeSpec(from); err == nil && ft == t {
+		return x, true, nil
+	}
+	p := fmt.Sprintf("unsafe.Pointer(%s)", x)
+	if isFuncPointer(from) {
+		p = fmt.Sprintf("libc.FuncToPointer(%s)", x)
+	}
+	if isFuncPointer(to) {
+		return fmt.Sprintf("*(*%s)(libc.PointerCell(%s))", t, p), true, nil
+	}
+	return fmt.Sprintf("(%s)(%s)", t, p), true, nil
+}
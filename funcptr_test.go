@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const funcPtrSource = `
+@table = global [2 x i8*] [i8* bitcast (i32 (i32)* @inc to i8*), i8* bitcast (i32 (i32)* @double to i8*)]
+
+define i32 @inc(i32 %x) {
+  %r = add i32 %x, 1
+  ret i32 %r
+}
+
+define i32 @double(i32 %x) {
+  %r = mul i32 %x, 2
+  ret i32 %r
+}
+
+; callEntry calls the function in the table at index i.
+define i32 @callEntry(i64 %i, i32 %x) {
+  %p = getelementptr [2 x i8*], [2 x i8*]* @table, i64 0, i64 %i
+  %f = load i8*, i8** %p
+  %fn = bitcast i8* %f to i32 (i32)*
+  %r = call i32 %fn(i32 %x)
+  ret i32 %r
+}
+
+; viaInt converts a function pointer to an integer and back.
+define i32 @viaInt(i32 %x) {
+  %n = ptrtoint i32 (i32)* @double to i64
+  %f = inttoptr i64 %n to i32 (i32)*
+  %r = call i32 %f(i32 %x)
+  ret i32 %r
+}
+
+; retyped casts @inc to another function type and back, as C code does to
+; store callbacks of different types.
+define i32 @retyped(i32 %x) {
+  %g = bitcast i32 (i32)* @inc to void (i8*)*
+  %f = bitcast void (i8*)* %g to i32 (i32)*
+  %r = call i32 %f(i32 %x)
+  ret i32 %r
+}
+
+define i32 @same(i32 (i32)* %f, i32 (i32)* %g) {
+  %eq = icmp eq i32 (i32)* %f, %g
+  %isInc = icmp eq i32 (i32)* %f, @inc
+  %isNull = icmp eq i32 (i32)* %f, null
+  %a = zext i1 %eq to i32
+  %b = zext i1 %isInc to i32
+  %c = zext i1 %isNull to i32
+  %a2 = mul i32 %a, 100
+  %b2 = mul i32 %b, 10
+  %s = add i32 %a2, %b2
+  %r = add i32 %s, %c
+  ret i32 %r
+}
+`
+
+func TestFuncPointers(t *testing.T) {
+	t.Parallel()
+	mainSrc := mainCalling(
+		"callEntry(0, 5), callEntry(1, 5)",
+		"viaInt(21)",
+		"retyped(41)",
+		"same(inc, inc), same(inc, double), same(double, double), same(nil, nil)",
+	)
+	code, _ := translate(t, funcPtrSource)
+	want := "6 10\n42\n42\n110 10 100 101\n"
+	if got := runGo(t, code, mainSrc, noUnsafePtrCheck); got != want {
+		t.Errorf("output:\n%s\nwant:\n%s\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestFuncPointersArena(t *testing.T) {
+	t.Parallel()
+	output := translateError(t, funcPtrSource, "-memory=arena", "-color=never")
+	if !strings.Contains(output, "can't convert between function and data pointers") {
+		t.Errorf("output doesn't report the conversion:\n%s", output)
+	}
+}
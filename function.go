@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// TranslateFunction writes the Go translation of f to out. Any parts of f that
+// cannot be translated are replaced with calls to panic, and the errors are
+// added to errs.
+func TranslateFunction(out io.Writer, f *ir.Func, errs *ErrorList) {
+	AssignLocalNames(f)
+	if *binaryReinterpret {
+		FindBinaryOnlyBitcasts(f)
+	}
+
+	inline := *inlineValues
+	if inline {
+		FindInlinable(f)
+	}
+
+	// Write the function to a buffer, so that the parentheses left over from
+	// inlining can be cleaned up.
+	final := out
+	fb := new(bytes.Buffer)
+	out = fb
+	defer func() {
+		src := fb.String()
+		if inline {
+			src = RemoveRedundantParens(src)
+		}
+		io.WriteString(final, src)
+	}()
+
+	if isMainFunc(f) {
+		fmt.Fprintln(out, "func main() {")
+	} else {
+		sig, err := signature(f)
+		if err != nil {
+			errs.AddAt(f, nil, err)
+			return
+		}
+		fmt.Fprintf(out, "func %s%s%s {\n", receiver(f), VariableName(f), sig)
+	}
+
+	// Translate the body first, since variables for inlined values don't need
+	// to be declared.
+	body := new(bytes.Buffer)
+	translateBody(body, f, errs)
+	if isMainFunc(f) && *instanceMode && usesState(body.String()) {
+		fmt.Fprintf(out, "\t%s := NewState()\n", stateReceiver)
+	}
+
+	// Declare variables.
+	conversions, allVars, err := goIntConversions(f)
+	if err != nil {
+		errs.AddAt(f, nil, err)
+	}
+	for _, c := range conversions {
+		fmt.Fprintf(out, "\t%s\n", c)
+	}
+	vars := make(map[string][]string)
+	for _, b := range f.Blocks {
+		// The results of instructions need variables, and so do those of
+		// terminators like invoke.
+		nodes := make([]llNode, 0, len(b.Insts)+1)
+		for _, inst := range b.Insts {
+			nodes = append(nodes, inst)
+		}
+		nodes = append(nodes, b.Term)
+		for _, node := range nodes {
+			if inst, ok := node.(value.Named); ok {
+				if _, ok := inlinedExprs[inst]; ok {
+					continue
+				}
+				vt := ValueType(inst)
+				if types.Equal(vt, types.Void) {
+					continue
+				}
+				t, err := TypeSpec(vt)
+				if err != nil {
+					if !errs.failed(node) {
+						errs.AddAt(f, node, fmt.Errorf("error translating type: %v", err))
+					}
+					continue
+				}
+				vars[t] = append(vars[t], VariableName(inst))
+				allVars = append(allVars, VariableName(inst))
+			}
+		}
+	}
+	varTypes := make([]string, 0, len(vars))
+	for t := range vars {
+		varTypes = append(varTypes, t)
+	}
+	sort.Strings(varTypes)
+	for _, t := range varTypes {
+		fmt.Fprintf(out, "\tvar %s %s\n", strings.Join(vars[t], ", "), t)
+	}
+	if len(allVars) > 0 {
+		fmt.Fprintln(out)
+		// Get rid of unused-variable errors.
+		for i := range allVars {
+			if i == 0 {
+				fmt.Fprint(out, "\t_")
+			} else {
+				fmt.Fprint(out, ", _")
+			}
+		}
+		fmt.Fprintf(out, " = %s\n\n", strings.Join(allVars, ", "))
+	}
+
+	if OutParams[f] != nil {
+		var decls []string
+		decls, err = outParamDecls(f)
+		if err != nil {
+			errs.AddAt(f, nil, err)
+		}
+		for _, d := range decls {
+			fmt.Fprintf(out, "\t%s\n", d)
+		}
+		fmt.Fprintln(out)
+	}
+
+	if arenaMode() && hasAlloca(f) {
+		fmt.Fprintln(out, "\tdefer libc.ArenaRelease(libc.ArenaMark())")
+		fmt.Fprintln(out)
+	}
+
+	body.WriteTo(out)
+	fmt.Fprint(out, "}\n\n")
+}
+
+// translateBody writes the translations of f's instructions to out.
+func translateBody(out io.Writer, f *ir.Func, errs *ErrorList) {
+	currentFunc = f
+	reachable := reachableBlocks(f)
+	last := len(f.Blocks) - 1
+	for last > 0 && !reachable[f.Blocks[last]] {
+		last--
+	}
+	for i, b := range f.Blocks {
+		if !reachable[b] {
+			continue
+		}
+		if i != 0 {
+			fmt.Fprintf(out, "\n%s:\n", BlockName(b))
+		}
+		for _, inst := range b.Insts {
+			if _, ok := inst.(*ir.InstPhi); ok {
+				continue
+			}
+			translated, err := TranslateInstruction(inst)
+			if err == nil && *ubChecks && translated != "" {
+				var checks string
+				checks, err = PointerChecks(inst)
+				translated = checks + translated
+			}
+			if err == nil {
+				err = checkUnsafe(translated)
+			}
+			if err != nil {
+				errs.AddAt(f, inst, err)
+				translated = midBlockPanic(untranslated(inst))
+			}
+			if v, ok := inst.(value.Named); ok && err == nil {
+				if _, ok := inlineExpr(v, translated); ok {
+					continue
+				}
+			}
+			CountStatement(translated)
+			if translated != "" {
+				fmt.Fprintf(out, "\t%s\n", translated)
+			}
+		}
+		translated, err := TranslateTerminator(f, b, i == last)
+		if err == nil {
+			err = checkUnsafe(translated)
+		}
+		if err != nil {
+			errs.AddAt(f, b.Term, err)
+			translated = fmt.Sprintf("\t%s\n", untranslated(b.Term))
+		}
+		fmt.Fprint(out, translated)
+	}
+}
+
+// signature returns the parameter list and result type of f, formatted as
+// they should appear in a Go function declaration.
+func signature(f *ir.Func) (string, error) {
+	b := new(bytes.Buffer)
+	b.WriteString("(")
+	n := 0
+	for i, p := range f.Params {
+		if isOut(f, i) {
+			continue
+		}
+		if n > 0 {
+			b.WriteString(", ")
+		}
+		n++
+		if name, ok := goParamNames[p]; ok {
+			fmt.Fprintf(b, "%s int", name)
+			continue
+		}
+		pt := TypedefSpec(valueDITypes[p], p.Typ)
+		if pt == "" {
+			var err error
+			pt, err = TypeSpec(p.Typ)
+			if err != nil {
+				return "", fmt.Errorf("error translating type for parameter %d: %v", i, err)
+			}
+		}
+		fmt.Fprintf(b, "%s %s", VariableName(p), pt)
+	}
+	if f.Sig.Variadic {
+		if n > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("varargs ...interface{}")
+	}
+	b.WriteString(")")
+	if OutParams[f] != nil {
+		results, err := outResults(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(b, " %s", results)
+		return b.String(), nil
+	}
+	rt := f.Sig.RetType
+	if sig := goIntSigs[f]; sig != nil && sig.result {
+		b.WriteString(" int")
+	} else if !types.Equal(rt, types.Void) {
+		retType := TypedefSpec(returnDITypes[f], rt)
+		if retType == "" {
+			var err error
+			retType, err = TypeSpec(rt)
+			if err != nil {
+				return "", fmt.Errorf("error translating return type: %v", err)
+			}
+		}
+		fmt.Fprintf(b, " %s", retType)
+	}
+	return b.String(), nil
+}
+
+// checkUnsafe returns an error if the -no-unsafe flag was given and the
+// translated code uses package unsafe.
+func checkUnsafe(translated string) error {
+	if *noUnsafe && strings.Contains(translated, "unsafe.") {
+		return errors.New("translation requires package unsafe")
+	}
+	return nil
+}
+
+// untranslated returns a statement to stand in for an instruction that could
+// not be translated.
+func untranslated(node llNode) string {
+	return fmt.Sprintf("panic(%q)", panicPrefix(node)+"untranslated: "+strings.TrimSpace(node.LLString()))
+}
+
+// midBlockPanic wraps a panic statement that isn't at the end of its block.
+// The condition keeps the rest of the block from being unreachable code,
+// which go vet would complain about.
+func midBlockPanic(stmt string) string {
+	return fmt.Sprintf("if true { %s }", stmt)
+}
+
+// TranslateTerminator translates the terminator instruction of block b, which
+// is part of function f. If last is true, b is the last block in the function.
+// The result includes the phi assignments for the branches taken, and is
+// formatted as complete lines of Go code.
+func TranslateTerminator(f *ir.Func, b *ir.Block, last bool) (string, error) {
+	out := new(bytes.Buffer)
+	switch term := b.Term.(type) {
+	case *ir.TermBr:
+		if err := branch(out, b, term.Target, "\t"); err != nil {
+			return "", err
+		}
+
+	case *ir.TermCondBr:
+		if target, ok := constantTarget(term); ok {
+			if err := branch(out, b, target, "\t"); err != nil {
+				return "", err
+			}
+			break
+		}
+		cond, err := FormatValue(term.Cond)
+		if err != nil {
+			return "", fmt.Errorf("error translating condition (%v): %v", term.Cond, err)
+		}
+		fmt.Fprintf(out, "\tif %s {\n", cond)
+		if err := branch(out, b, term.TargetTrue, "\t\t"); err != nil {
+			return "", err
+		}
+		fmt.Fprintln(out, "\t} else {")
+		if err := branch(out, b, term.TargetFalse, "\t\t"); err != nil {
+			return "", err
+		}
+		fmt.Fprintln(out, "\t}")
+
+	case *ir.TermRet:
+		if OutParams[f] != nil {
+			retVal := ""
+			if term.X != nil {
+				var err error
+				retVal, err = FormatValue(term.X)
+				if err != nil {
+					return "", fmt.Errorf("error translating return value (%v): %v", term.X, err)
+				}
+			}
+			fmt.Fprintf(out, "\t%s\n", outReturn(f, retVal))
+			break
+		}
+		if term.X == nil {
+			// void return
+			if !last {
+				// At the end of the function, the return statement can be
+				// left out.
+				fmt.Fprintln(out, "\treturn")
+			}
+			break
+		}
+		retVal, err := FormatValue(term.X)
+		if err != nil {
+			return "", fmt.Errorf("error translating return value (%v): %v", term.X, err)
+		}
+		if isMainFunc(f) {
+			if c, ok := term.X.(*constant.Int); ok && c.X.Sign() == 0 && last {
+				// Returning from main exits with status 0 anyway.
+				break
+			}
+			fmt.Fprintf(out, "\tos.Exit(int(%s))\n", retVal)
+		} else if sig := goIntSigs[f]; sig != nil && sig.result {
+			fmt.Fprintf(out, "\treturn int(%s)\n", retVal)
+		} else {
+			fmt.Fprintf(out, "\treturn %s\n", retVal)
+		}
+
+	case *ir.TermCallBr:
+		if err := translateCallBr(out, f, b, term); err != nil {
+			return "", err
+		}
+
+	case *ir.TermCatchRet:
+		if err := branch(out, b, term.Target, "\t"); err != nil {
+			return "", err
+		}
+
+	case *ir.TermCatchSwitch:
+		if err := translateCatchSwitch(out, b, term); err != nil {
+			return "", err
+		}
+
+	case *ir.TermCleanupRet:
+		if err := translateCleanupRet(out, b, term); err != nil {
+			return "", err
+		}
+
+	case *ir.TermIndirectBr:
+		if err := translateIndirectBr(out, f, b, term); err != nil {
+			return "", err
+		}
+
+	case *ir.TermInvoke:
+		if err := translateInvoke(out, b, term); err != nil {
+			return "", err
+		}
+
+	case *ir.TermResume:
+		s, err := translateResume(term)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(s)
+
+	case *ir.TermUnreachable:
+		if endsInTrap(b) {
+			break
+		}
+		fmt.Fprintf(out, "\tpanic(%q)\n", panicPrefix(term)+"unreachable code reached")
+
+	case *ir.TermSwitch:
+		// Cases that branch to the same block share a clause (since the phi
+		// assignments are the same too), and cases that branch to the
+		// default block are left out.
+		var targets []value.Value
+		values := make(map[value.Value][]string)
+		for _, c := range term.Cases {
+			if c.Target == term.TargetDefault {
+				continue
+			}
+			x, err := FormatEnumValue(c.X, term.X)
+			if err != nil {
+				return "", fmt.Errorf("error translating case value (%v): %v", c.X, err)
+			}
+			if _, ok := values[c.Target]; !ok {
+				targets = append(targets, c.Target)
+			}
+			values[c.Target] = append(values[c.Target], x)
+		}
+		if len(targets) == 0 {
+			if err := branch(out, b, term.TargetDefault, "\t"); err != nil {
+				return "", err
+			}
+			break
+		}
+		x, err := FormatValue(term.X)
+		if err != nil {
+			return "", fmt.Errorf("error translating control value (%v): %v", term.X, err)
+		}
+		fmt.Fprintf(out, "\tswitch %s {\n", x)
+		for _, t := range targets {
+			fmt.Fprintf(out, "\tcase %s:\n", strings.Join(values[t], ", "))
+			if err := branch(out, b, t, "\t\t"); err != nil {
+				return "", err
+			}
+		}
+		fmt.Fprint(out, "\tdefault:\n")
+		if err := branch(out, b, term.TargetDefault, "\t\t"); err != nil {
+			return "", err
+		}
+		fmt.Fprint(out, "\t}\n")
+
+	default:
+		return "", fmt.Errorf("unsupported block terminator type: %T", term)
+	}
+	return out.String(), nil
+}
+
+// branch writes the phi assignments and goto statement for a branch from
+// block from to block to, indented by indent.
+func branch(out io.Writer, from, to value.Value, indent string) error {
+	phis, err := PhiAssignments(from, to)
+	if err != nil {
+		return fmt.Errorf("error translating phi nodes: %v", err)
+	}
+	if phis != "" {
+		fmt.Fprintf(out, "%s%s\n", indent, phis)
+	}
+	fmt.Fprintf(out, "%sgoto %s\n", indent, BlockName(to))
+	return nil
+}
+
+// constantTarget returns the block that term always branches to, if its
+// condition is a constant or both of its targets are the same.
+func constantTarget(term *ir.TermCondBr) (value.Value, bool) {
+	if term.TargetTrue == term.TargetFalse {
+		return term.TargetTrue, true
+	}
+	if c, ok := term.Cond.(*constant.Int); ok {
+		if c.X.Sign() != 0 {
+			return term.TargetTrue, true
+		}
+		return term.TargetFalse, true
+	}
+	return nil, false
+}
+
+// reachableBlocks returns the blocks of f that can be reached from its entry
+// block. The others are left out of the translation, since Go doesn't allow
+// a label that no goto statement refers to.
+func reachableBlocks(f *ir.Func) map[*ir.Block]bool {
+	reachable := make(map[*ir.Block]bool)
+	var visit func(b *ir.Block)
+	visit = func(b *ir.Block) {
+		if reachable[b] {
+			return
+		}
+		reachable[b] = true
+		for _, s := range successors(b) {
+			visit(s)
+		}
+	}
+	if len(f.Blocks) > 0 {
+		visit(f.Blocks[0])
+	}
+	return reachable
+}
+
+// successors returns the blocks that b's terminator can branch to. (For a
+// conditional branch on a constant, that is only the one it always takes.)
+func successors(b *ir.Block) []*ir.Block {
+	var targets []value.Value
+	switch term := b.Term.(type) {
+	case *ir.TermBr:
+		targets = append(targets, term.Target)
+	case *ir.TermCondBr:
+		if target, ok := constantTarget(term); ok {
+			targets = append(targets, target)
+		} else {
+			targets = append(targets, term.TargetTrue, term.TargetFalse)
+		}
+	case *ir.TermSwitch:
+		for _, c := range term.Cases {
+			targets = append(targets, c.Target)
+		}
+		targets = append(targets, term.TargetDefault)
+	case *ir.TermCallBr:
+		// Only the default destination is ever taken (see translateCallBr).
+		targets = append(targets, term.NormalRetTarget)
+	case *ir.TermCatchSwitch:
+		if target := catchSwitchTarget(term); target != nil {
+			targets = append(targets, target)
+		}
+	default:
+		// Anything else may branch to any block it mentions.
+		targets = References(term)
+	}
+	var blocks []*ir.Block
+	for _, t := range targets {
+		if b, ok := t.(*ir.Block); ok {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks
+}
+
+// isMainFunc reports whether f is the C main function, which is translated
+// as the Go main function if the output is package main.
+func isMainFunc(f *ir.Func) bool {
+	return f.Name() == "main" && *packageName == "main"
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNoUnsafe(t *testing.T) {
+	t.Parallel()
+	src := `
+%pair = type { i32, i32 }
+
+define i32 @sum(i32 %n) {
+entry:
+  %a = alloca i32, i32 %n
+  %p = alloca %pair
+  %f1 = getelementptr %pair, %pair* %p, i32 0, i32 1
+  store i32 %n, i32* %f1
+  %buf = alloca [4 x i8]
+  %b0 = getelementptr [4 x i8], [4 x i8]* %buf, i64 0, i64 0
+  %b2 = getelementptr i8, i8* %b0, i64 2
+  store i8 5, i8* %b2
+  %c = load i8, i8* %b2
+  %cx = zext i8 %c to i32
+  %x = load i32, i32* %f1
+  %r = add i32 %x, %cx
+  %empty = icmp eq i32 %n, 0
+  br i1 %empty, label %done, label %fill
+
+fill:
+  store i32 100, i32* %a
+  %y = load i32, i32* %a
+  %r2 = add i32 %r, %y
+  ret i32 %r2
+
+done:
+  ret i32 %r
+}
+`
+	code, _ := translate(t, src, "-no-unsafe")
+	if strings.Contains(code, "unsafe") {
+		t.Errorf("generated code uses unsafe:\n%s", numberLines(code))
+	}
+	// A zero-length alloca still has an address.
+	got := runGo(t, code, mainCalling("sum(0)", "sum(3)"))
+	if want := "5\n108\n"; got != want {
+		t.Errorf("output:\n%s\nwant:\n%s\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+
+	output := translateError(t, `
+define i64 @addr(i32* %p) {
+  %x = ptrtoint i32* %p to i64
+  ret i64 %x
+}
+`, "-no-unsafe", "-color=never")
+	if !strings.Contains(output, "translation requires package unsafe") {
+		t.Errorf("ptrtoint wasn't reported as needing unsafe:\n%s", output)
+	}
+}
+
+func TestUnreachableBlocks(t *testing.T) {
+	t.Parallel()
+	src := `
+define i32 @pick(i32 %x) {
+entry:
+  br i1 true, label %yes, label %no
+
+yes:
+  %y = add i32 %x, 1
+  br i1 false, label %dead, label %same
+
+same:
+  %c = icmp sgt i32 %y, 10
+  br i1 %c, label %out, label %out
+
+no:
+  br label %dead
+
+dead:
+  %d = phi i32 [ 0, %no ], [ 1, %yes ]
+  ret i32 %d
+
+out:
+  ret i32 %y
+}
+`
+	code, _ := translate(t, src)
+	for _, label := range []string{"no:", "dead:"} {
+		if strings.Contains(code, "\n"+label) {
+			t.Errorf("unreachable block %s translated:\n%s", label, numberLines(code))
+		}
+	}
+	if strings.Contains(code, "if true") || strings.Contains(code, "if false") {
+		t.Errorf("constant condition kept:\n%s", numberLines(code))
+	}
+	if got, want := runGo(t, code, mainCalling("pick(4)", "pick(20)")), "5\n21\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestSwitchCases(t *testing.T) {
+	t.Parallel()
+	src := `
+define i32 @classify(i32 %x) {
+entry:
+  switch i32 %x, label %other [
+    i32 1, label %small
+    i32 2, label %small
+    i32 3, label %small
+    i32 10, label %big
+    i32 99, label %other
+  ]
+
+small:
+  br label %exit
+
+big:
+  br label %exit
+
+other:
+  br label %exit
+
+exit:
+  %r = phi i32 [ 1, %small ], [ 2, %big ], [ 0, %other ]
+  ret i32 %r
+}
+
+define i32 @onlyDefault(i32 %x) {
+entry:
+  switch i32 %x, label %d [
+    i32 5, label %d
+  ]
+
+d:
+  ret i32 7
+}
+`
+	code, _ := translate(t, src)
+	for _, s := range []string{"case 1, 2, 3:", "case 10:"} {
+		if !strings.Contains(code, s) {
+			t.Errorf("missing %q:\n%s", s, numberLines(code))
+		}
+	}
+	if strings.Contains(code, "case 99") || strings.Contains(code, "case 5") {
+		t.Errorf("case for the default block kept:\n%s", numberLines(code))
+	}
+	mainSrc := mainCalling("classify(1)", "classify(3)", "classify(10)", "classify(99)", "classify(4)", "onlyDefault(5)")
+	if got, want := runGo(t, code, mainSrc), "1\n1\n2\n0\n0\n7\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestReturns(t *testing.T) {
+	t.Parallel()
+	src := `
+@calls = global i32 0
+
+declare void @report(i32)
+
+define void @bump(i1 %skip) {
+entry:
+  br i1 %skip, label %early, label %body
+
+early:
+  ret void
+
+body:
+  %c = load i32, i32* @calls
+  %n = add i32 %c, 1
+  store i32 %n, i32* @calls
+  ret void
+}
+
+define i32 @main() {
+  call void @bump(i1 false)
+  call void @bump(i1 true)
+  call void @bump(i1 false)
+  %c = load i32, i32* @calls
+  call void @report(i32 %c)
+  ret i32 0
+}
+`
+	code, _ := translate(t, src)
+	if strings.Contains(code, "os.Exit(int(0))") {
+		t.Errorf("main ends with os.Exit(0):\n%s", numberLines(code))
+	}
+	if !strings.Contains(code, "\treturn\n") {
+		t.Errorf("early void return left out:\n%s", numberLines(code))
+	}
+	mainSrc := `package main
+
+import "fmt"
+
+func report(x int32) {
+	fmt.Println(x)
+}
+`
+	if got := runGo(t, code, mainSrc); got != "2\n" {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, "2\n", numberLines(code))
+	}
+}
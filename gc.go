@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// Frontends for garbage-collected languages wrap calls in
+// llvm.experimental.gc.statepoint and llvm.experimental.patchpoint, so that
+// the collector can find and relocate pointers. Go's collector doesn't need
+// that help, so these are unwrapped to the underlying calls. The result of a
+// statepoint (picked up later by gc.result) is stored in the variable for its
+// token, and gc.relocate just returns its pointer unchanged.
+
+// isStatepoint reports whether v is a call to llvm.experimental.gc.statepoint.
+func isStatepoint(v value.Value) bool {
+	call, ok := v.(*ir.InstCall)
+	if !ok {
+		return false
+	}
+	f, ok := call.Callee.(*ir.Func)
+	return ok && strings.HasPrefix(f.Name(), "llvm.experimental.gc.statepoint.")
+}
+
+// statepointTarget returns the function called by a statepoint, and its
+// arguments.
+func statepointTarget(call *ir.InstCall) (*ir.Func, []value.Value, error) {
+	if len(call.Args) < 5 {
+		return nil, nil, fmt.Errorf("too few arguments to statepoint")
+	}
+	target, err := directCallee(call.Args[2])
+	if err != nil {
+		return nil, nil, err
+	}
+	n, ok := intArg(call.Args[3])
+	if !ok || 5+n > len(call.Args) {
+		return nil, nil, fmt.Errorf("invalid argument count for statepoint: %v", call.Args[3])
+	}
+	return target, call.Args[5 : 5+n], nil
+}
+
+// ValueType returns the type of the Go variable for v. Usually this is just
+// v's type, but the token produced by a statepoint holds the result of the
+// call instead, and the tokens produced by Windows exception pads hold
+// exception pointers.
+func ValueType(v value.Value) types.Type {
+	if isPad(v) {
+		return types.I8Ptr
+	}
+	if isStatepoint(v) {
+		if target, _, err := statepointTarget(v.(*ir.InstCall)); err == nil {
+			return target.Sig.RetType
+		}
+	}
+	return v.Type()
+}
+
+// directCallee unwraps bitcasts to find the function that v points to.
+func directCallee(v value.Value) (*ir.Func, error) {
+	for {
+		switch x := v.(type) {
+		case *ir.Arg:
+			v = x.Value
+		case *constant.ExprBitCast:
+			v = x.From
+		case *ir.Func:
+			return x, nil
+		default:
+			return nil, fmt.Errorf("unsupported call target: %v", v)
+		}
+	}
+}
+
+// isNullTarget reports whether v (the target of a patchpoint) is a null
+// pointer.
+func isNullTarget(v value.Value) bool {
+	for {
+		switch x := v.(type) {
+		case *ir.Arg:
+			v = x.Value
+		case *constant.ExprBitCast:
+			v = x.From
+		case *constant.ExprIntToPtr:
+			c, ok := x.From.(*constant.Int)
+			return ok && c.X.Sign() == 0
+		case *constant.Null:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// intArg returns the value of an integer constant argument.
+func intArg(v value.Value) (int, bool) {
+	if a, ok := v.(*ir.Arg); ok {
+		v = a.Value
+	}
+	c, ok := v.(*constant.Int)
+	if !ok || !c.X.IsInt64() {
+		return 0, false
+	}
+	return int(c.X.Int64()), true
+}
+
+// formatPointerAs formats the pointer v, converting it to type t if
+// necessary.
+func formatPointerAs(v value.Value, t types.Type) (string, error) {
+	p, err := FormatValue(v)
+	if err != nil {
+		return "", err
+	}
+	if types.Equal(v.Type(), t) {
+		return p, nil
+	}
+	spec, err := TypeSpec(t)
+	if err != nil {
+		return "", fmt.Errorf("error translating type (%v): %v", t, err)
+	}
+	return fmt.Sprintf("(%s)(unsafe.Pointer(%s))", spec, p), nil
+}
+
+// formatCall formats a call to f.
+func formatCall(f *ir.Func, args []value.Value) (string, error) {
+	s := make([]string, len(args))
+	for i, a := range args {
+		v, err := FormatValue(a)
+		if err != nil {
+			return "", fmt.Errorf("error translating argument %d (%v): %v", i, a, err)
+		}
+		s[i] = v
+	}
+	return fmt.Sprintf("%s(%s)", GlobalRef(f), strings.Join(s, ", ")), nil
+}
+
+// GCIntrinsic translates calls to the statepoint, patchpoint, and stackmap
+// intrinsics. If name is not the name of one of them, it returns ok == false.
+func GCIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	switch {
+	case strings.HasPrefix(name, "llvm.experimental.gc.statepoint."):
+		target, args, err := statepointTarget(inst)
+		if err != nil {
+			return "", true, err
+		}
+		call, err := formatCall(target, args)
+		if err != nil {
+			return "", true, err
+		}
+		if types.Equal(target.Sig.RetType, types.Void) {
+			return call, true, nil
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), call), true, nil
+
+	case strings.HasPrefix(name, "llvm.experimental.gc.result."):
+		tok, ok := inst.Args[0].(*ir.InstCall)
+		if !ok || !isStatepoint(tok) {
+			return "", true, fmt.Errorf("gc.result of something other than a statepoint: %v", inst.Args[0])
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), VariableName(tok)), true, nil
+
+	case strings.HasPrefix(name, "llvm.experimental.gc.relocate."):
+		tok, ok := inst.Args[0].(*ir.InstCall)
+		if !ok || !isStatepoint(tok) {
+			return "", true, fmt.Errorf("gc.relocate of something other than a statepoint: %v", inst.Args[0])
+		}
+		i, ok := intArg(inst.Args[2])
+		if !ok || i >= len(tok.Args) {
+			return "", true, fmt.Errorf("invalid index for gc.relocate: %v", inst.Args[2])
+		}
+		ptr := tok.Args[i]
+		p, err := formatPointerAs(ptr, inst.Type())
+		if err != nil {
+			return "", true, fmt.Errorf("error translating relocated pointer (%v): %v", ptr, err)
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), p), true, nil
+
+	case strings.HasPrefix(name, "llvm.experimental.patchpoint."):
+		if len(inst.Args) < 4 {
+			return "", true, fmt.Errorf("too few arguments to patchpoint")
+		}
+		if isNullTarget(inst.Args[2]) {
+			// There is nothing to call until the code is patched at run time,
+			// so the result is just the zero value.
+			if types.Equal(inst.Type(), types.Void) {
+				return "", true, nil
+			}
+			zero, err := zeroValue(inst.Type())
+			if err != nil {
+				return "", true, err
+			}
+			return fmt.Sprintf("%s = %s", VariableName(inst), zero), true, nil
+		}
+		target, err := directCallee(inst.Args[2])
+		if err != nil {
+			return "", true, err
+		}
+		n, ok := intArg(inst.Args[3])
+		if !ok || 4+n > len(inst.Args) {
+			return "", true, fmt.Errorf("invalid argument count for patchpoint: %v", inst.Args[3])
+		}
+		call, err := formatCall(target, inst.Args[4:4+n])
+		if err != nil {
+			return "", true, err
+		}
+		if types.Equal(inst.Type(), types.Void) {
+			return call, true, nil
+		}
+		if !types.Equal(inst.Type(), target.Sig.RetType) {
+			// The patchpoint is declared with a result type of its own, which
+			// needn't match the target function's.
+			t, err := TypeSpec(inst.Type())
+			if err != nil {
+				return "", true, fmt.Errorf("error translating type (%v): %v", inst.Type(), err)
+			}
+			_, fromPointer := target.Sig.RetType.(*types.PointerType)
+			if _, toPointer := inst.Type().(*types.PointerType); toPointer && fromPointer {
+				call = fmt.Sprintf("(%s)(unsafe.Pointer(%s))", t, call)
+			} else {
+				call = fmt.Sprintf("%s(%s)", t, call)
+			}
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), call), true, nil
+
+	case name == "llvm.experimental.stackmap":
+		return "", true, nil
+	}
+	return "", false, nil
+}
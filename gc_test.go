@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestGCIntrinsics(t *testing.T) {
+	t.Parallel()
+	src := `
+declare token @llvm.experimental.gc.statepoint.p0f_i32i32f(i64, i32, i32 (i32)*, i32, i32, ...)
+declare i32 @llvm.experimental.gc.result.i32(token)
+declare i32* @llvm.experimental.gc.relocate.p0i32(token, i32, i32)
+declare i64 @llvm.experimental.patchpoint.i64(i64, i32, i8*, i32, ...)
+declare i8* @llvm.experimental.patchpoint.p0i8(i64, i32, i8*, i32, ...)
+declare void @llvm.experimental.stackmap(i64, i32, ...)
+
+define i32 @double(i32 %x) {
+  %r = mul i32 %x, 2
+  ret i32 %r
+}
+
+define i64 @wide(i64 %x) {
+  %r = add i64 %x, 1
+  ret i64 %r
+}
+
+define i32 @viaStatepoint(i32 %x, i32* %p) {
+  %tok = call token (i64, i32, i32 (i32)*, i32, i32, ...) @llvm.experimental.gc.statepoint.p0f_i32i32f(i64 0, i32 0, i32 (i32)* @double, i32 1, i32 0, i32 %x, i32 0, i32 0, i32* %p)
+  %r = call i32 @llvm.experimental.gc.result.i32(token %tok)
+  %q = call i32* @llvm.experimental.gc.relocate.p0i32(token %tok, i32 8, i32 8)
+  %y = load i32, i32* %q
+  %s = add i32 %r, %y
+  call void (i64, i32, ...) @llvm.experimental.stackmap(i64 1, i32 0, i32 %s)
+  ret i32 %s
+}
+
+define i64 @viaPatchpoint(i64 %x) {
+  %r = call i64 (i64, i32, i8*, i32, ...) @llvm.experimental.patchpoint.i64(i64 2, i32 15, i8* bitcast (i64 (i64)* @wide to i8*), i32 1, i64 %x)
+  ret i64 %r
+}
+
+define i64 @unpatched(i64 %x) {
+  %r = call i64 (i64, i32, i8*, i32, ...) @llvm.experimental.patchpoint.i64(i64 3, i32 15, i8* null, i32 1, i64 %x)
+  ret i64 %r
+}
+
+define i1 @unpatchedPointer() {
+  %p = call i8* (i64, i32, i8*, i32, ...) @llvm.experimental.patchpoint.p0i8(i64 4, i32 15, i8* null, i32 0)
+  %n = icmp eq i8* %p, null
+  ret i1 %n
+}
+`
+	checkProgram(t, src, `package main
+
+import "fmt"
+
+func main() {
+	y := int32(5)
+	fmt.Println(viaStatepoint(10, &y))
+	fmt.Println(viaPatchpoint(41))
+	fmt.Println(unpatched(41))
+	fmt.Println(unpatchedPointer())
+}
+`, "25\n42\n0\ntrue\n")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// When leaven is run by go generate, the options can come from the
+// //go:generate line itself, or from a config file named defaultConfigFile
+// in the package directory (which is the working directory under go
+// generate). A different config file can be chosen with -config.
+//
+// The config file contains command-line arguments, separated by spaces or
+// newlines. Lines starting with # are comments. Arguments from the command
+// line come after those from the config file, so they take precedence.
+
+const defaultConfigFile = "leaven.cfg"
+
+// underGoGenerate reports whether leaven is being run by go generate.
+func underGoGenerate() bool {
+	return os.Getenv("GOFILE") != ""
+}
+
+// configArgs returns the arguments from the config file selected by args, if
+// any.
+func configArgs(args []string) ([]string, error) {
+	file := ""
+	for i, a := range args {
+		if a == "--" || !strings.HasPrefix(a, "-") {
+			break
+		}
+		a = strings.TrimPrefix(strings.TrimPrefix(a, "-"), "-")
+		switch {
+		case strings.HasPrefix(a, "config="):
+			file = strings.TrimPrefix(a, "config=")
+		case a == "config" && i+1 < len(args):
+			file = args[i+1]
+		}
+	}
+	if file == "" {
+		if !underGoGenerate() {
+			return nil, nil
+		}
+		if _, err := os.Stat(defaultConfigFile); err != nil {
+			return nil, nil
+		}
+		file = defaultConfigFile
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		result = append(result, strings.Fields(line)...)
+	}
+	return result, nil
+}
+
+// defaultPackage returns the package name to use if -package isn't given.
+func defaultPackage() string {
+	if p := os.Getenv("GOPACKAGE"); p != "" {
+		return p
+	}
+	return "main"
+}
+
+// generatorComment returns the comment that marks the output as generated
+// code.
+func generatorComment(inFile string) string {
+	return "// Code generated by leaven from " + filepath.ToSlash(inFile) + ". DO NOT EDIT.\n\n"
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoGenerate(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "leaven-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mainSrc := `package main
+
+//go:generate ` + leavenBinary + ` -package=main answer.ll
+
+import "fmt"
+
+func main() {
+	fmt.Println(answer())
+}
+`
+	files := map[string]string{
+		"go.mod":  "module gen\n\ngo 1.13\n",
+		"main.go": mainSrc,
+		"answer.ll": `
+define i32 @answer() {
+  ret i32 42
+}
+`,
+		// The output file comes from the config file.
+		"leaven.cfg": "# leaven options\n-o generated_answer.go\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out, err := goCommand(dir, "generate"); err != nil {
+		t.Fatalf("go generate: %v\n%s", err, out)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "generated_answer.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(b)
+	if !strings.HasPrefix(code, "// Code generated by leaven from answer.ll. DO NOT EDIT.\n\npackage main\n") {
+		t.Errorf("generated code doesn't start with the generated-code comment and package clause:\n%s", numberLines(code))
+	}
+	if got := runGo(t, code, mainSrc); got != "42\n" {
+		t.Errorf("output: %q, want %q", got, "42\n")
+	}
+}
+
+func TestPackageFromGoGenerate(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "leaven-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := `
+define i32 @answer() {
+  ret i32 42
+}
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "answer.ll"), []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(leavenBinary, "answer.ll")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOPACKAGE=answers", "GOFILE=doc.go")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("leaven failed: %v\n%s", err, out)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "answer.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(b)
+	if !strings.Contains(code, "\npackage answers\n") {
+		t.Errorf("generated code isn't in package answers:\n%s", numberLines(code))
+	}
+	vetGo(t, code, "package answers\n")
+}
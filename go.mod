@@ -1,8 +1,9 @@
 module github.com/andybalholm/leaven
 
-go 1.13
+go 1.14
 
 require (
 	github.com/llir/llvm v0.3.0
+	github.com/mewmew/float v0.0.0-20191226120903-16bbe2fdd85e
 	golang.org/x/sys v0.0.0-20191228213918-04cbcbbfeed8
 )
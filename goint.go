@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// With -go-int, the parameters and results of externally visible functions
+// that are C's long (or, with -go-int=all, int as well) are declared as Go's
+// int, which is friendlier for callers of the translated package. Inside the
+// function, the values are converted to the fixed-size types that the rest of
+// the translation uses, so arithmetic still wraps at the same width as in C.
+//
+// Functions whose addresses are taken keep their original signatures, since
+// their Go types have to match the function pointer types they are used as.
+
+// pointerSize is the size of a pointer in bits, according to the module's data
+// layout.
+var pointerSize = 64
+
+// SetPointerSize sets pointerSize from an LLVM data layout string.
+func SetPointerSize(dataLayout string) {
+	for _, spec := range strings.Split(dataLayout, "-") {
+		if strings.HasPrefix(spec, "p:") || strings.HasPrefix(spec, "p0:") {
+			var size int
+			if _, err := fmt.Sscanf(spec[strings.Index(spec, ":")+1:], "%d", &size); err == nil {
+				pointerSize = size
+			}
+		}
+	}
+}
+
+// A goIntSig records which parameters and result of a function are declared
+// as int.
+type goIntSig struct {
+	params []bool
+	result bool
+}
+
+var goIntSigs = make(map[*ir.Func]*goIntSig)
+
+// goParamNames holds the names used in the function signature for parameters
+// declared as int. Inside the function, the converted value has the name in
+// valueNames.
+var goParamNames = make(map[*ir.Param]string)
+
+// isGoInt reports whether values of type t should be declared as int under
+// mode.
+func isGoInt(t types.Type, mode string) bool {
+	it, ok := t.(*types.IntType)
+	if !ok {
+		return false
+	}
+	switch mode {
+	case "long":
+		return int(it.BitSize) == pointerSize
+	case "all":
+		return int(it.BitSize) == pointerSize || (it.BitSize == 32 && pointerSize == 64)
+	}
+	return false
+}
+
+// FindGoIntSignatures decides which functions in m get int parameters or
+// results, according to mode (the value of the -go-int flag).
+func FindGoIntSignatures(m *ir.Module, mode string) {
+	if mode == "" {
+		return
+	}
+
+	addressTaken := make(map[value.Value]bool)
+	note := func(refs []value.Value) {
+		for _, r := range refs {
+			addressTaken[r] = true
+		}
+	}
+	for _, g := range m.Globals {
+		if g.Init != nil {
+			note(References(g.Init))
+		}
+	}
+	for _, f := range m.Funcs {
+		for _, b := range f.Blocks {
+			for _, inst := range b.Insts {
+				if call, ok := inst.(*ir.InstCall); ok {
+					for _, a := range call.Args {
+						note(References(a))
+					}
+					continue
+				}
+				note(References(inst))
+			}
+			note(References(b.Term))
+		}
+	}
+
+	for _, f := range m.Funcs {
+		if f.Blocks == nil || isMainFunc(f) || OutParams[f] != nil || addressTaken[f] {
+			continue
+		}
+		if f.Linkage != enum.LinkageNone && f.Linkage != enum.LinkageExternal {
+			continue
+		}
+		sig := &goIntSig{params: make([]bool, len(f.Params))}
+		found := false
+		for i, p := range f.Params {
+			if isGoInt(p.Typ, mode) {
+				sig.params[i] = true
+				found = true
+			}
+		}
+		if isGoInt(f.Sig.RetType, mode) {
+			sig.result = true
+			found = true
+		}
+		if found {
+			goIntSigs[f] = sig
+		}
+	}
+}
+
+// renameGoIntParams gives the parameters of f that are declared as int new
+// names for use inside the function, and records their original names for
+// the signature.
+func renameGoIntParams(f *ir.Func, s *scope) {
+	sig := goIntSigs[f]
+	if sig == nil {
+		return
+	}
+	for i, p := range f.Params {
+		if sig.params[i] {
+			goParamNames[p] = VariableName(p)
+			valueNames[p] = s.unique(VariableName(p))
+		}
+	}
+}
+
+// goIntConversions returns the declarations that convert f's int parameters
+// to their fixed-size types, and the names of the variables declared.
+func goIntConversions(f *ir.Func) (decls, names []string, err error) {
+	sig := goIntSigs[f]
+	if sig == nil {
+		return nil, nil, nil
+	}
+	for i, p := range f.Params {
+		if !sig.params[i] {
+			continue
+		}
+		t, err := TypeSpec(p.Typ)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error translating type for parameter %d: %v", i, err)
+		}
+		decls = append(decls, fmt.Sprintf("var %s = %s(%s)", VariableName(p), t, goParamNames[p]))
+		names = append(names, VariableName(p))
+	}
+	return decls, names, nil
+}
+
+// goIntCall translates a call to f, a function with int parameters or
+// results.
+func goIntCall(inst *ir.InstCall, f *ir.Func, callee string, args []string) (string, error) {
+	sig := goIntSigs[f]
+	for i := range args {
+		if i < len(sig.params) && sig.params[i] {
+			if _, err := strconv.ParseInt(args[i], 10, 64); err == nil {
+				// Untyped constants don't need converting.
+				continue
+			}
+			args[i] = fmt.Sprintf("int(%s)", args[i])
+		}
+	}
+	call := fmt.Sprintf("%s(%s)", callee, strings.Join(args, ", "))
+	if types.Equal(inst.Type(), types.Void) {
+		return call, nil
+	}
+	if sig.result {
+		t, err := TypeSpec(inst.Type())
+		if err != nil {
+			return "", fmt.Errorf("error translating type (%v): %v", inst.Type(), err)
+		}
+		call = fmt.Sprintf("%s(%s)", t, call)
+	}
+	return fmt.Sprintf("%s = %s", VariableName(inst), call), nil
+}
+
+// checkGoIntMode returns an error if mode is not a valid value for the
+// -go-int flag.
+func checkGoIntMode(mode string) error {
+	switch mode {
+	case "", "long", "all":
+		return nil
+	}
+	return fmt.Errorf("invalid value for -go-int: %q (want long or all)", mode)
+}
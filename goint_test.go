@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGoInt(t *testing.T) {
+	t.Parallel()
+	src := `
+target datalayout = "e-m:e-i64:64-n32:64-S128"
+
+@callback = global i64 (i64)* @negate
+
+define i64 @scale(i64 %n, i32 %k) {
+  %k64 = sext i32 %k to i64
+  %r = mul i64 %n, %k64
+  ret i64 %r
+}
+
+define i64 @twice(i64 %n) {
+  %r = call i64 @scale(i64 %n, i32 2)
+  ret i64 %r
+}
+
+define i64 @negate(i64 %n) {
+  %r = sub i64 0, %n
+  ret i64 %r
+}
+`
+	for _, c := range []struct {
+		mode string
+		sigs []string
+	}{
+		{"long", []string{"func scale(n int, k int32) int", "func twice(n int) int", "func negate(n int64) int64"}},
+		{"all", []string{"func scale(n int, k int) int", "func twice(n int) int", "func negate(n int64) int64"}},
+	} {
+		code, _ := translate(t, src, "-go-int="+c.mode)
+		for _, sig := range c.sigs {
+			if !strings.Contains(code, sig) {
+				t.Errorf("-go-int=%s: missing %q:\n%s", c.mode, sig, numberLines(code))
+			}
+		}
+		mainSrc := mainCalling("scale(1<<40, 3)", "twice(-21)", "negate(5)", "callback(7)")
+		if got, want := runGo(t, code, mainSrc), "3298534883328\n-42\n-5\n-7\n"; got != want {
+			t.Errorf("-go-int=%s: output %q, want %q\ngenerated code:\n%s", c.mode, got, want, numberLines(code))
+		}
+	}
+}
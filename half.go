@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/andybalholm/leaven/libc"
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// LLVM's half type is translated as libc.Float16, which holds the bits of
+// the value. The instructions that operate on it convert their operands to
+// float32 (which holds any half value exactly), and round the results back.
+// Vectors of half are handled the same way, one lane at a time.
+
+// isHalf reports whether t is the half type.
+func isHalf(t types.Type) bool {
+	ft, ok := t.(*types.FloatType)
+	return ok && ft.Kind == types.FloatKindHalf
+}
+
+// halfConstant formats a half constant as its bits.
+func halfConstant(c *constant.Float) string {
+	f, _ := c.X.Float64()
+	if c.NaN {
+		// The sign of a NaN is stored in X.
+		f = math.Copysign(math.NaN(), f)
+	}
+	h := libc.Float16FromFloat64(f)
+	return fmt.Sprintf("libc.Float16(%#04x)", uint16(h))
+}
+
+// halfLanes reports whether t is half or a vector of half, and which one.
+func halfLanes(t types.Type) (ok, vector bool) {
+	if vt, isVector := t.(*types.VectorType); isVector {
+		return isHalf(vt.ElemType), true
+	}
+	return isHalf(t), false
+}
+
+// laneOperands formats x, and y if it isn't nil. For vectors, it also returns
+// the expressions for their lanes, in a loop over the lanes of x that has v
+// for the lane of x and i for its index; for scalars, the lanes are x and y
+// themselves.
+func laneOperands(x, y value.Value, vector bool) (xs, xLane, yLane string, err error) {
+	xs, err = FormatValue(x)
+	if err != nil {
+		return "", "", "", fmt.Errorf("error translating operand (%v): %v", x, err)
+	}
+	xLane = xs
+	if vector {
+		xLane = "lane_v"
+	}
+	if y != nil {
+		yLane, err = FormatValue(y)
+		if err != nil {
+			return "", "", "", fmt.Errorf("error translating operand (%v): %v", y, err)
+		}
+		if vector {
+			yLane = parenthesize(yLane) + "[lane_i]"
+		}
+	}
+	return xs, xLane, yLane, nil
+}
+
+// laneAssignment assigns expr to dest, or for vectors, assigns it to each
+// lane of dest in a loop over the vector x (see laneOperands).
+func laneAssignment(dest value.Named, vector bool, x, expr string) string {
+	if vector {
+		return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = %s }", x, VariableName(dest), expr)
+	}
+	return fmt.Sprintf("%s = %s", VariableName(dest), expr)
+}
+
+// HalfInstruction translates the instructions that operate on half values
+// (or vectors of them), or convert to or from them. For other instructions,
+// it returns ok == false.
+func HalfInstruction(inst ir.Instruction) (result string, ok bool, err error) {
+	switch inst := inst.(type) {
+	case *ir.InstFAdd:
+		return halfArithmetic(inst, inst.Typ, "+", inst.X, inst.Y)
+	case *ir.InstFSub:
+		return halfArithmetic(inst, inst.Typ, "-", inst.X, inst.Y)
+	case *ir.InstFMul:
+		return halfArithmetic(inst, inst.Typ, "*", inst.X, inst.Y)
+	case *ir.InstFDiv:
+		return halfArithmetic(inst, inst.Typ, "/", inst.X, inst.Y)
+	case *ir.InstFRem:
+		return halfArithmetic(inst, inst.Typ, "%", inst.X, inst.Y)
+
+	case *ir.InstFNeg:
+		half, vector := halfLanes(inst.Typ)
+		if !half {
+			return "", false, nil
+		}
+		x, lane, _, err := laneOperands(inst.X, nil, vector)
+		if err != nil {
+			return "", true, err
+		}
+		// Flip the sign bit.
+		return laneAssignment(inst, vector, x, lane+" ^ 0x8000"), true, nil
+
+	case *ir.InstFCmp:
+		half, vector := halfLanes(inst.X.Type())
+		if !half {
+			return "", false, nil
+		}
+		x, xLane, yLane, err := laneOperands(inst.X, inst.Y, vector)
+		if err != nil {
+			return "", true, err
+		}
+		cmp, err := floatComparison(inst.Pred, xLane+".Float32()", yLane+".Float32()", types.Float, inst.X, inst.Y)
+		if err != nil {
+			return "", true, err
+		}
+		return laneAssignment(inst, vector, x, cmp), true, nil
+
+	case *ir.InstFPExt:
+		half, vector := halfLanes(inst.From.Type())
+		if !half {
+			return "", false, nil
+		}
+		x, lane, _, err := laneOperands(inst.From, nil, vector)
+		if err != nil {
+			return "", true, err
+		}
+		expr := lane + ".Float32()"
+		to := inst.To
+		if vt, ok := to.(*types.VectorType); ok {
+			to = vt.ElemType
+		}
+		if !types.Equal(to, types.Float) {
+			expr = fmt.Sprintf("float64(%s)", expr)
+		}
+		return laneAssignment(inst, vector, x, expr), true, nil
+
+	case *ir.InstFPTrunc:
+		half, vector := halfLanes(inst.To)
+		if !half {
+			return "", false, nil
+		}
+		x, lane, _, err := laneOperands(inst.From, nil, vector)
+		if err != nil {
+			return "", true, err
+		}
+		from := inst.From.Type()
+		if vt, ok := from.(*types.VectorType); ok {
+			from = vt.ElemType
+		}
+		fn := "libc.Float16FromFloat64"
+		if types.Equal(from, types.Float) {
+			fn = "libc.Float16FromFloat32"
+		}
+		return laneAssignment(inst, vector, x, fmt.Sprintf("%s(%s)", fn, lane)), true, nil
+
+	case *ir.InstSIToFP:
+		return intToHalf(inst, inst.From, inst.To, true)
+	case *ir.InstUIToFP:
+		return intToHalf(inst, inst.From, inst.To, false)
+
+	case *ir.InstFPToSI:
+		return halfToInt(inst, inst.From, inst.To, true)
+	case *ir.InstFPToUI:
+		return halfToInt(inst, inst.From, inst.To, false)
+
+	case *ir.InstBitCast:
+		// The bits are already the value.
+		if !isHalf(inst.From.Type()) && !isHalf(inst.To) {
+			return "", false, nil
+		}
+		if types.Equal(inst.From.Type(), inst.To) {
+			return "", false, nil
+		}
+		x, err := FormatValue(inst.From)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating source (%v): %v", inst.From, err)
+		}
+		t, err := TypeSpec(inst.To)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating type (%v): %v", inst.To, err)
+		}
+		return fmt.Sprintf("%s = %s(%s)", VariableName(inst), t, x), true, nil
+	}
+	return "", false, nil
+}
+
+// halfArithmetic translates a binary floating-point instruction on half
+// values.
+func halfArithmetic(dest value.Named, t types.Type, op string, x, y value.Value) (string, bool, error) {
+	half, vector := halfLanes(t)
+	if !half {
+		return "", false, nil
+	}
+	xs, xLane, yLane, err := laneOperands(x, y, vector)
+	if err != nil {
+		return "", true, err
+	}
+	xLane, yLane = xLane+".Float32()", yLane+".Float32()"
+	expr := fmt.Sprintf("libc.Float16FromFloat32(%s %s %s)", xLane, op, yLane)
+	if op == "%" {
+		expr = fmt.Sprintf("libc.Float16FromFloat64(math.Mod(float64(%s), float64(%s)))", xLane, yLane)
+	}
+	return laneAssignment(dest, vector, xs, expr), true, nil
+}
+
+// intToHalf translates a sitofp or uitofp instruction that converts to half.
+func intToHalf(dest value.Named, from value.Value, to types.Type, signed bool) (string, bool, error) {
+	half, vector := halfLanes(to)
+	if !half {
+		return "", false, nil
+	}
+	var x, lane string
+	var err error
+	if vector {
+		x, lane, _, err = laneOperands(from, nil, true)
+		if err != nil {
+			return "", true, err
+		}
+		// Give the lane the view of its value that FormatSigned or
+		// FormatUnsigned would.
+		if it, ok := from.Type().(*types.VectorType).ElemType.(*types.IntType); ok && it.BitSize != 1 {
+			if signed {
+				lane = signedElem(it, lane)
+			} else {
+				lane = unsignedElem(it, lane)
+			}
+		}
+	} else {
+		format := FormatUnsigned
+		if signed {
+			format = FormatSigned
+		}
+		lane, err = format(from)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating source (%v): %v", from, err)
+		}
+	}
+	elemType := from.Type()
+	if vt, ok := elemType.(*types.VectorType); ok {
+		elemType = vt.ElemType
+	}
+	switch {
+	case types.Equal(elemType, types.I1) && signed:
+		lane = fmt.Sprintf("-%s(%s)", boolToInt("int32"), lane)
+	case types.Equal(elemType, types.I1):
+		lane = fmt.Sprintf("%s(%s)", boolToInt("int32"), lane)
+	}
+	return laneAssignment(dest, vector, x, fmt.Sprintf("libc.Float16FromFloat64(float64(%s))", lane)), true, nil
+}
+
+// halfToInt translates an fptosi or fptoui instruction that converts from
+// half.
+func halfToInt(dest value.Named, from value.Value, to types.Type, signed bool) (string, bool, error) {
+	half, vector := halfLanes(from.Type())
+	if !half {
+		return "", false, nil
+	}
+	elemType := to
+	if vt, ok := elemType.(*types.VectorType); ok {
+		elemType = vt.ElemType
+	}
+	it, ok := elemType.(*types.IntType)
+	if !ok {
+		return "", true, fmt.Errorf("unsupported destination type for float-to-int conversion: %v", to)
+	}
+	x, lane, _, err := laneOperands(from, nil, vector)
+	if err != nil {
+		return "", true, err
+	}
+	conv, err := floatToIntConversion(types.Float, it, lane+".Float32()", signed, *fpToInt == "saturate")
+	if err != nil {
+		return "", true, err
+	}
+	return laneAssignment(dest, vector, x, conv), true, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const halfSource = `
+define half @addHalf(half %x, half %y) {
+  %r = fadd half %x, %y
+  ret half %r
+}
+
+define half @mulDiv(half %x, half %y) {
+  %p = fmul half %x, %y
+  %r = fdiv half %p, 3.0
+  ret half %r
+}
+
+define half @remainder(half %x, half %y) {
+  %r = frem half %x, %y
+  ret half %r
+}
+
+define half @negate(half %x) {
+  %r = fneg half %x
+  ret half %r
+}
+
+define i1 @unorderedLess(half %x, half %y) {
+  %r = fcmp ult half %x, %y
+  ret i1 %r
+}
+
+define double @extend(half %x) {
+  %r = fpext half %x to double
+  ret double %r
+}
+
+define half @narrow(float %x) {
+  %r = fptrunc float %x to half
+  ret half %r
+}
+
+define i32 @roundTrip(i32 %x) {
+  %h = sitofp i32 %x to half
+  %r = fptosi half %h to i32
+  ret i32 %r
+}
+
+define i16 @halfBits(half %x) {
+  %r = bitcast half %x to i16
+  ret i16 %r
+}
+
+define <4 x half> @addVectors(<4 x half> %x) {
+  %r = fadd <4 x half> %x, <half 1.0, half 0xH3800, half 2048.0, half -1.0>
+  ret <4 x half> %r
+}
+
+define <4 x half> @negateVector(<4 x half> %x) {
+  %r = fneg <4 x half> %x
+  ret <4 x half> %r
+}
+
+define <4 x i1> @lessVector(<4 x half> %x, <4 x half> %y) {
+  %r = fcmp olt <4 x half> %x, %y
+  ret <4 x i1> %r
+}
+
+define <4 x float> @extendVector(<4 x half> %x) {
+  %r = fpext <4 x half> %x to <4 x float>
+  ret <4 x float> %r
+}
+
+define <4 x half> @narrowVector(<4 x double> %x) {
+  %r = fptrunc <4 x double> %x to <4 x half>
+  ret <4 x half> %r
+}
+
+define <4 x i8> @convertVector(<4 x i8> %x) {
+  %s = sitofp <4 x i8> %x to <4 x half>
+  %u = uitofp <4 x i8> %x to <4 x half>
+  %sum = fadd <4 x half> %s, %u
+  %r = fptoui <4 x half> %sum to <4 x i8>
+  ret <4 x i8> %r
+}
+`
+
+func TestHalf(t *testing.T) {
+	t.Parallel()
+	mainSrc := `package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/andybalholm/leaven/libc"
+)
+
+func h(f float32) libc.Float16 { return libc.Float16FromFloat32(f) }
+
+func lanes(v [4]libc.Float16) [4]float32 {
+	var r [4]float32
+	for i, x := range v {
+		r[i] = x.Float32()
+	}
+	return r
+}
+
+func main() {
+	nan := float32(math.NaN())
+	fmt.Println(addHalf(h(1), h(0x1p-11)).Float32(), addHalf(h(1), h(0x1p-10)).Float32(), addHalf(h(65504), h(32)).Float32())
+	fmt.Println(mulDiv(h(3), h(7)).Float32(), remainder(h(7.5), h(2)).Float32())
+	fmt.Println(negate(h(0)) == 0x8000, negate(h(2)).Float32())
+	fmt.Println(unorderedLess(h(nan), h(1)), unorderedLess(h(2), h(1)), unorderedLess(h(1), h(2)))
+	fmt.Println(extend(h(0.1)), narrow(1e-8).Float32(), roundTrip(2049), halfBits(h(1)))
+	fmt.Println(lanes(addVectors([4]libc.Float16{h(1), h(0.25), h(1), h(-1)})))
+	fmt.Println(lanes(negateVector([4]libc.Float16{h(1), h(-2), h(0), h(nan)})))
+	fmt.Println(lessVector([4]libc.Float16{h(1), h(2), h(nan), h(-3)}, [4]libc.Float16{h(2), h(1), h(0), h(-2)}))
+	fmt.Println(extendVector([4]libc.Float16{h(1.5), h(-0.5), h(65504), h(0x1p-24)}))
+	fmt.Println(lanes(narrowVector([4]float64{1.0009765625, 1e6, -2.5, 0x1p-25})))
+	fmt.Println(convertVector([4]byte{1, 2, 0xff, 100}))
+}
+`
+	want := `1 1.0009766 +Inf
+7 1.5
+true -2
+true false true
+0.0999755859375 0 2048 15360
+[2 0.75 2048 -2]
+[-1 2 -0 NaN]
+[true false false true]
+[1.5 -0.5 65504 5.9604645e-08]
+[1.0009766 +Inf -2.5 0]
+[2 4 254 200]
+`
+	checkProgram(t, halfSource, mainSrc, want)
+}
+
+func TestHalfReductionError(t *testing.T) {
+	t.Parallel()
+	src := `
+declare half @llvm.vector.reduce.fmax.v4f16(<4 x half>)
+
+define half @largest(<4 x half> %x) {
+  %r = call half @llvm.vector.reduce.fmax.v4f16(<4 x half> %x)
+  ret half %r
+}
+`
+	output := translateError(t, src, "-color=never")
+	if !strings.Contains(output, "unsupported type for llvm.vector.reduce.fmax.v4f16") {
+		t.Errorf("output doesn't report the unsupported reduction:\n%s", output)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// usedHelpers holds the source code of the helper functions that the
+// generated code calls, keyed by name. They are written at the end of the
+// output file.
+var usedHelpers = make(map[string]string)
+
+// helperNames lists the names of all the helper functions, so that
+// translated values can be kept from using them.
+var helperNames = append([]string{
+	"b2i16", "b2i32", "b2i64", "b2u8",
+	"nswAdd8", "nswAdd16", "nswAdd32", "nswAdd64",
+	"nswSub8", "nswSub16", "nswSub32", "nswSub64",
+	"nswMul8", "nswMul16", "nswMul32", "nswMul64",
+	"saddOv8", "saddOv16", "saddOv32", "saddOv64",
+	"ssubOv8", "ssubOv16", "ssubOv32", "ssubOv64",
+	"smulOv8", "smulOv16", "smulOv32", "smulOv64",
+	"uaddOv8", "uaddOv16", "uaddOv32", "uaddOv64",
+	"usubOv8", "usubOv16", "usubOv32", "usubOv64",
+	"umulOv8", "umulOv16", "umulOv32", "umulOv64",
+	"saddSat8", "saddSat16", "saddSat32", "saddSat64",
+	"ssubSat8", "ssubSat16", "ssubSat32", "ssubSat64",
+	"uaddSat8", "uaddSat16", "uaddSat32", "uaddSat64",
+	"usubSat8", "usubSat16", "usubSat32", "usubSat64",
+}, satConversionNames()...)
+
+// satConversionNames returns the names of the helper functions that
+// saturatingConversion generates, for every width it supports.
+func satConversionNames() []string {
+	var names []string
+	for _, from := range []string{"F32", "F64"} {
+		for _, kind := range []string{"I", "U"} {
+			for bits := 1; bits <= 64; bits++ {
+				names = append(names, fmt.Sprintf("sat%s%s%d", from, kind, bits))
+			}
+			names = append(names, fmt.Sprintf("sat%s%s128", from, kind))
+		}
+	}
+	return names
+}
+
+// UseHelper records that the generated code calls the helper function name,
+// whose source code is src, and returns name.
+func UseHelper(name, src string) string {
+	usedHelpers[name] = src
+	return name
+}
+
+// HelperSource returns the source code for all the helper functions that
+// have been used, sorted by name.
+func HelperSource() string {
+	names := make([]string, 0, len(usedHelpers))
+	for name := range usedHelpers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b := new(strings.Builder)
+	for _, name := range names {
+		b.WriteString(usedHelpers[name])
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// boolToInt returns the name of a helper function that converts a bool to
+// the integer type t (1 for true, 0 for false).
+func boolToInt(t string) string {
+	name := "b2i" + strings.TrimPrefix(t, "int")
+	if t == "byte" {
+		name = "b2u8"
+	}
+	return UseHelper(name, fmt.Sprintf(`func %s(b bool) %s {
+	if b {
+		return 1
+	}
+	return 0
+}
+`, name, t))
+}
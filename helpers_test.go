@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBoolToInt(t *testing.T) {
+	t.Parallel()
+	src := `
+define i32 @less(i32 %a, i32 %b) {
+  %c = icmp slt i32 %a, %b
+  %r = zext i1 %c to i32
+  ret i32 %r
+}
+
+define i8 @equal(i64 %a, i64 %b) {
+  %c = icmp eq i64 %a, %b
+  %r = zext i1 %c to i8
+  ret i8 %r
+}
+
+define i64 @count(i32 %a, i32 %b) {
+  %c1 = icmp sgt i32 %a, 0
+  %c2 = icmp sgt i32 %b, 0
+  %z1 = zext i1 %c1 to i64
+  %z2 = zext i1 %c2 to i64
+  %r = add i64 %z1, %z2
+  ret i64 %r
+}
+
+define i16 @mask(i32 %a) {
+  %c = icmp ne i32 %a, 0
+  %r = sext i1 %c to i16
+  ret i16 %r
+}
+`
+	code, _ := translate(t, src)
+	for _, helper := range []string{"func b2i32(", "func b2u8(", "func b2i64(", "func b2i16("} {
+		if !strings.Contains(code, helper) {
+			t.Errorf("generated code doesn't contain %q:\n%s", helper, numberLines(code))
+		}
+	}
+	got := runGo(t, code, mainCalling("less(1, 2), less(2, 1)", "equal(5, 5), equal(5, 6)", "count(1, 1), count(-1, 1), count(0, 0)", "mask(7), mask(0)"))
+	want := "1 0\n1 0\n2 1 0\n-1 0\n"
+	if got != want {
+		t.Errorf("output:\n%s\nwant:\n%s\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
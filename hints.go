@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+)
+
+// HintIntrinsic translates calls to the intrinsics that only exchange hints
+// with the optimizer. If name is not one of them, it returns ok == false.
+func HintIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	switch intrinsicBase(name) {
+	case "expect":
+		// llvm.expect and llvm.expect.with.probability return their first
+		// argument; the others only say how likely it is.
+		if len(inst.Args) < 2 {
+			return "", true, fmt.Errorf("too few arguments to %s", name)
+		}
+		x, err := FormatValue(inst.Args[0])
+		if err != nil {
+			return "", true, fmt.Errorf("error translating argument (%v): %v", inst.Args[0], err)
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), x), true, nil
+
+	case "assume":
+		// The condition (and any operand bundles, such as alignment
+		// assumptions) only matter to the optimizer, unless -ub-checks asks
+		// for a violated assumption to be caught.
+		if len(inst.Args) != 1 {
+			return "", true, fmt.Errorf("wrong number of arguments to %s: %d", name, len(inst.Args))
+		}
+		if c, ok := inst.Args[0].(*constant.Int); !*ubChecks || ok && c.X.Sign() != 0 {
+			return "", true, nil
+		}
+		cond, err := FormatValue(inst.Args[0])
+		if err != nil {
+			return "", true, fmt.Errorf("error translating condition (%v): %v", inst.Args[0], err)
+		}
+		return fmt.Sprintf("if !%s { panic(%q) }", parenthesize(cond), panicPrefix(inst)+"assumption violated"), true, nil
+
+	case "is":
+		// llvm.is.constant (from __builtin_constant_p) is true if its operand
+		// is known to be a constant. Nothing is left to fold it later, so
+		// every other operand counts as not constant.
+		if !strings.HasPrefix(name, "llvm.is.constant.") || len(inst.Args) != 1 {
+			return "", false, nil
+		}
+		_, isConst := inst.Args[0].(constant.Constant)
+		return fmt.Sprintf("%s = %v", VariableName(inst), isConst), true, nil
+
+	case "prefetch":
+		// Like the lifetime markers, __builtin_prefetch has no effect on what
+		// the program does.
+		return "", true, nil
+	}
+	return "", false, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpect(t *testing.T) {
+	t.Parallel()
+	src := `
+declare i1 @llvm.expect.i1(i1, i1)
+declare i64 @llvm.expect.i64(i64, i64)
+declare i64 @llvm.expect.with.probability.i64(i64, i64, double)
+
+define i32 @classify(i64 %x) {
+entry:
+  %neg = icmp slt i64 %x, 0
+  %unlikely = call i1 @llvm.expect.i1(i1 %neg, i1 false)
+  br i1 %unlikely, label %negative, label %other
+
+negative:
+  ret i32 -1
+
+other:
+  %e = call i64 @llvm.expect.i64(i64 %x, i64 0)
+  %p = call i64 @llvm.expect.with.probability.i64(i64 %e, i64 1, double 0.9)
+  %t = trunc i64 %p to i32
+  ret i32 %t
+}
+`
+	code, _ := translate(t, src)
+	if strings.Contains(code, "expect") {
+		t.Errorf("llvm.expect isn't removed:\n%s", numberLines(code))
+	}
+	if got, want := runGo(t, code, mainCalling("classify(-5)", "classify(7)")), "-1\n7\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+const assumeSource = `
+declare void @llvm.assume(i1)
+
+define i32 @half(i32 %x) {
+  %even = and i32 %x, 1
+  %ok = icmp eq i32 %even, 0
+  call void @llvm.assume(i1 %ok)
+  call void @llvm.assume(i1 true)
+  %r = sdiv i32 %x, 2
+  ret i32 %r
+}
+`
+
+func TestAssume(t *testing.T) {
+	t.Parallel()
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(half(8))
+	defer func() {
+		fmt.Println(recover())
+	}()
+	fmt.Println(half(7))
+}
+`
+	code, _ := translate(t, assumeSource)
+	if strings.Contains(code, "assum") {
+		t.Errorf("llvm.assume isn't dropped:\n%s", numberLines(code))
+	}
+	if got, want := runGo(t, code, mainSrc), "4\n3\n<nil>\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+
+	code, _ = translate(t, assumeSource, "-ub-checks")
+	if n := strings.Count(code, "assumption violated"); n != 1 {
+		t.Errorf("%d checks with -ub-checks, want 1:\n%s", n, numberLines(code))
+	}
+	if got, want := runGo(t, code, mainSrc), "4\nassumption violated\n"; got != want {
+		t.Errorf("output with -ub-checks: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestIsConstant(t *testing.T) {
+	t.Parallel()
+	src := `
+declare i1 @llvm.is.constant.i32(i32)
+declare i1 @llvm.is.constant.f64(double)
+
+; pick chooses the constant-folded branch when its argument is a literal.
+define i32 @pick(i32 %x) {
+entry:
+  %k = call i1 @llvm.is.constant.i32(i32 7)
+  %d = call i1 @llvm.is.constant.f64(double 1.5)
+  %v = call i1 @llvm.is.constant.i32(i32 %x)
+  %kd = and i1 %k, %d
+  br i1 %kd, label %literal, label %wrong
+
+literal:
+  br i1 %v, label %wrong, label %variable
+
+variable:
+  ret i32 %x
+
+wrong:
+  ret i32 -1
+}
+`
+	code, _ := translate(t, src)
+	if strings.Contains(code, "is.constant") {
+		t.Errorf("llvm.is.constant isn't folded:\n%s", numberLines(code))
+	}
+	if got, want := runGo(t, code, mainCalling("pick(3)")), "3\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	t.Parallel()
+	src := `
+declare void @llvm.prefetch.p0i8(i8*, i32, i32, i32)
+
+define i8 @first(i8* %p) {
+  call void @llvm.prefetch.p0i8(i8* %p, i32 0, i32 3, i32 1)
+  %q = getelementptr i8, i8* %p, i64 64
+  call void @llvm.prefetch.p0i8(i8* %q, i32 1, i32 0, i32 1)
+  %x = load i8, i8* %p
+  ret i8 %x
+}
+`
+	code, _ := translate(t, src)
+	if strings.Contains(code, "prefetch") {
+		t.Errorf("llvm.prefetch isn't dropped:\n%s", numberLines(code))
+	}
+	// Prefetching past the end of an object is allowed.
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	b := byte(42)
+	fmt.Println(first(&b))
+}
+`
+	if got, want := runGo(t, code, mainSrc), "42\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
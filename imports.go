@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// knownImports maps the names of the packages that the generated code may
+// refer to to their import paths. References to other packages (such as
+// those named in a -libc-map file) are left for goimports to resolve.
+var knownImports = map[string]string{
+	"atomic":  "sync/atomic",
+	"binary":  "encoding/binary",
+	"bits":    "math/bits",
+	"libc":    "github.com/andybalholm/leaven/libc",
+	"math":    "math",
+	"os":      "os",
+	"runtime": "runtime",
+	"unsafe":  "unsafe",
+}
+
+// AddImport makes the package with the given import path available to the
+// generated code, under the last element of the path, which translated values
+// can no longer be named.
+func AddImport(path string) {
+	name := path[strings.LastIndex(path, "/")+1:]
+	knownImports[name] = path
+	packageScope.used[name] = true
+}
+
+// ImportDecl returns an import declaration for the packages that src (the
+// generated code, starting with its package clause) refers to. If src can't
+// be parsed, it returns the empty string, and the imports are left for
+// goimports (or the compiler's error messages) to sort out.
+func ImportDecl(src string) string {
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		return ""
+	}
+	used := make(map[string]bool)
+	for _, id := range f.Unresolved {
+		if path, ok := knownImports[id.Name]; ok {
+			used[path] = true
+		}
+	}
+	if len(used) == 0 {
+		return ""
+	}
+	paths := make([]string, 0, len(used))
+	for path := range used {
+		paths = append(paths, path)
+	}
+	// Sort the standard library packages (the ones without a dot in their
+	// paths) first, as goimports does.
+	sort.Slice(paths, func(i, j int) bool {
+		si, sj := isStandardPackage(paths[i]), isStandardPackage(paths[j])
+		if si != sj {
+			return si
+		}
+		return paths[i] < paths[j]
+	})
+	if len(paths) == 1 {
+		return fmt.Sprintf("import %q\n\n", paths[0])
+	}
+	b := new(strings.Builder)
+	b.WriteString("import (\n")
+	for i, path := range paths {
+		if i > 0 && isStandardPackage(paths[i-1]) && !isStandardPackage(path) {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(b, "\t%q\n", path)
+	}
+	b.WriteString(")\n\n")
+	return b.String()
+}
+
+// isStandardPackage reports whether path is the import path of a package in
+// the standard library.
+func isStandardPackage(path string) bool {
+	first := strings.SplitN(path, "/", 2)[0]
+	return !strings.Contains(first, ".")
+}
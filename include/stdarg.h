@@ -6,6 +6,7 @@
 #undef va_start
 #undef va_arg
 #undef va_end
+#undef va_copy
 
 typedef void *leaven_va_list;
 
@@ -13,8 +14,10 @@ typedef void *leaven_va_list;
 
 void leaven_va_start(leaven_va_list *vl);
 void *leaven_va_arg(leaven_va_list vl);
+void leaven_va_copy(leaven_va_list *dest, leaven_va_list src);
 
 #define va_start(list, param) leaven_va_start(&list)
 #define va_arg(list, type) (*(type *)leaven_va_arg(list))
 #define va_end
+#define va_copy(dest, src) leaven_va_copy(&(dest), src)
 
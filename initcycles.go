@@ -0,0 +1,118 @@
+package main
+
+import (
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/value"
+)
+
+// Go doesn't allow a package-level variable's initializer to refer back to
+// the variable, even just to take its address: not directly, not through
+// other variables, and not through the functions it refers to. But C code
+// does it all the time, in linked data structures (a circular list whose head
+// points to itself, or a tree whose nodes point to their parents) and in
+// tables of functions that use the table. So the globals whose initializers
+// are part of such a cycle are declared without initializers, and assigned in
+// an init function instead.
+
+// DeferredGlobals is the set of global variables that are initialized in an
+// init function, to break initialization cycles.
+var DeferredGlobals = make(map[*ir.Global]bool)
+
+// FindInitCycles fills in DeferredGlobals, by finding the strongly connected
+// components of the graph of references between globals and functions.
+func FindInitCycles(m *ir.Module) {
+	var nodes []value.Value
+	refs := make(map[value.Value][]value.Value)
+	for _, g := range m.Globals {
+		if g.Init != nil && !ConstGlobals[g] {
+			nodes = append(nodes, g)
+			refs[g] = initReferences(g.Init)
+		}
+	}
+	for _, f := range m.Funcs {
+		nodes = append(nodes, f)
+		for _, b := range f.Blocks {
+			for _, inst := range b.Insts {
+				refs[f] = append(refs[f], References(inst)...)
+			}
+			refs[f] = append(refs[f], References(b.Term)...)
+		}
+	}
+	for _, a := range m.Aliases {
+		nodes = append(nodes, a)
+		refs[a] = References(a.Aliasee)
+	}
+
+	// Tarjan's algorithm.
+	index := make(map[value.Value]int)
+	lowLink := make(map[value.Value]int)
+	onStack := make(map[value.Value]bool)
+	var stack []value.Value
+	var visit func(v value.Value)
+	visit = func(v value.Value) {
+		index[v] = len(index)
+		lowLink[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+		cyclic := false
+		for _, r := range refs[v] {
+			if r == v {
+				cyclic = true
+			}
+			if _, ok := index[r]; !ok {
+				visit(r)
+				if lowLink[r] < lowLink[v] {
+					lowLink[v] = lowLink[r]
+				}
+			} else if onStack[r] && index[r] < lowLink[v] {
+				lowLink[v] = index[r]
+			}
+		}
+		if lowLink[v] != index[v] {
+			return
+		}
+		// v is the root of a component; pop it off the stack.
+		i := len(stack) - 1
+		for stack[i] != v {
+			i--
+		}
+		component := stack[i:]
+		stack = stack[:i]
+		for _, c := range component {
+			onStack[c] = false
+			if g, ok := c.(*ir.Global); ok && (cyclic || len(component) > 1) {
+				DeferredGlobals[g] = true
+			}
+		}
+	}
+	for _, v := range nodes {
+		if _, ok := index[v]; !ok {
+			visit(v)
+		}
+	}
+}
+
+// initReferences returns the globals and functions that the initializer c
+// refers to. A blockaddress is translated as the address of a variable of its
+// own (see blockaddr.go), so it doesn't count as a reference to its function.
+func initReferences(c constant.Constant) []value.Value {
+	var elems []constant.Constant
+	switch c := c.(type) {
+	case *constant.BlockAddress:
+		return nil
+	case *constant.Struct:
+		elems = c.Fields
+	case *constant.Array:
+		elems = c.Elems
+	case *constant.Vector:
+		elems = c.Elems
+	default:
+		return References(c)
+	}
+	var refs []value.Value
+	for _, e := range elems {
+		refs = append(refs, initReferences(e)...)
+	}
+	return refs
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestDeferredInitialization(t *testing.T) {
+	t.Parallel()
+	src := `
+; head is a circular list whose only node points to itself, and table holds
+; functions that read it, so neither can be initialized in its declaration.
+%node = type { i32, %node* }
+
+@head = global %node { i32 1, %node* @head }
+
+@table = global [2 x i32 (i32)*] [i32 (i32)* @even, i32 (i32)* @odd]
+
+define i32 @even(i32 %n) {
+  %z = icmp eq i32 %n, 0
+  br i1 %z, label %yes, label %no
+yes:
+  ret i32 1
+no:
+  %m = sub i32 %n, 1
+  %p = getelementptr [2 x i32 (i32)*], [2 x i32 (i32)*]* @table, i64 0, i64 1
+  %f = load i32 (i32)*, i32 (i32)** %p
+  %r = call i32 %f(i32 %m)
+  ret i32 %r
+}
+
+define i32 @odd(i32 %n) {
+  %z = icmp eq i32 %n, 0
+  br i1 %z, label %yes, label %no
+yes:
+  ret i32 0
+no:
+  %m = sub i32 %n, 1
+  %p = getelementptr [2 x i32 (i32)*], [2 x i32 (i32)*]* @table, i64 0, i64 0
+  %f = load i32 (i32)*, i32 (i32)** %p
+  %r = call i32 %f(i32 %m)
+  ret i32 %r
+}
+
+define i32 @headValue() {
+  %p = getelementptr %node, %node* @head, i32 0, i32 1
+  %next = load %node*, %node** %p
+  %q = getelementptr %node, %node* %next, i32 0, i32 0
+  %v = load i32, i32* %q
+  ret i32 %v
+}
+
+define i1 @selfLoop() {
+  %p = getelementptr %node, %node* @head, i32 0, i32 1
+  %next = load %node*, %node** %p
+  %same = icmp eq %node* %next, @head
+  ret i1 %same
+}
+`
+	code, _ := translate(t, src)
+	for _, name := range []string{"head", "table"} {
+		if !regexp.MustCompile(`(?m)^var _?` + name + ` \w+$`).MatchString(code) {
+			t.Errorf("%s is not declared without an initializer:\n%s", name, numberLines(code))
+		}
+	}
+	if !regexp.MustCompile(`(?m)^func init\(\) \{$`).MatchString(code) {
+		t.Errorf("no init function:\n%s", numberLines(code))
+	}
+	got := runGo(t, code, mainCalling("headValue()", "selfLoop()", "even(10)", "odd(7)", "even(3)"))
+	if want := "1\ntrue\n1\n1\n0\n"; got != want {
+		t.Errorf("output:\n%s\nwant:\n%s\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
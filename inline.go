@@ -0,0 +1,286 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// With -inline, a value that is used only once, by a later instruction in the
+// same block, is written into the expression that uses it instead of getting
+// a variable of its own. So instead of
+//
+//	t = a * b
+//	u = t + c
+//	return u
+//
+// the output is "return a*b + c".
+//
+// Values that don't depend on memory can be moved any distance. Loads (and
+// operations that might panic, like division and GEPs) are only moved past
+// instructions that don't write to memory or have other side effects.
+//
+// With -ub-checks, the pointers (and indexes and lengths) that the checks
+// refer to are left in variables, so that the checks don't evaluate their
+// expressions a second time, and arithmetic marked nsw counts as possibly
+// panicking.
+
+// inlineCandidates is the set of instructions in the function being
+// translated that may be inlined into their users.
+var inlineCandidates = make(map[value.Named]bool)
+
+// inlinedExprs holds the expressions for the instructions that have been
+// inlined.
+var inlinedExprs = make(map[value.Named]string)
+
+// FindInlinable decides which instructions in f can be inlined.
+func FindInlinable(f *ir.Func) {
+	inlineCandidates = make(map[value.Named]bool)
+	inlinedExprs = make(map[value.Named]string)
+
+	// Count the uses of each instruction, and note where they are.
+	type use struct {
+		block *ir.Block
+		index int // index in block.Insts, or len(block.Insts) for the terminator
+		phi   bool
+	}
+	uses := make(map[value.Value][]use)
+	for _, b := range f.Blocks {
+		for i, inst := range b.Insts {
+			_, phi := inst.(*ir.InstPhi)
+			for _, r := range References(inst) {
+				if a, ok := r.(*ir.Arg); ok {
+					r = a.Value
+				}
+				uses[r] = append(uses[r], use{b, i, phi})
+			}
+		}
+		for _, r := range References(b.Term) {
+			uses[r] = append(uses[r], use{b, len(b.Insts), false})
+		}
+	}
+
+	checked := make(map[value.Value]bool)
+	if *ubChecks {
+		for _, b := range f.Blocks {
+			for _, inst := range b.Insts {
+				for _, v := range checkedOperands(inst) {
+					checked[v] = true
+				}
+			}
+		}
+	}
+
+	for _, b := range f.Blocks {
+		// impure records the candidates in this block whose expressions
+		// read memory or might panic.
+		impure := make(map[value.Value]bool)
+		for i, inst := range b.Insts {
+			v, ok := inst.(value.Named)
+			if !ok || checked[v] {
+				continue
+			}
+			pure, ok := inlinableOp(inst)
+			if !ok {
+				continue
+			}
+			if _, isVector := v.Type().(*types.VectorType); isVector {
+				continue
+			}
+			u := uses[v]
+			if len(u) != 1 || u[0].block != b || u[0].phi || u[0].index <= i {
+				continue
+			}
+			for _, r := range References(inst) {
+				if impure[r] {
+					pure = false
+				}
+			}
+			if !pure {
+				blocked := false
+				for _, between := range b.Insts[i+1 : u[0].index] {
+					if hasSideEffects(between) {
+						blocked = true
+						break
+					}
+				}
+				if blocked {
+					continue
+				}
+				impure[v] = true
+			}
+			inlineCandidates[v] = true
+		}
+	}
+}
+
+// inlinableOp reports whether inst is the kind of instruction that can be
+// inlined, and whether it is pure (neither reading memory nor possibly
+// panicking).
+func inlinableOp(inst ir.Instruction) (pure, ok bool) {
+	switch inst := inst.(type) {
+	case *ir.InstAdd:
+		return !*ubChecks || !hasNSW(inst.OverflowFlags), true
+	case *ir.InstSub:
+		return !*ubChecks || !hasNSW(inst.OverflowFlags), true
+	case *ir.InstMul:
+		return !*ubChecks || !hasNSW(inst.OverflowFlags), true
+	case *ir.InstAnd, *ir.InstOr, *ir.InstXor,
+		*ir.InstShl, *ir.InstLShr, *ir.InstAShr,
+		*ir.InstFAdd, *ir.InstFSub, *ir.InstFMul, *ir.InstFDiv,
+		*ir.InstICmp, *ir.InstFCmp,
+		*ir.InstTrunc, *ir.InstZExt, *ir.InstSExt, *ir.InstFPExt, *ir.InstFPTrunc,
+		*ir.InstSIToFP, *ir.InstUIToFP, *ir.InstFPToSI,
+		*ir.InstPtrToInt, *ir.InstIntToPtr, *ir.InstExtractValue:
+		return true, true
+	case *ir.InstBitCast:
+		return true, !binaryOnlyBitcasts[inst]
+	case *ir.InstLoad:
+		return false, !inst.Volatile && !inst.Atomic
+	case *ir.InstSDiv, *ir.InstGetElementPtr, *ir.InstExtractElement:
+		return false, true
+	}
+	return false, false
+}
+
+// checkedOperands returns the operands of inst that PointerChecks formats in
+// the checks it adds before inst.
+func checkedOperands(inst ir.Instruction) []value.Value {
+	switch inst := inst.(type) {
+	case *ir.InstLoad:
+		return []value.Value{inst.Src}
+	case *ir.InstStore:
+		return []value.Value{inst.Dst}
+	case *ir.InstGetElementPtr:
+		if !inst.InBounds {
+			return nil
+		}
+		operands := []value.Value{inst.Src, inst.Indices[0]}
+		if n, ok := objectLength(inst.Src, inst.ElemType); ok {
+			operands = append(operands, n)
+		}
+		return operands
+	}
+	return nil
+}
+
+// hasSideEffects reports whether inst might write to memory or otherwise make
+// it wrong to move a load past it.
+func hasSideEffects(inst ir.Instruction) bool {
+	switch inst := inst.(type) {
+	case *ir.InstStore, *ir.InstCall:
+		return true
+	case *ir.InstLoad:
+		return inst.Volatile || inst.Atomic
+	}
+	_, ok := inlinableOp(inst)
+	return !ok
+}
+
+// inlineExpr returns the expression form of translated, the translation of
+// v, if v is to be inlined.
+func inlineExpr(v value.Named, translated string) (string, bool) {
+	if !inlineCandidates[v] {
+		return "", false
+	}
+	prefix := VariableName(v) + " = "
+	if len(translated) <= len(prefix) || translated[:len(prefix)] != prefix {
+		return "", false
+	}
+	expr := translated[len(prefix):]
+	if _, err := parser.ParseExpr(expr); err != nil {
+		// It's more than a single assignment.
+		return "", false
+	}
+	inlinedExprs[v] = expr
+	return expr, true
+}
+
+// parenthesize wraps expr in parentheses unless it is an operand that doesn't
+// need them: an identifier, literal, call, index or selector expression, or
+// address.
+func parenthesize(expr string) string {
+	e, err := parser.ParseExpr(expr)
+	if err != nil {
+		return "(" + expr + ")"
+	}
+	switch e := e.(type) {
+	case *ast.Ident, *ast.BasicLit, *ast.CompositeLit, *ast.CallExpr, *ast.IndexExpr, *ast.SelectorExpr, *ast.ParenExpr:
+		return expr
+	case *ast.UnaryExpr:
+		if e.Op == token.AND {
+			return expr
+		}
+	}
+	return "(" + expr + ")"
+}
+
+// RemoveRedundantParens removes the parentheses around inlined expressions
+// that are complete operands already: the right-hand side of an assignment, an
+// if condition, a function argument, and so on. src is the source of a
+// function declaration.
+func RemoveRedundantParens(src string) string {
+	const header = "package p\n"
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", header+src, 0)
+	if err != nil {
+		return src
+	}
+
+	var remove []int
+	removeParens := func(e ast.Expr) {
+		for {
+			p, ok := e.(*ast.ParenExpr)
+			if !ok {
+				return
+			}
+			remove = append(remove, fset.Position(p.Lparen).Offset-len(header), fset.Position(p.Rparen).Offset-len(header))
+			e = p.X
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, e := range n.Rhs {
+				removeParens(e)
+			}
+		case *ast.IfStmt:
+			removeParens(n.Cond)
+		case *ast.SwitchStmt:
+			removeParens(n.Tag)
+		case *ast.ReturnStmt:
+			for _, e := range n.Results {
+				removeParens(e)
+			}
+		case *ast.CallExpr:
+			for _, e := range n.Args {
+				removeParens(e)
+			}
+		case *ast.IndexExpr:
+			removeParens(n.Index)
+		case *ast.CompositeLit:
+			for _, e := range n.Elts {
+				removeParens(e)
+			}
+		}
+		return true
+	})
+	if len(remove) == 0 {
+		return src
+	}
+
+	sort.Ints(remove)
+	b := make([]byte, 0, len(src))
+	last := 0
+	for _, i := range remove {
+		b = append(b, src[last:i]...)
+		last = i + 1
+	}
+	b = append(b, src[last:]...)
+	return string(b)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInline(t *testing.T) {
+	t.Parallel()
+	src := `
+define i32 @madd(i32 %a, i32 %b, i32 %c) {
+  %p = mul i32 %a, %b
+  %s = add i32 %p, %c
+  ret i32 %s
+}
+
+define i32 @sum(i32* %p, i64 %n) {
+  %q = getelementptr inbounds i32, i32* %p, i64 %n
+  %x = load i32, i32* %p
+  %y = load i32, i32* %q
+  %s = add nsw i32 %x, %y
+  ret i32 %s
+}
+`
+	code, _ := translate(t, src, "-inline")
+	if !strings.Contains(code, "return (a * b) + c") {
+		t.Errorf("madd not inlined:\n%s", numberLines(code))
+	}
+	mainSrc := mainCalling("madd(6, 7, 8)", "sum(&[]int32{1, 2}[0], 1)")
+	if got, want := runGo(t, code, mainSrc), "50\n3\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+
+	// With -ub-checks, values that the checks don't refer to are still
+	// inlined.
+	code, _ = translate(t, src, "-inline", "-ub-checks")
+	if !strings.Contains(code, "return (a * b) + c") {
+		t.Errorf("madd not inlined with -ub-checks:\n%s", numberLines(code))
+	}
+	if got, want := runGo(t, code, mainSrc), "50\n3\n"; got != want {
+		t.Errorf("output with -ub-checks: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestInlineUBChecks(t *testing.T) {
+	t.Parallel()
+	want := `3
+signed overflow in add
+5
+load from nil pointer
+7
+inbounds getelementptr out of bounds
+true
+inbounds getelementptr out of bounds
+inbounds getelementptr out of bounds
+`
+	checkProgram(t, ubSource, ubMain, want, "-inline", "-ub-checks")
+}
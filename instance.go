@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/value"
+)
+
+// With -instance, the module's global variables become fields of a State
+// struct, and its functions become methods on *State. Each call to NewState
+// creates an independent copy of the library's global state, so several
+// instances can be used at once (from different goroutines, or from tests
+// that want to start fresh). Constants, external symbols, and main are still
+// translated at package level; main creates a State of its own.
+
+// stateReceiver is the name of the *State receiver in the generated methods.
+const stateReceiver = "st"
+
+// ReserveInstanceNames keeps the names that instance mode uses from being
+// given to translated values.
+func ReserveInstanceNames() {
+	for _, name := range []string{"State", "NewState", stateReceiver} {
+		packageScope.claim(name)
+	}
+}
+
+// inState reports whether v is translated as a field or method of State.
+func inState(v value.Named) bool {
+	if !*instanceMode {
+		return false
+	}
+	switch v := v.(type) {
+	case *ir.Func:
+		return v.Blocks != nil && !isMainFunc(v)
+	case *ir.Global:
+		return v.Init != nil && !ConstGlobals[v]
+	}
+	return false
+}
+
+// GlobalRef returns the expression that refers to the function or global
+// variable v.
+func GlobalRef(v value.Named) string {
+	if inState(v) {
+		return stateReceiver + "." + VariableName(v)
+	}
+	return VariableName(v)
+}
+
+// receiver returns the receiver to put in the declaration of f.
+func receiver(f *ir.Func) string {
+	if !inState(f) {
+		return ""
+	}
+	return fmt.Sprintf("(%s *State) ", stateReceiver)
+}
+
+var stateRef = regexp.MustCompile(`\b` + stateReceiver + `\.`)
+
+// usesState reports whether the translated code in src refers to the State.
+func usesState(src string) bool {
+	return stateRef.MatchString(src)
+}
+
+// isZeroValue reports whether c is the zero value of its type, and so doesn't
+// need to be assigned to a field that new has allocated.
+func isZeroValue(c constant.Constant) bool {
+	switch c := c.(type) {
+	case *constant.ZeroInitializer, *constant.Null:
+		return true
+	case *constant.Int:
+		return c.X.Sign() == 0
+	}
+	return false
+}
+
+// StateDecl returns the declarations of the State type, with the given
+// fields, and of NewState, which runs the initializers.
+func StateDecl(fields, inits []string) string {
+	b := new(strings.Builder)
+	b.WriteString("// State holds the global variables of an instance of the library.\n")
+	b.WriteString("type State struct {\n")
+	for _, f := range fields {
+		fmt.Fprintf(b, "\t%s\n", f)
+	}
+	b.WriteString("}\n\n")
+	b.WriteString("// NewState returns a State with the global variables initialized.\n")
+	b.WriteString("func NewState() *State {\n")
+	fmt.Fprintf(b, "\t%s := new(State)\n", stateReceiver)
+	for _, i := range inits {
+		fmt.Fprintf(b, "\t%s\n", i)
+	}
+	fmt.Fprintf(b, "\treturn %s\n}\n\n", stateReceiver)
+	return b.String()
+}
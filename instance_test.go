@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInstance(t *testing.T) {
+	t.Parallel()
+	src := `
+@counter = global i32 10
+@step = constant i32 5
+@ptr = global i32* @counter
+@total = global i64 0
+
+define i32 @next() {
+  %p = load i32*, i32** @ptr
+  %c = load i32, i32* %p
+  %s = load i32, i32* @step
+  %n = add i32 %c, %s
+  store i32 %n, i32* %p
+  %t = load i64, i64* @total
+  %t1 = add i64 %t, 1
+  store i64 %t1, i64* @total
+  ret i32 %n
+}
+
+define i32 @twice() {
+  %a = call i32 @next()
+  %b = call i32 @next()
+  ret i32 %b
+}
+`
+	code, _ := translate(t, src, "-instance")
+	for _, s := range []string{"type State struct {", "func NewState() *State {", "func (st *State) next() int32 {", "st.next()"} {
+		if !strings.Contains(code, s) {
+			t.Errorf("generated code doesn't contain %q:\n%s", s, numberLines(code))
+		}
+	}
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	a, b := NewState(), NewState()
+	fmt.Println(a.next(), a.twice(), b.next())
+	fmt.Println(a.counter, a.total, b.counter, b.total)
+}
+`
+	if got, want := runGo(t, code, mainSrc), "15 25 15\n25 3 15 1\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestInstanceMain(t *testing.T) {
+	t.Parallel()
+	src := `
+@calls = global i32 0
+
+define i32 @bump() {
+  %c = load i32, i32* @calls
+  %n = add i32 %c, 1
+  store i32 %n, i32* @calls
+  ret i32 %n
+}
+
+declare void @report(i32)
+
+define i32 @main() {
+  %a = call i32 @bump()
+  %b = call i32 @bump()
+  call void @report(i32 %b)
+  ret i32 0
+}
+`
+	code, _ := translate(t, src, "-instance")
+	if !strings.Contains(code, "st := NewState()") {
+		t.Errorf("main doesn't create a State:\n%s", numberLines(code))
+	}
+	mainSrc := `package main
+
+import "fmt"
+
+func report(x int32) {
+	fmt.Println(x)
+}
+`
+	if got, want := runGo(t, code, mainSrc), "2\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
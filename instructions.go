@@ -2,18 +2,52 @@ package main
 
 import (
 	"fmt"
+	"go/token"
+	"math/big"
 	"strings"
 
 	"github.com/llir/llvm/ir"
 	"github.com/llir/llvm/ir/constant"
 	"github.com/llir/llvm/ir/enum"
 	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
 )
 
 // TranslateInstruction translates an LLVM instruction to Go.
 func TranslateInstruction(inst ir.Instruction) (string, error) {
+	if arenaMode() {
+		if result, ok, err := ArenaInstruction(inst); ok {
+			return result, err
+		}
+	}
+	if result, ok, err := LongDoubleInstruction(inst); ok {
+		return result, err
+	}
+	if result, ok, err := IntWidthInstruction(inst); ok {
+		return result, err
+	}
+	if result, ok, err := BoolInstruction(inst); ok {
+		return result, err
+	}
+	if result, ok, err := HalfInstruction(inst); ok {
+		return result, err
+	}
 	switch inst := inst.(type) {
+	case *ir.InstPhi:
+		// Phi nodes are assigned by the branches that lead to their block
+		// (see PhiAssignments), not where they appear.
+		return "", nil
+
+	case *ir.InstLandingPad:
+		// Its value is set by the invoke instructions that unwind to it.
+		return "", nil
+
 	case *ir.InstAdd:
+		if *ubChecks && hasNSW(inst.OverflowFlags) {
+			if result, err := CheckedArithmetic(inst, "add", inst.Typ, inst.X, inst.Y); result != "" || err != nil {
+				return result, err
+			}
+		}
 		x, err := FormatValue(inst.X)
 		if err != nil {
 			return "", fmt.Errorf("error translating left operand (%v): %v", inst.X, err)
@@ -23,25 +57,45 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 			return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
 		}
 		if _, ok := inst.Typ.(*types.VectorType); ok {
-			return fmt.Sprintf("for i, v := range %s { %s[i] = v + %s[i] }", x, VariableName(inst), y), nil
+			return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = lane_v + %s[lane_i] }", x, VariableName(inst), y), nil
 		}
 		if ciy, ok := inst.Y.(*constant.Int); ok && ciy.X.Sign() == -1 {
 			return fmt.Sprintf("%s = %s %s", VariableName(inst), x, ciy.X), nil // Use the constant's own minus sign.
 		}
 		return fmt.Sprintf("%s = %s + %s", VariableName(inst), x, y), nil
 
+	case *ir.InstAddrSpaceCast:
+		result, err := AddrSpaceCast(inst.From, inst.To)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), result), nil
+
 	case *ir.InstAlloca:
 		t, err := TypeSpec(inst.ElemType)
 		if err != nil {
 			return "", fmt.Errorf("error translating type (%v): %v", inst.ElemType, err)
 		}
 		if inst.NElems == nil {
+			if *noUnsafe {
+				return fmt.Sprintf("%s = new(%s)", VariableName(inst), t), nil
+			}
 			return fmt.Sprintf("%s = (*%s)(unsafe.Pointer(&make([]byte, (unsafe.Sizeof(*(*%s)(nil))+1))[0]))", VariableName(inst), t, t), nil
 		}
 		nElems, err := FormatValue(inst.NElems)
 		if err != nil {
 			return "", fmt.Errorf("error translating NElems (%v): %v", inst.NElems, err)
 		}
+		if *noUnsafe {
+			// Allocate an extra element, so that there is one to take the
+			// address of even when the count is zero.
+			return fmt.Sprintf("%s = &make([]%s, %s+1)[0]", VariableName(inst), t, nElems), nil
+		}
+		if _, ok := inst.NElems.(*constant.Int); !ok {
+			// The count of a variable-length array has to be converted for
+			// the multiplication.
+			nElems = fmt.Sprintf("uintptr(%s)", nElems)
+		}
 		return fmt.Sprintf("%s = (*%s)(unsafe.Pointer(&make([]byte, (unsafe.Sizeof(*(*%s)(nil)) * %s + 1))[0]))", VariableName(inst), t, t, nElems), nil
 
 	case *ir.InstAnd:
@@ -54,14 +108,30 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 			return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
 		}
 		if _, ok := inst.Typ.(*types.VectorType); ok {
-			return fmt.Sprintf("for i, v := range %s { %s[i] = v & %s[i] }", x, VariableName(inst), y), nil
-		}
-		if intType, ok := inst.Typ.(*types.IntType); ok && intType.BitSize == 1 {
-			return fmt.Sprintf("%s = %s && %s", VariableName(inst), x, y), nil
+			return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = lane_v & %s[lane_i] }", x, VariableName(inst), y), nil
 		}
 		return fmt.Sprintf("%s = %s & %s", VariableName(inst), x, y), nil
 
 	case *ir.InstAShr:
+		if vt, ok := inst.Typ.(*types.VectorType); ok {
+			et, ok := vt.ElemType.(*types.IntType)
+			if !ok {
+				return "", fmt.Errorf("unsupported type for ashr: %v", inst.Typ)
+			}
+			x, err := FormatValue(inst.X)
+			if err != nil {
+				return "", fmt.Errorf("error translating left operand (%v): %v", inst.X, err)
+			}
+			y, err := FormatValue(inst.Y)
+			if err != nil {
+				return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
+			}
+			expr := fmt.Sprintf("lane_v >> uint%d(%s[lane_i])", et.BitSize, y)
+			if et.BitSize == 8 {
+				expr = fmt.Sprintf("byte(int8(lane_v) >> %s[lane_i])", y)
+			}
+			return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = %s }", x, VariableName(inst), expr), nil
+		}
 		x, err := FormatSigned(inst.X)
 		if err != nil {
 			return "", fmt.Errorf("error translating left operand (%v): %v", inst.X, err)
@@ -75,11 +145,26 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		}
 		return fmt.Sprintf("%s = %s >> %s", VariableName(inst), x, y), nil
 
+	case *ir.InstAtomicRMW:
+		return AtomicRMW(inst)
+
 	case *ir.InstBitCast:
+		if *binaryReinterpret && binaryOnlyBitcasts[inst] {
+			return "", nil
+		}
 		from, err := FormatValue(inst.From)
 		if err != nil {
 			return "", fmt.Errorf("error translating source (%v): %v", inst.From, err)
 		}
+		if types.Equal(inst.From.Type(), inst.To) {
+			return fmt.Sprintf("%s = %s", VariableName(inst), from), nil
+		}
+		if result, ok, err := funcPointerCast(from, inst.From.Type(), inst.To); ok {
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s = %s", VariableName(inst), result), nil
+		}
 		to, err := TypeSpec(inst.To)
 		if err != nil {
 			return "", fmt.Errorf("error translating type (%v): %v", inst.To, err)
@@ -87,6 +172,13 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		return fmt.Sprintf("%s = (%s)(unsafe.Pointer(%s))", VariableName(inst), to, from), nil
 
 	case *ir.InstCall:
+		if f, ok := inst.Callee.(*ir.Func); ok {
+			for _, hook := range intrinsicHooks {
+				if result, ok, err := hook(inst, f.Name()); ok {
+					return result, err
+				}
+			}
+		}
 		callee, err := FormatValue(inst.Callee)
 		if err != nil {
 			return "", fmt.Errorf("error translating callee (%v): %v", inst.Callee, err)
@@ -99,54 +191,104 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 			}
 			args[i] = v
 		}
+		if f, ok := inst.Callee.(*ir.Func); ok && OutParams[f] != nil {
+			return outCall(inst, f, callee, args), nil
+		}
+		if f, ok := inst.Callee.(*ir.Func); ok && goIntSigs[f] != nil {
+			return goIntCall(inst, f, callee, args)
+		}
+		if *freestanding {
+			f, _ := inst.Callee.(*ir.Func)
+			if f != nil {
+				if err := checkFreestandingCall(f); err != nil {
+					return "", err
+				}
+			}
+			if f == nil || !isIntrinsic(f) {
+				return callStatement(inst, callee, args), nil
+			}
+		}
+		if f, ok := inst.Callee.(*ir.Func); ok && f.Blocks == nil {
+			name, drop := libcName(f.Name())
+			if name != f.Name() {
+				callee = valueName(name)
+				args = dropArgs(args, drop)
+			}
+		}
 		if renamed, ok := libraryFunctions[callee]; ok {
 			callee = renamed
 		}
 		switch callee {
 		case "leaven_va_start":
 			if len(args) == 1 {
-				return fmt.Sprintf("*%s = (*byte)(unsafe.Pointer(&varargs))", args[0]), nil
+				return fmt.Sprintf("*%s = libc.VAStart(varargs)", args[0]), nil
+			}
+		case "leaven_va_copy":
+			if len(args) == 2 {
+				return fmt.Sprintf("*%s = libc.VACopy(%s)", args[0], args[1]), nil
 			}
 		case "ldexp":
 			if len(args) == 2 {
 				return fmt.Sprintf("%s = math.Ldexp(%s, int(%s))", VariableName(inst), args[0], args[1]), nil
 			}
-		case "llvm_fabs_f32":
-			if len(args) == 1 {
-				return fmt.Sprintf("%s = float32(math.Abs(float64(%s)))", VariableName(inst), args[0]), nil
-			}
-		case "llvm_lifetime_start", "llvm_lifetime_end":
-			return ";", nil
-		case "llvm_memcpy_p0i8_p0i8_i64":
-			return fmt.Sprintf("libc.Memmove(%s, %s, %s)", args[0], args[1], args[2]), nil
-		case "llvm_memset_p0i8_i64":
-			return fmt.Sprintf("libc.Memset(%s, %s, %s)", args[0], args[1], args[2]), nil
-		case "llvm_objectsize_i64_p0i8":
-			// Use -1 for unknown size.
-			return fmt.Sprintf("%s = -1", VariableName(inst)), nil
 		case "putchar":
 			if len(args) == 1 {
-				return fmt.Sprintf("if _, err := os.Stdout.Write([]byte{byte(%s)}); err != nil { %s = -1 } else { %s = %s }", args[0], VariableName(inst), VariableName(inst), args[0]), nil
+				return fmt.Sprintf("if _, putchar_err := os.Stdout.Write([]byte{byte(%s)}); putchar_err != nil { %s = -1 } else { %s = %s }", args[0], VariableName(inst), VariableName(inst), args[0]), nil
 			}
 		case "__sprintf_chk":
 			return fmt.Sprintf("%s = noarch.Snprintf(%s, %s)", VariableName(inst), args[0], strings.Join(args[2:], ", ")), nil
 		}
-		if types.Equal(inst.Type(), types.Void) {
-			return fmt.Sprintf("%s(%s)", callee, strings.Join(args, ", ")), nil
+		return callStatement(inst, callee, args), nil
+
+	case *ir.InstCatchPad:
+		// The exception pointer comes from the catchswitch.
+		if arenaMode() {
+			return "", fmt.Errorf("exceptions aren't supported with -memory=arena")
 		}
-		return fmt.Sprintf("%s = %s(%s)", VariableName(inst), callee, strings.Join(args, ", ")), nil
+		return fmt.Sprintf("%s = %s", VariableName(inst), VariableName(inst.CatchSwitch.(value.Named))), nil
+
+	case *ir.InstCleanupPad:
+		// Its value is set by whatever unwinds to it.
+		return "", nil
+
+	case *ir.InstCmpXchg:
+		return CmpXchg(inst)
 
 	case *ir.InstExtractElement:
 		x, err := FormatValue(inst.X)
 		if err != nil {
 			return "", fmt.Errorf("error translating vector (%v): %v", inst.X, err)
 		}
+		if constantIndexOutOfRange(inst.Index, inst.X.Type()) {
+			// The result is poison, so any value will do.
+			return "", nil
+		}
 		index, err := FormatValue(inst.Index)
 		if err != nil {
 			return "", fmt.Errorf("error translating index (%v): %v", inst.Index, err)
 		}
 		return fmt.Sprintf("%s = %s[%s]", VariableName(inst), x, index), nil
 
+	case *ir.InstExtractValue:
+		x, err := FormatValue(inst.X)
+		if err != nil {
+			return "", fmt.Errorf("error translating aggregate (%v): %v", inst.X, err)
+		}
+		if misalignedPath(inst.X.Type(), inst.Indices) && !token.IsIdentifier(x) {
+			// The misaligned field is reached through a pointer
+			// conversion, which needs a variable to take the address of.
+			elem, _, err := AggregateElement("packed_v", inst.X.Type(), inst.Indices)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("{ packed_v := %s; %s = %s }", x, VariableName(inst), elem), nil
+		}
+		elem, _, err := AggregateElement(x, inst.X.Type(), inst.Indices)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), elem), nil
+
 	case *ir.InstFAdd:
 		x, err := FormatValue(inst.X)
 		if err != nil {
@@ -156,6 +298,9 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
 		}
+		if _, ok := inst.Typ.(*types.VectorType); ok {
+			return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = lane_v + %s[lane_i] }", x, VariableName(inst), y), nil
+		}
 		return fmt.Sprintf("%s = %s + %s", VariableName(inst), x, y), nil
 
 	case *ir.InstFCmp:
@@ -167,42 +312,18 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
 		}
-
-		var op string
-		switch inst.Pred {
-		case enum.FPredOEQ:
-			op = "=="
-		case enum.FPredOGE:
-			op = ">="
-		case enum.FPredOGT:
-			op = ">"
-		case enum.FPredOLE:
-			op = "<="
-		case enum.FPredOLT:
-			op = "<"
-		case enum.FPredUNE:
-			op = "!="
-		case enum.FPredORD:
-			return fmt.Sprintf("%s = %s == %s && %s == %s", VariableName(inst), x, x, y, y), nil
-		case enum.FPredUNO:
-			return fmt.Sprintf("%s = %s != %s || %s != %s", VariableName(inst), x, x, y, y), nil
-		case enum.FPredUEQ:
-			return fmt.Sprintf("%s = %s != %s || %s != %s || %s == %s", VariableName(inst), x, x, y, y, x, y), nil
-		case enum.FPredUGT:
-			return fmt.Sprintf("%s = %s != %s || %s != %s || %s > %s", VariableName(inst), x, x, y, y, x, y), nil
-		case enum.FPredUGE:
-			return fmt.Sprintf("%s = %s != %s || %s != %s || %s >= %s", VariableName(inst), x, x, y, y, x, y), nil
-		case enum.FPredULT:
-			return fmt.Sprintf("%s = %s != %s || %s != %s || %s < %s", VariableName(inst), x, x, y, y, x, y), nil
-		case enum.FPredULE:
-			return fmt.Sprintf("%s = %s != %s || %s != %s || %s <= %s", VariableName(inst), x, x, y, y, x, y), nil
-		case enum.FPredONE:
-			return fmt.Sprintf("%s = %s == %s && %s == %s && %s != %s", VariableName(inst), x, x, y, y, x, y), nil
-		default:
-			return "", fmt.Errorf("unsupported comparison predicate: %v", inst.Pred)
+		if vt, ok := inst.X.Type().(*types.VectorType); ok {
+			cmp, err := floatComparison(inst.Pred, "lane_v", y+"[lane_i]", vt.ElemType, nil, nil)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = %s }", x, VariableName(inst), cmp), nil
 		}
-
-		return fmt.Sprintf("%s = %s %s %s", VariableName(inst), x, op, y), nil
+		cmp, err := floatComparison(inst.Pred, x, y, inst.X.Type(), inst.X, inst.Y)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), cmp), nil
 
 	case *ir.InstFDiv:
 		x, err := FormatValue(inst.X)
@@ -213,8 +334,14 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
 		}
+		if _, ok := inst.Typ.(*types.VectorType); ok {
+			return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = lane_v / %s[lane_i] }", x, VariableName(inst), y), nil
+		}
 		return fmt.Sprintf("%s = %s / %s", VariableName(inst), x, y), nil
 
+	case *ir.InstFence:
+		return Fence(inst)
+
 	case *ir.InstFMul:
 		x, err := FormatValue(inst.X)
 		if err != nil {
@@ -224,45 +351,58 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
 		}
+		if _, ok := inst.Typ.(*types.VectorType); ok {
+			return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = lane_v * %s[lane_i] }", x, VariableName(inst), y), nil
+		}
 		return fmt.Sprintf("%s = %s * %s", VariableName(inst), x, y), nil
 
+	case *ir.InstFNeg:
+		return negation(inst, inst.X)
+
 	case *ir.InstFPExt:
-		from, err := FormatValue(inst.From)
-		if err != nil {
-			return "", fmt.Errorf("error translating source (%v): %v", inst.From, err)
-		}
-		to, err := TypeSpec(inst.To)
-		if err != nil {
-			return "", fmt.Errorf("error translating type (%v): %v", inst.To, err)
-		}
-		return fmt.Sprintf("%s = %s(%s)", VariableName(inst), to, from), nil
+		return floatConversion(inst, inst.From, inst.To)
 
 	case *ir.InstFPToSI:
-		from, err := FormatValue(inst.From)
+		return floatToInt(inst, inst.From, inst.To, true, *fpToInt == "saturate")
+
+	case *ir.InstFPToUI:
+		return floatToInt(inst, inst.From, inst.To, false, *fpToInt == "saturate")
+
+	case *ir.InstFPTrunc:
+		return floatConversion(inst, inst.From, inst.To)
+
+	case *ir.InstFRem:
+		x, err := FormatValue(inst.X)
 		if err != nil {
-			return "", fmt.Errorf("error translating source (%v): %v", inst.From, err)
+			return "", fmt.Errorf("error translating left operand (%v): %v", inst.X, err)
 		}
-		to, err := TypeSpec(inst.To)
+		y, err := FormatValue(inst.Y)
 		if err != nil {
-			return "", fmt.Errorf("error translating type (%v): %v", inst.To, err)
+			return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
 		}
-		if to == "byte" {
-			return fmt.Sprintf("%s = byte(int8(%s))", VariableName(inst), from), nil
+		t := inst.Typ
+		if vt, ok := t.(*types.VectorType); ok {
+			t = vt.ElemType
 		}
-		return fmt.Sprintf("%s = %s(%s)", VariableName(inst), to, from), nil
-
-	case *ir.InstFPTrunc:
-		from, err := FormatValue(inst.From)
-		if err != nil {
-			return "", fmt.Errorf("error translating source (%v): %v", inst.From, err)
+		// frem has the semantics of C's fmod, which math.Mod matches.
+		mod := "math.Mod(%s, %s)"
+		switch t.(*types.FloatType).Kind {
+		case types.FloatKindFloat:
+			mod = "float32(math.Mod(float64(%s), float64(%s)))"
+		case types.FloatKindDouble, types.FloatKindX86_FP80, types.FloatKindFP128:
+		default:
+			return "", fmt.Errorf("unsupported type for frem: %v", inst.Typ)
 		}
-		to, err := TypeSpec(inst.To)
-		if err != nil {
-			return "", fmt.Errorf("error translating type (%v): %v", inst.To, err)
+		if _, ok := inst.Typ.(*types.VectorType); ok {
+			return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = %s }", x, VariableName(inst), fmt.Sprintf(mod, "lane_v", y+"[lane_i]")), nil
 		}
-		return fmt.Sprintf("%s = %s(%s)", VariableName(inst), to, from), nil
+		return fmt.Sprintf("%s = %s", VariableName(inst), fmt.Sprintf(mod, x, y)), nil
 
 	case *ir.InstFSub:
+		if isNegativeZero(inst.X) {
+			// The old way of writing fneg.
+			return negation(inst, inst.Y)
+		}
 		x, err := FormatValue(inst.X)
 		if err != nil {
 			return "", fmt.Errorf("error translating left operand (%v): %v", inst.X, err)
@@ -271,6 +411,9 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
 		}
+		if _, ok := inst.Typ.(*types.VectorType); ok {
+			return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = lane_v - %s[lane_i] }", x, VariableName(inst), y), nil
+		}
 		return fmt.Sprintf("%s = %s - %s", VariableName(inst), x, y), nil
 
 	case *ir.InstGetElementPtr:
@@ -324,6 +467,19 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
 		}
+		if inst.Pred == enum.IPredEQ || inst.Pred == enum.IPredNE {
+			// Use enumerator names for constants if possible.
+			if x, err = FormatEnumValue(inst.X, inst.Y); err != nil {
+				return "", fmt.Errorf("error translating left operand (%v): %v", inst.X, err)
+			}
+			if y, err = FormatEnumValue(inst.Y, inst.X); err != nil {
+				return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
+			}
+		}
+		if isFuncPointer(inst.X.Type()) && !isNull(inst.X) && !isNull(inst.Y) {
+			// Go funcs can only be compared with nil.
+			x, y = fmt.Sprintf("libc.FuncToPointer(%s)", x), fmt.Sprintf("libc.FuncToPointer(%s)", y)
+		}
 		return fmt.Sprintf("%s = %s %s %s", VariableName(inst), x, op, y), nil
 
 	case *ir.InstInsertElement:
@@ -335,6 +491,10 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("error translating new element (%v): %v", inst.Elem, err)
 		}
+		if constantIndexOutOfRange(inst.Index, inst.X.Type()) {
+			// The result is poison.
+			return "", nil
+		}
 		index, err := FormatValue(inst.Index)
 		if err != nil {
 			return "", fmt.Errorf("error translating index (%v): %v", inst.Index, err)
@@ -344,18 +504,39 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		}
 		return fmt.Sprintf("%s = %s; %s[%s] = %s", VariableName(inst), x, VariableName(inst), index, elem), nil
 
-	case *ir.InstIntToPtr:
-		from, err := FormatValue(inst.From)
+	case *ir.InstInsertValue:
+		name := VariableName(inst)
+		dest, _, err := AggregateElement(name, inst.X.Type(), inst.Indices)
 		if err != nil {
-			return "", fmt.Errorf("error translating source (%v): %v", inst.From, err)
+			return "", err
 		}
-		to, err := TypeSpec(inst.To)
+		elem, err := FormatValue(inst.Elem)
 		if err != nil {
-			return "", fmt.Errorf("error translating type (%v): %v", inst.To, err)
+			return "", fmt.Errorf("error translating element (%v): %v", inst.Elem, err)
+		}
+		if _, ok := inst.X.(*constant.Undef); ok {
+			// The other fields can keep whatever values they have.
+			return fmt.Sprintf("%s = %s", dest, elem), nil
+		}
+		x, err := FormatValue(inst.X)
+		if err != nil {
+			return "", fmt.Errorf("error translating aggregate (%v): %v", inst.X, err)
 		}
-		return fmt.Sprintf("%s = (%s)(unsafe.Pointer(uintptr(%s)))", VariableName(inst), to, from), nil
+		return fmt.Sprintf("%s = %s; %s = %s", name, x, dest, elem), nil
+
+	case *ir.InstIntToPtr:
+		result, err := IntToPtr(inst.From, inst.To)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), result), nil
 
 	case *ir.InstLoad:
+		if *binaryReinterpret {
+			if result, ok, err := BinaryLoad(inst); ok {
+				return result, err
+			}
+		}
 		src, err := FormatValue(inst.Src)
 		if err != nil {
 			return "", fmt.Errorf("error translating source (%v): %v", inst.Src, err)
@@ -380,6 +561,11 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		return fmt.Sprintf("%s = %s >> %s", VariableName(inst), x, y), nil
 
 	case *ir.InstMul:
+		if *ubChecks && hasNSW(inst.OverflowFlags) {
+			if result, err := CheckedArithmetic(inst, "mul", inst.Typ, inst.X, inst.Y); result != "" || err != nil {
+				return result, err
+			}
+		}
 		x, err := FormatValue(inst.X)
 		if err != nil {
 			return "", fmt.Errorf("error translating left operand (%v): %v", inst.X, err)
@@ -400,10 +586,7 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 			return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
 		}
 		if _, ok := inst.Typ.(*types.VectorType); ok {
-			return fmt.Sprintf("for i, v := range %s { %s[i] = v | %s[i] }", x, VariableName(inst), y), nil
-		}
-		if intType, ok := inst.Typ.(*types.IntType); ok && intType.BitSize == 1 {
-			return fmt.Sprintf("%s = %s || %s", VariableName(inst), x, y), nil
+			return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = lane_v | %s[lane_i] }", x, VariableName(inst), y), nil
 		}
 		return fmt.Sprintf("%s = %s | %s", VariableName(inst), x, y), nil
 
@@ -416,21 +599,13 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("error translating type (%v): %v", inst.To, err)
 		}
+		if isFuncPointer(inst.From.Type()) && !arenaMode() {
+			return fmt.Sprintf("%s = %s(uintptr(libc.FuncToPointer(%s)))", VariableName(inst), to, from), nil
+		}
 		return fmt.Sprintf("%s = %s(uintptr(unsafe.Pointer(%s)))", VariableName(inst), to, from), nil
 
 	case *ir.InstSDiv:
-		x, err := FormatSigned(inst.X)
-		if err != nil {
-			return "", fmt.Errorf("error translating left operand (%v): %v", inst.X, err)
-		}
-		y, err := FormatSigned(inst.Y)
-		if err != nil {
-			return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
-		}
-		if intType, ok := inst.Typ.(*types.IntType); ok && intType.BitSize == 8 {
-			return fmt.Sprintf("%s = byte(%s / %s)", VariableName(inst), x, y), nil
-		}
-		return fmt.Sprintf("%s = %s / %s", VariableName(inst), x, y), nil
+		return intDivision(inst, inst.Typ, inst.X, inst.Y, "/", true)
 
 	case *ir.InstSelect:
 		cond, err := FormatValue(inst.Cond)
@@ -446,6 +621,10 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 			return "", fmt.Errorf("error translating second operand (%v): %v", inst.ValueFalse, err)
 		}
 		name := VariableName(inst)
+		if _, ok := inst.Cond.Type().(*types.VectorType); ok {
+			// Each lane is selected separately.
+			return fmt.Sprintf("for lane_i, lane_v := range %s { if lane_v { %s[lane_i] = %s[lane_i] } else { %s[lane_i] = %s[lane_i] } }", cond, name, valueTrue, name, valueFalse), nil
+		}
 		return fmt.Sprintf("if %s { %s = %s } else { %s = %s }", cond, name, valueTrue, name, valueFalse), nil
 
 	case *ir.InstSExt:
@@ -457,6 +636,9 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("error translating source (%v): %v", inst.From, err)
 		}
+		if toType.BitSize == 8 {
+			return fmt.Sprintf("%s = byte(%s)", VariableName(inst), from), nil
+		}
 		return fmt.Sprintf("%s = int%d(%s)", VariableName(inst), toType.BitSize, from), nil
 
 	case *ir.InstShl:
@@ -471,33 +653,22 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		return fmt.Sprintf("%s = %s << %s", VariableName(inst), x, y), nil
 
 	case *ir.InstShuffleVector:
-		x, err := FormatValue(inst.X)
-		if err != nil {
-			return "", fmt.Errorf("error translating left operand (%v): %v", inst.X, err)
-		}
-		y, err := FormatValue(inst.Y)
-		if err != nil {
-			return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
-		}
-		mask, err := FormatValue(inst.Mask)
-		if err != nil {
-			return "", fmt.Errorf("error translating mask (%v): %v", inst.Mask, err)
-		}
-		length := inst.Typ.Len
-		return fmt.Sprintf("for i, m := range %s { if m < %d { %s[i] = %s[m] } else { %s[i] = %s[m - %d] } }", mask, length, VariableName(inst), x, VariableName(inst), y, length), nil
+		return shuffleVector(inst)
 
 	case *ir.InstSIToFP:
-		from, err := FormatSigned(inst.From)
-		if err != nil {
-			return "", fmt.Errorf("error translating source (%v): %v", inst.From, err)
-		}
-		to, err := TypeSpec(inst.To)
-		if err != nil {
-			return "", fmt.Errorf("error translating type (%v): %v", inst.To, err)
-		}
-		return fmt.Sprintf("%s = %s(%s)", VariableName(inst), to, from), nil
+		return intToFloat(inst, inst.From, inst.To, true)
+
+	case *ir.InstSRem:
+		// Go's % truncates toward zero, like srem, so the result has the
+		// sign of the dividend.
+		return intDivision(inst, inst.Typ, inst.X, inst.Y, "%", true)
 
 	case *ir.InstStore:
+		if *binaryReinterpret {
+			if result, ok, err := BinaryStore(inst); ok {
+				return result, err
+			}
+		}
 		dest, err := FormatValue(inst.Dst)
 		if err != nil {
 			return "", fmt.Errorf("error translating destination (%v): %v", inst.Dst, err)
@@ -512,6 +683,11 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		return fmt.Sprintf("*%s = %s", dest, src), nil
 
 	case *ir.InstSub:
+		if *ubChecks && hasNSW(inst.OverflowFlags) {
+			if result, err := CheckedArithmetic(inst, "sub", inst.Typ, inst.X, inst.Y); result != "" || err != nil {
+				return result, err
+			}
+		}
 		x, err := FormatValue(inst.X)
 		if err != nil {
 			return "", fmt.Errorf("error translating left operand (%v): %v", inst.X, err)
@@ -536,7 +712,7 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 			if err != nil {
 				return "", fmt.Errorf("error translating source (%v): %v", inst.From, err)
 			}
-			return fmt.Sprintf("for i, v := range %s { %s[i] = %s(v) }", from, VariableName(inst), to), nil
+			return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = %s(lane_v) }", from, VariableName(inst), to), nil
 		}
 		to, err := TypeSpec(inst.To)
 		if err != nil {
@@ -551,16 +727,39 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		}
 		return fmt.Sprintf("%s = %s(%s)", VariableName(inst), to, from), nil
 
+	case *ir.InstUDiv:
+		return intDivision(inst, inst.Typ, inst.X, inst.Y, "/", false)
+
+	case *ir.InstURem:
+		return intDivision(inst, inst.Typ, inst.X, inst.Y, "%", false)
+
 	case *ir.InstUIToFP:
-		from, err := FormatUnsigned(inst.From)
+		return intToFloat(inst, inst.From, inst.To, false)
+
+	case *ir.InstVAArg:
+		// A va_list is a pointer to the []interface{} that holds the
+		// function's variadic arguments (see libc.VAArg), and ArgList points
+		// to the va_list.
+		if arenaMode() {
+			return "", fmt.Errorf("va_arg isn't supported with -memory=arena")
+		}
+		if pt, ok := inst.ArgList.Type().(*types.PointerType); !ok || !types.Equal(pt.ElemType, types.I8Ptr) {
+			return "", fmt.Errorf("unsupported va_list type: %v", inst.ArgList.Type())
+		}
+		list, err := FormatValue(inst.ArgList)
 		if err != nil {
-			return "", fmt.Errorf("error translating source (%v): %v", inst.From, err)
+			return "", fmt.Errorf("error translating argument list (%v): %v", inst.ArgList, err)
 		}
-		to, err := TypeSpec(inst.To)
+		if strings.HasPrefix(list, "&") {
+			list = strings.TrimPrefix(list, "&")
+		} else {
+			list = "*" + list
+		}
+		t, err := TypeSpec(inst.ArgType)
 		if err != nil {
-			return "", fmt.Errorf("error translating type (%v): %v", inst.To, err)
+			return "", fmt.Errorf("error translating type (%v): %v", inst.ArgType, err)
 		}
-		return fmt.Sprintf("%s = %s(%s)", VariableName(inst), to, from), nil
+		return fmt.Sprintf("%s = *(*%s)(unsafe.Pointer(libc.VAArg(%s)))", VariableName(inst), t, list), nil
 
 	case *ir.InstXor:
 		x, err := FormatValue(inst.X)
@@ -571,11 +770,26 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
 		}
-		if _, ok := inst.Typ.(*types.VectorType); ok {
-			return fmt.Sprintf("for i, v := range %s { %s[i] = v ^ %s[i] }", x, VariableName(inst), y), nil
+		yv := inst.Y
+		if isAllOnes(inst.X) {
+			// Make the constant the second operand.
+			x, y, yv = y, x, inst.X
+		}
+		if vt, ok := inst.Typ.(*types.VectorType); ok {
+			if types.Equal(vt.ElemType, types.I1) {
+				if isAllOnes(yv) {
+					return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = !lane_v }", x, VariableName(inst)), nil
+				}
+				return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = lane_v != %s[lane_i] }", x, VariableName(inst), y), nil
+			}
+			if isAllOnes(yv) {
+				return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = ^lane_v }", x, VariableName(inst)), nil
+			}
+			return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = lane_v ^ %s[lane_i] }", x, VariableName(inst), y), nil
 		}
-		if intType, ok := inst.Typ.(*types.IntType); ok && intType.BitSize == 1 {
-			return fmt.Sprintf("%s = %s != %s", VariableName(inst), x, y), nil
+		if isAllOnes(yv) {
+			// Bitwise complement, which is xor with -1.
+			return fmt.Sprintf("%s = ^%s", VariableName(inst), x), nil
 		}
 		return fmt.Sprintf("%s = %s ^ %s", VariableName(inst), x, y), nil
 
@@ -597,7 +811,7 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 			if err != nil {
 				return "", fmt.Errorf("error translating source (%v): %v", inst.From, err)
 			}
-			return fmt.Sprintf("for i, v := range %s { %s[i] = int%d(uint%d(uint%d(v))) }", from, VariableName(inst), toType.BitSize, toType.BitSize, fromType.BitSize), nil
+			return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = int%d(uint%d(uint%d(lane_v))) }", from, VariableName(inst), toType.BitSize, toType.BitSize, fromType.BitSize), nil
 		}
 		toType, ok := inst.To.(*types.IntType)
 		if !ok {
@@ -607,8 +821,8 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("error translating source (%v): %v", inst.From, err)
 		}
-		if fromType, ok := inst.From.Type().(*types.IntType); ok && fromType.BitSize == 1 {
-			return fmt.Sprintf("if %s { %s = 1 } else { %s = 0 }", from, VariableName(inst), VariableName(inst)), nil
+		if toType.BitSize == 8 {
+			return fmt.Sprintf("%s = %s", VariableName(inst), from), nil
 		}
 		return fmt.Sprintf("%s = int%d(uint%d(%s))", VariableName(inst), toType.BitSize, toType.BitSize, from), nil
 
@@ -617,32 +831,355 @@ func TranslateInstruction(inst ir.Instruction) (string, error) {
 	}
 }
 
-var libraryFunctions = map[string]string{
-	"calloc":           "libc.Calloc",
-	"fabs":             "math.Abs",
-	"free":             "libc.Free",
-	"leaven_va_arg":    "libc.VAArg",
-	"llvm_fabs_f64":    "math.Abs",
-	"llvm_fabs_f80":    "math.Abs",
-	"llvm_pow_f64":     "math.Pow",
-	"malloc":           "libc.Malloc",
-	"memchr":           "libc.Memchr",
-	"memcmp":           "libc.Memcmp",
-	"__memcpy_chk":     "libc.MemcpyChk",
-	"memset_pattern16": "libc.MemsetPattern16",
-	"__memset_chk":     "libc.MemsetChk",
-	"printf":           "noarch.Printf",
-	"puts":             "noarch.Puts",
-	"scanf":            "noarch.Scanf",
-	"__strcat_chk":     "libc.StrcatChk",
-	"strchr":           "libc.Strchr",
-	"strcmp":           "libc.Strcmp",
-	"strcpy":           "libc.Strcpy",
-	"strcspn":          "libc.Strcspn",
-	"strncat":          "libc.Strncat",
-	"strncmp":          "libc.Strncmp",
-	"strncpy":          "libc.Strncpy",
-	"strrchr":          "libc.Strrchr",
-	"strspn":           "libc.Strspn",
-	"strstr":           "libc.Strstr",
+// callStatement returns a statement that calls callee with args, and assigns
+// the result (if any) to inst's variable.
+func callStatement(inst *ir.InstCall, callee string, args []string) string {
+	if types.Equal(inst.Type(), types.Void) {
+		return fmt.Sprintf("%s(%s)", callee, strings.Join(args, ", "))
+	}
+	return fmt.Sprintf("%s = %s(%s)", VariableName(inst), callee, strings.Join(args, ", "))
+}
+
+// negation translates fneg of x (or fsub from -0, which is equivalent),
+// storing the result in dest.
+func negation(dest value.Named, x value.Value) (string, error) {
+	if c, ok := x.(*constant.Float); ok {
+		// Negate the constant itself, since in Go -0 would be positive zero
+		// (and --2 wouldn't parse).
+		c = fixFP128Constant(c)
+		neg := &constant.Float{Typ: c.Typ, X: new(big.Float).Neg(c.X), NaN: c.NaN}
+		fixedFP128[neg] = fixedFP128[c]
+		xs, err := FormatValue(neg)
+		if err != nil {
+			return "", fmt.Errorf("error translating operand (%v): %v", x, err)
+		}
+		return fmt.Sprintf("%s = %s", VariableName(dest), xs), nil
+	}
+	xs, err := FormatValue(x)
+	if err != nil {
+		return "", fmt.Errorf("error translating operand (%v): %v", x, err)
+	}
+	if _, ok := x.Type().(*types.VectorType); ok {
+		return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = -lane_v }", xs, VariableName(dest)), nil
+	}
+	// Unary minus flips the sign bit, so it turns 0 into -0 and works for
+	// NaN, as fneg does.
+	return fmt.Sprintf("%s = -%s", VariableName(dest), xs), nil
+}
+
+// isNegativeZero reports whether v is the floating-point constant -0.0.
+func isNegativeZero(v value.Value) bool {
+	c, ok := v.(*constant.Float)
+	return ok && !c.NaN && c.X.Sign() == 0 && c.X.Signbit()
+}
+
+// intDivision translates an integer division or remainder instruction (op is
+// "/" or "%"), which stores its result in dest. Since Go's integer types are
+// signed (except for byte), the operands of an unsigned operation are
+// converted to unsigned and the result is converted back, like lshr; for a
+// signed operation it is the other way around with bytes.
+func intDivision(dest value.Named, t types.Type, x, y value.Value, op string, signed bool) (string, error) {
+	if vt, ok := t.(*types.VectorType); ok {
+		et, ok := vt.ElemType.(*types.IntType)
+		if !ok || et.BitSize == 1 {
+			return "", fmt.Errorf("unsupported type for division: %v", t)
+		}
+		xs, err := FormatValue(x)
+		if err != nil {
+			return "", fmt.Errorf("error translating left operand (%v): %v", x, err)
+		}
+		ys, err := FormatValue(y)
+		if err != nil {
+			return "", fmt.Errorf("error translating right operand (%v): %v", y, err)
+		}
+		expr := fmt.Sprintf("lane_v %s %s[lane_i]", op, ys)
+		switch {
+		case signed && et.BitSize == 8:
+			expr = fmt.Sprintf("byte(int8(lane_v) %s int8(%s[lane_i]))", op, ys)
+		case !signed && et.BitSize > 8:
+			expr = fmt.Sprintf("int%d(uint%d(lane_v) %s uint%d(%s[lane_i]))", et.BitSize, et.BitSize, op, et.BitSize, ys)
+		}
+		return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = %s }", xs, VariableName(dest), expr), nil
+	}
+
+	it, ok := t.(*types.IntType)
+	if !ok || it.BitSize == 1 {
+		return "", fmt.Errorf("unsupported type for division: %v", t)
+	}
+	format := FormatSigned
+	if !signed {
+		format = FormatUnsigned
+	}
+	xs, err := format(x)
+	if err != nil {
+		return "", fmt.Errorf("error translating left operand (%v): %v", x, err)
+	}
+	ys, err := format(y)
+	if err != nil {
+		return "", fmt.Errorf("error translating right operand (%v): %v", y, err)
+	}
+	switch {
+	case signed && it.BitSize == 8:
+		return fmt.Sprintf("%s = byte(%s %s %s)", VariableName(dest), xs, op, ys), nil
+	case !signed && it.BitSize > 8:
+		return fmt.Sprintf("%s = int%d(%s %s %s)", VariableName(dest), it.BitSize, xs, op, ys), nil
+	}
+	return fmt.Sprintf("%s = %s %s %s", VariableName(dest), xs, op, ys), nil
+}
+
+// isAllOnes reports whether v is an integer constant (or a vector of them)
+// with all its bits set: true for i1, and -1 for other types.
+func isAllOnes(v value.Value) bool {
+	switch c := v.(type) {
+	case *constant.Int:
+		all := new(big.Int).Lsh(big.NewInt(1), uint(c.Typ.BitSize))
+		return new(big.Int).Add(unsignedConstant(c), big.NewInt(1)).Cmp(all) == 0
+	case *constant.Vector:
+		for _, e := range c.Elems {
+			if !isAllOnes(e) {
+				return false
+			}
+		}
+		return len(c.Elems) > 0
+	}
+	return false
+}
+
+// floatComparison returns an expression that compares the floating-point
+// values x and y, of type t, according to pred. Go's comparison operators
+// are false when either operand is NaN (except for !=, which is true), so the
+// ordered predicates and une translate directly; the others also test for
+// NaN. If xv or yv is a constant that isn't NaN, it doesn't need to be tested.
+func floatComparison(pred enum.FPred, x, y string, t types.Type, xv, yv value.Value) (string, error) {
+	var nanTests, notNaNTests []string
+	for _, operand := range []struct {
+		s string
+		v value.Value
+	}{{x, xv}, {y, yv}} {
+		if c, ok := operand.v.(*constant.Float); ok && !c.NaN {
+			continue
+		}
+		if len(nanTests) > 0 && operand.s == x {
+			// Comparing a value with itself.
+			continue
+		}
+		test := fmt.Sprintf("math.IsNaN(%s)", operand.s)
+		if ft, ok := t.(*types.FloatType); ok && ft.Kind == types.FloatKindFloat {
+			test = fmt.Sprintf("math.IsNaN(float64(%s))", operand.s)
+		}
+		nanTests = append(nanTests, test)
+		notNaNTests = append(notNaNTests, "!"+test)
+	}
+	unordered := func(op string) string {
+		return strings.Join(append(nanTests, fmt.Sprintf("%s %s %s", x, op, y)), " || ")
+	}
+
+	switch pred {
+	case enum.FPredFalse:
+		return "false", nil
+	case enum.FPredTrue:
+		return "true", nil
+	case enum.FPredOEQ:
+		return fmt.Sprintf("%s == %s", x, y), nil
+	case enum.FPredOGE:
+		return fmt.Sprintf("%s >= %s", x, y), nil
+	case enum.FPredOGT:
+		return fmt.Sprintf("%s > %s", x, y), nil
+	case enum.FPredOLE:
+		return fmt.Sprintf("%s <= %s", x, y), nil
+	case enum.FPredOLT:
+		return fmt.Sprintf("%s < %s", x, y), nil
+	case enum.FPredONE:
+		return strings.Join(append(notNaNTests, fmt.Sprintf("%s != %s", x, y)), " && "), nil
+	case enum.FPredORD:
+		if len(notNaNTests) == 0 {
+			return "true", nil
+		}
+		return strings.Join(notNaNTests, " && "), nil
+	case enum.FPredUEQ:
+		return unordered("=="), nil
+	case enum.FPredUGE:
+		return unordered(">="), nil
+	case enum.FPredUGT:
+		return unordered(">"), nil
+	case enum.FPredULE:
+		return unordered("<="), nil
+	case enum.FPredULT:
+		return unordered("<"), nil
+	case enum.FPredUNE:
+		return fmt.Sprintf("%s != %s", x, y), nil
+	case enum.FPredUNO:
+		if len(nanTests) == 0 {
+			return "false", nil
+		}
+		return strings.Join(nanTests, " || "), nil
+	}
+	return "", fmt.Errorf("unsupported comparison predicate: %v", pred)
+}
+
+// intToFloat translates a sitofp or uitofp instruction (according to signed)
+// that converts from to the type to, and stores the result in dest.
+func intToFloat(dest value.Named, from value.Value, to types.Type, signed bool) (string, error) {
+	fromType, toType := from.Type(), to
+	vt, isVector := to.(*types.VectorType)
+	if isVector {
+		toType = vt.ElemType
+		if ft, ok := fromType.(*types.VectorType); ok {
+			fromType = ft.ElemType
+		}
+	}
+	it, ok := fromType.(*types.IntType)
+	if !ok {
+		return "", fmt.Errorf("unsupported source type for int-to-float conversion: %v", from.Type())
+	}
+	t, err := TypeSpec(toType)
+	if err != nil {
+		return "", fmt.Errorf("error translating type (%v): %v", to, err)
+	}
+
+	var x string
+	switch {
+	case isVector:
+		x, err = FormatValue(from)
+	case signed:
+		x, err = FormatSigned(from)
+	default:
+		x, err = FormatUnsigned(from)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error translating source (%v): %v", from, err)
+	}
+	elem := x
+	if isVector {
+		elem = "lane_v"
+		switch {
+		case it.BitSize == 8 && signed:
+			elem = "int8(lane_v)"
+		case it.BitSize > 8 && !signed:
+			elem = fmt.Sprintf("uint%d(lane_v)", it.BitSize)
+		}
+	}
+
+	conv := fmt.Sprintf("%s(%s)", t, elem)
+	if it.BitSize == 1 {
+		// A bool can't be converted directly; as a signed integer, true is -1.
+		if signed {
+			conv = fmt.Sprintf("%s(-%s(%s))", t, boolToInt("int32"), elem)
+		} else {
+			conv = fmt.Sprintf("%s(%s(%s))", t, boolToInt("int32"), elem)
+		}
+	}
+	if isVector {
+		return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = %s }", x, VariableName(dest), conv), nil
+	}
+	return fmt.Sprintf("%s = %s", VariableName(dest), conv), nil
+}
+
+// floatConversion translates an fpext or fptrunc instruction, which converts
+// from to the floating-point type to and stores the result in dest.
+func floatConversion(dest value.Named, from value.Value, to types.Type) (string, error) {
+	x, err := FormatValue(from)
+	if err != nil {
+		return "", fmt.Errorf("error translating source (%v): %v", from, err)
+	}
+	if vt, ok := to.(*types.VectorType); ok {
+		t, err := TypeSpec(vt.ElemType)
+		if err != nil {
+			return "", fmt.Errorf("error translating type (%v): %v", to, err)
+		}
+		return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = %s(lane_v) }", x, VariableName(dest), t), nil
+	}
+	t, err := TypeSpec(to)
+	if err != nil {
+		return "", fmt.Errorf("error translating type (%v): %v", to, err)
+	}
+	if ft, err := TypeSpec(from.Type()); err == nil && ft == t {
+		// For example, x86_fp80 and double are both float64.
+		return fmt.Sprintf("%s = %s", VariableName(dest), x), nil
+	}
+	return fmt.Sprintf("%s = %s(%s)", VariableName(dest), t, x), nil
+}
+
+// constantIndexOutOfRange reports whether index is a constant that is out of
+// range for the vector type t. (Such an index would be a compile-time error
+// in Go.) A dynamic index that is out of range makes the generated code
+// panic instead.
+func constantIndexOutOfRange(index value.Value, t types.Type) bool {
+	c, ok := index.(*constant.Int)
+	vt, isVector := t.(*types.VectorType)
+	if !ok || !isVector {
+		return false
+	}
+	// The index is treated as unsigned.
+	return unsignedConstant(c).Cmp(new(big.Int).SetUint64(vt.Len)) >= 0
+}
+
+// unsignedConstant returns the value of c, interpreted as unsigned.
+func unsignedConstant(c *constant.Int) *big.Int {
+	mask := new(big.Int).Lsh(big.NewInt(1), uint(c.Typ.BitSize))
+	mask.Sub(mask, big.NewInt(1))
+	return new(big.Int).And(c.X, mask)
+}
+
+// shuffleVector translates a shufflevector instruction. The result is built
+// element by element from the two input vectors; lanes whose mask entries
+// are undef (or that come from an undef input) are set to zero.
+func shuffleVector(inst *ir.InstShuffleVector) (string, error) {
+	inType, ok := inst.X.Type().(*types.VectorType)
+	if !ok {
+		return "", fmt.Errorf("non-vector operand to shufflevector: %v", inst.X.Type())
+	}
+	n := inType.Len
+	t, err := TypeSpec(inst.Typ)
+	if err != nil {
+		return "", fmt.Errorf("error translating type (%v): %v", inst.Typ, err)
+	}
+	zero, err := zeroValue(inType.ElemType)
+	if err != nil {
+		return "", err
+	}
+
+	var operands [2]string
+	for i, v := range []value.Value{inst.X, inst.Y} {
+		if _, ok := v.(*constant.Undef); ok {
+			continue
+		}
+		if operands[i], err = FormatValue(v); err != nil {
+			return "", fmt.Errorf("error translating operand %d (%v): %v", i, v, err)
+		}
+	}
+
+	var mask []constant.Constant
+	switch m := inst.Mask.(type) {
+	case *constant.Vector:
+		mask = m.Elems
+	case *constant.ZeroInitializer:
+		for i := uint64(0); i < inst.Typ.Len; i++ {
+			mask = append(mask, constant.NewInt(types.I32, 0))
+		}
+	case *constant.Undef:
+		return fmt.Sprintf("%s = %s{}", VariableName(inst), t), nil
+	default:
+		return "", fmt.Errorf("unsupported shufflevector mask: %v", inst.Mask)
+	}
+
+	elems := make([]string, len(mask))
+	for i, m := range mask {
+		elems[i] = zero
+		c, ok := m.(*constant.Int)
+		if !ok {
+			// An undef lane.
+			continue
+		}
+		lane := c.X.Uint64()
+		operand := operands[0]
+		if lane >= n {
+			operand = operands[1]
+			lane -= n
+		}
+		if operand != "" {
+			elems[i] = fmt.Sprintf("%s[%d]", operand, lane)
+		}
+	}
+	return fmt.Sprintf("%s = %s{%s}", VariableName(inst), t, strings.Join(elems, ", ")), nil
 }
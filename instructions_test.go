@@ -0,0 +1,631 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFloatArithmetic(t *testing.T) {
+	t.Parallel()
+	src := `
+define <2 x double> @vecops(<2 x double> %a, <2 x double> %b) {
+  %s = fadd <2 x double> %a, %b
+  %d = fsub <2 x double> %s, %b
+  %m = fmul <2 x double> %d, %b
+  %q = fdiv <2 x double> %m, <double 2.0, double 4.0>
+  ret <2 x double> %q
+}
+
+define double @negate(double %x) {
+  %r = fsub double -0.0, %x
+  ret double %r
+}
+
+define double @negzero() {
+  ret double -0.0
+}
+
+define double @negconst() {
+  %r = fsub double -0.0, -2.0
+  ret double %r
+}
+
+define double @negsum(double %x) {
+  %a = fsub double %x, 1.0
+  %n = fneg double %a
+  %r = fsub double -0.0, %n
+  ret double %r
+}
+
+define float @tenth() {
+  %r = fadd float 0x3FB99999A0000000, 0.0
+  ret float %r
+}
+`
+	mainSrc := `package main
+
+import (
+	"fmt"
+	"math"
+)
+
+func main() {
+	fmt.Println(vecops([2]float64{1, 2}, [2]float64{3, 4}))
+	fmt.Println(negate(1.5), math.Signbit(negate(0)))
+	fmt.Println(negzero(), math.Signbit(negzero()))
+	fmt.Println(negconst(), negsum(3))
+	fmt.Println(tenth())
+}
+`
+	want := "[1.5 2]\n-1.5 true\n-0 true\n2 2\n0.1\n"
+	checkProgram(t, src, mainSrc, want)
+	checkProgram(t, src, mainSrc, want, "-inline")
+}
+
+func TestFRem(t *testing.T) {
+	t.Parallel()
+	src := `
+define double @remd(double %x, double %y) {
+  %r = frem double %x, %y
+  ret double %r
+}
+
+define float @remf(float %x, float %y) {
+  %r = frem float %x, %y
+  ret float %r
+}
+
+define <2 x float> @remv(<2 x float> %x, <2 x float> %y) {
+  %r = frem <2 x float> %x, %y
+  ret <2 x float> %r
+}
+`
+	mainSrc := mainCalling("remd(7.5, 2)", "remd(-7.5, 2)", "remf(10, 3)", "remv([2]float32{5, -5}, [2]float32{3, 3})")
+	checkProgram(t, src, mainSrc, "1.5\n-1.5\n1\n[2 -2]\n")
+}
+
+const divisionSource = `
+define i32 @sdiv32(i32 %x, i32 %y) {
+  %r = sdiv i32 %x, %y
+  ret i32 %r
+}
+
+define i32 @udiv32(i32 %x, i32 %y) {
+  %r = udiv i32 %x, %y
+  ret i32 %r
+}
+
+define i8 @sdiv8(i8 %x, i8 %y) {
+  %r = sdiv i8 %x, %y
+  ret i8 %r
+}
+
+define i8 @udiv8(i8 %x, i8 %y) {
+  %r = udiv i8 %x, %y
+  ret i8 %r
+}
+
+define <2 x i16> @udivv(<2 x i16> %x, <2 x i16> %y) {
+  %r = udiv <2 x i16> %x, %y
+  ret <2 x i16> %r
+}
+
+define <2 x i8> @sdivv(<2 x i8> %x, <2 x i8> %y) {
+  %r = sdiv <2 x i8> %x, %y
+  ret <2 x i8> %r
+}
+`
+
+func TestDivision(t *testing.T) {
+	t.Parallel()
+	mainSrc := mainCalling(
+		"sdiv32(-7, 2)",
+		"udiv32(-2, 2)",
+		"sdiv8(0xf9, 2)", // -7 / 2
+		"udiv8(0xf9, 2)",
+		"udivv([2]int16{-2, 9}, [2]int16{2, 3})",
+		"sdivv([2]byte{0xf9, 9}, [2]byte{2, 0xfd})", // -7 / 2, 9 / -3
+	)
+	checkProgram(t, divisionSource, mainSrc, "-3\n2147483647\n253\n124\n[32767 3]\n[253 253]\n")
+}
+
+func TestRemainder(t *testing.T) {
+	t.Parallel()
+	src := strings.NewReplacer("div", "rem").Replace(divisionSource)
+	mainSrc := mainCalling(
+		"srem32(-7, 2)",
+		"urem32(-1, 10)",
+		"srem8(0xf9, 2)", // -7 % 2
+		"urem8(0xf9, 10)",
+		"uremv([2]int16{-1, 9}, [2]int16{10, 4})",
+		"sremv([2]byte{0xf9, 9}, [2]byte{4, 0xfc})", // -7 % 4, 9 % -4
+	)
+	checkProgram(t, src, mainSrc, "-1\n5\n255\n9\n[5 1]\n[253 1]\n")
+}
+
+func TestXorNegation(t *testing.T) {
+	t.Parallel()
+	src := `
+define i1 @not(i32 %x) {
+  %c = icmp sgt i32 %x, 0
+  %r = xor i1 true, %c
+  ret i1 %r
+}
+
+define i32 @complement(i32 %x) {
+  %r = xor i32 %x, -1
+  ret i32 %r
+}
+
+define i8 @complement8(i8 %x) {
+  %r = xor i8 -1, %x
+  ret i8 %r
+}
+
+define <2 x i1> @notv(<2 x i1> %x) {
+  %r = xor <2 x i1> %x, <i1 true, i1 true>
+  ret <2 x i1> %r
+}
+
+define <2 x i1> @xorv(<2 x i1> %x, <2 x i1> %y) {
+  %r = xor <2 x i1> %x, %y
+  ret <2 x i1> %r
+}
+
+define <2 x i16> @complementv(<2 x i16> %x) {
+  %r = xor <2 x i16> %x, <i16 -1, i16 -1>
+  ret <2 x i16> %r
+}
+`
+	code, _ := translate(t, src)
+	for _, s := range []string{"r = !", "r = ^x", "= !lane_v", "= ^lane_v"} {
+		if !strings.Contains(code, s) {
+			t.Errorf("missing %q:\n%s", s, numberLines(code))
+		}
+	}
+	mainSrc := mainCalling(
+		"not(1)", "not(-1)",
+		"complement(5)", "complement8(0x0f)",
+		"notv([2]bool{true, false})",
+		"xorv([2]bool{true, false}, [2]bool{true, true})",
+		"complementv([2]int16{0, -2})",
+	)
+	if got, want := runGo(t, code, mainSrc), "false\ntrue\n-6\n240\n[false true]\n[false true]\n[-1 1]\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestVectorAShr(t *testing.T) {
+	t.Parallel()
+	src := `
+define <4 x i32> @shr32(<4 x i32> %x, <4 x i32> %n) {
+  %r = ashr <4 x i32> %x, %n
+  ret <4 x i32> %r
+}
+
+define <2 x i8> @shr8(<2 x i8> %x) {
+  %r = ashr <2 x i8> %x, <i8 1, i8 7>
+  ret <2 x i8> %r
+}
+`
+	mainSrc := mainCalling(
+		"shr32([4]int32{-16, 16, -1, 1 << 30}, [4]int32{2, 2, 31, 30})",
+		"shr8([2]byte{0x80, 0x80})",
+	)
+	checkProgram(t, src, mainSrc, "[-4 4 -1 1]\n[192 255]\n")
+}
+
+func TestFNeg(t *testing.T) {
+	t.Parallel()
+	src := `
+define double @neg(double %x) {
+  %r = fneg double %x
+  ret double %r
+}
+
+define float @negzero() {
+  %r = fneg float 0.0
+  ret float %r
+}
+
+define <2 x double> @negv(<2 x double> %x) {
+  %r = fneg <2 x double> %x
+  ret <2 x double> %r
+}
+`
+	mainSrc := `package main
+
+import (
+	"fmt"
+	"math"
+)
+
+func main() {
+	fmt.Println(neg(2.5), math.Signbit(neg(0)), math.IsNaN(neg(math.NaN())))
+	fmt.Println(math.Signbit(float64(negzero())))
+	fmt.Println(negv([2]float64{1, -3}))
+}
+`
+	checkProgram(t, src, mainSrc, "-2.5 true true\ntrue\n[-1 3]\n")
+}
+
+func TestFCmp(t *testing.T) {
+	t.Parallel()
+	preds := []string{"false", "oeq", "ogt", "oge", "olt", "ole", "one", "ord", "ueq", "ugt", "uge", "ult", "ule", "une", "uno", "true"}
+	src := new(strings.Builder)
+	var exprs []string
+	for _, p := range preds {
+		fmt.Fprintf(src, "define i1 @%s_d(double %%x, double %%y) {\n  %%r = fcmp %s double %%x, %%y\n  ret i1 %%r\n}\n\n", p, p)
+		fmt.Fprintf(src, "define i1 @%s_c(float %%x) {\n  %%r = fcmp %s float %%x, 1.0\n  ret i1 %%r\n}\n\n", p, p)
+		for _, args := range []string{"1, 2", "2, 2", "2, 1", "nan, 1", "nan, nan"} {
+			exprs = append(exprs, fmt.Sprintf("%s_d(%s)", p, args))
+		}
+		for _, arg := range []string{"1", "0", "float32(nan)"} {
+			exprs = append(exprs, fmt.Sprintf("%s_c(%s)", p, arg))
+		}
+	}
+	src.WriteString(`define <2 x i1> @ult_v(<2 x double> %x, <2 x double> %y) {
+  %r = fcmp ult <2 x double> %x, %y
+  ret <2 x i1> %r
+}
+`)
+
+	mainSrc := new(strings.Builder)
+	mainSrc.WriteString("package main\n\nimport (\n\t\"fmt\"\n\t\"math\"\n)\n\nvar nan = math.NaN()\n\nfunc main() {\n")
+	for _, e := range exprs {
+		fmt.Fprintf(mainSrc, "\tfmt.Println(%s)\n", e)
+	}
+	mainSrc.WriteString("\tfmt.Println(ult_v([2]float64{1, nan}, [2]float64{0, 0}))\n}\n")
+
+	// What each predicate should give for the arguments above: less, equal,
+	// greater, and unordered.
+	truth := map[string][4]bool{
+		"false": {false, false, false, false},
+		"oeq":   {false, true, false, false},
+		"ogt":   {false, false, true, false},
+		"oge":   {false, true, true, false},
+		"olt":   {true, false, false, false},
+		"ole":   {true, true, false, false},
+		"one":   {true, false, true, false},
+		"ord":   {true, true, true, false},
+		"ueq":   {false, true, false, true},
+		"ugt":   {false, false, true, true},
+		"uge":   {false, true, true, true},
+		"ult":   {true, false, false, true},
+		"ule":   {true, true, false, true},
+		"une":   {true, false, true, true},
+		"uno":   {false, false, false, true},
+		"true":  {true, true, true, true},
+	}
+	want := new(strings.Builder)
+	for _, p := range preds {
+		r := truth[p]
+		for _, i := range []int{0, 1, 2, 3, 3, 1, 0, 3} {
+			fmt.Fprintln(want, r[i])
+		}
+	}
+	want.WriteString("[false true]\n")
+	checkProgram(t, src.String(), mainSrc.String(), want.String())
+}
+
+func TestIntToFloat(t *testing.T) {
+	t.Parallel()
+	src := `
+define double @sbool(i1 %b) {
+  %r = sitofp i1 %b to double
+  ret double %r
+}
+
+define float @ubool(i1 %b) {
+  %r = uitofp i1 %b to float
+  ret float %r
+}
+
+define double @u32(i32 %x) {
+  %r = uitofp i32 %x to double
+  ret double %r
+}
+
+define double @s8(i8 %x) {
+  %r = sitofp i8 %x to double
+  ret double %r
+}
+
+define <2 x float> @sv8(<2 x i8> %x) {
+  %r = sitofp <2 x i8> %x to <2 x float>
+  ret <2 x float> %r
+}
+
+define <2 x double> @uv16(<2 x i16> %x) {
+  %r = uitofp <2 x i16> %x to <2 x double>
+  ret <2 x double> %r
+}
+
+define <2 x double> @uvbool(<2 x i1> %x) {
+  %r = uitofp <2 x i1> %x to <2 x double>
+  ret <2 x double> %r
+}
+`
+	mainSrc := mainCalling(
+		"sbool(true)", "sbool(false)", "ubool(true)",
+		"u32(-1)", "s8(0xff)",
+		"sv8([2]byte{0xfe, 3})",
+		"uv16([2]int16{-1, 7})",
+		"uvbool([2]bool{true, false})",
+	)
+	checkProgram(t, src, mainSrc, "-1\n0\n1\n4.294967295e+09\n-1\n[-2 3]\n[65535 7]\n[1 0]\n")
+}
+
+func TestFloatConversions(t *testing.T) {
+	t.Parallel()
+	src := `
+define double @ext(float %x) {
+  %r = fpext float %x to double
+  ret double %r
+}
+
+define float @trunc(double %x) {
+  %r = fptrunc double %x to float
+  ret float %r
+}
+
+define <2 x double> @extv(<2 x float> %x) {
+  %r = fpext <2 x float> %x to <2 x double>
+  ret <2 x double> %r
+}
+
+define <2 x float> @truncv(<2 x double> %x) {
+  %r = fptrunc <2 x double> %x to <2 x float>
+  ret <2 x float> %r
+}
+
+define double @roundtrip80(double %x) {
+  %l = fpext double %x to x86_fp80
+  %r = fptrunc x86_fp80 %l to double
+  ret double %r
+}
+`
+	code, _ := translate(t, src)
+	if !strings.Contains(code, "\tl = x\n\tr = l\n") {
+		t.Errorf("conversion between same-sized Go types:\n%s", numberLines(code))
+	}
+	mainSrc := mainCalling("ext(0.5)", "trunc(1.0000000001)", "extv([2]float32{0.25, -2})", "truncv([2]float64{1e300, 3})", "roundtrip80(2.5)")
+	if got, want := runGo(t, code, mainSrc), "0.5\n1\n[0.25 -2]\n[+Inf 3]\n2.5\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestIntToPtr(t *testing.T) {
+	t.Parallel()
+	src := `
+@x = global i32 42
+@null_ptr = global i32* inttoptr (i64 0 to i32*)
+
+define i32 @viaInt() {
+  %i = ptrtoint i32* @x to i64
+  %p = inttoptr i64 %i to i32*
+  %v = load i32, i32* %p
+  ret i32 %v
+}
+
+; A 32-bit value with the high bit set is zero-extended, not sign-extended.
+define i64 @widen(i32 %i) {
+  %p = inttoptr i32 %i to i8*
+  %r = ptrtoint i8* %p to i64
+  ret i64 %r
+}
+
+define i1 @isNull() {
+  %p = load i32*, i32** @null_ptr
+  %r = icmp eq i32* %p, null
+  ret i1 %r
+}
+`
+	code, _ := translate(t, src)
+	checkMain := mainCalling("viaInt()", "widen(-1)", "isNull()")
+	if got, want := runGo(t, code, checkMain, noUnsafePtrCheck), "42\n4294967295\ntrue\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestAggregateValues(t *testing.T) {
+	t.Parallel()
+	src := `
+%rec = type { i32, [2 x i64] }
+
+define %rec @build(i32 %a, i64 %b) {
+  %r0 = insertvalue %rec undef, i32 %a, 0
+  %r1 = insertvalue %rec %r0, i64 %b, 1, 0
+  %r2 = insertvalue %rec %r1, i64 7, 1, 1
+  ret %rec %r2
+}
+
+define i64 @sum(%rec %r) {
+  %a = extractvalue %rec %r, 0
+  %b = extractvalue %rec %r, 1, 0
+  %c = extractvalue %rec %r, 1, 1
+  %a64 = sext i32 %a to i64
+  %s1 = add i64 %a64, %b
+  %s2 = add i64 %s1, %c
+  ret i64 %s2
+}
+
+define i64 @constant() {
+  %c = extractvalue %rec { i32 1, [2 x i64] [i64 2, i64 3] }, 1, 1
+  ret i64 %c
+}
+
+define { i32, i1 } @pair(i32 %x) {
+  %p = insertvalue { i32, i1 } { i32 0, i1 true }, i32 %x, 0
+  ret { i32, i1 } %p
+}
+`
+	mainSrc := mainCalling("build(1, 2)", "sum(build(-1, 10))", "constant()", "pair(9)")
+	for _, flags := range [][]string{nil, {"-inline"}} {
+		code, _ := translate(t, src, flags...)
+		if got, want := runGo(t, code, mainSrc), "{1 [2 7]}\n16\n3\n{9 true}\n"; got != want {
+			t.Errorf("%v: output: %q, want %q\ngenerated code:\n%s", flags, got, want, numberLines(code))
+		}
+	}
+}
+
+func TestVectorIndexOutOfRange(t *testing.T) {
+	t.Parallel()
+	src := `
+define i32 @get(<4 x i32> %v, i32 %i) {
+  %in = extractelement <4 x i32> %v, i32 3
+  %bad = extractelement <4 x i32> %v, i32 4
+  %neg = extractelement <4 x i32> %v, i32 -1
+  %dyn = extractelement <4 x i32> %v, i32 %i
+  %s = add i32 %in, %dyn
+  ret i32 %s
+}
+
+define <4 x i32> @set(<4 x i32> %v) {
+  %bad = insertelement <4 x i32> %v, i32 9, i64 8
+  %ok = insertelement <4 x i32> %v, i32 9, i64 0
+  ret <4 x i32> %ok
+}
+`
+	code, _ := translate(t, src)
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(get([4]int32{1, 2, 3, 4}, 0))
+	fmt.Println(set([4]int32{1, 2, 3, 4}))
+	defer func() {
+		fmt.Println(recover() != nil)
+	}()
+	get([4]int32{1, 2, 3, 4}, 4)
+}
+`
+	if got, want := runGo(t, code, mainSrc), "5\n[9 2 3 4]\ntrue\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestShuffleVector(t *testing.T) {
+	t.Parallel()
+	src := `
+define <4 x i32> @interleave(<4 x i32> %a, <4 x i32> %b) {
+  %r = shufflevector <4 x i32> %a, <4 x i32> %b, <4 x i32> <i32 0, i32 4, i32 1, i32 5>
+  ret <4 x i32> %r
+}
+
+define <2 x float> @widen(<4 x float> %a) {
+  %r = shufflevector <4 x float> %a, <4 x float> undef, <2 x i32> <i32 3, i32 undef>
+  ret <2 x float> %r
+}
+
+define <8 x i1> @splat(i1 %b) {
+  %v = insertelement <8 x i1> undef, i1 %b, i32 0
+  %r = shufflevector <8 x i1> %v, <8 x i1> undef, <8 x i32> zeroinitializer
+  ret <8 x i1> %r
+}
+`
+	mainSrc := mainCalling(
+		"interleave([4]int32{1, 2, 3, 4}, [4]int32{5, 6, 7, 8})",
+		"widen([4]float32{1, 2, 3, 4})",
+		"splat(true)",
+	)
+	checkProgram(t, src, mainSrc, "[1 5 2 6]\n[4 0]\n[true true true true true true true true]\n")
+}
+
+func TestVAArg(t *testing.T) {
+	t.Parallel()
+	src := `
+declare void @leaven_va_start(i8**)
+
+; total adds up n ints, then scales the sum by a double and the int that a
+; pointer argument points to.
+define double @total(i32 %n, ...) {
+entry:
+  %ap = alloca i8*
+  call void @leaven_va_start(i8** %ap)
+  br label %loop
+
+loop:
+  %i = phi i32 [ 0, %entry ], [ %i1, %body ]
+  %sum = phi i32 [ 0, %entry ], [ %sum1, %body ]
+  %more = icmp slt i32 %i, %n
+  br i1 %more, label %body, label %done
+
+body:
+  %x = va_arg i8** %ap, i32
+  %sum1 = add i32 %sum, %x
+  %i1 = add i32 %i, 1
+  br label %loop
+
+done:
+  %scale = va_arg i8** %ap, double
+  %p = va_arg i8** %ap, i32*
+  %y = load i32, i32* %p
+  %s = sitofp i32 %sum to double
+  %k = sitofp i32 %y to double
+  %r1 = fmul double %s, %scale
+  %r = fmul double %r1, %k
+  ret double %r
+}
+`
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	k := int32(10)
+	fmt.Println(total(3, int32(1), int32(2), byte(3), 0.5, &k))
+	fmt.Println(total(0, 2.0, &k))
+}
+`
+	checkProgram(t, src, mainSrc, "30\n0\n")
+
+	output := translateError(t, `
+%struct.__va_list_tag = type { i32, i32, i8*, i8* }
+
+define i32 @first(%struct.__va_list_tag* %ap) {
+  %x = va_arg %struct.__va_list_tag* %ap, i32
+  ret i32 %x
+}
+`, "-color=never")
+	if !strings.Contains(output, "unsupported va_list type") {
+		t.Errorf("output doesn't mention the va_list type:\n%s", output)
+	}
+}
+
+func TestVectorSelect(t *testing.T) {
+	t.Parallel()
+	src := `
+define <4 x float> @larger(<4 x float> %i, <4 x float> %v) {
+  %c = fcmp ogt <4 x float> %i, %v
+  %r = select <4 x i1> %c, <4 x float> %i, <4 x float> %v
+  ret <4 x float> %r
+}
+
+define <3 x i32> @masked(<3 x i1> %m, <3 x i32> %x) {
+  %r = select <3 x i1> %m, <3 x i32> %x, <3 x i32> zeroinitializer
+  ret <3 x i32> %r
+}
+
+define <2 x double> @alternate(<2 x double> %x) {
+  %r = select <2 x i1> <i1 false, i1 true>, <2 x double> %x, <2 x double> <double 0.5, double 1.5>
+  ret <2 x double> %r
+}
+
+; scalar still selects whole vectors with an i1 condition.
+define <2 x i8> @scalar(i1 %c, <2 x i8> %x, <2 x i8> %y) {
+  %r = select i1 %c, <2 x i8> %x, <2 x i8> %y
+  ret <2 x i8> %r
+}
+`
+	mainSrc := mainCalling(
+		"larger([4]float32{1, 5, -3, 7}, [4]float32{2, 4, -4, 7})",
+		"masked([3]bool{true, false, true}, [3]int32{1, 2, 3})",
+		"alternate([2]float64{8, 9})",
+		"scalar(true, [2]byte{1, 2}, [2]byte{3, 4})",
+		"scalar(false, [2]byte{1, 2}, [2]byte{3, 4})",
+	)
+	checkProgram(t, src, mainSrc, "[2 5 -3 7]\n[1 0 3]\n[0.5 9]\n[1 2]\n[3 4]\n")
+}
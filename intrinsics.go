@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+)
+
+// intrinsicHooks are tried in order on each call to a named function, until
+// one of them handles it (returning ok == true). Each one covers a family of
+// intrinsics (or calls that frontends insert); calls that none of them
+// handle are translated as ordinary function calls.
+var intrinsicHooks = []func(inst *ir.InstCall, name string) (result string, ok bool, err error){
+	GCIntrinsic,
+	FrontendCall,
+	SIMDIntrinsic,
+	SaturatingIntrinsic,
+	MemIntrinsic,
+	OverflowIntrinsic,
+	SatArithmeticIntrinsic,
+	BitIntrinsic,
+	IntMinMaxIntrinsic,
+	MathIntrinsic,
+	HintIntrinsic,
+	StackIntrinsic,
+	PtrMaskIntrinsic,
+	VAIntrinsic,
+	TrapIntrinsic,
+	DebugIntrinsic,
+	EHIntrinsic,
+	ReduceIntrinsic,
+	MaskedIntrinsic,
+	SimpleIntrinsic,
+}
+
+// simpleIntrinsics maps the names of intrinsics (without the suffixes for
+// overloaded types) to the functions that translate calls to them, for the
+// ones that are simple enough not to need a hook of their own. Most of them
+// are only there for the optimizer or for debugging tools, and can be
+// ignored.
+var simpleIntrinsics = map[string]func(inst *ir.InstCall) (string, error){
+	"llvm.annotation":                       passIntrinsic,
+	"llvm.codeview.annotation":              ignoreIntrinsic,
+	"llvm.donothing":                        ignoreIntrinsic,
+	"llvm.experimental.noalias.scope.decl":  ignoreIntrinsic,
+	"llvm.experimental.widenable.condition": foldIntrinsic("true"),
+	"llvm.instrprof.increment":              ignoreIntrinsic,
+	"llvm.instrprof.increment.step":         ignoreIntrinsic,
+	"llvm.invariant.end":                    ignoreIntrinsic,
+	"llvm.launder.invariant.group":          passIntrinsic,
+	"llvm.lifetime.end":                     ignoreIntrinsic,
+	"llvm.lifetime.start":                   ignoreIntrinsic,
+	"llvm.objectsize":                       objectSize,
+	"llvm.pseudoprobe":                      ignoreIntrinsic,
+	"llvm.ptr.annotation":                   passIntrinsic,
+	"llvm.sideeffect":                       ignoreIntrinsic,
+	"llvm.ssa.copy":                         passIntrinsic,
+	"llvm.strip.invariant.group":            passIntrinsic,
+	"llvm.var.annotation":                   ignoreIntrinsic,
+}
+
+// SimpleIntrinsic translates calls to the intrinsics in simpleIntrinsics. If
+// name is not one of them, it returns ok == false.
+func SimpleIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	if !strings.HasPrefix(name, "llvm.") {
+		return "", false, nil
+	}
+	for {
+		if translate, ok := simpleIntrinsics[name]; ok {
+			result, err = translate(inst)
+			return result, true, err
+		}
+		i := strings.LastIndex(name, ".")
+		if i == -1 {
+			return "", false, nil
+		}
+		name = name[:i]
+	}
+}
+
+// ignoreIntrinsic translates a call that has no effect on what the program
+// does, and whose result (if any) is never used, as nothing at all.
+func ignoreIntrinsic(inst *ir.InstCall) (string, error) {
+	return "", nil
+}
+
+// passIntrinsic translates a call that returns its first argument.
+func passIntrinsic(inst *ir.InstCall) (string, error) {
+	if len(inst.Args) == 0 {
+		return "", fmt.Errorf("too few arguments to %v", inst.Callee.Ident())
+	}
+	x, err := FormatValue(inst.Args[0])
+	if err != nil {
+		return "", fmt.Errorf("error translating argument (%v): %v", inst.Args[0], err)
+	}
+	return fmt.Sprintf("%s = %s", VariableName(inst), x), nil
+}
+
+// foldIntrinsic returns a function that translates a call as the constant
+// value x.
+func foldIntrinsic(x string) func(inst *ir.InstCall) (string, error) {
+	return func(inst *ir.InstCall) (string, error) {
+		return fmt.Sprintf("%s = %s", VariableName(inst), x), nil
+	}
+}
+
+// objectSize translates llvm.objectsize (from __builtin_object_size) as the
+// value it returns when the size is unknown: -1, or 0 if its second argument
+// asks for the minimum size.
+func objectSize(inst *ir.InstCall) (string, error) {
+	if len(inst.Args) < 2 {
+		return "", fmt.Errorf("too few arguments to %v", inst.Callee.Ident())
+	}
+	if min, ok := inst.Args[1].(*constant.Int); ok && min.X.Sign() != 0 {
+		return fmt.Sprintf("%s = 0", VariableName(inst)), nil
+	}
+	return fmt.Sprintf("%s = -1", VariableName(inst)), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSimpleIntrinsics(t *testing.T) {
+	t.Parallel()
+	src := `
+@note = private constant [5 x i8] c"note\00"
+
+declare void @llvm.lifetime.start.p0i8(i64, i8*)
+declare void @llvm.lifetime.end.p0i8(i64, i8*)
+declare void @llvm.donothing()
+declare void @llvm.sideeffect()
+declare void @llvm.var.annotation(i8*, i8*, i8*, i32, i8*)
+declare i32 @llvm.annotation.i32(i32, i8*, i8*, i32)
+declare i8* @llvm.launder.invariant.group.p0i8(i8*)
+declare i8* @llvm.strip.invariant.group.p0i8(i8*)
+declare i32 @llvm.ssa.copy.i32(i32)
+declare i1 @llvm.experimental.widenable.condition()
+declare i64 @llvm.objectsize.i64.p0i8(i8*, i1, i1, i1)
+
+define i32 @annotated(i32 %x) {
+  %a = alloca i32
+  %p = bitcast i32* %a to i8*
+  call void @llvm.lifetime.start.p0i8(i64 4, i8* %p)
+  call void @llvm.donothing()
+  call void @llvm.sideeffect()
+  %n = getelementptr [5 x i8], [5 x i8]* @note, i64 0, i64 0
+  call void @llvm.var.annotation(i8* %p, i8* %n, i8* %n, i32 1, i8* null)
+  %y = call i32 @llvm.annotation.i32(i32 %x, i8* %n, i8* %n, i32 2)
+  %q = call i8* @llvm.launder.invariant.group.p0i8(i8* %p)
+  %q2 = call i8* @llvm.strip.invariant.group.p0i8(i8* %q)
+  %b = bitcast i8* %q2 to i32*
+  store i32 %y, i32* %b
+  %z = load i32, i32* %a
+  call void @llvm.lifetime.end.p0i8(i64 4, i8* %p)
+  %w = call i32 @llvm.ssa.copy.i32(i32 %z)
+  %c = call i1 @llvm.experimental.widenable.condition()
+  %r = select i1 %c, i32 %w, i32 -1
+  ret i32 %r
+}
+
+define i64 @sizes(i8* %p) {
+  %max = call i64 @llvm.objectsize.i64.p0i8(i8* %p, i1 false, i1 true, i1 false)
+  %min = call i64 @llvm.objectsize.i64.p0i8(i8* %p, i1 true, i1 true, i1 false)
+  %r = sub i64 %min, %max
+  ret i64 %r
+}
+`
+	code, _ := translate(t, src)
+	if strings.Contains(code, "llvm_") {
+		t.Errorf("intrinsics are translated as calls:\n%s", numberLines(code))
+	}
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	var b byte
+	fmt.Println(annotated(42), sizes(&b))
+}
+`
+	if got, want := runGo(t, code, mainSrc), "42 1\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// Integer types whose widths Go doesn't have are handled in two ways:
+//
+// Odd widths up to 64 bits (like the i24 and i48 that Clang uses for
+// bitfields) are held in the next larger Go type: byte for i2 through i7, and
+// int16, int32, or int64 for the rest. The bits above the width are kept
+// normalized, so that equal values compare equal: they are zeros in a byte,
+// and copies of the sign bit in the others. IntWidthInstruction normalizes
+// the results of the instructions that can disturb them, and FormatSigned
+// and FormatUnsigned give the views of the values that the other
+// instructions need.
+//
+// i128 is translated as libc.Int128, and IntWidthInstruction translates the
+// arithmetic on it as method calls. Other widths over 64 bits are not
+// supported.
+
+// intContainer returns the width of the Go integer type that holds values of
+// an LLVM integer type with the given width, or 0 if there is none. (For i128,
+// it is 0 too, since libc.Int128 isn't one of Go's integer types.)
+func intContainer(bits uint64) uint64 {
+	switch {
+	case bits <= 8:
+		return 8
+	case bits <= 16:
+		return 16
+	case bits <= 32:
+		return 32
+	case bits <= 64:
+		return 64
+	}
+	return 0
+}
+
+// oddWidth returns t as an integer type, if it is one of the odd widths up to
+// 64 bits.
+func oddWidth(t types.Type) (*types.IntType, bool) {
+	it, ok := t.(*types.IntType)
+	if !ok || it.BitSize == 1 || it.BitSize > 64 || intContainer(it.BitSize) == it.BitSize {
+		return nil, false
+	}
+	return it, true
+}
+
+// isInt128 reports whether t is i128.
+func isInt128(t types.Type) bool {
+	it, ok := t.(*types.IntType)
+	return ok && it.BitSize == 128
+}
+
+// oddMask returns the mask for the bits of an odd-width integer type.
+func oddMask(it *types.IntType) uint64 {
+	return 1<<it.BitSize - 1
+}
+
+// normalizeOdd returns expr (an expression of the container type for it) with
+// the bits above its width normalized.
+func normalizeOdd(expr string, it *types.IntType) string {
+	c := intContainer(it.BitSize)
+	if c == 8 {
+		return fmt.Sprintf("%s & %d", parenthesize(expr), oddMask(it))
+	}
+	return fmt.Sprintf("%s << %d >> %d", parenthesize(expr), c-it.BitSize, c-it.BitSize)
+}
+
+// sextInt64 returns the value of the constant c, sign-extended from its width.
+func sextInt64(c *constant.Int) int64 {
+	x := new(big.Int).And(c.X, new(big.Int).SetUint64(1<<c.Typ.BitSize-1)).Uint64()
+	shift := 64 - c.Typ.BitSize
+	return int64(x<<shift) >> shift
+}
+
+// int128Literal returns a libc.Int128 composite literal for the constant c.
+func int128Literal(c *constant.Int) string {
+	x := new(big.Int).Set(c.X)
+	if x.Sign() < 0 {
+		x.Add(x, new(big.Int).Lsh(big.NewInt(1), 128))
+	}
+	lo := new(big.Int).And(x, new(big.Int).SetUint64(^uint64(0))).Uint64()
+	hi := new(big.Int).Rsh(x, 64).Uint64()
+	switch {
+	case hi == 0 && lo == 0:
+		return "libc.Int128{}"
+	case hi == 0:
+		return fmt.Sprintf("libc.Int128{Lo: %d}", lo)
+	}
+	return fmt.Sprintf("libc.Int128{Lo: %#x, Hi: %#x}", lo, hi)
+}
+
+// int128Ops gives the names of the libc.Int128 methods for arithmetic
+// instructions.
+var int128Ops = map[string]string{
+	"add":  "Add",
+	"sub":  "Sub",
+	"mul":  "Mul",
+	"and":  "And",
+	"or":   "Or",
+	"xor":  "Xor",
+	"udiv": "UDiv",
+	"sdiv": "SDiv",
+	"urem": "URem",
+	"srem": "SRem",
+	"shl":  "Shl",
+	"lshr": "LShr",
+	"ashr": "AShr",
+}
+
+// IntWidthInstruction translates the instructions whose results are odd-width
+// integers or i128, and the ones that take i128 operands, which need more
+// than the usual Go operators. For other instructions, it returns ok ==
+// false.
+func IntWidthInstruction(inst ir.Instruction) (result string, ok bool, err error) {
+	switch inst := inst.(type) {
+	case *ir.InstAdd:
+		result, err = intWidthBinary(inst, inst.Typ, "add", inst.X, inst.Y)
+	case *ir.InstSub:
+		result, err = intWidthBinary(inst, inst.Typ, "sub", inst.X, inst.Y)
+	case *ir.InstMul:
+		result, err = intWidthBinary(inst, inst.Typ, "mul", inst.X, inst.Y)
+	case *ir.InstAnd:
+		result, err = intWidthBinary(inst, inst.Typ, "and", inst.X, inst.Y)
+	case *ir.InstOr:
+		result, err = intWidthBinary(inst, inst.Typ, "or", inst.X, inst.Y)
+	case *ir.InstXor:
+		result, err = intWidthBinary(inst, inst.Typ, "xor", inst.X, inst.Y)
+	case *ir.InstUDiv:
+		result, err = intWidthBinary(inst, inst.Typ, "udiv", inst.X, inst.Y)
+	case *ir.InstSDiv:
+		result, err = intWidthBinary(inst, inst.Typ, "sdiv", inst.X, inst.Y)
+	case *ir.InstURem:
+		result, err = intWidthBinary(inst, inst.Typ, "urem", inst.X, inst.Y)
+	case *ir.InstSRem:
+		result, err = intWidthBinary(inst, inst.Typ, "srem", inst.X, inst.Y)
+	case *ir.InstShl:
+		result, err = intWidthBinary(inst, inst.Typ, "shl", inst.X, inst.Y)
+	case *ir.InstLShr:
+		result, err = intWidthBinary(inst, inst.Typ, "lshr", inst.X, inst.Y)
+	case *ir.InstAShr:
+		result, err = intWidthBinary(inst, inst.Typ, "ashr", inst.X, inst.Y)
+
+	case *ir.InstICmp:
+		if !isInt128(inst.X.Type()) {
+			return "", false, nil
+		}
+		result, err = int128Comparison(inst)
+
+	case *ir.InstTrunc:
+		result, err = intWidthConversion(inst, inst.From, inst.To, "trunc")
+	case *ir.InstZExt:
+		result, err = intWidthConversion(inst, inst.From, inst.To, "zext")
+	case *ir.InstSExt:
+		result, err = intWidthConversion(inst, inst.From, inst.To, "sext")
+	case *ir.InstFPToSI:
+		result, err = intWidthConversion(inst, inst.From, inst.To, "fptosi")
+	case *ir.InstFPToUI:
+		result, err = intWidthConversion(inst, inst.From, inst.To, "fptoui")
+
+	case *ir.InstSIToFP:
+		if !isInt128(inst.From.Type()) {
+			return "", false, nil
+		}
+		result, err = int128ToFloat(inst, inst.From, inst.To, "Float")
+	case *ir.InstUIToFP:
+		if !isInt128(inst.From.Type()) {
+			return "", false, nil
+		}
+		result, err = int128ToFloat(inst, inst.From, inst.To, "UFloat")
+
+	default:
+		return "", false, nil
+	}
+	if result == "" && err == nil {
+		// The type is an ordinary one.
+		return "", false, nil
+	}
+	return result, true, err
+}
+
+// intWidthBinary translates a binary operation (with the name of the LLVM
+// instruction as op), if its type is an odd width or i128. Otherwise it
+// returns the empty string.
+func intWidthBinary(dest value.Named, t types.Type, op string, x, y value.Value) (string, error) {
+	if isInt128(t) {
+		xs, err := FormatValue(x)
+		if err != nil {
+			return "", fmt.Errorf("error translating left operand (%v): %v", x, err)
+		}
+		var ys string
+		switch op {
+		case "shl", "lshr", "ashr":
+			if c, ok := y.(*constant.Int); ok && c.X.IsUint64() {
+				ys = c.X.String()
+			} else {
+				ys, err = FormatValue(y)
+				ys = fmt.Sprintf("uint(%s.Lo)", ys)
+			}
+		default:
+			ys, err = FormatValue(y)
+		}
+		if err != nil {
+			return "", fmt.Errorf("error translating right operand (%v): %v", y, err)
+		}
+		return fmt.Sprintf("%s = %s.%s(%s)", VariableName(dest), xs, int128Ops[op], ys), nil
+	}
+
+	it, ok := oddWidth(t)
+	if !ok {
+		return "", nil
+	}
+	format, view := FormatValue, true
+	switch op {
+	case "and", "or", "xor":
+		// These can't disturb the normalized bits.
+		return "", nil
+	case "sdiv", "srem", "ashr":
+		format = FormatSigned
+	case "udiv", "urem", "lshr":
+		format = FormatUnsigned
+	default:
+		view = false
+	}
+	xs, err := format(x)
+	if err != nil {
+		return "", fmt.Errorf("error translating left operand (%v): %v", x, err)
+	}
+	yFormat := format
+	if op == "shl" || op == "lshr" || op == "ashr" {
+		yFormat = FormatUnsigned
+	}
+	ys, err := yFormat(y)
+	if err != nil {
+		return "", fmt.Errorf("error translating right operand (%v): %v", y, err)
+	}
+	expr := fmt.Sprintf("%s %s %s", xs, goBinaryOps[op], ys)
+	if view {
+		// Convert the signed or unsigned view back to the container type.
+		ct, err := TypeSpec(it)
+		if err != nil {
+			return "", fmt.Errorf("error translating type (%v): %v", it, err)
+		}
+		expr = fmt.Sprintf("%s(%s)", ct, expr)
+	}
+	return fmt.Sprintf("%s = %s", VariableName(dest), normalizeOdd(expr, it)), nil
+}
+
+// goBinaryOps gives the Go operators for LLVM's binary instructions.
+var goBinaryOps = map[string]string{
+	"add":  "+",
+	"sub":  "-",
+	"mul":  "*",
+	"udiv": "/",
+	"sdiv": "/",
+	"urem": "%",
+	"srem": "%",
+	"shl":  "<<",
+	"lshr": ">>",
+	"ashr": ">>",
+}
+
+// int128Comparison translates an icmp instruction that compares i128 values.
+func int128Comparison(inst *ir.InstICmp) (string, error) {
+	x, err := FormatValue(inst.X)
+	if err != nil {
+		return "", fmt.Errorf("error translating left operand (%v): %v", inst.X, err)
+	}
+	y, err := FormatValue(inst.Y)
+	if err != nil {
+		return "", fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
+	}
+	pred := inst.Pred.String()
+	if pred == "eq" || pred == "ne" {
+		op := "=="
+		if pred == "ne" {
+			op = "!="
+		}
+		return fmt.Sprintf("%s = %s %s %s", VariableName(inst), x, op, y), nil
+	}
+	method := "Cmp"
+	if pred[0] == 'u' {
+		method = "UCmp"
+	}
+	op, ok := map[string]string{"gt": ">", "ge": ">=", "lt": "<", "le": "<="}[pred[1:]]
+	if !ok {
+		return "", fmt.Errorf("unsupported comparison predicate: %v", inst.Pred)
+	}
+	return fmt.Sprintf("%s = %s.%s(%s) %s 0", VariableName(inst), x, method, y, op), nil
+}
+
+// intWidthConversion translates a conversion (with the name of the LLVM
+// instruction as op) to or from an odd-width integer or i128. If neither
+// type is one of them, it returns the empty string.
+func intWidthConversion(dest value.Named, from value.Value, to types.Type, op string) (string, error) {
+	fromWide, toWide := isInt128(from.Type()), isInt128(to)
+	toOdd, isOdd := oddWidth(to)
+	if !fromWide && !toWide && !isOdd {
+		// Conversions from odd widths work like the others, with the
+		// views from FormatSigned and FormatUnsigned.
+		return "", nil
+	}
+	if (op == "fptosi" || op == "fptoui") && *fpToInt == "saturate" {
+		return floatToInt(dest, from, to, op == "fptosi", true)
+	}
+	format := FormatValue
+	switch op {
+	case "zext":
+		format = FormatUnsigned
+	case "sext":
+		format = FormatSigned
+	}
+	x, err := format(from)
+	if err != nil {
+		return "", fmt.Errorf("error translating source (%v): %v", from, err)
+	}
+	if isHalf(from.Type()) {
+		x += ".Float32()"
+	}
+	fromBool := types.Equal(from.Type(), types.I1)
+
+	if toWide {
+		switch {
+		case op == "fptosi" || op == "fptoui":
+			if ft, ok := from.Type().(*types.FloatType); ok && (ft.Kind == types.FloatKindFloat || ft.Kind == types.FloatKindHalf) {
+				x = fmt.Sprintf("float64(%s)", x)
+			}
+			x = fmt.Sprintf("libc.Int128FromFloat64(%s)", x)
+		case fromBool && op == "sext":
+			x = fmt.Sprintf("libc.Int128FromInt64(-%s(%s))", boolToInt("int64"), x)
+		case fromBool:
+			x = fmt.Sprintf("libc.Int128FromUint64(uint64(%s(%s)))", boolToInt("int64"), x)
+		case op == "sext":
+			x = fmt.Sprintf("libc.Int128FromInt64(int64(%s))", x)
+		default:
+			x = fmt.Sprintf("libc.Int128FromUint64(uint64(%s))", x)
+		}
+		return fmt.Sprintf("%s = %s", VariableName(dest), x), nil
+	}
+
+	if fromWide {
+		// Truncate to the low half first.
+		x = x + ".Lo"
+		if types.Equal(to, types.I1) {
+			return fmt.Sprintf("%s = %s&1 != 0", VariableName(dest), x), nil
+		}
+	}
+	t, err := TypeSpec(to)
+	if err != nil {
+		return "", fmt.Errorf("error translating type (%v): %v", to, err)
+	}
+	switch {
+	case fromBool && op == "sext":
+		x = fmt.Sprintf("-%s(%s)", boolToInt(t), x)
+	case fromBool:
+		x = fmt.Sprintf("%s(%s)", boolToInt(t), x)
+	case op == "fptoui":
+		x = fmt.Sprintf("%s(uint64(%s))", t, x)
+	default:
+		x = fmt.Sprintf("%s(%s)", t, x)
+	}
+	if isOdd {
+		x = normalizeOdd(x, toOdd)
+	}
+	return fmt.Sprintf("%s = %s", VariableName(dest), x), nil
+}
+
+// int128ToFloat translates a conversion from i128 to floating point, with
+// method as "Float" for signed integers and "UFloat" for unsigned ones.
+func int128ToFloat(dest value.Named, from value.Value, to types.Type, method string) (string, error) {
+	ft, ok := to.(*types.FloatType)
+	if !ok {
+		return "", fmt.Errorf("unsupported type for conversion from i128: %v", to)
+	}
+	x, err := FormatValue(from)
+	if err != nil {
+		return "", fmt.Errorf("error translating source (%v): %v", from, err)
+	}
+	switch ft.Kind {
+	case types.FloatKindHalf:
+		return fmt.Sprintf("%s = libc.Float16FromFloat64(%s.%s64())", VariableName(dest), x, method), nil
+	case types.FloatKindFloat:
+		return fmt.Sprintf("%s = %s.%s32()", VariableName(dest), x, method), nil
+	}
+	return fmt.Sprintf("%s = %s.%s64()", VariableName(dest), x, method), nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// int128String formats x (reduced to 128 bits) the way fmt prints a
+// libc.Int128.
+func int128String(x *big.Int) string {
+	m := new(big.Int).Lsh(big.NewInt(1), 128)
+	x = new(big.Int).Mod(x, m)
+	lo := new(big.Int).And(x, new(big.Int).SetUint64(^uint64(0)))
+	hi := new(big.Int).Rsh(x, 64)
+	return fmt.Sprintf("{%v %v}", lo, hi)
+}
+
+func TestInt128(t *testing.T) {
+	t.Parallel()
+	a := new(big.Int).Neg(new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 100), big.NewInt(12345)))
+	b := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 70), big.NewInt(999))
+	m := new(big.Int).Lsh(big.NewInt(1), 128)
+	ua := new(big.Int).Add(a, m)
+
+	src := new(strings.Builder)
+	var exprs []string
+	want := new(strings.Builder)
+	lit := func(x *big.Int) string {
+		x = new(big.Int).Mod(x, m)
+		return fmt.Sprintf("libc.Int128{Lo: %v, Hi: %v}", new(big.Int).And(x, new(big.Int).SetUint64(^uint64(0))), new(big.Int).Rsh(x, 64))
+	}
+	binary := map[string]*big.Int{
+		"add":  new(big.Int).Add(a, b),
+		"sub":  new(big.Int).Sub(a, b),
+		"mul":  new(big.Int).Mul(a, b),
+		"and":  new(big.Int).And(a, b),
+		"or":   new(big.Int).Or(a, b),
+		"xor":  new(big.Int).Xor(a, b),
+		"udiv": new(big.Int).Quo(ua, b),
+		"urem": new(big.Int).Rem(ua, b),
+		"sdiv": new(big.Int).Quo(a, b),
+		"srem": new(big.Int).Rem(a, b),
+	}
+	for _, op := range []string{"add", "sub", "mul", "and", "or", "xor", "udiv", "urem", "sdiv", "srem"} {
+		fmt.Fprintf(src, "define i128 @i128_%[1]s(i128 %%x, i128 %%y) {\n  %%r = %[1]s i128 %%x, %%y\n  ret i128 %%r\n}\n\n", op)
+		exprs = append(exprs, fmt.Sprintf("i128_%s(%s, %s)", op, lit(a), lit(b)))
+		fmt.Fprintln(want, int128String(binary[op]))
+	}
+
+	// Shifts, by a constant and by a variable amount.
+	shifts := map[string]*big.Int{
+		"shl":  new(big.Int).Lsh(a, 67),
+		"lshr": new(big.Int).Rsh(ua, 67),
+		"ashr": new(big.Int).Rsh(a, 67),
+	}
+	for _, op := range []string{"shl", "lshr", "ashr"} {
+		fmt.Fprintf(src, "define i128 @i128_%[1]s(i128 %%x, i128 %%n) {\n  %%c = %[1]s i128 %%x, 67\n  %%v = %[1]s i128 %%x, %%n\n  %%r = xor i128 %%c, %%v\n  ret i128 %%r\n}\n\n", op)
+		fmt.Fprintf(src, "define i128 @i128_%[1]s_const(i128 %%x) {\n  %%r = %[1]s i128 %%x, 67\n  ret i128 %%r\n}\n\n", op)
+		exprs = append(exprs, fmt.Sprintf("i128_%s(%s, libc.Int128{Lo: 67})", op, lit(a)), fmt.Sprintf("i128_%s_const(%s)", op, lit(a)))
+		fmt.Fprintf(want, "{0 0}\n%s\n", int128String(shifts[op]))
+	}
+
+	src.WriteString(`
+define i32 @compare(i128 %x, i128 %y) {
+  %slt = icmp slt i128 %x, %y
+  %ult = icmp ult i128 %x, %y
+  %eq = icmp eq i128 %x, %y
+  %s = zext i1 %slt to i32
+  %u = zext i1 %ult to i32
+  %e = zext i1 %eq to i32
+  %s2 = mul i32 %s, 100
+  %u2 = mul i32 %u, 10
+  %a = add i32 %s2, %u2
+  %r = add i32 %a, %e
+  ret i32 %r
+}
+
+define i128 @widen(i64 %x) {
+  %s = sext i64 %x to i128
+  %z = zext i64 %x to i128
+  %r = add i128 %s, %z
+  ret i128 %r
+}
+
+define i32 @narrow(i128 %x) {
+  %r = trunc i128 %x to i32
+  ret i32 %r
+}
+
+define double @toFloat(i128 %x) {
+  %r = sitofp i128 %x to double
+  ret double %r
+}
+
+define i128 @fromFloat(double %x) {
+  %r = fptosi double %x to i128
+  ret i128 %r
+}
+
+define i128 @constant() {
+  %r = add i128 -1, 18446744073709551616
+  ret i128 %r
+}
+`)
+	exprs = append(exprs,
+		fmt.Sprintf("compare(%s, %s)", lit(a), lit(b)),
+		"widen(-3)",
+		fmt.Sprintf("narrow(%s)", lit(a)),
+		"toFloat(libc.Int128FromInt64(-1 << 40))",
+		"fromFloat(-0x1p80)",
+		"constant()",
+	)
+	fmt.Fprintf(want, "100\n%s\n%d\n%v\n%s\n%s\n",
+		int128String(new(big.Int).Add(big.NewInt(-3), new(big.Int).SetUint64(uint64(1<<64-3)))),
+		int32(-12345),
+		-float64(int64(1)<<40),
+		int128String(new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 80))),
+		int128String(new(big.Int).SetUint64(^uint64(0))),
+	)
+
+	mainSrc := strings.Replace(mainCalling(exprs...), `import "fmt"`, "import (\n\t\"fmt\"\n\n\t\"github.com/andybalholm/leaven/libc\"\n)", 1)
+	checkProgram(t, src.String(), mainSrc, want.String())
+}
+
+func TestOddWidths(t *testing.T) {
+	t.Parallel()
+	src := `
+; Each function truncates its arguments to an odd width, and extends the
+; result back to i32.
+
+define i32 @add24(i32 %a, i32 %b) {
+  %x = trunc i32 %a to i24
+  %y = trunc i32 %b to i24
+  %r = add i24 %x, %y
+  %s = sext i24 %r to i32
+  ret i32 %s
+}
+
+define i32 @mulZext24(i32 %a, i32 %b) {
+  %x = trunc i32 %a to i24
+  %y = trunc i32 %b to i24
+  %r = mul i24 %x, %y
+  %z = zext i24 %r to i32
+  ret i32 %z
+}
+
+define i32 @div24(i32 %a, i32 %b) {
+  %x = trunc i32 %a to i24
+  %y = trunc i32 %b to i24
+  %s = sdiv i24 %x, %y
+  %u = udiv i24 %x, %y
+  %s32 = sext i24 %s to i32
+  %u32 = zext i24 %u to i32
+  %r = sub i32 %u32, %s32
+  ret i32 %r
+}
+
+define i32 @shifts24(i32 %a) {
+  %x = trunc i32 %a to i24
+  %l = shl i24 %x, 4
+  %a1 = ashr i24 %x, 4
+  %u = lshr i24 %x, 4
+  %l32 = sext i24 %l to i32
+  %a32 = sext i24 %a1 to i32
+  %u32 = zext i24 %u to i32
+  %s = add i32 %l32, %a32
+  %r = add i32 %s, %u32
+  ret i32 %r
+}
+
+define i1 @equal24(i32 %a) {
+  %x = trunc i32 %a to i24
+  %y = add i24 %x, 1
+  %r = icmp eq i24 %y, -8388608
+  ret i1 %r
+}
+
+define i32 @add5(i32 %a, i32 %b) {
+  %x = trunc i32 %a to i5
+  %y = trunc i32 %b to i5
+  %r = add i5 %x, %y
+  %s = sext i5 %r to i32
+  %z = zext i5 %r to i32
+  %m = mul i32 %s, 100
+  %t = add i32 %m, %z
+  ret i32 %t
+}
+
+define i64 @sub48(i64 %a, i64 %b) {
+  %x = trunc i64 %a to i48
+  %y = trunc i64 %b to i48
+  %r = sub i48 %x, %y
+  %s = sext i48 %r to i64
+  ret i64 %s
+}
+`
+	s24 := func(x int32) int32 { return x << 8 >> 8 }
+	s5 := func(x int32) int32 { return x << 27 >> 27 }
+	wantLines := []interface{}{
+		s24(0x7fffff + 1),
+		(uint32(0x123456) * 0x10) & 0xffffff,
+		int32(uint32(0xffff00)/2) - s24(0xffff00)/2,
+		s24(0x812345<<4) + s24(0x812345)>>4 + 0x812345>>4,
+		true,
+		s5(13+9)*100 + (13+9)&31,
+		int64(-1) << 47,
+	}
+	mainSrc := mainCalling(
+		"add24(0x7fffff, 1)",
+		"mulZext24(0x123456, 0x10)",
+		"div24(0xffff00, 2)",
+		"shifts24(0x812345)",
+		"equal24(0x7fffff)",
+		"add5(13, 9)",
+		"sub48(0, 1 << 47)",
+	)
+	want := new(strings.Builder)
+	for _, l := range wantLines {
+		fmt.Fprintln(want, l)
+	}
+	checkProgram(t, src, mainSrc, want.String())
+}
+
+func TestSaturatingWidths(t *testing.T) {
+	t.Parallel()
+	src := `
+; The odd-width results are extended back to i64 (sign-extended for fptosi,
+; zero-extended for fptoui) to show their values.
+
+define i64 @s24(double %x) {
+  %r = fptosi double %x to i24
+  %e = sext i24 %r to i64
+  ret i64 %e
+}
+
+define i64 @u24(float %x) {
+  %r = fptoui float %x to i24
+  %e = zext i24 %r to i64
+  ret i64 %e
+}
+
+define i64 @s4(double %x) {
+  %r = fptosi double %x to i4
+  %e = sext i4 %r to i64
+  ret i64 %e
+}
+
+define i64 @u4(double %x) {
+  %r = fptoui double %x to i4
+  %e = zext i4 %r to i64
+  ret i64 %e
+}
+
+define i64 @sat48(double %x) {
+  %r = call i48 @llvm.fptosi.sat.i48.f64(double %x)
+  %e = sext i48 %r to i64
+  ret i64 %e
+}
+
+define i128 @s128(double %x) {
+  %r = fptosi double %x to i128
+  ret i128 %r
+}
+
+define i128 @u128(float %x) {
+  %r = fptoui float %x to i128
+  ret i128 %r
+}
+
+declare i48 @llvm.fptosi.sat.i48.f64(double)
+`
+	mainSrc := `package main
+
+import (
+	"fmt"
+	"math"
+)
+
+func main() {
+	nan := math.NaN()
+	fmt.Println(s24(1e9), s24(-1e9), s24(-5.5), s24(nan))
+	fmt.Println(u24(1e9), u24(-3), u24(12345.75))
+	fmt.Println(s4(100), s4(-100), s4(-3.5), s4(7))
+	fmt.Println(u4(100), u4(-1), u4(9.9))
+	fmt.Println(sat48(1e20), sat48(-1e20), sat48(-12345))
+	fmt.Println(s128(1e40), s128(-1e40), s128(-2), s128(nan))
+	fmt.Println(u128(float32(math.Inf(1))), u128(-1), u128(3))
+}
+`
+	max128 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 127), big.NewInt(1))
+	min128 := new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 127))
+	want := fmt.Sprintf(`8388607 -8388608 -5 0
+16777215 0 12345
+7 -8 -3 7
+15 0 9
+140737488355327 -140737488355328 -12345
+%s %s %s {0 0}
+%s {0 0} {3 0}
+`, int128String(max128), int128String(min128), int128String(big.NewInt(-2)), int128String(big.NewInt(-1)))
+	checkProgram(t, src, mainSrc, want, "-fp-to-int=saturate")
+}
+
+func TestSaturatingHelperNames(t *testing.T) {
+	t.Parallel()
+	// A function with the same name as an odd-width helper is renamed.
+	src := `
+define i64 @satF64I24(double %x) {
+  %r = fptosi double %x to i24
+  %e = sext i24 %r to i64
+  ret i64 %e
+}
+`
+	code, _ := translate(t, src, "-fp-to-int=saturate")
+	if !strings.Contains(code, "func satF64I24(x float64) int32 {") {
+		t.Errorf("the helper isn't named satF64I24:\n%s", numberLines(code))
+	}
+	if got, want := runGo(t, code, mainCalling("satF64I24_1(1e9)")), "8388607\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
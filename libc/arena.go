@@ -0,0 +1,225 @@
+package libc
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// The arena memory model (leaven -memory=arena) keeps all of a program's C
+// memory—globals, the heap, and stack variables whose address is taken—in a
+// single contiguous byte slice, and represents pointers as offsets into it.
+// That makes pointer arithmetic, pointer↔integer round trips, and
+// comparisons between pointers to different objects behave the way they do in
+// C, at the cost of giving up Go's type and memory safety inside the arena.
+//
+// The arena grows as needed, but it is not safe for concurrent use.
+
+// arenaNull is the size of the region at the start of the arena that is never
+// allocated, so that accesses through a null pointer (or a small offset from
+// one) panic instead of silently reading memory.
+const arenaNull = 16
+
+// arenaAlign is the alignment of every allocation (like malloc's, it is
+// enough for any type).
+const arenaAlign = 16
+
+var (
+	arena           = make([]byte, 1<<16)
+	heapTop uintptr = arenaNull
+
+	// blockSizes records the size of each allocated block, and freeBlocks
+	// holds the blocks that have been freed, by size, for reuse.
+	blockSizes = make(map[uintptr]uintptr)
+	freeBlocks = make(map[uintptr][]uintptr)
+
+	// allocas lists the blocks allocated by ArenaAlloca that haven't been
+	// released yet.
+	allocas []uintptr
+)
+
+// mem returns the n bytes of the arena starting at p, panicking if p is null.
+func mem(p uintptr, n int) []byte {
+	if p < arenaNull {
+		panic("nil pointer dereference")
+	}
+	return arena[p : p+uintptr(n)]
+}
+
+// ArenaMalloc allocates size bytes in the arena.
+func ArenaMalloc(size int64) uintptr {
+	n := (uintptr(size) + arenaAlign - 1) &^ (arenaAlign - 1)
+	if n == 0 {
+		n = arenaAlign
+	}
+	if free := freeBlocks[n]; len(free) > 0 {
+		p := free[len(free)-1]
+		freeBlocks[n] = free[:len(free)-1]
+		blockSizes[p] = n
+		zero(arena[p : p+n])
+		return p
+	}
+	p := heapTop
+	heapTop += n
+	for heapTop > uintptr(len(arena)) {
+		// Pointers are offsets, so moving the arena doesn't invalidate them.
+		bigger := make([]byte, 2*len(arena))
+		copy(bigger, arena)
+		arena = bigger
+	}
+	blockSizes[p] = n
+	return p
+}
+
+// zero sets the bytes of b to 0.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// ArenaCalloc allocates space in the arena for n objects of the given size.
+// (Arena memory is always zeroed when it is allocated.)
+func ArenaCalloc(n, size int64) uintptr {
+	return ArenaMalloc(n * size)
+}
+
+// ArenaFree frees the block at p, which must have come from ArenaMalloc.
+func ArenaFree(p uintptr) {
+	if p == 0 {
+		return
+	}
+	n, ok := blockSizes[p]
+	if !ok {
+		panic("free of a pointer that was not allocated")
+	}
+	delete(blockSizes, p)
+	freeBlocks[n] = append(freeBlocks[n], p)
+}
+
+// ArenaRealloc changes the size of the block at p, moving it if necessary.
+func ArenaRealloc(p uintptr, size int64) uintptr {
+	if p == 0 {
+		return ArenaMalloc(size)
+	}
+	n := blockSizes[p]
+	if uintptr(size) <= n {
+		return p
+	}
+	q := ArenaMalloc(size)
+	copy(arena[q:q+n], arena[p:p+n])
+	ArenaFree(p)
+	return q
+}
+
+// ArenaAlloca allocates size bytes for a stack variable. It is freed by the
+// ArenaRelease call that matches the ArenaMark call at the start of the
+// function.
+func ArenaAlloca(size int64) uintptr {
+	p := ArenaMalloc(size)
+	allocas = append(allocas, p)
+	return p
+}
+
+// ArenaMark returns a marker for the current depth of the alloca stack.
+func ArenaMark() int {
+	return len(allocas)
+}
+
+// ArenaRelease frees the stack variables allocated since the call to
+// ArenaMark that returned mark.
+func ArenaRelease(mark int) {
+	for _, p := range allocas[mark:] {
+		ArenaFree(p)
+	}
+	allocas = allocas[:mark]
+}
+
+// ArenaMemmove copies n bytes from src to dst, which may overlap.
+func ArenaMemmove(dst, src uintptr, n int64) uintptr {
+	if n > 0 {
+		copy(mem(dst, int(n)), mem(src, int(n)))
+	}
+	return dst
+}
+
+// ArenaMemset sets n bytes starting at p to c.
+func ArenaMemset(p uintptr, c int32, n int64) uintptr {
+	if n > 0 {
+		b := mem(p, int(n))
+		for i := range b {
+			b[i] = byte(c)
+		}
+	}
+	return p
+}
+
+// ArenaStrlen returns the length of the NUL-terminated string at p.
+func ArenaStrlen(p uintptr) int64 {
+	mem(p, 0)
+	n := int64(0)
+	for arena[p+uintptr(n)] != 0 {
+		n++
+	}
+	return n
+}
+
+// ArenaGoString returns a copy of the NUL-terminated string at p.
+func ArenaGoString(p uintptr) string {
+	if p == 0 {
+		return ""
+	}
+	return string(mem(p, int(ArenaStrlen(p))))
+}
+
+// ArenaBytes returns the n bytes starting at p. The slice refers to the
+// arena's memory, so it is only valid until the arena next grows.
+func ArenaBytes(p uintptr, n int) []byte {
+	return mem(p, n)
+}
+
+// ArenaWriteString copies the bytes of s to the arena, starting at p.
+func ArenaWriteString(p uintptr, s string) {
+	copy(mem(p, len(s)), s)
+}
+
+// The ArenaLoad and ArenaStore functions read and write values of each type
+// that can be loaded from memory. Values are stored in little-endian order.
+
+func ArenaLoadBool(p uintptr) bool     { return mem(p, 1)[0] != 0 }
+func ArenaLoadByte(p uintptr) byte     { return mem(p, 1)[0] }
+func ArenaLoadInt16(p uintptr) int16   { return int16(binary.LittleEndian.Uint16(mem(p, 2))) }
+func ArenaLoadInt32(p uintptr) int32   { return int32(binary.LittleEndian.Uint32(mem(p, 4))) }
+func ArenaLoadInt64(p uintptr) int64   { return int64(binary.LittleEndian.Uint64(mem(p, 8))) }
+func ArenaLoadPtr(p uintptr) uintptr   { return uintptr(binary.LittleEndian.Uint64(mem(p, 8))) }
+func ArenaLoadPtr32(p uintptr) uintptr { return uintptr(binary.LittleEndian.Uint32(mem(p, 4))) }
+
+func ArenaLoadFloat32(p uintptr) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(mem(p, 4)))
+}
+
+func ArenaLoadFloat64(p uintptr) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(mem(p, 8)))
+}
+
+func ArenaStoreBool(p uintptr, v bool) {
+	b := byte(0)
+	if v {
+		b = 1
+	}
+	mem(p, 1)[0] = b
+}
+
+func ArenaStoreByte(p uintptr, v byte)     { mem(p, 1)[0] = v }
+func ArenaStoreInt16(p uintptr, v int16)   { binary.LittleEndian.PutUint16(mem(p, 2), uint16(v)) }
+func ArenaStoreInt32(p uintptr, v int32)   { binary.LittleEndian.PutUint32(mem(p, 4), uint32(v)) }
+func ArenaStoreInt64(p uintptr, v int64)   { binary.LittleEndian.PutUint64(mem(p, 8), uint64(v)) }
+func ArenaStorePtr(p uintptr, v uintptr)   { binary.LittleEndian.PutUint64(mem(p, 8), uint64(v)) }
+func ArenaStorePtr32(p uintptr, v uintptr) { binary.LittleEndian.PutUint32(mem(p, 4), uint32(v)) }
+
+func ArenaStoreFloat32(p uintptr, v float32) {
+	binary.LittleEndian.PutUint32(mem(p, 4), math.Float32bits(v))
+}
+
+func ArenaStoreFloat64(p uintptr, v float64) {
+	binary.LittleEndian.PutUint64(mem(p, 8), math.Float64bits(v))
+}
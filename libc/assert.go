@@ -0,0 +1,16 @@
+package libc
+
+import "fmt"
+
+// AssertFail implements glibc's __assert_fail, which is what the assert macro
+// calls when an assertion fails. Instead of printing a message and aborting,
+// it panics with the location of the assertion in the C source.
+func AssertFail(expr, file *byte, line int32, function *byte) {
+	panic(fmt.Sprintf("%s:%d: %s: assertion failed: %s", GoString(file), line, GoString(function), GoString(expr)))
+}
+
+// AssertRtn implements __assert_rtn, the macOS and BSD equivalent of
+// __assert_fail, which takes its arguments in a different order.
+func AssertRtn(function, file *byte, line int32, expr *byte) {
+	AssertFail(expr, file, line, function)
+}
@@ -0,0 +1,15 @@
+package libc
+
+import "sync/atomic"
+
+// fenceWord is the variable that Fence operates on.
+var fenceWord uint32
+
+// Fence is a memory barrier, used to translate LLVM's fence instruction (and
+// C's atomic_thread_fence). Go doesn't have fences as such, but operations in
+// sync/atomic are sequentially consistent, so an atomic operation on a
+// variable that every fence shares orders the memory accesses before and
+// after it like a sequentially-consistent fence.
+func Fence() {
+	atomic.AddUint32(&fenceWord, 0)
+}
@@ -0,0 +1,49 @@
+package libc
+
+import "runtime"
+
+// Conversions between Go strings and C strings (NUL-terminated arrays of
+// bytes), for use by shims and by Go code that calls translated functions.
+
+// CString returns a NUL-terminated copy of s. Unlike cgo's C.CString, the
+// memory is managed by Go's garbage collector, so it doesn't need to be freed.
+func CString(s string) *byte {
+	b := make([]byte, len(s)+1)
+	copy(b, s)
+	return &b[0]
+}
+
+// GoString returns s converted from a C string to a Go string. A nil pointer
+// is converted to the empty string.
+func GoString(s *byte) string {
+	if s == nil {
+		return ""
+	}
+	return string(byteSlice(s, int(Strlen(s))))
+}
+
+// GoStringN returns the n bytes starting at s as a Go string.
+func GoStringN(s *byte, n int) string {
+	if s == nil || n <= 0 {
+		return ""
+	}
+	return string(byteSlice(s, n))
+}
+
+// GoBytes returns a copy of the n bytes starting at p.
+func GoBytes(p *byte, n int) []byte {
+	if p == nil || n <= 0 {
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, byteSlice(p, n))
+	return b
+}
+
+// WithCString calls f with a C string containing a copy of s. The string is
+// only valid until f returns.
+func WithCString(s string, f func(*byte)) {
+	p := CString(s)
+	f(p)
+	runtime.KeepAlive(p)
+}
@@ -0,0 +1,45 @@
+package libc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCStringRoundTrip(t *testing.T) {
+	for _, s := range []string{"", "hello", "with space"} {
+		p := CString(s)
+		if got := Strlen(p); got != int64(len(s)) {
+			t.Errorf("Strlen(CString(%q)) = %d", s, got)
+		}
+		if got := GoString(p); got != s {
+			t.Errorf("GoString(CString(%q)) = %q", s, got)
+		}
+	}
+	if got := GoString(nil); got != "" {
+		t.Errorf("GoString(nil) = %q", got)
+	}
+}
+
+func TestGoStringN(t *testing.T) {
+	p := CString("hello, world")
+	if got := GoStringN(p, 5); got != "hello" {
+		t.Errorf("GoStringN(p, 5) = %q", got)
+	}
+	if got := GoStringN(p, 0); got != "" {
+		t.Errorf("GoStringN(p, 0) = %q", got)
+	}
+	b := GoBytes(p, 5)
+	if !bytes.Equal(b, []byte("hello")) {
+		t.Errorf("GoBytes(p, 5) = %q", b)
+	}
+	// GoBytes returns a copy.
+	b[0] = 'j'
+	if got := GoString(p); got != "hello, world" {
+		t.Errorf("after changing GoBytes result, GoString(p) = %q", got)
+	}
+	WithCString("abc", func(p *byte) {
+		if got := Strlen(p); got != 3 {
+			t.Errorf("Strlen in WithCString = %d", got)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package libc
+
+import "unsafe"
+
+// LLVM's exception handling (invoke, landingpad, and resume) is translated
+// to Go panics. An invoke becomes a call to Invoke, and the landing pad gets
+// a pointer standing for the panic that was recovered; resume uses it to
+// continue panicking with the same value.
+
+// An exception records a panic value that has been recovered by Invoke. The
+// exception pointer that the translated code sees points to its first field.
+type exception struct {
+	tag   byte
+	value interface{}
+}
+
+// Invoke calls f. If f returns normally, Invoke returns nil. If f panics,
+// Invoke recovers, and returns an exception pointer for the panic.
+func Invoke(f func()) (exc *byte) {
+	returned := false
+	defer func() {
+		if !returned {
+			// Check returned instead of comparing the result of recover
+			// to nil, so that panic(nil) is caught too.
+			e := &exception{value: recover()}
+			exc = &e.tag
+		}
+	}()
+	f()
+	returned = true
+	return nil
+}
+
+// PanicValue returns the value that was passed to panic in the panic that exc
+// (an exception pointer returned by Invoke) was recovered from. A resume
+// instruction is translated as a panic with that value.
+func PanicValue(exc *byte) interface{} {
+	if exc == nil {
+		return "resume with nil exception pointer"
+	}
+	return (*exception)(unsafe.Pointer(exc)).value
+}
@@ -0,0 +1,69 @@
+package libc
+
+import "math"
+
+// Float16 is an IEEE 754 half-precision floating-point number, which is what
+// LLVM's half type (C's _Float16 and __fp16) is translated as. It is stored
+// as its bits. Go has no arithmetic on it, so values are converted to float32
+// for computing, and rounded back; float32 is precise enough that the results
+// of the basic operations are still correctly rounded.
+type Float16 uint16
+
+// Float16FromFloat64 rounds f to the nearest half-precision value (with ties
+// to even).
+func Float16FromFloat64(f float64) Float16 {
+	b := math.Float64bits(f)
+	sign := uint16(b>>48) & 0x8000
+	exp := int(b>>52&0x7ff) - 1023 + 15
+	mant := b & (1<<52 - 1)
+	switch {
+	case b&^(1<<63) > 0x7ff0000000000000:
+		// Keep the NaN quiet, and as much of its payload as fits.
+		return Float16(sign | 0x7e00 | uint16(mant>>42))
+	case exp >= 31:
+		return Float16(sign | 0x7c00)
+	case exp < -10:
+		// Less than half of the smallest subnormal.
+		return Float16(sign)
+	}
+	shift := uint(42)
+	if exp <= 0 {
+		// A subnormal result, with the implicit 1 bit shifted into the
+		// mantissa.
+		mant |= 1 << 52
+		shift = uint(43 - exp)
+		exp = 0
+	}
+	m := mant >> shift
+	rem, half := mant&(1<<shift-1), uint64(1)<<(shift-1)
+	if rem > half || rem == half && m&1 == 1 {
+		// Rounding up may carry into the exponent, which gives the right
+		// result (even when it makes the value infinite).
+		m++
+	}
+	return Float16(sign | (uint16(exp)<<10 + uint16(m)))
+}
+
+// Float16FromFloat32 rounds f to the nearest half-precision value.
+func Float16FromFloat32(f float32) Float16 {
+	return Float16FromFloat64(float64(f))
+}
+
+// Float32 returns h as a float32, which holds every half-precision value
+// exactly.
+func (h Float16) Float32() float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h) & 0x3ff
+	switch exp {
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	case 0:
+		f := float32(mant) / (1 << 24)
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	}
+	return math.Float32frombits(sign | (exp-15+127)<<23 | mant<<13)
+}
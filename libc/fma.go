@@ -0,0 +1,40 @@
+package libc
+
+import (
+	"math"
+	"math/big"
+)
+
+// FMA32 returns x*y + z for float32 values, computed with a single rounding,
+// as C's fmaf does.
+//
+// The product of two float32 values is exact in float64, so math.FMA gives
+// the exact result rounded to float64. Rounding that again to float32 gives
+// the correctly rounded result unless it lands exactly halfway between two
+// float32 values, where the first rounding may have decided which way the
+// second one goes. Only then is the sum computed exactly.
+func FMA32(x, y, z float32) float32 {
+	r := math.FMA(float64(x), float64(y), float64(z))
+	r32 := float32(r)
+	if r != r || math.IsInf(r, 0) {
+		return r32
+	}
+	if !math.IsInf(float64(r32), 0) {
+		toward := float32(math.Inf(1))
+		if r < float64(r32) {
+			toward = -toward
+		}
+		next := math.Nextafter32(r32, toward)
+		if float64(r32) == r || r != (float64(r32)+float64(next))/2 {
+			return r32
+		}
+	}
+
+	// The exponents of the product and z may be far apart, so the sum needs
+	// enough precision to cover both.
+	const prec = 1024
+	p := new(big.Float).SetPrec(prec).Mul(big.NewFloat(float64(x)), big.NewFloat(float64(y)))
+	p.Add(p, big.NewFloat(float64(z)))
+	f, _ := p.Float32()
+	return f
+}
@@ -0,0 +1,45 @@
+package libc
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+// exactFMA32 computes x*y + z with math/big, rounding once.
+func exactFMA32(x, y, z float32) float32 {
+	p := new(big.Float).SetPrec(1024).Mul(big.NewFloat(float64(x)), big.NewFloat(float64(y)))
+	p.Add(p, big.NewFloat(float64(z)))
+	f, _ := p.Float32()
+	return f
+}
+
+func TestFMA32(t *testing.T) {
+	cases := [][3]float32{
+		{2, 3, 4},
+		// The product is halfway between two float32 values; z decides
+		// which way it rounds.
+		{1 + 0x1p-12, 1 + 0x1p-12, 0x1p-80},
+		{1 + 0x1p-12, 1 + 0x1p-12, -0x1p-80},
+		{-(1 + 0x1p-12), 1 + 0x1p-12, 0x1p-80},
+		// Results in the subnormal range.
+		{0x1p-75, 0x1p-75 + 0x1p-98, 0x1p-200},
+		{math.MaxFloat32, 1 + 0x1p-23, -math.MaxFloat32},
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		// Products of values with few significant bits are often halfway
+		// cases.
+		x := float32(r.Intn(1<<13)) * 0x1p-13
+		y := float32(r.Intn(1<<13)) * 0x1p-13
+		z := float32(r.NormFloat64()) * float32(math.Ldexp(1, r.Intn(60)-50))
+		cases = append(cases, [3]float32{x, y, z})
+	}
+	for _, c := range cases {
+		got, want := FMA32(c[0], c[1], c[2]), exactFMA32(c[0], c[1], c[2])
+		if math.Float32bits(got) != math.Float32bits(want) {
+			t.Errorf("FMA32(%g, %g, %g) = %g, want %g", c[0], c[1], c[2], got, want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package libc
+
+import "unsafe"
+
+// A Go func value is a pointer (to a closure record), but Go doesn't allow
+// converting it to unsafe.Pointer, or between func types. C code does both
+// with function pointers, so FuncToPointer and PointerCell do it indirectly.
+
+// FuncToPointer returns the pointer that represents f, which must be a func
+// value (of any func type). Two values for the same top-level function give
+// the same pointer.
+func FuncToPointer(f interface{}) unsafe.Pointer {
+	// A func is stored directly in the data word of an interface.
+	return (*[2]unsafe.Pointer)(unsafe.Pointer(&f))[1]
+}
+
+// PointerCell returns the address of a variable holding p. Converting it to a
+// pointer to a func type and dereferencing it gives the func value that p
+// represents (the reverse of FuncToPointer).
+func PointerCell(p unsafe.Pointer) unsafe.Pointer {
+	return unsafe.Pointer(&p)
+}
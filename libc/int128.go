@@ -0,0 +1,273 @@
+package libc
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Int128 is a 128-bit integer, which is what LLVM's i128 type (C's __int128
+// and unsigned __int128) is translated as. Like the other integer types in
+// LLVM, it has no signedness of its own; the methods that care say which
+// interpretation they use. The low half comes first, as it does in memory on
+// little-endian machines.
+type Int128 struct {
+	Lo, Hi uint64
+}
+
+// Int128FromInt64 sign-extends x to 128 bits.
+func Int128FromInt64(x int64) Int128 {
+	return Int128{uint64(x), uint64(x >> 63)}
+}
+
+// Int128FromUint64 zero-extends x to 128 bits.
+func Int128FromUint64(x uint64) Int128 {
+	return Int128{x, 0}
+}
+
+// Int128FromFloat64 converts f to an integer, truncating toward zero. Values
+// from 2^127 up to 2^128 give the bits of the unsigned result, so it works
+// for both fptosi and fptoui.
+func Int128FromFloat64(f float64) Int128 {
+	neg := f < 0
+	if neg {
+		f = -f
+	}
+	var x Int128
+	if f < 1<<64 {
+		x.Lo = uint64(f)
+	} else {
+		x.Hi = uint64(f / (1 << 64))
+		x.Lo = uint64(f - float64(x.Hi)*(1<<64))
+	}
+	if neg {
+		return x.Neg()
+	}
+	return x
+}
+
+// Add returns x + y.
+func (x Int128) Add(y Int128) Int128 {
+	lo, carry := bits.Add64(x.Lo, y.Lo, 0)
+	hi, _ := bits.Add64(x.Hi, y.Hi, carry)
+	return Int128{lo, hi}
+}
+
+// Sub returns x - y.
+func (x Int128) Sub(y Int128) Int128 {
+	lo, borrow := bits.Sub64(x.Lo, y.Lo, 0)
+	hi, _ := bits.Sub64(x.Hi, y.Hi, borrow)
+	return Int128{lo, hi}
+}
+
+// Neg returns -x.
+func (x Int128) Neg() Int128 {
+	return Int128{}.Sub(x)
+}
+
+// Mul returns x * y.
+func (x Int128) Mul(y Int128) Int128 {
+	hi, lo := bits.Mul64(x.Lo, y.Lo)
+	hi += x.Hi*y.Lo + x.Lo*y.Hi
+	return Int128{lo, hi}
+}
+
+// And returns x & y.
+func (x Int128) And(y Int128) Int128 {
+	return Int128{x.Lo & y.Lo, x.Hi & y.Hi}
+}
+
+// Or returns x | y.
+func (x Int128) Or(y Int128) Int128 {
+	return Int128{x.Lo | y.Lo, x.Hi | y.Hi}
+}
+
+// Xor returns x ^ y.
+func (x Int128) Xor(y Int128) Int128 {
+	return Int128{x.Lo ^ y.Lo, x.Hi ^ y.Hi}
+}
+
+// Shl returns x << n.
+func (x Int128) Shl(n uint) Int128 {
+	switch {
+	case n >= 128:
+		return Int128{}
+	case n >= 64:
+		return Int128{0, x.Lo << (n - 64)}
+	case n == 0:
+		return x
+	}
+	return Int128{x.Lo << n, x.Hi<<n | x.Lo>>(64-n)}
+}
+
+// LShr returns x >> n, shifting in zeros.
+func (x Int128) LShr(n uint) Int128 {
+	switch {
+	case n >= 128:
+		return Int128{}
+	case n >= 64:
+		return Int128{x.Hi >> (n - 64), 0}
+	case n == 0:
+		return x
+	}
+	return Int128{x.Lo>>n | x.Hi<<(64-n), x.Hi >> n}
+}
+
+// AShr returns x >> n, shifting in copies of the sign bit.
+func (x Int128) AShr(n uint) Int128 {
+	sign := uint64(int64(x.Hi) >> 63)
+	switch {
+	case n >= 128:
+		return Int128{sign, sign}
+	case n >= 64:
+		return Int128{uint64(int64(x.Hi) >> (n - 64)), sign}
+	case n == 0:
+		return x
+	}
+	return Int128{x.Lo>>n | x.Hi<<(64-n), uint64(int64(x.Hi) >> n)}
+}
+
+// Cmp compares x and y as signed integers, returning -1, 0, or +1.
+func (x Int128) Cmp(y Int128) int {
+	if x.Hi != y.Hi {
+		if int64(x.Hi) < int64(y.Hi) {
+			return -1
+		}
+		return 1
+	}
+	return x.UCmp(y)
+}
+
+// UCmp compares x and y as unsigned integers, returning -1, 0, or +1.
+func (x Int128) UCmp(y Int128) int {
+	switch {
+	case x.Hi < y.Hi, x.Hi == y.Hi && x.Lo < y.Lo:
+		return -1
+	case x == y:
+		return 0
+	}
+	return 1
+}
+
+func (x Int128) negative() bool {
+	return int64(x.Hi) < 0
+}
+
+// UDivRem returns the quotient and remainder of x and y as unsigned
+// integers. It panics if y is zero.
+func (x Int128) UDivRem(y Int128) (q, r Int128) {
+	if y.Hi == 0 {
+		if y.Lo == 0 {
+			panic("integer divide by zero")
+		}
+		// Divide 64 bits at a time, like long division by a single digit.
+		q.Hi, r.Lo = x.Hi/y.Lo, x.Hi%y.Lo
+		q.Lo, r.Lo = bits.Div64(r.Lo, x.Lo, y.Lo)
+		return q, r
+	}
+	// The quotient fits in 64 bits. Estimate it from the high halves, with y
+	// shifted so that its top bit is set; the estimate is at most one too
+	// small.
+	n := uint(bits.LeadingZeros64(y.Hi))
+	y1 := y.Shl(n)
+	x1 := x.LShr(1)
+	est, _ := bits.Div64(x1.Hi, x1.Lo, y1.Hi)
+	est >>= 63 - n
+	if est != 0 {
+		est--
+	}
+	q = Int128{est, 0}
+	r = x.Sub(y.Mul(q))
+	if r.UCmp(y) >= 0 {
+		q = q.Add(Int128{1, 0})
+		r = r.Sub(y)
+	}
+	return q, r
+}
+
+// UDiv returns x / y as unsigned integers.
+func (x Int128) UDiv(y Int128) Int128 {
+	q, _ := x.UDivRem(y)
+	return q
+}
+
+// URem returns x % y as unsigned integers.
+func (x Int128) URem(y Int128) Int128 {
+	_, r := x.UDivRem(y)
+	return r
+}
+
+// SDiv returns x / y as signed integers, truncating toward zero.
+func (x Int128) SDiv(y Int128) Int128 {
+	xn, yn := x.negative(), y.negative()
+	if xn {
+		x = x.Neg()
+	}
+	if yn {
+		y = y.Neg()
+	}
+	q, _ := x.UDivRem(y)
+	if xn != yn {
+		return q.Neg()
+	}
+	return q
+}
+
+// SRem returns x % y as signed integers; the result has the sign of x.
+func (x Int128) SRem(y Int128) Int128 {
+	xn := x.negative()
+	if xn {
+		x = x.Neg()
+	}
+	if y.negative() {
+		y = y.Neg()
+	}
+	_, r := x.UDivRem(y)
+	if xn {
+		return r.Neg()
+	}
+	return r
+}
+
+// UFloat64 returns x as an unsigned integer, converted to float64.
+func (x Int128) UFloat64() float64 {
+	if x.Hi == 0 {
+		return float64(x.Lo)
+	}
+	// Shift x right so that it fits in 64 bits, keeping track of whether any
+	// 1 bits were shifted out so that the result is rounded correctly.
+	n := uint(64 - bits.LeadingZeros64(x.Hi))
+	m := x.LShr(n).Lo
+	if x.Lo<<(64-n) != 0 {
+		m |= 1
+	}
+	return math.Ldexp(float64(m), int(n))
+}
+
+// Float64 returns x as a signed integer, converted to float64.
+func (x Int128) Float64() float64 {
+	if x.negative() {
+		return -x.Neg().UFloat64()
+	}
+	return x.UFloat64()
+}
+
+// UFloat32 returns x as an unsigned integer, converted to float32.
+func (x Int128) UFloat32() float32 {
+	if x.Hi == 0 {
+		return float32(x.Lo)
+	}
+	n := uint(64 - bits.LeadingZeros64(x.Hi))
+	m := x.LShr(n).Lo
+	if x.Lo<<(64-n) != 0 {
+		m |= 1
+	}
+	return float32(math.Ldexp(float64(float32(m)), int(n)))
+}
+
+// Float32 returns x as a signed integer, converted to float32.
+func (x Int128) Float32() float32 {
+	if x.negative() {
+		return -x.Neg().UFloat32()
+	}
+	return x.UFloat32()
+}
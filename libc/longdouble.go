@@ -0,0 +1,247 @@
+package libc
+
+import (
+	"math"
+	"math/big"
+)
+
+// LongDouble is a floating-point number with more precision than float64,
+// which is what LLVM's x86_fp80 and fp128 types (C's long double) are
+// translated as with -long-double=big. Each value carries its precision (64
+// bits for x86_fp80, and 113 for fp128), and the results of operations are
+// rounded to the larger precision of their operands. Unlike the hardware
+// types, its exponent range is practically unlimited, so there are no
+// subnormals, and results that would overflow stay finite.
+//
+// The zero value is positive zero. A LongDouble is immutable, so it can be
+// copied like the other floating-point types.
+type LongDouble struct {
+	f   *big.Float
+	nan bool
+}
+
+var longDoubleZero = new(big.Float)
+
+func (x LongDouble) float() *big.Float {
+	if x.f == nil {
+		return longDoubleZero
+	}
+	return x.f
+}
+
+func longDoubleNaN() LongDouble {
+	return LongDouble{nan: true}
+}
+
+// NewLongDouble returns f, with prec bits of precision.
+func NewLongDouble(f float64, prec uint) LongDouble {
+	if math.IsNaN(f) {
+		return longDoubleNaN()
+	}
+	return LongDouble{f: new(big.Float).SetPrec(prec).SetFloat64(f)}
+}
+
+// ParseLongDouble returns the number represented by s (in any of the formats
+// accepted by big.ParseFloat), rounded to prec bits. It panics if s is not a
+// valid number.
+func ParseLongDouble(s string, prec uint) LongDouble {
+	f, _, err := big.ParseFloat(s, 0, prec, big.ToNearestEven)
+	if err != nil {
+		panic(err)
+	}
+	return LongDouble{f: f}
+}
+
+// LongDoubleFromInt64 converts x to a LongDouble with prec bits of
+// precision.
+func LongDoubleFromInt64(x int64, prec uint) LongDouble {
+	return LongDouble{f: new(big.Float).SetPrec(prec).SetInt64(x)}
+}
+
+// LongDoubleFromUint64 converts x to a LongDouble with prec bits of
+// precision.
+func LongDoubleFromUint64(x uint64, prec uint) LongDouble {
+	return LongDouble{f: new(big.Float).SetPrec(prec).SetUint64(x)}
+}
+
+// Round returns x rounded to prec bits of precision (for fptrunc and fpext
+// between x86_fp80 and fp128).
+func (x LongDouble) Round(prec uint) LongDouble {
+	if x.nan {
+		return x
+	}
+	return LongDouble{f: new(big.Float).SetPrec(prec).Set(x.float())}
+}
+
+// IsNaN reports whether x is NaN.
+func (x LongDouble) IsNaN() bool {
+	return x.nan
+}
+
+// Unordered reports whether x or y is NaN.
+func (x LongDouble) Unordered(y LongDouble) bool {
+	return x.nan || y.nan
+}
+
+// Cmp compares x and y, returning -1, 0, or +1. Its result is meaningless
+// if x and y are unordered.
+func (x LongDouble) Cmp(y LongDouble) int {
+	if x.Unordered(y) {
+		return 0
+	}
+	return x.float().Cmp(y.float())
+}
+
+// Sign returns -1, 0, or +1, according to the sign of x (0 for NaN).
+func (x LongDouble) Sign() int {
+	if x.nan {
+		return 0
+	}
+	return x.float().Sign()
+}
+
+// Neg returns -x.
+func (x LongDouble) Neg() LongDouble {
+	if x.nan {
+		return x
+	}
+	return LongDouble{f: new(big.Float).Neg(x.float())}
+}
+
+// isInf reports whether x is infinite, and (if so) whether it is negative.
+func (x LongDouble) isInf() (inf, neg bool) {
+	if x.nan || !x.float().IsInf() {
+		return false, false
+	}
+	return true, x.float().Signbit()
+}
+
+// isZero reports whether x is zero.
+func (x LongDouble) isZero() bool {
+	return !x.nan && x.float().Sign() == 0
+}
+
+// Add returns x + y.
+func (x LongDouble) Add(y LongDouble) LongDouble {
+	xi, xn := x.isInf()
+	yi, yn := y.isInf()
+	if x.Unordered(y) || xi && yi && xn != yn {
+		return longDoubleNaN()
+	}
+	return LongDouble{f: new(big.Float).Add(x.float(), y.float())}
+}
+
+// Sub returns x - y.
+func (x LongDouble) Sub(y LongDouble) LongDouble {
+	xi, xn := x.isInf()
+	yi, yn := y.isInf()
+	if x.Unordered(y) || xi && yi && xn == yn {
+		return longDoubleNaN()
+	}
+	return LongDouble{f: new(big.Float).Sub(x.float(), y.float())}
+}
+
+// Mul returns x * y.
+func (x LongDouble) Mul(y LongDouble) LongDouble {
+	xi, _ := x.isInf()
+	yi, _ := y.isInf()
+	if x.Unordered(y) || xi && y.isZero() || yi && x.isZero() {
+		return longDoubleNaN()
+	}
+	return LongDouble{f: new(big.Float).Mul(x.float(), y.float())}
+}
+
+// Quo returns x / y.
+func (x LongDouble) Quo(y LongDouble) LongDouble {
+	xi, _ := x.isInf()
+	yi, _ := y.isInf()
+	if x.Unordered(y) || xi && yi || x.isZero() && y.isZero() {
+		return longDoubleNaN()
+	}
+	return LongDouble{f: new(big.Float).Quo(x.float(), y.float())}
+}
+
+// Rem returns the remainder of x / y, with the quotient truncated toward
+// zero, like C's fmodl. The result is exact, and has the sign of x.
+func (x LongDouble) Rem(y LongDouble) LongDouble {
+	xi, _ := x.isInf()
+	yi, _ := y.isInf()
+	switch {
+	case x.Unordered(y) || xi || y.isZero():
+		return longDoubleNaN()
+	case yi || x.isZero():
+		return x
+	}
+	// Subtract the largest multiple of |y| by a power of 2 that fits, until
+	// the remainder is less than |y|. Each subtraction is exact.
+	prec := x.float().Prec()
+	if p := y.float().Prec(); p > prec {
+		prec = p
+	}
+	r := new(big.Float).SetPrec(prec).Abs(x.float())
+	ay := new(big.Float).SetPrec(prec).Abs(y.float())
+	yExp := ay.MantExp(nil)
+	m := new(big.Float).SetPrec(prec)
+	for r.Cmp(ay) >= 0 {
+		k := r.MantExp(nil) - yExp
+		m.SetMantExp(ay, k)
+		if m.Cmp(r) > 0 {
+			m.SetMantExp(ay, k-1)
+		}
+		r.Sub(r, m)
+	}
+	if x.float().Signbit() {
+		r.Neg(r)
+	}
+	return LongDouble{f: r}
+}
+
+// Float64 returns x, rounded to the nearest float64.
+func (x LongDouble) Float64() float64 {
+	if x.nan {
+		return math.NaN()
+	}
+	f, _ := x.float().Float64()
+	return f
+}
+
+// Float32 returns x, rounded to the nearest float32.
+func (x LongDouble) Float32() float32 {
+	if x.nan {
+		return float32(math.NaN())
+	}
+	f, _ := x.float().Float32()
+	return f
+}
+
+// Int64 returns x, truncated toward zero. The result is undefined if it is
+// out of range.
+func (x LongDouble) Int64() int64 {
+	if x.nan {
+		return 0
+	}
+	i, _ := x.float().Int64()
+	return i
+}
+
+// Uint64 returns x, truncated toward zero, as an unsigned integer. Negative
+// values (for fptoui from an operand that is out of range) give the bits of
+// the signed result.
+func (x LongDouble) Uint64() uint64 {
+	if x.nan {
+		return 0
+	}
+	if x.float().Sign() < 0 {
+		return uint64(x.Int64())
+	}
+	u, _ := x.float().Uint64()
+	return u
+}
+
+// String formats x like %g.
+func (x LongDouble) String() string {
+	if x.nan {
+		return "NaN"
+	}
+	return x.float().Text('g', -1)
+}
@@ -0,0 +1,32 @@
+package libc
+
+import "fmt"
+
+// A Status is a nonzero status code returned by a C function, used as an
+// error.
+type Status int32
+
+func (s Status) Error() string {
+	return fmt.Sprintf("status %d", int32(s))
+}
+
+// StatusError converts a C status code to an error. Zero means success, and
+// is converted to nil.
+func StatusError(code int32) error {
+	if code == 0 {
+		return nil
+	}
+	return Status(code)
+}
+
+// StatusCode converts an error back to a C status code. Errors that did not
+// come from StatusError are reported as -1.
+func StatusCode(err error) int32 {
+	if err == nil {
+		return 0
+	}
+	if s, ok := err.(Status); ok {
+		return int32(s)
+	}
+	return -1
+}
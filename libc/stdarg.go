@@ -5,8 +5,25 @@ import (
 	"unsafe"
 )
 
+// VAStart returns a va_list for the variadic arguments args. Each va_list has
+// its own copy of the slice, so that starting the list again begins with the
+// first argument.
+func VAStart(args []interface{}) *byte {
+	vl := args
+	return (*byte)(unsafe.Pointer(&vl))
+}
+
+// VACopy returns a copy of list, which starts at the same argument but
+// advances independently.
+func VACopy(list *byte) *byte {
+	vl := *(*[]interface{})(unsafe.Pointer(list))
+	return (*byte)(unsafe.Pointer(&vl))
+}
+
 // VAArg returns a pointer to the next argument in a varargs list. The actual
-// type of list is *[]interface{}, but it is declared as void * in C.
+// type of list is *[]interface{}, but it is declared as void * in C. (It is
+// also what va_arg instructions are translated to, so va_list has the same
+// representation for them.)
 func VAArg(list *byte) *byte {
 	vl := (*[]interface{})(unsafe.Pointer(list))
 	arg := (*vl)[0]
@@ -19,7 +19,7 @@ func Malloc(size int64) *byte {
 	mallocLock.Lock()
 	defer mallocLock.Unlock()
 
-	b, err := unix.Mmap(0, 0, int(size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON)
+	b, err := unix.Mmap(0, 0, int(size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
 	if err != nil {
 		panic(err)
 	}
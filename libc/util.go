@@ -9,7 +9,7 @@ func byteSlice(p *byte, n int) []byte {
 	return (*[1 << 30]byte)(unsafe.Pointer(p))[:n:n]
 }
 
-// GoString returns s converted from a C string to a Go string.
-func GoString(s *byte) string {
-	return string(byteSlice(s, int(Strlen(s))))
+// ByteSlice returns a slice of the n bytes starting at p.
+func ByteSlice(p *byte, n int) []byte {
+	return byteSlice(p, n)
 }
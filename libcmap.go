@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// libraryFunctions maps the names of C library functions (as sanitized by
+// valueName) to the Go functions that implement them. Entries can be added or
+// overridden with -libc-map.
+var libraryFunctions = map[string]string{
+	"__assert":         "libc.AssertRtn",
+	"__assert_fail":    "libc.AssertFail",
+	"__assert_rtn":     "libc.AssertRtn",
+	"calloc":           "libc.Calloc",
+	"fabs":             "math.Abs",
+	"free":             "libc.Free",
+	"leaven_va_arg":    "libc.VAArg",
+	"malloc":           "libc.Malloc",
+	"memchr":           "libc.Memchr",
+	"memcmp":           "libc.Memcmp",
+	"__memcpy_chk":     "libc.MemcpyChk",
+	"memset_pattern16": "libc.MemsetPattern16",
+	"__memset_chk":     "libc.MemsetChk",
+	"printf":           "noarch.Printf",
+	"puts":             "noarch.Puts",
+	"scanf":            "noarch.Scanf",
+	"__strcat_chk":     "libc.StrcatChk",
+	"strchr":           "libc.Strchr",
+	"strcmp":           "libc.Strcmp",
+	"strcpy":           "libc.Strcpy",
+	"strcspn":          "libc.Strcspn",
+	"strncat":          "libc.Strncat",
+	"strncmp":          "libc.Strncmp",
+	"strlen":           "libc.Strlen",
+	"strncpy":          "libc.Strncpy",
+	"strpbrk":          "libc.Strpbrk",
+	"strrchr":          "libc.Strrchr",
+	"strspn":           "libc.Strspn",
+	"strstr":           "libc.Strstr",
+}
+
+// A libcVariant describes a platform-specific name for a C library function:
+// the function it is equivalent to, and which of its arguments (such as the
+// flag and buffer size added by the fortify _chk variants) to drop when
+// calling that function.
+type libcVariant struct {
+	Name string
+	Drop []int
+}
+
+// libcVariants lists the names glibc, musl, and Darwin headers redirect
+// standard functions to. The _chk functions that have shims of their own
+// (such as __memcpy_chk) are in libraryFunctions instead.
+var libcVariants = map[string]libcVariant{
+	"__isoc99_scanf":   {Name: "scanf"},
+	"__isoc99_sscanf":  {Name: "sscanf"},
+	"__isoc99_fscanf":  {Name: "fscanf"},
+	"__isoc99_vscanf":  {Name: "vscanf"},
+	"__isoc99_vsscanf": {Name: "vsscanf"},
+	"__isoc99_vfscanf": {Name: "vfscanf"},
+	"__isoc23_scanf":   {Name: "scanf"},
+	"__isoc23_sscanf":  {Name: "sscanf"},
+	"__isoc23_fscanf":  {Name: "fscanf"},
+	"__isoc23_strtol":  {Name: "strtol"},
+	"__isoc23_strtoul": {Name: "strtoul"},
+	"__isoc23_strtoll": {Name: "strtoll"},
+
+	"__printf_chk":   {Name: "printf", Drop: []int{0}},
+	"__vprintf_chk":  {Name: "vprintf", Drop: []int{0}},
+	"__fprintf_chk":  {Name: "fprintf", Drop: []int{1}},
+	"__vfprintf_chk": {Name: "vfprintf", Drop: []int{1}},
+	"__puts_chk":     {Name: "puts", Drop: []int{1}},
+	"__memmove_chk":  {Name: "memmove", Drop: []int{3}},
+	"__strcpy_chk":   {Name: "strcpy", Drop: []int{2}},
+	"__stpcpy_chk":   {Name: "stpcpy", Drop: []int{2}},
+	"__strncpy_chk":  {Name: "strncpy", Drop: []int{3}},
+	"__strncat_chk":  {Name: "strncat", Drop: []int{3}},
+	"__read_chk":     {Name: "read", Drop: []int{3}},
+	"__fgets_chk":    {Name: "fgets", Drop: []int{1}},
+
+	"__error":  {Name: "__errno_location"},
+	"___errno": {Name: "__errno_location"},
+}
+
+// libcName returns the standard name of the C library function called name,
+// and the arguments to drop when calling it. Besides the names in
+// libcVariants, it recognizes Darwin names like "\01_fopen$UNIX2003".
+func libcName(name string) (string, []int) {
+	if strings.HasPrefix(name, "\x01_") {
+		name = strings.TrimPrefix(name, "\x01_")
+		if i := strings.Index(name, "$"); i != -1 {
+			name = name[:i]
+		}
+	}
+	if v, ok := libcVariants[name]; ok {
+		return v.Name, v.Drop
+	}
+	return name, nil
+}
+
+// dropArgs returns args without the ones at the indexes in drop.
+func dropArgs(args []string, drop []int) []string {
+	if len(drop) == 0 {
+		return args
+	}
+	var result []string
+outer:
+	for i, a := range args {
+		for _, d := range drop {
+			if i == d {
+				continue outer
+			}
+		}
+		result = append(result, a)
+	}
+	return result
+}
+
+// LoadLibcMap reads a file of extra entries for libraryFunctions. Each line
+// has the name of a C function and the Go function to call instead, separated
+// by whitespace. Lines starting with # are comments.
+func LoadLibcMap(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expected a C function name and a Go function name", file, i+1)
+		}
+		libraryFunctions[valueName(fields[0])] = fields[1]
+	}
+	return nil
+}
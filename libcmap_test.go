@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLibcVariants(t *testing.T) {
+	t.Parallel()
+	src := `
+@hello = constant [6 x i8] c"hello\00"
+
+declare i8* @__strcpy_chk(i8*, i8*, i64)
+declare i64 @"\01_strlen$UNIX2003"(i8*)
+declare i32 @twice(i32)
+
+define i64 @f(i8* %buf) {
+  %src = getelementptr [6 x i8], [6 x i8]* @hello, i64 0, i64 0
+  %p = call i8* @__strcpy_chk(i8* %buf, i8* %src, i64 16)
+  %n = call i64 @"\01_strlen$UNIX2003"(i8* %p)
+  ret i64 %n
+}
+
+define i32 @g(i32 %x) {
+  %r = call i32 @twice(i32 %x)
+  ret i32 %r
+}
+`
+	code, output, ok := runLeaven(t, src, map[string]string{
+		"libc.map": "# extra functions\ntwice goTwice\n",
+	}, "-libc-map=libc.map")
+	if !ok {
+		t.Fatalf("leaven failed:\n%s", output)
+	}
+	for _, s := range []string{"libc.Strcpy(buf, src)", "libc.Strlen(p)", "goTwice(x)"} {
+		if !strings.Contains(code, s) {
+			t.Errorf("generated code doesn't contain %q:\n%s", s, numberLines(code))
+		}
+	}
+	got := runGo(t, code, `package main
+
+import "fmt"
+
+func goTwice(x int32) int32 { return 2 * x }
+
+func main() {
+	buf := make([]byte, 16)
+	fmt.Println(f(&buf[0]), string(buf[:5]), g(21))
+}
+`)
+	if want := "5 hello 42\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+	"github.com/mewmew/float/binary128"
+)
+
+// C's long double is x86_fp80 on x86, and fp128 on some other targets. By
+// default (with -long-double=float64), both are translated as float64, which
+// loses precision, so a warning is printed when they are used. With
+// -long-double=big, they are translated as libc.LongDouble, which is backed by
+// a big.Float with the type's precision. Its memory layout is not the same as
+// the real type's, so code that looks at the bytes of a long double won't
+// work.
+
+// checkLongDoubleMode returns an error if mode is not a valid value for the
+// -long-double flag.
+func checkLongDoubleMode(mode string) error {
+	switch mode {
+	case "float64", "big":
+		return nil
+	}
+	return fmt.Errorf("invalid value for -long-double: %q (want float64 or big)", mode)
+}
+
+// longDoublePrecision gives the number of bits in the significands of the
+// long double types, including the integer bit.
+var longDoublePrecision = map[types.FloatKind]uint{
+	types.FloatKindX86_FP80: 64,
+	types.FloatKindFP128:    113,
+}
+
+// bigLongDouble reports whether t is translated as libc.LongDouble, and if so,
+// returns its precision.
+func bigLongDouble(t types.Type) (prec uint, ok bool) {
+	ft, isFloat := t.(*types.FloatType)
+	if !isFloat || *longDouble != "big" {
+		return 0, false
+	}
+	prec, ok = longDoublePrecision[ft.Kind]
+	return prec, ok
+}
+
+// warnedLongDouble records which long double types have been warned about.
+var warnedLongDouble = map[types.FloatKind]bool{}
+
+// warnLongDouble adds a warning (the first time it is called for t's kind)
+// that t is being translated as float64.
+func warnLongDouble(t *types.FloatType) {
+	if warnedLongDouble[t.Kind] {
+		return
+	}
+	warnedLongDouble[t.Kind] = true
+	Warnings = append(Warnings, fmt.Sprintf("%v values are translated as float64, losing precision (use -long-double=big to keep it)", t))
+}
+
+// longDoubleConstant formats c as a libc.LongDouble with prec bits of
+// precision. Values that float64 holds exactly are written as float64
+// constants, and others in hexadecimal, so that they aren't rounded.
+func longDoubleConstant(c *constant.Float, prec uint) string {
+	var f string
+	switch {
+	case c.NaN:
+		f = "math.NaN()"
+	case c.X.IsInf():
+		f = fmt.Sprintf("math.Inf(%d)", c.X.Sign())
+	case c.X.Sign() == 0 && c.X.Signbit():
+		f = "math.Copysign(0, -1)"
+	default:
+		x, acc := c.X.Float64()
+		if acc != big.Exact {
+			return fmt.Sprintf("libc.ParseLongDouble(%q, %d)", c.X.Text('p', 0), prec)
+		}
+		f = strconv.FormatFloat(x, 'g', -1, 64)
+	}
+	return fmt.Sprintf("libc.NewLongDouble(%s, %d)", f, prec)
+}
+
+// fixedFP128 holds the fp128 constants whose bits are already in the right
+// order.
+var fixedFP128 = map[*constant.Float]bool{}
+
+// fixFP128Constant returns c, with the halves of its bits swapped if it is an
+// fp128 constant from the parser. LLVM writes fp128 constants with the low 64
+// bits first, but llir reads them as if the high bits came first, so that 1.0
+// (0xL00000000000000003FFF000000000000) would come out as a subnormal number.
+func fixFP128Constant(c *constant.Float) *constant.Float {
+	if c.Typ.Kind != types.FloatKindFP128 || fixedFP128[c] {
+		return c
+	}
+	fixed := c
+	if !c.NaN {
+		// (The bits of a NaN are lost, but it's still a NaN.)
+		f, _ := binary128.NewFromBig(c.X)
+		hi, lo := f.Bits()
+		x, nan := binary128.NewFromBits(lo, hi).Big()
+		fixed = &constant.Float{Typ: c.Typ, X: x, NaN: nan}
+	}
+	fixedFP128[fixed] = true
+	return fixed
+}
+
+// longDoubleComparisons gives the expressions for comparisons of
+// libc.LongDouble values, in terms of the operands x and y.
+var longDoubleComparisons = map[enum.FPred]string{
+	enum.FPredFalse: "false",
+	enum.FPredTrue:  "true",
+	enum.FPredOEQ:   "!%[1]s.Unordered(%[2]s) && %[1]s.Cmp(%[2]s) == 0",
+	enum.FPredOGT:   "!%[1]s.Unordered(%[2]s) && %[1]s.Cmp(%[2]s) > 0",
+	enum.FPredOGE:   "!%[1]s.Unordered(%[2]s) && %[1]s.Cmp(%[2]s) >= 0",
+	enum.FPredOLT:   "!%[1]s.Unordered(%[2]s) && %[1]s.Cmp(%[2]s) < 0",
+	enum.FPredOLE:   "!%[1]s.Unordered(%[2]s) && %[1]s.Cmp(%[2]s) <= 0",
+	enum.FPredONE:   "!%[1]s.Unordered(%[2]s) && %[1]s.Cmp(%[2]s) != 0",
+	enum.FPredORD:   "!%[1]s.Unordered(%[2]s)",
+	enum.FPredUEQ:   "%[1]s.Unordered(%[2]s) || %[1]s.Cmp(%[2]s) == 0",
+	enum.FPredUGT:   "%[1]s.Unordered(%[2]s) || %[1]s.Cmp(%[2]s) > 0",
+	enum.FPredUGE:   "%[1]s.Unordered(%[2]s) || %[1]s.Cmp(%[2]s) >= 0",
+	enum.FPredULT:   "%[1]s.Unordered(%[2]s) || %[1]s.Cmp(%[2]s) < 0",
+	enum.FPredULE:   "%[1]s.Unordered(%[2]s) || %[1]s.Cmp(%[2]s) <= 0",
+	enum.FPredUNE:   "%[1]s.Unordered(%[2]s) || %[1]s.Cmp(%[2]s) != 0",
+	enum.FPredUNO:   "%[1]s.Unordered(%[2]s)",
+}
+
+// longDoubleMethods gives the libc.LongDouble methods for the binary
+// floating-point instructions.
+var longDoubleMethods = map[string]string{
+	"fadd": "Add",
+	"fsub": "Sub",
+	"fmul": "Mul",
+	"fdiv": "Quo",
+	"frem": "Rem",
+}
+
+// LongDoubleInstruction translates the instructions that operate on
+// libc.LongDouble values, or convert to or from them, with -long-double=big.
+// For other instructions, it returns ok == false.
+func LongDoubleInstruction(inst ir.Instruction) (result string, ok bool, err error) {
+	if *longDouble != "big" {
+		return "", false, nil
+	}
+	switch inst := inst.(type) {
+	case *ir.InstFAdd:
+		return longDoubleBinary(inst, inst.Typ, "fadd", inst.X, inst.Y)
+	case *ir.InstFSub:
+		return longDoubleBinary(inst, inst.Typ, "fsub", inst.X, inst.Y)
+	case *ir.InstFMul:
+		return longDoubleBinary(inst, inst.Typ, "fmul", inst.X, inst.Y)
+	case *ir.InstFDiv:
+		return longDoubleBinary(inst, inst.Typ, "fdiv", inst.X, inst.Y)
+	case *ir.InstFRem:
+		return longDoubleBinary(inst, inst.Typ, "frem", inst.X, inst.Y)
+
+	case *ir.InstFNeg:
+		if _, ok := bigLongDouble(inst.Typ); !ok {
+			return "", false, nil
+		}
+		x, err := FormatValue(inst.X)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating operand (%v): %v", inst.X, err)
+		}
+		return fmt.Sprintf("%s = %s.Neg()", VariableName(inst), x), true, nil
+
+	case *ir.InstFCmp:
+		if _, ok := bigLongDouble(inst.X.Type()); !ok {
+			return "", false, nil
+		}
+		expr, ok := longDoubleComparisons[inst.Pred]
+		if !ok {
+			return "", true, fmt.Errorf("unsupported comparison predicate: %v", inst.Pred)
+		}
+		x, err := FormatValue(inst.X)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating left operand (%v): %v", inst.X, err)
+		}
+		y, err := FormatValue(inst.Y)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating right operand (%v): %v", inst.Y, err)
+		}
+		if inst.Pred == enum.FPredFalse || inst.Pred == enum.FPredTrue {
+			return fmt.Sprintf("%s = %s", VariableName(inst), expr), true, nil
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), fmt.Sprintf(expr, x, y)), true, nil
+
+	case *ir.InstFPExt:
+		return longDoubleConversion(inst, inst.From, inst.To)
+	case *ir.InstFPTrunc:
+		return longDoubleConversion(inst, inst.From, inst.To)
+
+	case *ir.InstSIToFP:
+		return intToLongDouble(inst, inst.From, inst.To, true)
+	case *ir.InstUIToFP:
+		return intToLongDouble(inst, inst.From, inst.To, false)
+
+	case *ir.InstFPToSI:
+		return longDoubleToInt(inst, inst.From, inst.To, true)
+	case *ir.InstFPToUI:
+		return longDoubleToInt(inst, inst.From, inst.To, false)
+
+	case *ir.InstBitCast:
+		_, from := bigLongDouble(inst.From.Type())
+		_, to := bigLongDouble(inst.To)
+		if (from || to) && !types.Equal(inst.From.Type(), inst.To) {
+			return "", true, fmt.Errorf("can't bitcast %v to %v with -long-double=big", inst.From.Type(), inst.To)
+		}
+	}
+	return "", false, nil
+}
+
+// longDoubleBinary translates the binary floating-point instruction op on
+// libc.LongDouble values.
+func longDoubleBinary(dest value.Named, t types.Type, op string, x, y value.Value) (string, bool, error) {
+	if _, ok := bigLongDouble(t); !ok {
+		return "", false, nil
+	}
+	xs, err := FormatValue(x)
+	if err != nil {
+		return "", true, fmt.Errorf("error translating left operand (%v): %v", x, err)
+	}
+	ys, err := FormatValue(y)
+	if err != nil {
+		return "", true, fmt.Errorf("error translating right operand (%v): %v", y, err)
+	}
+	return fmt.Sprintf("%s = %s.%s(%s)", VariableName(dest), xs, longDoubleMethods[op], ys), true, nil
+}
+
+// longDoubleConversion translates an fpext or fptrunc instruction that
+// converts to or from libc.LongDouble.
+func longDoubleConversion(dest value.Named, from value.Value, to types.Type) (string, bool, error) {
+	fromPrec, fromBig := bigLongDouble(from.Type())
+	toPrec, toBig := bigLongDouble(to)
+	if !fromBig && !toBig {
+		return "", false, nil
+	}
+	x, err := FormatValue(from)
+	if err != nil {
+		return "", true, fmt.Errorf("error translating source (%v): %v", from, err)
+	}
+	switch {
+	case fromBig && toBig:
+		if fromPrec != toPrec {
+			x = fmt.Sprintf("%s.Round(%d)", x, toPrec)
+		}
+	case toBig:
+		switch {
+		case isHalf(from.Type()):
+			x = fmt.Sprintf("float64(%s.Float32())", x)
+		case types.Equal(from.Type(), types.Float):
+			x = fmt.Sprintf("float64(%s)", x)
+		case types.Equal(from.Type(), types.Double):
+		default:
+			return "", true, fmt.Errorf("unsupported conversion from %v to %v", from.Type(), to)
+		}
+		x = fmt.Sprintf("libc.NewLongDouble(%s, %d)", x, toPrec)
+	default:
+		switch {
+		case isHalf(to):
+			// Rounded twice, which can be off by one in the last place
+			// for values very close to halfway between two half values.
+			x = fmt.Sprintf("libc.Float16FromFloat64(%s.Float64())", x)
+		case types.Equal(to, types.Float):
+			x += ".Float32()"
+		case types.Equal(to, types.Double):
+			x += ".Float64()"
+		default:
+			return "", true, fmt.Errorf("unsupported conversion from %v to %v", from.Type(), to)
+		}
+	}
+	return fmt.Sprintf("%s = %s", VariableName(dest), x), true, nil
+}
+
+// intToLongDouble translates a sitofp or uitofp instruction that converts to
+// libc.LongDouble.
+func intToLongDouble(dest value.Named, from value.Value, to types.Type, signed bool) (string, bool, error) {
+	prec, ok := bigLongDouble(to)
+	if !ok {
+		return "", false, nil
+	}
+	if isInt128(from.Type()) {
+		return "", true, fmt.Errorf("unsupported conversion from %v to %v", from.Type(), to)
+	}
+	format := FormatUnsigned
+	if signed {
+		format = FormatSigned
+	}
+	x, err := format(from)
+	if err != nil {
+		return "", true, fmt.Errorf("error translating source (%v): %v", from, err)
+	}
+	if types.Equal(from.Type(), types.I1) {
+		x = fmt.Sprintf("%s(%s)", boolToInt("int64"), x)
+		if signed {
+			x = "-" + x
+		}
+	}
+	if signed {
+		return fmt.Sprintf("%s = libc.LongDoubleFromInt64(int64(%s), %d)", VariableName(dest), x, prec), true, nil
+	}
+	return fmt.Sprintf("%s = libc.LongDoubleFromUint64(uint64(%s), %d)", VariableName(dest), x, prec), true, nil
+}
+
+// longDoubleToInt translates an fptosi or fptoui instruction that converts
+// from libc.LongDouble.
+func longDoubleToInt(dest value.Named, from value.Value, to types.Type, signed bool) (string, bool, error) {
+	if _, ok := bigLongDouble(from.Type()); !ok {
+		return "", false, nil
+	}
+	it, ok := to.(*types.IntType)
+	if !ok || it.BitSize > 64 {
+		return "", true, fmt.Errorf("unsupported conversion from %v to %v", from.Type(), to)
+	}
+	if *fpToInt == "saturate" && it.BitSize != 1 {
+		// Clamp the value as a float64.
+		result, err := floatToInt(dest, from, to, signed, true)
+		return result, true, err
+	}
+	x, err := FormatValue(from)
+	if err != nil {
+		return "", true, fmt.Errorf("error translating source (%v): %v", from, err)
+	}
+	if it.BitSize == 1 {
+		// Only 0 and -1 (or 1, for fptoui) are in range.
+		return fmt.Sprintf("%s = %s.Sign() != 0", VariableName(dest), x), true, nil
+	}
+	t, err := TypeSpec(it)
+	if err != nil {
+		return "", true, fmt.Errorf("error translating type (%v): %v", it, err)
+	}
+	method := "Uint64"
+	if signed {
+		method = "Int64"
+	}
+	x = fmt.Sprintf("%s(%s.%s())", t, x, method)
+	if odd, ok := oddWidth(it); ok {
+		x = normalizeOdd(x, odd)
+	}
+	return fmt.Sprintf("%s = %s", VariableName(dest), x), true, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const longDoubleSource = `
+; tiny returns (1 + 2^-60) - 1, which is 0 in double precision.
+define x86_fp80 @tiny() {
+  %one = fpext double 1.0 to x86_fp80
+  %eps = fpext double 0x3C30000000000000 to x86_fp80
+  %s = fadd x86_fp80 %one, %eps
+  %r = fsub x86_fp80 %s, %one
+  ret x86_fp80 %r
+}
+
+define i1 @distinct() {
+  %t = call x86_fp80 @tiny()
+  %r = fcmp one x86_fp80 %t, 0xK00000000000000000000
+  ret i1 %r
+}
+
+; maxInt converts the largest int64 to x86_fp80, which holds it exactly, and
+; back.
+define i64 @maxInt() {
+  %f = sitofp i64 9223372036854775807 to x86_fp80
+  %r = fptosi x86_fp80 %f to i64
+  ret i64 %r
+}
+
+define double @quadThird() {
+  %one = fpext double 1.0 to fp128
+  %a = fdiv fp128 %one, 0xL00000000000000004000800000000000
+  %n = fneg fp128 %a
+  %r = fptrunc fp128 %n to double
+  ret double %r
+}
+
+define i1 @quadOne() {
+  %r = fcmp oeq fp128 0xL00000000000000003FFF000000000000, 0xL00000000000000003FFF000000000000
+  %one = fptrunc fp128 0xL00000000000000003FFF000000000000 to double
+  %c = fcmp oeq double %one, 1.0
+  %both = and i1 %r, %c
+  ret i1 %both
+}
+
+define double @remainder(double %x, double %y) {
+  %a = fpext double %x to x86_fp80
+  %b = fpext double %y to x86_fp80
+  %r = frem x86_fp80 %a, %b
+  %d = fptrunc x86_fp80 %r to double
+  ret double %d
+}
+`
+
+func TestLongDouble(t *testing.T) {
+	t.Parallel()
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(distinct(), maxInt(), quadThird(), quadOne(), remainder(7.5, 2))
+}
+`
+	// By default, they are float64s.
+	code, output := translate(t, longDoubleSource, "-color=never")
+	for _, typ := range []string{"x86_fp80", "fp128"} {
+		if n := strings.Count(output, typ+" values are translated as float64"); n != 1 {
+			t.Errorf("%d warnings about %s, want 1:\n%s", n, typ, output)
+		}
+	}
+	if got, want := runGo(t, code, mainSrc), "false -9223372036854775808 -0.3333333333333333 true 1.5\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+
+	// With -long-double=big, they keep their precision.
+	code, output = translate(t, longDoubleSource, "-long-double=big", "-color=never")
+	if strings.Contains(output, "losing precision") {
+		t.Errorf("warning with -long-double=big:\n%s", output)
+	}
+	if got, want := runGo(t, code, mainSrc), "true 9223372036854775807 -0.3333333333333333 true 1.5\n"; got != want {
+		t.Errorf("output with -long-double=big: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+	if got, want := runGo(t, code, mainCalling("tiny()")), "8.673617379884035472e-19\n"; got != want {
+		t.Errorf("tiny() with -long-double=big: %q, want %q", got, want)
+	}
+}
+
+func TestLongDoubleErrors(t *testing.T) {
+	t.Parallel()
+	src := `
+define i128 @bits(fp128 %x) {
+  %r = bitcast fp128 %x to i128
+  ret i128 %r
+}
+`
+	output := translateError(t, src, "-long-double=big", "-color=never")
+	if !strings.Contains(output, "can't bitcast fp128 to i128 with -long-double=big") {
+		t.Errorf("output doesn't report the bitcast:\n%s", output)
+	}
+	for _, flags := range [][]string{
+		{"-long-double=float80"},
+		{"-long-double=big", "-memory=arena"},
+	} {
+		if output := translateError(t, longDoubleSource, flags...); !strings.Contains(output, "-long-double") {
+			t.Errorf("leaven %s: output doesn't mention -long-double:\n%s", strings.Join(flags, " "), output)
+		}
+	}
+}
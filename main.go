@@ -1,66 +1,312 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"sort"
 	"strings"
 
 	"github.com/llir/llvm/asm"
 	"github.com/llir/llvm/ir"
-	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/constant"
 	"github.com/llir/llvm/ir/value"
 )
 
+var (
+	outParams     = flag.Bool("out-params", false, "translate sret and other output parameters as extra results")
+	statusErrors  = flag.Bool("status-errors", false, "with -out-params, translate the int32 result of a function with output parameters as an error")
+	outParamList  stringList
+	libcMapFiles  stringList
+	overrideFiles stringList
+	externMaps    stringList
+
+	binaryReinterpret = flag.Bool("binary", false, "use encoding/binary for loads and stores that reinterpret bytes as a wider type")
+	ubChecks          = flag.Bool("ub-checks", false, "generate code that panics on signed overflow, nil or misaligned pointers, violated llvm.assume conditions, and other undefined behavior")
+	packageName       = flag.String("package", defaultPackage(), "the package `name` for the generated code")
+	outputFile        = flag.String("o", "", "write the output to `file` (default: the input file with a .go extension)")
+	_                 = flag.String("config", "", "read additional arguments from `file` (default: "+defaultConfigFile+" under go generate)")
+	passes            = flag.String("passes", "", "run opt with this `pipeline` (e.g. mem2reg,simplifycfg,instcombine) before translating")
+	optPath           = flag.String("opt", "opt", "the `path` of LLVM's opt tool, for -passes")
+	colorMode         = flag.String("color", "auto", "color diagnostics: `auto`, always, or never")
+	printStats        = flag.Bool("stats", false, "print statistics about the module: instruction and intrinsic counts, external symbols, and how much of the output uses package unsafe")
+	noUnsafe          = flag.Bool("no-unsafe", false, "report an error for anything that would need package unsafe (implies -binary)")
+	freestanding      = flag.Bool("freestanding", false, "translate code built with -ffreestanding: don't map calls to libc or the Go standard library, and report calls to functions the module doesn't define")
+	llvmVersion       = flag.Int("llvm-version", 0, "the major `version` of LLVM that produced the input (default: detected from the file)")
+	goInt             = flag.String("go-int", "", "declare parameters and results of exported functions that are C's long (`long`) or long and int (all) as Go's int")
+	inlineValues      = flag.Bool("inline", false, "write values that are used only once into the expressions that use them, instead of assigning them to variables")
+	debugNames        = flag.Bool("debug-names", false, "name local variables after the C variables they hold, according to the llvm.dbg.declare and llvm.dbg.value calls")
+	simdMode          = flag.String("simd", "scalar", "how to translate x86 and ARM SIMD intrinsics: `scalar` (loops over the lanes) or error")
+	longDouble        = flag.String("long-double", "float64", "how to translate x86_fp80 and fp128 (C's long double): as `float64` (losing precision) or as big (libc.LongDouble, backed by math/big)")
+	fpToInt           = flag.String("fp-to-int", "go", "how to convert floating-point values that are out of range for the integer type: `go` (like a Go conversion, which depends on the architecture) or saturate (clamp to the range, and convert NaN to 0)")
+	moduleAsm         = flag.String("module-asm", "warn", "what to do with unsupported module-level inline assembly: `warn`, ignore, or error")
+	memoryModel       = flag.String("memory", "go", "the memory `model`: go (pointers are Go pointers) or arena (pointers are offsets into a byte slice allocated by package libc)")
+	instanceMode      = flag.Bool("instance", false, "put the global variables in a State struct, and make the functions methods on it, so that the library can have several independent instances")
+	roots             = flag.String("roots", "", "translate only the functions and globals reachable from these `functions` (comma-separated; \"exported\" means all non-static functions)")
+	reportFormat      = flag.String("report", "", "write a report on the translation of each function, in `format` html, to a file beside the output")
+)
+
+func init() {
+	flag.Var(&outParamList, "out-param", "treat `function:parameter` as an output parameter (implies -out-params; may be repeated)")
+	flag.Var(&libcMapFiles, "libc-map", "read extra mappings from C library functions to Go functions from `file` (may be repeated)")
+	flag.Var(&externMaps, "extern-map", "read bindings from external C functions to Go functions, with their Go types, from `file` (may be repeated)")
+	flag.Var(&overrideFiles, "override", "use the hand-written functions in the Go source `file` instead of translating the functions with the same names (may be repeated)")
+}
+
+// A stringList is a flag.Value that collects the values of a flag that may be
+// repeated.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Fprintln(os.Stderr, "Usage: leaven input-file.ll")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: leaven [flags] input-file.ll")
+		flag.PrintDefaults()
+	}
+	args, err := configArgs(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	flag.CommandLine.Parse(args)
+	inputs := flag.Args()
+	flag.CommandLine.Parse(os.Args[1:])
+	if flag.NArg() > 0 {
+		inputs = flag.Args()
+	}
+	if len(inputs) != 1 {
+		flag.Usage()
 		os.Exit(1)
 	}
+	if *noUnsafe {
+		*binaryReinterpret = true
+	}
+	if err := checkAsmPolicy(*moduleAsm); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkSIMDMode(*simdMode); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkGoIntMode(*goInt); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkFPToIntMode(*fpToInt); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkLongDoubleMode(*longDouble); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkReportFormat(*reportFormat); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkMemoryModel(*memoryModel); err != nil {
+		log.Fatal(err)
+	}
+	if *roots != "" {
+		if err := checkRoots(*roots); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if arenaMode() {
+		if *instanceMode {
+			log.Fatal("-memory=arena can't be used with -instance")
+		}
+		if *longDouble == "big" {
+			log.Fatal("-memory=arena can't be used with -long-double=big")
+		}
+		if *outParams || len(outParamList) > 0 {
+			log.Fatal("-memory=arena can't be used with -out-params or -out-param")
+		}
+		UseArenaFunctions()
+	}
+	for _, file := range libcMapFiles {
+		if err := LoadLibcMap(file); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, file := range externMaps {
+		if err := LoadExternMap(file); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, file := range overrideFiles {
+		if err := LoadOverrides(file); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	inFile := os.Args[1]
-	m, err := asm.ParseFile(inFile)
+	inFile := inputs[0]
+	irFile := inFile
+	displayName := inFile
+	if *passes != "" {
+		irFile, err = RunOpt(*optPath, inFile, *passes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		displayName += " (after opt)"
+	}
+	normalized, err := NormalizeFile(irFile, *llvmVersion)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if normalized != irFile {
+		if irFile != inFile {
+			os.Remove(irFile)
+		}
+		irFile = normalized
+	}
+	m, err := asm.ParseFile(irFile)
+	diagnostics := NewDiagnostics(irFile, displayName, UseColor(*colorMode))
+	if irFile != inFile {
+		os.Remove(irFile)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+	NormalizeModule(m)
+	if *roots != "" {
+		if err := EliminateDeadCode(m, *roots); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	outFile := strings.TrimSuffix(inFile, ".ll") + ".go"
+	if *outParams || len(outParamList) > 0 {
+		if err := FindOutParams(m, outParamList, *statusErrors); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	outFile := *outputFile
+	if outFile == "" {
+		outFile = strings.TrimSuffix(inFile, ".ll") + ".go"
+	}
 	out, err := os.Create(outFile)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	fmt.Fprint(out, "package main\n\n")
+	var errs ErrorList
+	SetByteOrder(m.DataLayout)
+	SetPointerSize(m.DataLayout)
+	if arenaMode() {
+		if err := SetArenaLayout(m.DataLayout); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *instanceMode {
+		ReserveInstanceNames()
+	}
+	AssignGlobalNames(m)
+	if !arenaMode() {
+		// In the arena, every global has an address.
+		FindConstGlobals(m)
+		FindInitCycles(m)
+	}
+	FindGoIntSignatures(m, *goInt)
+	ExternWrappers(m, &errs)
+	CollectDebugTypes(m)
+	CollectEnums(m)
+	if *freestanding {
+		FindRuntimeFuncs(m)
+	}
+	if *printStats {
+		CollectStats(m)
+	}
+	if *reportFormat != "" {
+		Report = NewModuleReport(inFile, outFile, diagnostics)
+	}
 
-	for _, t := range m.TypeDefs {
+	for _, t := range TypeDefsInOrder(m.TypeDefs) {
 		name := TypeName(t)
-		if name == "" {
-			continue
-		}
 
 		def, err := TypeDefinition(t)
 		if err != nil {
-			log.Fatalf("Error generating type definition for %v: %v", t, err)
+			errs.Add("", t.LLString(), fmt.Errorf("error generating type definition: %v", err))
+			continue
 		}
 
-		fmt.Fprintf(out, "type %s %s\n\n", name, def)
+		TypeDecls = append(TypeDecls, TypeDecl{Name: name, Definition: def})
 	}
 
+	// Write the globals and functions to a buffer first, since translating
+	// them may add more type declarations.
+	body := new(bytes.Buffer)
+
+	var stateFields, stateInits, deferredInits []string
+	if arenaMode() {
+		body.WriteString(ArenaGlobals(m, &errs))
+	}
 	for _, g := range m.Globals {
-		if g.Init == nil {
+		if g.Init == nil || arenaMode() {
 			// Just a declaration; skip it.
 			continue
 		}
 		t, err := TypeSpec(g.ContentType)
 		if err != nil {
-			log.Fatalf("Error translating type (%v): %v", g.ContentType, err)
+			errs.Add("", g.LLString(), fmt.Errorf("error translating type (%v): %v", g.ContentType, err))
+			continue
 		}
 		val, err := FormatValue(g.Init)
+		if err == nil {
+			err = checkUnsafe(val)
+		}
 		if err != nil {
-			log.Fatalf("Error translating initializer (%v): %v", g.Init, err)
+			errs.Add("", g.LLString(), fmt.Errorf("error translating initializer (%v): %v", g.Init, err))
+			continue
+		}
+		if inState(g) {
+			stateFields = append(stateFields, fmt.Sprintf("%s %s", VariableName(g), t))
+			if !isZeroValue(g.Init) {
+				stateInits = append(stateInits, fmt.Sprintf("%s = %s", GlobalRef(g), val))
+			}
+			continue
+		}
+		if DeferredGlobals[g] {
+			fmt.Fprintf(body, "var %s %s\n\n", VariableName(g), t)
+			deferredInits = append(deferredInits, fmt.Sprintf("%s = %s", VariableName(g), val))
+			continue
+		}
+		decl := "var"
+		if ConstGlobals[g] {
+			decl = "const"
+		}
+		fmt.Fprintf(body, "%s %s %s = %s\n\n", decl, VariableName(g), t, val)
+	}
+	if len(deferredInits) > 0 {
+		body.WriteString("func init() {\n")
+		for _, s := range deferredInits {
+			fmt.Fprintf(body, "\t%s\n", s)
+		}
+		body.WriteString("}\n\n")
+	}
+	if *instanceMode {
+		body.WriteString(StateDecl(stateFields, stateInits))
+	}
+
+	aliases, unsupportedAsm := ModuleAsm(m)
+	for _, a := range aliases {
+		target := VariableName(a.Target)
+		if inState(a.Target) {
+			// A method expression, which takes the State as its first
+			// argument.
+			target = "(*State)." + target
+		}
+		fmt.Fprintf(body, "var %s = %s\n\n", aliasName(m, a), target)
+	}
+	for _, line := range unsupportedAsm {
+		switch *moduleAsm {
+		case "warn":
+			fmt.Fprintf(os.Stderr, "%s: warning: ignoring module asm: %s\n", displayName, line)
+		case "error":
+			errs.Add("", fmt.Sprintf("module asm %q", line), errors.New("unsupported module-level inline assembly"))
 		}
-		fmt.Fprintf(out, "var %s %s = %s\n\n", VariableName(g), t, val)
 	}
 
 	for _, f := range m.Funcs {
@@ -68,193 +314,65 @@ func main() {
 			// Just a declaration, not a definition; skip it.
 			continue
 		}
-		if f.Name() == "main" {
-			fmt.Fprintln(out, "func main() {")
-		} else {
-			fmt.Fprintf(out, "func %s(", f.Name())
-			for i, p := range f.Params {
-				if i > 0 {
-					fmt.Fprint(out, ", ")
-				}
-				pt, err := TypeSpec(p.Typ)
-				if err != nil {
-					log.Fatalf("Error translating type for parameter %d of %s: %v", i, f.Name(), err)
-				}
-				fmt.Fprintf(out, "%s %s", VariableName(p), pt)
+		if src, ok := Override(VariableName(f)); ok {
+			fmt.Fprintf(body, "%s\n\n", src)
+			if Report != nil {
+				Report.AddOverride(f)
 			}
-			if f.Sig.Variadic {
-				if len(f.Params) > 0 {
-					fmt.Fprint(out, ", ")
-				}
-				fmt.Fprint(out, "varargs ...interface{}")
-			}
-			fmt.Fprint(out, ") ")
-			rt := f.Sig.RetType
-			if !types.Equal(rt, types.Void) {
-				retType, err := TypeSpec(rt)
-				if err != nil {
-					log.Fatalf("Error translating return type for %s: %v", f.Name(), err)
-				}
-				fmt.Fprintf(out, "%s ", retType)
-			}
-			fmt.Fprint(out, "{\n")
-		}
-
-		// Declare variables.
-		vars := make(map[string][]string)
-		var allVars []string
-		for _, b := range f.Blocks {
-			for _, inst := range b.Insts {
-				if inst, ok := inst.(value.Named); ok {
-					if types.Equal(inst.Type(), types.Void) {
-						continue
-					}
-					t, err := TypeSpec(inst.Type())
-					if err != nil {
-						log.Fatalf("Error translating type of %s in %s: %v", inst.Ident(), f.Name(), err)
-					}
-					vars[t] = append(vars[t], VariableName(inst))
-					allVars = append(allVars, VariableName(inst))
-				}
-			}
-		}
-		varTypes := make([]string, 0, len(vars))
-		for t := range vars {
-			varTypes = append(varTypes, t)
-		}
-		sort.Strings(varTypes)
-		for _, t := range varTypes {
-			fmt.Fprintf(out, "\tvar %s %s\n", strings.Join(vars[t], ", "), t)
+			continue
 		}
-		if len(vars) > 0 {
-			fmt.Fprintln(out)
-			// Get rid of unused-variable errors.
-			for i := range allVars {
-				if i == 0 {
-					fmt.Fprint(out, "\t_")
-				} else {
-					fmt.Fprint(out, ", _")
-				}
-			}
-			fmt.Fprintf(out, " = %s\n\n", strings.Join(allVars, ", "))
+		statements, unsafe, nerrs := Stats.Statements, Stats.Unsafe, len(errs)
+		TranslateFunction(body, f, &errs)
+		if Report != nil {
+			Report.AddFunc(f, Stats.Statements-statements, Stats.Unsafe-unsafe, errs[nerrs:])
 		}
+	}
 
-		// Translate instructions.
-		for i, b := range f.Blocks {
-			if i != 0 {
-				fmt.Fprintf(out, "\n%s:\n", BlockName(b))
-			}
-			for _, inst := range b.Insts {
-				if _, ok := inst.(*ir.InstPhi); ok {
-					continue
-				}
-				translated, err := TranslateInstruction(inst)
-				if err != nil {
-					log.Fatalf("Error translating %q: %v", inst.LLString(), err)
-				}
-				if translated != "" {
-					fmt.Fprintf(out, "\t%s\n", translated)
-				}
-			}
-			switch term := b.Term.(type) {
-			case *ir.TermBr:
-				phis, err := PhiAssignments(b, term.Target)
-				if err != nil {
-					log.Fatalf("Error translating phi nodes: %v", err)
-				}
-				if phis != "" {
-					fmt.Fprintf(out, "\t%s\n", phis)
-				}
-				fmt.Fprintf(out, "\tgoto %s\n", BlockName(term.Target))
+	for _, name := range UnusedOverrides() {
+		fmt.Fprintf(os.Stderr, "%s: warning: override for %s doesn't match any function\n", displayName, name)
+	}
+	for _, w := range Warnings {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", displayName, w)
+	}
 
-			case *ir.TermCondBr:
-				cond, err := FormatValue(term.Cond)
-				if err != nil {
-					log.Fatalf("Error translating condition (%v): %v", term.Cond, err)
-				}
-				fmt.Fprintf(out, "\tif %s {\n", cond)
-				phis, err := PhiAssignments(b, term.TargetTrue)
-				if err != nil {
-					log.Fatalf("Error translating phi nodes: %v", err)
-				}
-				if phis != "" {
-					fmt.Fprintf(out, "\t\t%s\n", phis)
-				}
-				fmt.Fprintf(out, "\t\tgoto %s\n", BlockName(term.TargetTrue))
-				fmt.Fprintln(out, "\t} else {")
-				phis, err = PhiAssignments(b, term.TargetFalse)
-				if err != nil {
-					log.Fatalf("Error translating phi nodes: %v", err)
-				}
-				if phis != "" {
-					fmt.Fprintf(out, "\t\t%s\n", phis)
-				}
-				fmt.Fprintf(out, "\t\tgoto %s\n", BlockName(term.TargetFalse))
-				fmt.Fprintln(out, "\t}")
+	pkg := fmt.Sprintf("package %s\n\n", *packageName)
+	decls := new(bytes.Buffer)
+	for _, t := range TypeDecls {
+		fmt.Fprintf(decls, "type %s %s\n\n", t.Name, t.Definition)
+	}
+	fmt.Fprint(decls, EnumDecls())
+	body.WriteTo(decls)
+	fmt.Fprint(decls, HelperSource())
 
-			case *ir.TermRet:
-				if term.X == nil {
-					// void return
-					if i == len(f.Blocks)-1 {
-						// Just skip the return statement, since it's the end of the function anyway.
-						continue
-					}
-					fmt.Fprintln(out, "\treturn")
-				}
-				retVal, err := FormatValue(term.X)
-				if err != nil {
-					log.Fatalf("Error translating return value (%v): %v", term.X, err)
-				}
-				if f.Name() == "main" {
-					fmt.Fprintf(out, "\tos.Exit(int(%s))\n", retVal)
-				} else {
-					fmt.Fprintf(out, "\treturn %s\n", retVal)
-				}
+	fmt.Fprint(out, generatorComment(inFile))
+	fmt.Fprint(out, pkg)
+	fmt.Fprint(out, ImportDecl(pkg+decls.String()))
+	decls.WriteTo(out)
 
-			case *ir.TermSwitch:
-				x, err := FormatValue(term.X)
-				if err != nil {
-					log.Fatalf("Error translating control value (%v): %v", term.X, err)
-				}
-				fmt.Fprintf(out, "\tswitch %s {\n", x)
-				for _, c := range term.Cases {
-					x, err := FormatValue(c.X)
-					if err != nil {
-						log.Fatalf("Error translating case value (%v): %v", c.X, err)
-					}
-					fmt.Fprintf(out, "\tcase %s:\n", x)
-					phis, err := PhiAssignments(b, c.Target)
-					if err != nil {
-						log.Fatalf("Error translating phi nodes: %v", err)
-					}
-					if phis != "" {
-						fmt.Fprintf(out, "\t\t%s\n", phis)
-					}
-					fmt.Fprintf(out, "\t\tgoto %s\n", BlockName(c.Target))
-				}
-				fmt.Fprint(out, "\tdefault:\n")
-				phis, err := PhiAssignments(b, term.TargetDefault)
-				if err != nil {
-					log.Fatalf("Error translating phi nodes: %v", err)
-				}
-				if phis != "" {
-					fmt.Fprintf(out, "\t\t%s\n", phis)
-				}
-				fmt.Fprintf(out, "\t\tgoto %s\n", BlockName(term.TargetDefault))
-				fmt.Fprint(out, "\t}\n")
+	if err := out.Close(); err != nil {
+		log.Fatal(err)
+	}
 
-			default:
-				log.Fatalf("Unsupported block terminator type: %T", term)
-			}
+	if *printStats {
+		Stats.Print(os.Stdout)
+	}
+	if Report != nil {
+		if err := Report.Write(strings.TrimSuffix(outFile, ".go") + ".html"); err != nil {
+			log.Fatal(err)
 		}
+	}
 
-		fmt.Fprint(out, "}\n\n")
+	if len(errs) > 0 {
+		errs.Report(os.Stderr, diagnostics)
+		os.Exit(1)
 	}
 }
 
 // PhiAssignments returns an assignment statement expressing the effects of Phi
 // nodes on the branch from block a to block b. If block b has no phi nodes,
-// it returns the empty string.
+// it returns the empty string. The phi nodes are all assigned at once, so
+// that one can take the previous value of another (as when two variables are
+// swapped on each iteration of a loop).
 func PhiAssignments(a, b value.Value) (string, error) {
 	var dest, src []string
 	for _, inst := range b.(*ir.Block).Insts {
@@ -264,6 +382,14 @@ func PhiAssignments(a, b value.Value) (string, error) {
 		}
 		for _, inc := range phi.Incs {
 			if inc.Pred == a {
+				if inc.X == phi {
+					// The value is unchanged on this edge.
+					break
+				}
+				if _, ok := inc.X.(*constant.Undef); ok {
+					// Any value will do, including the one it already has.
+					break
+				}
 				source, err := FormatValue(inc.X)
 				if err != nil {
 					return "", fmt.Errorf("error translating value (%v): %v", inc.X, err)
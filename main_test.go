@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// The tests run leaven as a separate process, since the translator keeps its
+// state in package-level variables. The generated code is then checked with
+// go vet, and usually run, in a temporary module that uses the libc package
+// from this repository.
+
+// leavenBinary is the path of the leaven binary built by TestMain.
+var leavenBinary string
+
+// repoDir is the root of this repository.
+var repoDir string
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "leaven-test-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	repoDir, err = os.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	leavenBinary = filepath.Join(dir, "leaven")
+	build := exec.Command("go", "build", "-o", leavenBinary, ".")
+	if out, err := build.CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "error building leaven: %v\n%s", err, out)
+		os.Exit(1)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// runLeaven translates src (the text of an LLVM IR module) with the given
+// flags. It returns the generated Go code (or the empty string if there is
+// none), what leaven printed, and whether it succeeded. The files named by
+// extra (the name of a file, and its contents) are written to the same
+// directory, so that flags can refer to them.
+func runLeaven(t *testing.T, src string, extra map[string]string, flags ...string) (code, output string, ok bool) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "leaven-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range extra {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "test.ll"), []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(leavenBinary, append(flags, "test.ll")...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOPACKAGE=", "GOFILE=")
+	out, err := cmd.CombinedOutput()
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "test.go"))
+	return string(b), string(out), err == nil
+}
+
+// translate translates src with the given flags, failing the test if leaven
+// reports an error. It returns the generated code and leaven's output (its
+// warnings).
+func translate(t *testing.T, src string, flags ...string) (code, output string) {
+	t.Helper()
+	code, output, ok := runLeaven(t, src, nil, flags...)
+	if !ok {
+		t.Fatalf("leaven %s failed:\n%s", strings.Join(flags, " "), output)
+	}
+	return code, output
+}
+
+// translateError translates src, which should fail to translate, and returns
+// leaven's output.
+func translateError(t *testing.T, src string, flags ...string) string {
+	t.Helper()
+	_, output, ok := runLeaven(t, src, nil, flags...)
+	if ok {
+		t.Fatalf("leaven %s succeeded; want an error", strings.Join(flags, " "))
+	}
+	return output
+}
+
+// goModule writes a module to a temporary directory, containing the
+// generated code and mainSrc (another file in the same package, with the
+// main function that calls the generated code, or the empty string for
+// none), and returns its directory.
+func goModule(t *testing.T, generated, mainSrc string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "leaven-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := ioutil.ReadFile(filepath.Join(repoDir, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod := fmt.Sprintf("module leaventest\n\ngo 1.14\n\nrequire github.com/andybalholm/leaven v0.0.0\n\nreplace github.com/andybalholm/leaven => %s\n", repoDir)
+	if mainSrc == "" && !regexp.MustCompile(`(?m)^func main\(\)`).MatchString(generated) {
+		mainSrc = "package main\n\nfunc main() {}\n"
+	}
+	files := map[string]string{
+		"go.mod":  mod,
+		"go.sum":  string(sum),
+		"test.go": generated,
+	}
+	if mainSrc != "" {
+		files["main.go"] = mainSrc
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// goCommand runs the go command in dir, returning its output.
+func goCommand(dir string, args ...string) (string, error) {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOPACKAGE=", "GOFILE=")
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// vetGo runs go vet on the generated code (and mainSrc, if it isn't empty),
+// failing the test if it finds a problem.
+func vetGo(t *testing.T, generated, mainSrc string) {
+	t.Helper()
+	dir := goModule(t, generated, mainSrc)
+	defer os.RemoveAll(dir)
+	if out, err := goCommand(dir, "vet", "."); err != nil {
+		t.Fatalf("go vet: %v\n%s\ngenerated code:\n%s", err, out, numberLines(generated))
+	}
+}
+
+// noUnsafePtrCheck turns off go vet's unsafeptr check, for tests of inttoptr.
+// It is translated as a conversion from uintptr to unsafe.Pointer, which is
+// what the check reports.
+const noUnsafePtrCheck = "-unsafeptr=false"
+
+// runGo checks the generated code and mainSrc with go vet (with vetFlags
+// added), then runs them and returns the program's output.
+func runGo(t *testing.T, generated, mainSrc string, vetFlags ...string) string {
+	t.Helper()
+	dir := goModule(t, generated, mainSrc)
+	defer os.RemoveAll(dir)
+	args := append(append([]string{"vet"}, vetFlags...), ".")
+	if out, err := goCommand(dir, args...); err != nil {
+		t.Fatalf("go vet: %v\n%s\ngenerated code:\n%s", err, out, numberLines(generated))
+	}
+	if out, err := goCommand(dir, "build", "-o", "test.bin", "."); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	cmd := exec.Command(filepath.Join(dir, "test.bin"))
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stdout
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			t.Fatal(err)
+		}
+	}
+	return stdout.String()
+}
+
+// checkProgram translates src with the given flags, runs it with mainSrc, and
+// compares its output to want.
+func checkProgram(t *testing.T, src, mainSrc, want string, flags ...string) {
+	t.Helper()
+	code, _ := translate(t, src, flags...)
+	if got := runGo(t, code, mainSrc); got != want {
+		t.Errorf("output:\n%s\nwant:\n%s\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+// numberLines adds line numbers to src, to make it easier to match up with
+// compiler errors.
+func numberLines(src string) string {
+	lines := strings.Split(src, "\n")
+	for i, l := range lines {
+		lines[i] = fmt.Sprintf("%4d  %s", i+1, l)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// mainCalling returns the source of a main function that prints the results
+// of the given Go expressions, one per line.
+func mainCalling(exprs ...string) string {
+	b := new(strings.Builder)
+	b.WriteString("package main\n\nimport \"fmt\"\n\nfunc main() {\n")
+	for _, e := range exprs {
+		fmt.Fprintf(b, "\tfmt.Println(%s)\n", e)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func TestPhiAssignments(t *testing.T) {
+	t.Parallel()
+	src := `
+; fib returns the nth Fibonacci number, swapping a and b on each iteration.
+define i64 @fib(i64 %n) {
+entry:
+  br label %loop
+
+loop:
+  %i = phi i64 [ 0, %entry ], [ %i1, %body ]
+  %a = phi i64 [ 0, %entry ], [ %b, %body ]
+  %b = phi i64 [ 1, %entry ], [ %c, %body ]
+  %done = icmp eq i64 %i, %n
+  br i1 %done, label %exit, label %body
+
+body:
+  %c = add i64 %a, %b
+  %i1 = add i64 %i, 1
+  br label %loop
+
+exit:
+  ret i64 %a
+}
+
+; count keeps %k unchanged on the back edge, and leaves %u undefined on entry.
+define i32 @count(i32 %n) {
+entry:
+  br label %loop
+
+loop:
+  %j = phi i32 [ 0, %entry ], [ %j1, %loop ]
+  %k = phi i32 [ 5, %entry ], [ %k, %loop ]
+  %u = phi i32 [ undef, %entry ], [ %j, %loop ]
+  %j1 = add i32 %j, 1
+  %more = icmp slt i32 %j1, %n
+  br i1 %more, label %loop, label %exit
+
+exit:
+  %r = add i32 %k, %u
+  ret i32 %r
+}
+`
+	code, _ := translate(t, src)
+	if ok, _ := regexp.MatchString(`(?m)^\s*(\w+, )*_?k(, \w+)* = (\w+, )*_?k\b`, code); ok {
+		t.Errorf("unchanged phi is reassigned:\n%s", numberLines(code))
+	}
+	if strings.Contains(code, "undef") {
+		t.Errorf("undef phi input is assigned:\n%s", numberLines(code))
+	}
+	if got, want := runGo(t, code, mainCalling("fib(10)", "fib(0)", "count(4)")), "55\n0\n7\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
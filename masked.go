@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// vectorPointer returns an expression for the pointer p, as a pointer to the
+// Go array that represents a vector of type vt, that can be indexed to get
+// at the elements.
+func vectorPointer(p value.Value, vt *types.VectorType) (string, error) {
+	x, err := FormatValue(p)
+	if err != nil {
+		return "", fmt.Errorf("error translating pointer (%v): %v", p, err)
+	}
+	if pt, ok := p.Type().(*types.PointerType); ok && types.Equal(pt.ElemType, vt) {
+		if strings.HasPrefix(x, "&") {
+			// Index the variable itself.
+			return parenthesize(x[1:]), nil
+		}
+		return parenthesize(x), nil
+	}
+	t, err := TypeSpec(vt)
+	if err != nil {
+		return "", fmt.Errorf("error translating type (%v): %v", vt, err)
+	}
+	return fmt.Sprintf("(*%s)(unsafe.Pointer(%s))", t, x), nil
+}
+
+// MaskedIntrinsic translates calls to llvm.masked.load, llvm.masked.store,
+// llvm.masked.gather, and llvm.masked.scatter, as loops that only touch the
+// memory for the lanes that are enabled in the mask. If name is not one of
+// them, it returns ok == false.
+func MaskedIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	if !strings.HasPrefix(name, "llvm.masked.") {
+		return "", false, nil
+	}
+	op := strings.TrimPrefix(name, "llvm.masked.")
+	if i := strings.Index(op, "."); i != -1 {
+		op = op[:i]
+	}
+	// Stores and scatters take the value to store first, and the mask always
+	// comes after the alignment.
+	var ptrArg, maskArg int
+	switch op {
+	case "load", "gather":
+		ptrArg, maskArg = 0, 2
+	case "store", "scatter":
+		ptrArg, maskArg = 1, 3
+	default:
+		return "", false, nil
+	}
+	if len(inst.Args) != 4 {
+		return "", true, fmt.Errorf("wrong number of arguments to %s: %d", name, len(inst.Args))
+	}
+	if arenaMode() {
+		return "", true, fmt.Errorf("%s isn't supported with -memory=arena", name)
+	}
+	mask, err := FormatValue(inst.Args[maskArg])
+	if err != nil {
+		return "", true, fmt.Errorf("error translating mask (%v): %v", inst.Args[maskArg], err)
+	}
+	mask = parenthesize(mask) + "[lane_i]"
+
+	switch op {
+	case "load", "gather":
+		r := VariableName(inst)
+		passthru, err := FormatValue(inst.Args[3])
+		if err != nil {
+			return "", true, fmt.Errorf("error translating passthrough value (%v): %v", inst.Args[3], err)
+		}
+		var elem string
+		if op == "load" {
+			vt, ok := inst.Type().(*types.VectorType)
+			if !ok {
+				return "", true, fmt.Errorf("unsupported type for %s: %v", name, inst.Type())
+			}
+			p, err := vectorPointer(inst.Args[ptrArg], vt)
+			if err != nil {
+				return "", true, err
+			}
+			elem = p + "[lane_i]"
+		} else {
+			ptrs, err := FormatValue(inst.Args[ptrArg])
+			if err != nil {
+				return "", true, fmt.Errorf("error translating pointers (%v): %v", inst.Args[ptrArg], err)
+			}
+			elem = "*" + parenthesize(ptrs) + "[lane_i]"
+		}
+		return fmt.Sprintf("for lane_i := range %s { if %s { %s[lane_i] = %s } else { %s[lane_i] = %s[lane_i] } }", r, mask, r, elem, r, parenthesize(passthru)), true, nil
+	}
+
+	x, err := FormatValue(inst.Args[0])
+	if err != nil {
+		return "", true, fmt.Errorf("error translating value (%v): %v", inst.Args[0], err)
+	}
+	var dest string
+	if op == "store" {
+		vt, ok := inst.Args[0].Type().(*types.VectorType)
+		if !ok {
+			return "", true, fmt.Errorf("unsupported type for %s: %v", name, inst.Args[0].Type())
+		}
+		p, err := vectorPointer(inst.Args[ptrArg], vt)
+		if err != nil {
+			return "", true, err
+		}
+		dest = p + "[lane_i]"
+	} else {
+		ptrs, err := FormatValue(inst.Args[ptrArg])
+		if err != nil {
+			return "", true, fmt.Errorf("error translating pointers (%v): %v", inst.Args[ptrArg], err)
+		}
+		dest = "*" + parenthesize(ptrs) + "[lane_i]"
+	}
+	return fmt.Sprintf("for lane_i, lane_v := range %s { if %s { %s = lane_v } }", x, mask, dest), true, nil
+}
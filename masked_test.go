@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const maskedSource = `
+@data = global [4 x i32] [i32 10, i32 20, i32 30, i32 40]
+
+declare <4 x i32> @llvm.masked.load.v4i32.p0v4i32(<4 x i32>*, i32, <4 x i1>, <4 x i32>)
+declare void @llvm.masked.store.v4i32.p0v4i32(<4 x i32>, <4 x i32>*, i32, <4 x i1>)
+declare <2 x i32> @llvm.masked.gather.v2i32.v2p0i32(<2 x i32*>, i32, <2 x i1>, <2 x i32>)
+declare void @llvm.masked.scatter.v2i32.v2p0i32(<2 x i32>, <2 x i32*>, i32, <2 x i1>)
+
+define <4 x i32> @loadSome(<4 x i1> %mask) {
+  %p = bitcast [4 x i32]* @data to <4 x i32>*
+  %r = call <4 x i32> @llvm.masked.load.v4i32.p0v4i32(<4 x i32>* %p, i32 4, <4 x i1> %mask, <4 x i32> <i32 -1, i32 -2, i32 -3, i32 -4>)
+  ret <4 x i32> %r
+}
+
+define void @storeSome(<4 x i32> %x, <4 x i1> %mask) {
+  %p = bitcast [4 x i32]* @data to <4 x i32>*
+  call void @llvm.masked.store.v4i32.p0v4i32(<4 x i32> %x, <4 x i32>* %p, i32 4, <4 x i1> %mask)
+  ret void
+}
+
+define <2 x i32> @gatherEnds(<2 x i1> %mask) {
+  %first = getelementptr [4 x i32], [4 x i32]* @data, i64 0, i64 0
+  %last = getelementptr [4 x i32], [4 x i32]* @data, i64 0, i64 3
+  %v0 = insertelement <2 x i32*> undef, i32* %last, i32 0
+  %ptrs = insertelement <2 x i32*> %v0, i32* %first, i32 1
+  %r = call <2 x i32> @llvm.masked.gather.v2i32.v2p0i32(<2 x i32*> %ptrs, i32 4, <2 x i1> %mask, <2 x i32> zeroinitializer)
+  ret <2 x i32> %r
+}
+
+define void @scatterEnds(<2 x i32> %x, <2 x i1> %mask) {
+  %first = getelementptr [4 x i32], [4 x i32]* @data, i64 0, i64 0
+  %last = getelementptr [4 x i32], [4 x i32]* @data, i64 0, i64 3
+  %v0 = insertelement <2 x i32*> undef, i32* %first, i32 0
+  %ptrs = insertelement <2 x i32*> %v0, i32* %last, i32 1
+  call void @llvm.masked.scatter.v2i32.v2p0i32(<2 x i32> %x, <2 x i32*> %ptrs, i32 4, <2 x i1> %mask)
+  ret void
+}
+`
+
+func TestMaskedMemory(t *testing.T) {
+	t.Parallel()
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(loadSome([4]bool{true, false, true, false}))
+	fmt.Println(gatherEnds([2]bool{true, false}))
+	storeSome([4]int32{1, 2, 3, 4}, [4]bool{false, true, false, true})
+	fmt.Println(data)
+	scatterEnds([2]int32{7, 8}, [2]bool{false, true})
+	fmt.Println(data)
+	fmt.Println(gatherEnds([2]bool{true, true}))
+}
+`
+	want := "[10 -2 30 -4]\n[40 0]\n[10 2 30 4]\n[10 2 30 8]\n[8 10]\n"
+	checkProgram(t, maskedSource, mainSrc, want)
+}
+
+func TestMaskedMemoryArena(t *testing.T) {
+	t.Parallel()
+	output := translateError(t, maskedSource, "-memory=arena", "-color=never")
+	if !strings.Contains(output, "llvm.masked.load.v4i32.p0v4i32 isn't supported with -memory=arena") {
+		t.Errorf("output doesn't report the unsupported intrinsic:\n%s", output)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+)
+
+// MemIntrinsic translates calls to the llvm.memcpy, llvm.memmove, and
+// llvm.memset intrinsics (with any overloaded types, and their .inline
+// variants) as Go code operating on byte slices, so that the program doesn't
+// need definitions of memcpy, memmove, and memset. In freestanding mode, they
+// are calls to the module's own definitions instead, as in C. If name is
+// none of them, it returns ok == false.
+func MemIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	var fn string
+	switch {
+	case strings.HasPrefix(name, "llvm.memcpy."):
+		fn = "memcpy"
+	case strings.HasPrefix(name, "llvm.memmove."):
+		fn = "memmove"
+	case strings.HasPrefix(name, "llvm.memset."):
+		fn = "memset"
+	default:
+		return "", false, nil
+	}
+	if len(inst.Args) < 3 {
+		return "", true, fmt.Errorf("too few arguments to %s", name)
+	}
+	args := make([]string, 3)
+	for i, a := range inst.Args[:3] {
+		v, err := FormatValue(a)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating argument %d (%v): %v", i, a, err)
+		}
+		args[i] = v
+	}
+	if *freestanding {
+		result, err = freestandingMemCall(fn, args)
+		return result, true, err
+	}
+
+	dst, n := args[0], fmt.Sprintf("int(%s)", args[2])
+	if _, ok := inst.Args[2].(*constant.Int); ok {
+		n = args[2]
+	}
+	if fn == "memset" {
+		c := args[1]
+		if _, ok := inst.Args[1].(*constant.Int); ok {
+			c = fmt.Sprintf("byte(%s)", c)
+		}
+		// Go recognizes this loop and compiles it to a memset (or a memclr,
+		// for zero). The operands are evaluated before b and c are declared,
+		// so variables with the same names don't get in the way.
+		return fmt.Sprintf("{ memset_b, memset_c := libc.ByteSlice(%s, %s), %s; for lane_i := range memset_b { memset_b[lane_i] = memset_c } }", dst, n, c), true, nil
+	}
+	// copy handles overlapping slices, so memcpy and memmove are the same.
+	return fmt.Sprintf("copy(libc.ByteSlice(%s, %s), libc.ByteSlice(%s, %s))", dst, n, args[1], n), true, nil
+}
+
+// StackIntrinsic translates calls to llvm.stacksave and llvm.stackrestore,
+// which C compilers use to free variable-length arrays when they go out of
+// scope. Stack variables are ordinary Go allocations, so they are left to the
+// garbage collector. With -memory=arena, they are released like the ones that
+// are freed when the function returns. If name is neither intrinsic, it
+// returns ok == false.
+func StackIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	switch intrinsicBase(name) {
+	case "stacksave":
+		if arenaMode() {
+			return fmt.Sprintf("%s = uintptr(libc.ArenaMark())", VariableName(inst)), true, nil
+		}
+		return fmt.Sprintf("%s = nil", VariableName(inst)), true, nil
+
+	case "stackrestore":
+		if len(inst.Args) != 1 {
+			return "", true, fmt.Errorf("wrong number of arguments to %s: %d", name, len(inst.Args))
+		}
+		if !arenaMode() {
+			return "", true, nil
+		}
+		mark, err := FormatValue(inst.Args[0])
+		if err != nil {
+			return "", true, fmt.Errorf("error translating argument (%v): %v", inst.Args[0], err)
+		}
+		return fmt.Sprintf("libc.ArenaRelease(int(%s))", mark), true, nil
+	}
+	return "", false, nil
+}
+
+// PtrMaskIntrinsic translates calls to llvm.ptrmask, which clears bits of a
+// pointer (usually to align it, or to remove a tag from the low bits). If name
+// is not llvm.ptrmask, it returns ok == false.
+func PtrMaskIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	if intrinsicBase(name) != "ptrmask" {
+		return "", false, nil
+	}
+	if len(inst.Args) != 2 {
+		return "", true, fmt.Errorf("wrong number of arguments to %s: %d", name, len(inst.Args))
+	}
+	p, err := FormatValue(inst.Args[0])
+	if err != nil {
+		return "", true, fmt.Errorf("error translating pointer (%v): %v", inst.Args[0], err)
+	}
+	mask, err := FormatUnsigned(inst.Args[1])
+	if err != nil {
+		return "", true, fmt.Errorf("error translating mask (%v): %v", inst.Args[1], err)
+	}
+	if arenaMode() {
+		return fmt.Sprintf("%s = %s & uintptr(%s)", VariableName(inst), p, mask), true, nil
+	}
+	t, err := TypeSpec(inst.Type())
+	if err != nil {
+		return "", true, fmt.Errorf("error translating type (%v): %v", inst.Type(), err)
+	}
+	// The mask is applied with &^ and its complement, which go vet accepts as
+	// pointer arithmetic on the same allocation, while it reports &.
+	return fmt.Sprintf("%s = (%s)(unsafe.Pointer(uintptr(unsafe.Pointer(%s)) &^ ^uintptr(%s)))", VariableName(inst), t, p, mask), true, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMemIntrinsics(t *testing.T) {
+	t.Parallel()
+	src := `
+declare void @llvm.memcpy.p0i8.p0i8.i64(i8*, i8*, i64, i1)
+declare void @llvm.memcpy.inline.p0i8.p0i8.i32(i8*, i8*, i32, i1)
+declare void @llvm.memmove.p0i8.p0i8.i64(i8*, i8*, i64, i1)
+declare void @llvm.memset.p0i8.i64(i8*, i8, i64, i1)
+declare void @llvm.memset.p0i8.i32(i8*, i8, i32, i1)
+
+define void @copy(i8* %dst, i8* %src, i64 %n) {
+  call void @llvm.memcpy.p0i8.p0i8.i64(i8* %dst, i8* %src, i64 %n, i1 false)
+  ret void
+}
+
+define void @copy4(i8* %dst, i8* %src) {
+  call void @llvm.memcpy.inline.p0i8.p0i8.i32(i8* %dst, i8* %src, i32 4, i1 false)
+  ret void
+}
+
+; shift moves the first n bytes of p up by one.
+define void @shift(i8* %p, i64 %n) {
+  %q = getelementptr i8, i8* %p, i64 1
+  call void @llvm.memmove.p0i8.p0i8.i64(i8* %q, i8* %p, i64 %n, i1 false)
+  ret void
+}
+
+define void @fill(i8* %p, i8 %c, i64 %n) {
+  call void @llvm.memset.p0i8.i64(i8* %p, i8 %c, i64 %n, i1 false)
+  ret void
+}
+
+define void @clear3(i8* %b) {
+  call void @llvm.memset.p0i8.i32(i8* %b, i8 0, i32 3, i1 false)
+  ret void
+}
+`
+	code, _ := translate(t, src)
+	for _, name := range []string{"libc.Memmove", "libc.Memset", "memcpy(", "memset("} {
+		if strings.Contains(code, name) {
+			t.Errorf("generated code calls %s:\n%s", name, numberLines(code))
+		}
+	}
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	a, b := []byte("hello, world"), []byte("HELLO")
+	_copy(&a[0], &b[0], 3)
+	fmt.Println(string(a))
+	copy4(&a[7], &b[1])
+	fmt.Println(string(a))
+	shift(&a[0], 5)
+	fmt.Println(string(a))
+	fill(&a[0], '*', 4)
+	fmt.Println(string(a))
+	c := []byte("abcd")
+	clear3(&c[0])
+	fmt.Println(c)
+}
+`
+	if got, want := runGo(t, code, mainSrc), "HELlo, world\nHELlo, ELLOd\nHHELlo ELLOd\n****lo ELLOd\n[0 0 0 100]\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+const stackSaveSource = `
+declare i8* @llvm.stacksave()
+declare void @llvm.stackrestore(i8*)
+
+; sumSquares adds up the squares of 1 to n, many times over, with a
+; variable-length array that is freed at the end of each iteration.
+define i64 @sumSquares(i32 %n, i32 %times) {
+entry:
+  br label %outer
+
+outer:
+  %k = phi i32 [ 0, %entry ], [ %k1, %body.done ]
+  %total = phi i64 [ 0, %entry ], [ %total1, %body.done ]
+  %more = icmp slt i32 %k, %times
+  br i1 %more, label %body, label %exit
+
+body:
+  %saved = call i8* @llvm.stacksave()
+  %vla = alloca i64, i32 %n
+  br label %fill
+
+fill:
+  %i = phi i32 [ 0, %body ], [ %i1, %fill ]
+  %sum = phi i64 [ 0, %body ], [ %sum1, %fill ]
+  %i64 = sext i32 %i to i64
+  %p = getelementptr i64, i64* %vla, i64 %i64
+  %j = add i64 %i64, 1
+  %sq = mul i64 %j, %j
+  store i64 %sq, i64* %p
+  %v = load i64, i64* %p
+  %sum1 = add i64 %sum, %v
+  %i1 = add i32 %i, 1
+  %filled = icmp eq i32 %i1, %n
+  br i1 %filled, label %body.done, label %fill
+
+body.done:
+  call void @llvm.stackrestore(i8* %saved)
+  %total1 = add i64 %total, %sum1
+  %k1 = add i32 %k, 1
+  br label %outer
+
+exit:
+  ret i64 %total
+}
+`
+
+func TestStackSave(t *testing.T) {
+	t.Parallel()
+	mainSrc := mainCalling("sumSquares(10, 3)", "sumSquares(1000, 1000)")
+	checkProgram(t, stackSaveSource, mainSrc, "1155\n333833500000\n")
+
+	// With -memory=arena, the arrays are released on each iteration.
+	code, _ := translate(t, stackSaveSource, "-memory=arena")
+	if !strings.Contains(code, "libc.ArenaRelease(int(") {
+		t.Errorf("stackrestore doesn't release the arena:\n%s", numberLines(code))
+	}
+	if got, want := runGo(t, code, mainSrc), "1155\n333833500000\n"; got != want {
+		t.Errorf("output with -memory=arena: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+const ptrMaskSource = `
+declare i8* @llvm.ptrmask.p0i8.i64(i8*, i64)
+
+; tagLoad adds tag to p, and masks it off again before loading.
+define i64 @tagLoad(i64* %p, i64 %tag) {
+  %b = bitcast i64* %p to i8*
+  %tagged = getelementptr i8, i8* %b, i64 %tag
+  %untagged = call i8* @llvm.ptrmask.p0i8.i64(i8* %tagged, i64 -8)
+  %q = bitcast i8* %untagged to i64*
+  %x = load i64, i64* %q
+  ret i64 %x
+}
+`
+
+func TestPtrMask(t *testing.T) {
+	t.Parallel()
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	a := [2]int64{10, 20}
+	fmt.Println(tagLoad(&a[1], 5), tagLoad(&a[0], 7), tagLoad(&a[1], 0))
+}
+`
+	checkProgram(t, ptrMaskSource, mainSrc, "20 10 20\n")
+
+	arenaMain := `package main
+
+import (
+	"fmt"
+
+	"github.com/andybalholm/leaven/libc"
+)
+
+func main() {
+	p := libc.ArenaMalloc(16)
+	libc.ArenaStoreInt64(p, 10)
+	libc.ArenaStoreInt64(p+8, 20)
+	fmt.Println(tagLoad(p+8, 5), tagLoad(p, 7), tagLoad(p+8, 0))
+}
+`
+	checkProgram(t, ptrMaskSource, arenaMain, "20 10 20\n", "-memory=arena")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/types"
+)
+
+// intMinMax describes the integer min and max intrinsics: the operator that
+// is true when the first operand should be chosen, and whether the operands
+// are compared as signed numbers.
+var intMinMax = map[string]struct {
+	op     string
+	signed bool
+}{
+	"smax": {">", true},
+	"smin": {"<", true},
+	"umax": {">", false},
+	"umin": {"<", false},
+}
+
+// signedElem converts the element of an integer vector with type it (held in
+// a variable named elem) to signed.
+func signedElem(it *types.IntType, elem string) string {
+	if it.BitSize == 8 {
+		return fmt.Sprintf("int8(%s)", elem)
+	}
+	return elem
+}
+
+// IntMinMaxIntrinsic translates calls to llvm.abs and to the intrinsics in
+// intMinMax. If name is not one of them, it returns ok == false.
+func IntMinMaxIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	base := intrinsicBase(name)
+	mm, ok := intMinMax[base]
+	if !ok && base != "abs" {
+		return "", false, nil
+	}
+	if len(inst.Args) != 2 {
+		return "", true, fmt.Errorf("wrong number of arguments to %s: %d", name, len(inst.Args))
+	}
+	t := inst.Args[0].Type()
+	vt, isVector := t.(*types.VectorType)
+	if isVector {
+		t = vt.ElemType
+	}
+	it, ok := t.(*types.IntType)
+	if !ok {
+		return "", true, fmt.Errorf("unsupported type for %s: %v", name, inst.Args[0].Type())
+	}
+	if _, err := bitsWidth(it); err != nil {
+		return "", true, err
+	}
+	r := VariableName(inst)
+
+	if base == "abs" {
+		// The second operand says whether the result is poison for the
+		// minimum value; Go's negation wraps it around to itself, which is
+		// what LLVM returns when it isn't.
+		x, err := FormatValue(inst.Args[0])
+		if err != nil {
+			return "", true, fmt.Errorf("error translating operand (%v): %v", inst.Args[0], err)
+		}
+		if isVector {
+			elem := r + "[lane_i]"
+			return fmt.Sprintf("for lane_i, lane_v := range %s { %s = lane_v; if %s < 0 { %s = -%s } }", x, elem, signedElem(it, elem), elem, elem), true, nil
+		}
+		return fmt.Sprintf("%s = %s; if %s < 0 { %s = -%s }", r, x, signedElem(it, r), r, r), true, nil
+	}
+
+	var operands, compared [2]string
+	for i, arg := range inst.Args {
+		operands[i], err = FormatValue(arg)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating operand %d (%v): %v", i, arg, err)
+		}
+		switch {
+		case isVector:
+			operands[i] = parenthesize(operands[i]) + "[lane_i]"
+			if mm.signed {
+				compared[i] = signedElem(it, operands[i])
+			} else {
+				compared[i] = unsignedElem(it, operands[i])
+			}
+		case mm.signed:
+			compared[i], err = FormatSigned(arg)
+		default:
+			compared[i], err = FormatUnsigned(arg)
+		}
+		if err != nil {
+			return "", true, fmt.Errorf("error translating operand %d (%v): %v", i, arg, err)
+		}
+	}
+	if isVector {
+		return fmt.Sprintf("for lane_i := range %s { if %s %s %s { %s[lane_i] = %s } else { %s[lane_i] = %s } }", r, compared[0], mm.op, compared[1], r, operands[0], r, operands[1]), true, nil
+	}
+	return fmt.Sprintf("if %s %s %s { %s = %s } else { %s = %s }", compared[0], mm.op, compared[1], r, operands[0], r, operands[1]), true, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestIntMinMax(t *testing.T) {
+	t.Parallel()
+	src := new(strings.Builder)
+	var exprs []string
+	for _, typ := range []struct {
+		ir, goType string
+		x, y       string
+	}{
+		{"i8", "byte", "0x05", "0xf0"},
+		{"i32", "int32", "5", "-16"},
+		{"i64", "int64", "5", "-16"},
+	} {
+		for _, fn := range []string{"smax", "smin", "umax", "umin"} {
+			fmt.Fprintf(src, "declare %[1]s @llvm.%[2]s.%[1]s(%[1]s, %[1]s)\n\n", typ.ir, fn)
+			fmt.Fprintf(src, "define %[1]s @%[2]s_%[1]s(%[1]s %%x, %[1]s %%y) {\n  %%r = call %[1]s @llvm.%[2]s.%[1]s(%[1]s %%x, %[1]s %%y)\n  ret %[1]s %%r\n}\n\n", typ.ir, fn)
+			exprs = append(exprs, fmt.Sprintf("%s_%s(%s, %s), %s_%s(%s, %s)", fn, typ.ir, typ.x, typ.y, fn, typ.ir, typ.y, typ.x))
+		}
+		fmt.Fprintf(src, "declare %[1]s @llvm.abs.%[1]s(%[1]s, i1)\n\n", typ.ir)
+		fmt.Fprintf(src, "define %[1]s @abs_%[1]s(%[1]s %%x) {\n  %%r = call %[1]s @llvm.abs.%[1]s(%[1]s %%x, i1 false)\n  ret %[1]s %%r\n}\n\n", typ.ir)
+		exprs = append(exprs, fmt.Sprintf("abs_%s(%s), abs_%s(%s)", typ.ir, typ.x, typ.ir, typ.y))
+	}
+	src.WriteString(`
+declare <4 x i8> @llvm.smin.v4i8(<4 x i8>, <4 x i8>)
+
+define <4 x i8> @sminv(<4 x i8> %x, <4 x i8> %y) {
+  %r = call <4 x i8> @llvm.smin.v4i8(<4 x i8> %x, <4 x i8> %y)
+  ret <4 x i8> %r
+}
+
+declare <2 x i32> @llvm.umax.v2i32(<2 x i32>, <2 x i32>)
+
+define <2 x i32> @umaxv(<2 x i32> %x) {
+  %r = call <2 x i32> @llvm.umax.v2i32(<2 x i32> %x, <2 x i32> <i32 10, i32 10>)
+  ret <2 x i32> %r
+}
+
+declare <2 x i16> @llvm.abs.v2i16(<2 x i16>, i1)
+
+define <2 x i16> @absv(<2 x i16> %x) {
+  %r = call <2 x i16> @llvm.abs.v2i16(<2 x i16> %x, i1 true)
+  ret <2 x i16> %r
+}
+
+define i32 @absMin() {
+  %r = call i32 @llvm.abs.i32(i32 -2147483648, i1 false)
+  ret i32 %r
+}
+`)
+	exprs = append(exprs,
+		"sminv([4]byte{1, 0x80, 0xff, 7}, [4]byte{2, 1, 0, 7})",
+		"umaxv([2]int32{3, -3})",
+		"absv([2]int16{-7, 7})",
+		"absMin()",
+	)
+	// The i8 results are bytes, so -16 is printed as 240.
+	want := "5 5\n240 240\n240 240\n5 5\n5 16\n" +
+		"5 5\n-16 -16\n-16 -16\n5 5\n5 16\n" +
+		"5 5\n-16 -16\n-16 -16\n5 5\n5 16\n" +
+		"[1 128 255 7]\n[10 -3]\n[7 7]\n-2147483648\n"
+	checkProgram(t, src.String(), mainCalling(exprs...), want)
+}
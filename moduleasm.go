@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+)
+
+// An AsmAlias is a symbol alias declared in module-level inline assembly.
+type AsmAlias struct {
+	Name   string
+	Target *ir.Func
+}
+
+// ModuleAsm examines the module-level inline assembly in m. Symbol aliases
+// (.symver, .set, and .equ directives) that refer to functions are returned
+// so that they can be declared as Go variables. Directives that don't affect
+// the translation, such as .ident, are skipped silently, and anything else is
+// returned in unsupported.
+func ModuleAsm(m *ir.Module) (aliases []AsmAlias, unsupported []string) {
+	funcs := make(map[string]*ir.Func)
+	for _, f := range m.Funcs {
+		funcs[f.Name()] = f
+	}
+
+	for _, blob := range m.ModuleAsms {
+		for _, line := range strings.FieldsFunc(blob, func(r rune) bool { return r == '\n' || r == ';' }) {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			directive := line
+			args := ""
+			if i := strings.IndexAny(line, " \t"); i != -1 {
+				directive, args = line[:i], strings.TrimSpace(line[i:])
+			}
+
+			switch directive {
+			case ".ident", ".text", ".previous", ".section", ".globl", ".global", ".weak", ".hidden", ".type", ".size", ".p2align", ".align":
+				continue
+
+			case ".symver", ".set", ".equ":
+				parts := strings.Split(args, ",")
+				if len(parts) != 2 {
+					break
+				}
+				target, name := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+				if directive != ".symver" {
+					target, name = name, target
+				} else {
+					// The default version (name@@VERSION) gets the plain
+					// name; other versions get the version as a suffix.
+					if i := strings.Index(name, "@@"); i != -1 {
+						name = name[:i]
+					} else if i := strings.Index(name, "@"); i != -1 {
+						name = name[:i] + "_" + name[i+1:]
+					}
+				}
+				f, ok := funcs[target]
+				if !ok || f.Blocks == nil {
+					break
+				}
+				if g, ok := funcs[name]; ok && g.Blocks != nil {
+					// The alias is already defined as a function in its own
+					// right.
+					break
+				}
+				aliases = append(aliases, AsmAlias{Name: name, Target: f})
+				continue
+			}
+
+			unsupported = append(unsupported, line)
+		}
+	}
+
+	return aliases, unsupported
+}
+
+// aliasName returns the Go name for an alias. If the module declares the
+// alias as an external function, the name assigned to the declaration is used,
+// so that calls through the declaration reach the alias.
+func aliasName(m *ir.Module, a AsmAlias) string {
+	for _, f := range m.Funcs {
+		if f.Name() == a.Name && f.Blocks == nil {
+			return VariableName(f)
+		}
+	}
+	return packageScope.unique(valueName(a.Name))
+}
+
+// checkAsmPolicy returns an error if policy is not a valid value for the
+// -module-asm flag.
+func checkAsmPolicy(policy string) error {
+	switch policy {
+	case "warn", "ignore", "error":
+		return nil
+	}
+	return fmt.Errorf("invalid value for -module-asm: %q (want warn, ignore, or error)", policy)
+}
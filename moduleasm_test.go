@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const moduleAsmSource = `
+module asm ".symver real_open, open@@GLIBC_2.2"
+module asm ".symver real_open_old, open@GLIBC_2.0"
+module asm ".set add_alias, add"
+module asm ".ident \22test\22"
+module asm "movl $1, %eax"
+
+define i32 @real_open(i32 %x) {
+  ret i32 %x
+}
+
+define i32 @real_open_old(i32 %x) {
+  %r = sub i32 0, %x
+  ret i32 %r
+}
+
+define i32 @add(i32 %x, i32 %y) {
+  %r = add i32 %x, %y
+  ret i32 %r
+}
+
+declare i32 @add_alias(i32, i32)
+
+define i32 @use() {
+  %r = call i32 @add_alias(i32 20, i32 22)
+  ret i32 %r
+}
+`
+
+func TestModuleAsm(t *testing.T) {
+	t.Parallel()
+	code, output := translate(t, moduleAsmSource)
+	if !strings.Contains(output, "warning: ignoring module asm: movl $1, %eax") {
+		t.Errorf("no warning for the unsupported directive:\n%s", output)
+	}
+	if strings.Contains(output, ".symver") || strings.Contains(output, ".ident") {
+		t.Errorf("warnings for supported directives:\n%s", output)
+	}
+	got := runGo(t, code, mainCalling("open(3)", "open_GLIBC_2_0(3)", "use()"))
+	if want := "3\n-3\n42\n"; got != want {
+		t.Errorf("output:\n%s\nwant:\n%s\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+
+	if _, output := translate(t, moduleAsmSource, "-module-asm=ignore"); strings.Contains(output, "module asm") {
+		t.Errorf("warning with -module-asm=ignore:\n%s", output)
+	}
+	output = translateError(t, moduleAsmSource, "-module-asm=error", "-color=never")
+	if !strings.Contains(output, "unsupported module-level inline assembly") {
+		t.Errorf("no error with -module-asm=error:\n%s", output)
+	}
+}
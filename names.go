@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/value"
+)
+
+// LLVM names may contain characters that are not allowed in Go identifiers,
+// and several LLVM names may sanitize to the same Go identifier. So the Go
+// names are assigned ahead of time, a module or a function at a time, and
+// recorded here. Names that are already valid Go identifiers get first pick,
+// and the others get a numeric suffix if their sanitized form is taken.
+var (
+	valueNames   = make(map[value.Named]string)
+	blockNames   = make(map[*ir.Block]string)
+	typeNames    = make(map[string]string)
+	packageScope = newScope(nil)
+
+	// localScope holds the names in the function being translated.
+	localScope *scope
+)
+
+// reservedNames are identifiers that may not be used for translated values,
+// because they are Go keywords, the blank identifier, predeclared identifiers,
+// package names used in the generated code, or names that the generated code
+// uses for other purposes.
+var reservedNames = []string{
+	// Keywords
+	"break", "case", "chan", "const", "continue", "default", "defer", "else",
+	"fallthrough", "for", "func", "go", "goto", "if", "import", "interface",
+	"map", "package", "range", "return", "select", "struct", "switch", "type",
+	"var",
+
+	// The blank identifier, which can't be read from
+	"_",
+
+	// Predeclared identifiers
+	"bool", "byte", "complex64", "complex128", "error", "float32", "float64",
+	"int", "int8", "int16", "int32", "int64", "rune", "string", "uint",
+	"uint8", "uint16", "uint32", "uint64", "uintptr", "true", "false", "iota",
+	"nil", "append", "cap", "close", "complex", "copy", "delete", "imag",
+	"len", "make", "new", "panic", "print", "println", "real", "recover",
+	"any", "comparable", "min", "max", "clear",
+
+	// Package names (the names in knownImports, and the packages added by
+	// AddImport, are reserved too)
+	"atomic", "binary", "bits", "libc", "math", "noarch", "os", "runtime",
+	"unsafe",
+
+	// Other names used in generated code, including the temporaries in the
+	// loops over vector lanes and in other multi-statement translations (they
+	// have underscores so as to be unlikely names for C variables)
+	"init", "main", "varargs",
+	"lane_i", "lane_v", "memset_b", "memset_c", "packed_v", "putchar_err",
+	"sat_s", "status_err",
+}
+
+// A scope keeps track of which Go identifiers are in use.
+type scope struct {
+	parent *scope
+	used   map[string]bool
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{
+		parent: parent,
+		used:   make(map[string]bool),
+	}
+}
+
+func (s *scope) isUsed(name string) bool {
+	for ; s != nil; s = s.parent {
+		if s.used[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// claim marks name as used if it is available, and reports whether it was.
+func (s *scope) claim(name string) bool {
+	if s.isUsed(name) {
+		return false
+	}
+	s.used[name] = true
+	return true
+}
+
+// unique returns a name based on name that is not yet used in s, and marks it
+// as used.
+func (s *scope) unique(name string) string {
+	if s.claim(name) {
+		return name
+	}
+	for i := 1; ; i++ {
+		n := fmt.Sprintf("%s_%d", name, i)
+		if s.claim(n) {
+			return n
+		}
+	}
+}
+
+func init() {
+	for _, name := range reservedNames {
+		packageScope.used[name] = true
+	}
+	for _, name := range helperNames {
+		packageScope.used[name] = true
+	}
+	for name := range knownImports {
+		packageScope.used[name] = true
+	}
+}
+
+// uniquePackageName returns a name based on name that is not yet used in
+// packageScope, and marks it as used. It also avoids the names in the function
+// being translated (if any), since one of them would hide the new name.
+func uniquePackageName(name string) string {
+	n := name
+	for i := 1; ; i++ {
+		if (localScope == nil || !localScope.isUsed(n)) && packageScope.claim(n) {
+			return n
+		}
+		n = fmt.Sprintf("%s_%d", name, i)
+	}
+}
+
+// sanitizeName converts an LLVM name to a valid Go identifier, adding prefix
+// if it starts with a digit, and an underscore if it is reserved.
+func sanitizeName(name, prefix string) string {
+	name = strings.Trim(name, `"`)
+	b := new(strings.Builder)
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '_':
+			b.WriteByte(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	name = b.String()
+	if name == "" || '0' <= name[0] && name[0] <= '9' {
+		name = prefix + name
+	}
+	for _, r := range reservedNames {
+		if name == r {
+			return "_" + name
+		}
+	}
+	return name
+}
+
+// assignNames gives each of the values a unique name in s. sanitize
+// converts LLVM names to Go identifiers, and set records the result.
+func assignNames(s *scope, names []string, sanitize func(string) string, set func(i int, name string)) {
+	// First give all the names that don't need changing a chance to keep
+	// their names; then deal with the rest.
+	done := make([]bool, len(names))
+	for i, name := range names {
+		if sanitize(name) == name && s.claim(name) {
+			set(i, name)
+			done[i] = true
+		}
+	}
+	for i, name := range names {
+		if !done[i] {
+			set(i, s.unique(sanitize(name)))
+		}
+	}
+}
+
+// AssignGlobalNames chooses Go names for all the functions, global
+// variables, and named types in m.
+func AssignGlobalNames(m *ir.Module) {
+	var values []value.Named
+	var names []string
+	for _, f := range m.Funcs {
+		if isMainFunc(f) {
+			valueNames[f] = "main"
+			continue
+		}
+		values = append(values, f)
+		names = append(names, f.Name())
+	}
+	for _, g := range m.Globals {
+		values = append(values, g)
+		names = append(names, g.Name())
+	}
+	assignNames(packageScope, names, valueName, func(i int, name string) {
+		valueNames[values[i]] = name
+	})
+
+	// Type names share the package namespace, but they come last, since
+	// they aren't part of the API.
+	var typeDefs []string
+	for _, t := range m.TypeDefs {
+		typeDefs = append(typeDefs, t.Name())
+	}
+	assignNames(packageScope, typeDefs, typeName, func(i int, name string) {
+		typeNames[typeDefs[i]] = name
+	})
+}
+
+// AssignLocalNames chooses Go names for the parameters, local variables, and
+// labels in f.
+func AssignLocalNames(f *ir.Func) {
+	var debugVars map[value.Value]string
+	if *debugNames {
+		debugVars = DebugVariableNames(f)
+	}
+	var values []value.Named
+	var names []string
+	add := func(v value.Named) {
+		values = append(values, v)
+		if name, ok := debugVars[v]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, v.Name())
+		}
+	}
+	for _, p := range f.Params {
+		add(p)
+	}
+	for _, b := range f.Blocks {
+		for _, inst := range b.Insts {
+			if v, ok := inst.(value.Named); ok {
+				add(v)
+			}
+		}
+		if v, ok := b.Term.(value.Named); ok {
+			add(v)
+		}
+	}
+	s := newScope(packageScope)
+	localScope = s
+	assignNames(s, names, valueName, func(i int, name string) {
+		valueNames[values[i]] = name
+	})
+	renameGoIntParams(f, s)
+
+	// Labels have a namespace of their own.
+	labels := make([]string, len(f.Blocks))
+	for i, b := range f.Blocks {
+		labels[i] = b.Name()
+	}
+	assignNames(newScope(nil), labels, labelName, func(i int, name string) {
+		blockNames[f.Blocks[i]] = name
+	})
+}
+
+func valueName(name string) string { return sanitizeName(name, "v") }
+func labelName(name string) string { return sanitizeName(name, "block") }
+
+func typeName(name string) string {
+	name = strings.TrimPrefix(name, "struct.")
+	name = strings.TrimPrefix(name, "union.")
+	return sanitizeName(name, "t")
+}
+
+// VariableName returns the name to use for a local variable, parameter,
+// global variable, or function.
+func VariableName(v value.Named) string {
+	if name, ok := valueNames[v]; ok {
+		return name
+	}
+	return valueName(v.Name())
+}
+
+// BlockName returns the label to use for a basic block.
+func BlockName(v value.Value) string {
+	block := v.(*ir.Block)
+	if name, ok := blockNames[block]; ok {
+		return name
+	}
+	return labelName(block.Name())
+}
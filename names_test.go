@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNameCollisions(t *testing.T) {
+	t.Parallel()
+	src := `
+@bits = global i32 7
+@type = global i32 1
+@"a.b" = global i32 2
+@a_b = global i32 3
+@_ = global i32 5
+
+declare i32 @llvm.ctpop.i32(i32)
+
+define i32 @count() {
+  %x = load i32, i32* @bits
+  %n = call i32 @llvm.ctpop.i32(i32 %x)
+  ret i32 %n
+}
+
+define i32 @sum(i32 %range, i32 %func) {
+  %a = load i32, i32* @type
+  %b = load i32, i32* @"a.b"
+  %c = load i32, i32* @a_b
+  %d = load i32, i32* @_
+  %s1 = add i32 %range, %func
+  %s2 = add i32 %s1, %a
+  %s3 = add i32 %s2, %b
+  %s4 = add i32 %s3, %c
+  %s5 = add i32 %s4, %d
+  ret i32 %s5
+}
+
+define <4 x double> @mod(<4 x double> %x, <4 x double> %v) {
+  %r = frem <4 x double> %x, %v
+  ret <4 x double> %r
+}
+
+define <2 x i32> @addi(<2 x i32> %i, <2 x i32> %b) {
+  %r = add <2 x i32> %i, %b
+  ret <2 x i32> %r
+}
+
+define <2 x i32> @addl(<2 x i32> %lane_v, <2 x i32> %lane_i) {
+  %r = add <2 x i32> %lane_v, %lane_i
+  ret <2 x i32> %r
+}
+`
+	mainSrc := mainCalling(
+		"count()",
+		"sum(10, 20)",
+		"mod([4]float64{5, 7, 9, 10}, [4]float64{3, 4, 5, 6})",
+		"addi([2]int32{1, 2}, [2]int32{30, 40})",
+		"addl([2]int32{30, 40}, [2]int32{1, 2})",
+	)
+	checkProgram(t, src, mainSrc, "3\n41\n[2 3 4 4]\n[31 42]\n[31 42]\n")
+
+	// Common short names are left alone; only the loop temporaries are
+	// reserved.
+	code, _ := translate(t, src)
+	if !strings.Contains(code, "func addi(i [2]int32, b [2]int32) [2]int32 {") {
+		t.Errorf("addi's parameters were renamed:\n%s", numberLines(code))
+	}
+}
+
+func TestNamesAvoidImports(t *testing.T) {
+	t.Parallel()
+	src := `
+@crc32 = global [3 x i8] c"abc"
+
+declare i32 @my_hash(i8*, i64)
+
+define i32 @hash() {
+  %p = getelementptr [3 x i8], [3 x i8]* @crc32, i64 0, i64 0
+  %h = call i32 @my_hash(i8* %p, i64 3)
+  ret i32 %h
+}
+`
+	code, output, ok := runLeaven(t, src, map[string]string{
+		"extern.map": "my_hash hash/crc32.ChecksumIEEE func([]byte) uint32\n",
+	}, "-extern-map=extern.map")
+	if !ok {
+		t.Fatalf("leaven failed:\n%s", output)
+	}
+	// crc32("abc") = 0x352441c2
+	if got := runGo(t, code, mainCalling("hash()")); got != "891568578\n" {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, "891568578\n", numberLines(code))
+	}
+}
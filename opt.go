@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// RunOpt runs LLVM's opt tool on inFile with the given pass pipeline (in the
+// syntax of opt's -passes flag, such as "mem2reg,simplifycfg,instcombine"),
+// and returns the name of a temporary file containing the optimized IR. The
+// caller should remove the file when it is done with it.
+func RunOpt(optPath, inFile, passes string) (string, error) {
+	tmp, err := ioutil.TempFile("", "leaven-*.ll")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+
+	stderr := new(bytes.Buffer)
+	cmd := exec.Command(optPath, "-S", "-passes="+passes, "-o", tmp.Name(), inFile)
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmp.Name())
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", fmt.Errorf("running %s: %v", optPath, err)
+		}
+		return "", fmt.Errorf("running %s: %v\n%s", optPath, err, msg)
+	}
+	return tmp.Name(), nil
+}
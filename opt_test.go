@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestPasses(t *testing.T) {
+	t.Parallel()
+	src := `
+define i32 @sum(i32 %n) {
+entry:
+  %i = alloca i32
+  %s = alloca i32
+  store i32 0, i32* %i
+  store i32 0, i32* %s
+  br label %loop
+
+loop:
+  %iv = load i32, i32* %i
+  %done = icmp sge i32 %iv, %n
+  br i1 %done, label %exit, label %body
+
+body:
+  %sv = load i32, i32* %s
+  %s2 = add i32 %sv, %iv
+  store i32 %s2, i32* %s
+  %i2 = add i32 %iv, 1
+  store i32 %i2, i32* %i
+  br label %loop
+
+exit:
+  %r = load i32, i32* %s
+  ret i32 %r
+}
+`
+	output := translateError(t, src, "-passes=mem2reg", "-opt=/nonexistent/opt")
+	if !strings.Contains(output, "running /nonexistent/opt") {
+		t.Errorf("missing opt wasn't reported:\n%s", output)
+	}
+
+	if _, err := exec.LookPath("opt"); err != nil {
+		t.Skip("opt not found")
+	}
+	code, _ := translate(t, src, "-passes=mem2reg")
+	if strings.Contains(code, "unsafe") {
+		t.Errorf("allocas weren't promoted to registers:\n%s", numberLines(code))
+	}
+	if got := runGo(t, code, mainCalling("sum(10)")); got != "45\n" {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, "45\n", numberLines(code))
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// OutParams lists, for each function whose signature is being rewritten, the
+// indices of the parameters that are translated as results instead.
+var OutParams = make(map[*ir.Func][]int)
+
+// StatusFuncs is the set of functions (among those in OutParams) whose int32
+// result is translated as an error.
+var StatusFuncs = make(map[*ir.Func]bool)
+
+// FindOutParams fills in OutParams and StatusFuncs for the functions defined
+// in m. A parameter is an output parameter if it has the sret attribute, if it
+// is listed in explicit (as "function:parameter", where the parameter is
+// given by name or index), or if it is a pointer whose name marks it as an
+// output (out, out_x, or x_out) and the function never reads the value it
+// points to before writing it.
+//
+// Only functions that are used just as the callee of direct calls are
+// rewritten, since a function value needs the signature LLVM gave it.
+func FindOutParams(m *ir.Module, explicit []string, statusErrors bool) error {
+	listed := make(map[string]bool)
+	for _, s := range explicit {
+		if !strings.Contains(s, ":") {
+			return fmt.Errorf("invalid output parameter %q (should be function:parameter)", s)
+		}
+		listed[s] = true
+	}
+
+	addressTaken := make(map[value.Value]bool)
+	note := func(x interface{}) {
+		for _, r := range References(x) {
+			addressTaken[r] = true
+		}
+	}
+	for _, g := range m.Globals {
+		if g.Init != nil {
+			note(g.Init)
+		}
+	}
+	for _, a := range m.Aliases {
+		note(a.Aliasee)
+	}
+	for _, f := range m.Funcs {
+		for _, b := range f.Blocks {
+			for _, inst := range b.Insts {
+				if call, ok := inst.(*ir.InstCall); ok {
+					if _, ok := call.Callee.(*ir.Func); !ok {
+						note(call.Callee)
+					}
+					for _, a := range call.Args {
+						note(a)
+					}
+					continue
+				}
+				note(inst)
+			}
+			note(b.Term)
+		}
+	}
+
+	for _, f := range m.Funcs {
+		if f.Blocks == nil || isMainFunc(f) || addressTaken[f] {
+			continue
+		}
+		var out []int
+		for i, p := range f.Params {
+			if isOutParam(f, i, p, listed) {
+				out = append(out, i)
+			}
+		}
+		if len(out) == 0 {
+			continue
+		}
+		OutParams[f] = out
+		if statusErrors && types.Equal(f.Sig.RetType, types.I32) {
+			StatusFuncs[f] = true
+		}
+	}
+	return nil
+}
+
+func isOutParam(f *ir.Func, i int, p *ir.Param, listed map[string]bool) bool {
+	pt, ok := p.Typ.(*types.PointerType)
+	if !ok || types.IsFunc(pt.ElemType) {
+		return false
+	}
+	for _, a := range p.Attrs {
+		if a == enum.ParamAttrSRet {
+			return true
+		}
+	}
+	if listed[f.Name()+":"+p.Name()] || listed[f.Name()+":"+strconv.Itoa(i)] {
+		return true
+	}
+	if types.Equal(pt.ElemType, types.I8) {
+		// A char * is much more likely to be a buffer than a single output
+		// character.
+		return false
+	}
+	name := p.LocalName
+	if name != "out" && !strings.HasPrefix(name, "out_") && !strings.HasSuffix(name, "_out") {
+		return false
+	}
+	// An in/out parameter would lose the value the caller passed in.
+	return writtenBeforeRead(f, p)
+}
+
+// writtenBeforeRead reports whether f only stores to p, and loads from it
+// after a store earlier in the same block, so that what p points to when f is
+// called doesn't matter. Any other use of p (passing it to another function,
+// say) counts as reading it.
+func writtenBeforeRead(f *ir.Func, p *ir.Param) bool {
+	uses := func(x interface{}) bool {
+		for _, r := range References(x) {
+			if r == p {
+				return true
+			}
+		}
+		return false
+	}
+	for _, b := range f.Blocks {
+		stored := false
+		for _, inst := range b.Insts {
+			switch inst := inst.(type) {
+			case *ir.InstStore:
+				if inst.Dst == p && inst.Src != p {
+					stored = true
+					continue
+				}
+			case *ir.InstLoad:
+				if inst.Src == p && stored {
+					continue
+				}
+			}
+			if uses(inst) {
+				return false
+			}
+		}
+		if uses(b.Term) {
+			return false
+		}
+	}
+	return true
+}
+
+// isOut reports whether parameter i of f is an output parameter.
+func isOut(f *ir.Func, i int) bool {
+	for _, j := range OutParams[f] {
+		if i == j {
+			return true
+		}
+	}
+	return false
+}
+
+// outResults returns the result list for a function with output parameters.
+func outResults(f *ir.Func) (string, error) {
+	var results []string
+	for _, i := range OutParams[f] {
+		t, err := TypeSpec(f.Params[i].Typ.(*types.PointerType).ElemType)
+		if err != nil {
+			return "", fmt.Errorf("error translating type for parameter %d: %v", i, err)
+		}
+		results = append(results, t)
+	}
+	switch {
+	case StatusFuncs[f]:
+		results = append(results, "error")
+	case !types.Equal(f.Sig.RetType, types.Void):
+		t, err := TypeSpec(f.Sig.RetType)
+		if err != nil {
+			return "", fmt.Errorf("error translating return type: %v", err)
+		}
+		results = append(results, t)
+	}
+	if len(results) == 1 {
+		return results[0], nil
+	}
+	return "(" + strings.Join(results, ", ") + ")", nil
+}
+
+// outParamDecls returns the statements that allocate the storage for f's
+// output parameters.
+func outParamDecls(f *ir.Func) ([]string, error) {
+	var decls []string
+	for _, i := range OutParams[f] {
+		p := f.Params[i]
+		t, err := TypeSpec(p.Typ.(*types.PointerType).ElemType)
+		if err != nil {
+			return nil, fmt.Errorf("error translating type for parameter %d: %v", i, err)
+		}
+		decls = append(decls, fmt.Sprintf("%s := new(%s)", VariableName(p), t))
+	}
+	return decls, nil
+}
+
+// outReturn returns the return statement for a function with output
+// parameters. retVal is the translated return value, if any.
+func outReturn(f *ir.Func, retVal string) string {
+	var results []string
+	for _, i := range OutParams[f] {
+		results = append(results, "*"+VariableName(f.Params[i]))
+	}
+	switch {
+	case StatusFuncs[f]:
+		results = append(results, fmt.Sprintf("libc.StatusError(%s)", retVal))
+	case retVal != "":
+		results = append(results, retVal)
+	}
+	return "return " + strings.Join(results, ", ")
+}
+
+// outCall translates a call to a function with output parameters. args are
+// the translated arguments, including the ones for the output parameters.
+func outCall(inst *ir.InstCall, f *ir.Func, callee string, args []string) string {
+	var in, dest []string
+	for i, a := range args {
+		if !isOut(f, i) {
+			in = append(in, a)
+			continue
+		}
+		if strings.HasPrefix(a, "&") {
+			dest = append(dest, strings.TrimPrefix(a, "&"))
+		} else {
+			dest = append(dest, "*"+a)
+		}
+	}
+	call := fmt.Sprintf("%s(%s)", callee, strings.Join(in, ", "))
+	switch {
+	case StatusFuncs[f]:
+		return fmt.Sprintf("{ var status_err error; %s, status_err = %s; %s = libc.StatusCode(status_err) }", strings.Join(dest, ", "), call, VariableName(inst))
+	case !types.Equal(inst.Type(), types.Void):
+		dest = append(dest, VariableName(inst))
+	}
+	return fmt.Sprintf("%s = %s", strings.Join(dest, ", "), call)
+}
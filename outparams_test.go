@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const outParamsSource = `
+%pair = type { i32, i32 }
+
+define void @make_pair(%pair* sret %r, i32 %a) {
+  %p0 = getelementptr %pair, %pair* %r, i32 0, i32 0
+  store i32 %a, i32* %p0
+  %p1 = getelementptr %pair, %pair* %r, i32 0, i32 1
+  %b = mul i32 %a, 2
+  store i32 %b, i32* %p1
+  ret void
+}
+
+define i32 @halve(i32 %x, i32* %out) {
+  %odd = and i32 %x, 1
+  %bad = icmp ne i32 %odd, 0
+  br i1 %bad, label %fail, label %ok
+
+ok:
+  %h = sdiv i32 %x, 2
+  store i32 %h, i32* %out
+  ret i32 0
+
+fail:
+  ret i32 22
+}
+
+; count_out is named like an output, but it is read before it is written, so
+; it stays a pointer.
+define void @count_up(i32* %count_out) {
+  %c = load i32, i32* %count_out
+  %c1 = add i32 %c, 1
+  store i32 %c1, i32* %count_out
+  ret void
+}
+
+define i32 @counted(i32 %n) {
+  %p = alloca i32
+  store i32 %n, i32* %p
+  call void @count_up(i32* %p)
+  %r = load i32, i32* %p
+  ret i32 %r
+}
+
+define i32 @sum_halves(i32 %x) {
+  %h = alloca i32
+  %st = call i32 @halve(i32 %x, i32* %h)
+  %failed = icmp ne i32 %st, 0
+  br i1 %failed, label %fail, label %ok
+
+ok:
+  %v = load i32, i32* %h
+  %p = alloca %pair
+  call void @make_pair(%pair* sret %p, i32 %v)
+  %p1 = getelementptr %pair, %pair* %p, i32 0, i32 1
+  %v1 = load i32, i32* %p1
+  ret i32 %v1
+
+fail:
+  %neg = sub i32 0, %st
+  ret i32 %neg
+}
+`
+
+func TestOutParams(t *testing.T) {
+	t.Parallel()
+	code, _ := translate(t, outParamsSource, "-out-params", "-status-errors")
+	for _, sig := range []string{"func make_pair(a int32) pair {", "func halve(x int32) (int32, error) {", "func count_up(count_out *int32) {"} {
+		if !strings.Contains(code, sig) {
+			t.Errorf("generated code doesn't contain %q:\n%s", sig, numberLines(code))
+		}
+	}
+	got := runGo(t, code, mainCalling("make_pair(3)", "halve(10)", "halve(3)", "sum_halves(10)", "sum_halves(3)", "counted(4)"))
+	want := "{3 6}\n5 <nil>\n0 status 22\n10\n-22\n5\n"
+	if got != want {
+		t.Errorf("output:\n%s\nwant:\n%s\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestOutParamsAddressTaken(t *testing.T) {
+	t.Parallel()
+	// get's address is taken, so it keeps its output parameter; put is only
+	// called directly, so it gets a result.
+	src := `
+@fp = global void (i32*)* null
+
+define void @get(i32* %out) {
+  store i32 7, i32* %out
+  ret void
+}
+
+define void @put(i32* %out) {
+  store i32 8, i32* %out
+  ret void
+}
+
+define i32 @use() {
+  store void (i32*)* @get, void (i32*)** @fp
+  %f = load void (i32*)*, void (i32*)** @fp
+  %p = alloca i32
+  call void %f(i32* %p)
+  %a = load i32, i32* %p
+  call void @put(i32* %p)
+  %b = load i32, i32* %p
+  %r = add i32 %a, %b
+  ret i32 %r
+}
+`
+	code, _ := translate(t, src, "-out-params")
+	for _, sig := range []string{"func get(out *int32) {", "func put() int32 {"} {
+		if !strings.Contains(code, sig) {
+			t.Errorf("generated code doesn't contain %q:\n%s", sig, numberLines(code))
+		}
+	}
+	if got, want := runGo(t, code, mainCalling("use()")), "15\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
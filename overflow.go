@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/types"
+)
+
+// unsignedOverflowConditions are the conditions (in terms of the unsigned
+// operands x and y, and the result z) under which unsigned arithmetic
+// overflows. Multiplication is handled separately, since its result can't be
+// checked that way.
+var unsignedOverflowConditions = map[string]string{
+	"add": "z < x",
+	"sub": "y > x",
+}
+
+// overflowHelper returns the name of a helper function that does op (add,
+// sub, or mul) on integers of type it, returning the result and whether it
+// overflowed.
+func overflowHelper(op string, it *types.IntType, signed bool) (string, error) {
+	bits := it.BitSize
+	switch bits {
+	case 8, 16, 32, 64:
+	default:
+		return "", fmt.Errorf("unsupported type for overflow intrinsic: %v", it)
+	}
+	t, err := TypeSpec(it)
+	if err != nil {
+		return "", err
+	}
+	kind := "s"
+	if !signed {
+		kind = "u"
+	}
+	name := fmt.Sprintf("%s%sOv%d", kind, op, bits)
+
+	// The arithmetic is done with Go types of the right signedness, and
+	// converted back to the translation of it.
+	conv, ut := "int", fmt.Sprintf("int%d", bits)
+	if !signed {
+		conv, ut = "uint", fmt.Sprintf("uint%d", bits)
+	}
+	if bits == 8 {
+		ut = conv + "8"
+	}
+	var body string
+	switch {
+	case signed:
+		body = fmt.Sprintf("\tz := x %s y\n\treturn %s(z), %s\n", overflowOperators[op], t, overflowConditions[op])
+	case op != "mul":
+		body = fmt.Sprintf("\tz := x %s y\n\treturn %s(z), %s\n", overflowOperators[op], t, unsignedOverflowConditions[op])
+	case bits == 64:
+		body = fmt.Sprintf("\thi, lo := bits.Mul64(x, y)\n\treturn %s(lo), hi != 0\n", t)
+	default:
+		// Do the multiplication in a type twice as wide.
+		body = fmt.Sprintf("\tz := uint%d(x) * uint%d(y)\n\treturn %s(z), z>>%d != 0\n", bits*2, bits*2, t, bits)
+	}
+	src := fmt.Sprintf("func %s(a, b %s) (%s, bool) {\n\tx, y := %s(a), %s(b)\n%s}\n", name, t, t, ut, ut, body)
+	if ut == t {
+		src = fmt.Sprintf("func %s(x, y %s) (%s, bool) {\n%s}\n", name, t, t, strings.Replace(body, t+"(z)", "z", 1))
+	}
+	return UseHelper(name, src), nil
+}
+
+// OverflowIntrinsic translates calls to llvm.sadd.with.overflow and the other
+// arithmetic-with-overflow intrinsics, whose result is a struct holding the
+// result of the operation and whether it overflowed. If name is not one of
+// them, it returns ok == false.
+func OverflowIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	if !strings.HasPrefix(name, "llvm.") || !strings.Contains(name, ".with.overflow.") {
+		return "", false, nil
+	}
+	fn := name[len("llvm."):strings.Index(name, ".with.overflow.")]
+	switch fn {
+	case "sadd", "ssub", "smul", "uadd", "usub", "umul":
+	default:
+		return "", false, nil
+	}
+	if len(inst.Args) != 2 {
+		return "", true, fmt.Errorf("wrong number of arguments to %s", name)
+	}
+
+	t := inst.Args[0].Type()
+	vt, isVector := t.(*types.VectorType)
+	if isVector {
+		t = vt.ElemType
+	}
+	it, ok := t.(*types.IntType)
+	if !ok {
+		return "", true, fmt.Errorf("unsupported type for %s: %v", name, inst.Args[0].Type())
+	}
+	helper, err := overflowHelper(fn[1:], it, fn[0] == 's')
+	if err != nil {
+		return "", true, err
+	}
+	x, err := FormatValue(inst.Args[0])
+	if err != nil {
+		return "", true, fmt.Errorf("error translating left operand (%v): %v", inst.Args[0], err)
+	}
+	y, err := FormatValue(inst.Args[1])
+	if err != nil {
+		return "", true, fmt.Errorf("error translating right operand (%v): %v", inst.Args[1], err)
+	}
+	r := VariableName(inst)
+	if isVector {
+		return fmt.Sprintf("for lane_i, lane_v := range %s { %s.F0[lane_i], %s.F1[lane_i] = %s(lane_v, %s[lane_i]) }", x, r, r, helper, y), true, nil
+	}
+	return fmt.Sprintf("%s.F0, %s.F1 = %s(%s, %s)", r, r, helper, x, y), true, nil
+}
+
+// satHelper returns the name of a helper function that does op (add or sub)
+// on integers of type it, clamping the result to the range of the type
+// instead of wrapping around.
+func satHelper(op string, it *types.IntType, signed bool) (string, error) {
+	ov, err := overflowHelper(op, it, signed)
+	if err != nil {
+		return "", err
+	}
+	t, err := TypeSpec(it)
+	if err != nil {
+		return "", err
+	}
+	bits := it.BitSize
+	kind := "s"
+	if !signed {
+		kind = "u"
+	}
+	name := fmt.Sprintf("%s%sSat%d", kind, op, bits)
+
+	var clamp string
+	switch {
+	case signed:
+		// Signed overflow goes past the end of the range on the side of x.
+		x, min, max := "x", fmt.Sprintf("-1 << %d", bits-1), fmt.Sprintf("1<<%d - 1", bits-1)
+		if bits == 8 {
+			x, min, max = "int8(x)", "0x80", "0x7f"
+		}
+		clamp = fmt.Sprintf("if %s < 0 {\n\t\t\treturn %s\n\t\t}\n\t\treturn %s", x, min, max)
+	case op == "add":
+		clamp = "return ^" + t + "(0)"
+	default:
+		clamp = "return 0"
+	}
+	src := fmt.Sprintf("func %s(x, y %s) %s {\n\tz, overflow := %s(x, y)\n\tif overflow {\n\t\t%s\n\t}\n\treturn z\n}\n", name, t, t, ov, clamp)
+	return UseHelper(name, src), nil
+}
+
+// SatArithmeticIntrinsic translates calls to llvm.sadd.sat, llvm.uadd.sat,
+// llvm.ssub.sat, and llvm.usub.sat. If name is not one of them, it returns
+// ok == false.
+func SatArithmeticIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	fn := intrinsicBase(name)
+	switch fn {
+	case "sadd", "ssub", "uadd", "usub":
+	default:
+		return "", false, nil
+	}
+	if !strings.HasPrefix(name, "llvm."+fn+".sat.") {
+		return "", false, nil
+	}
+	if len(inst.Args) != 2 {
+		return "", true, fmt.Errorf("wrong number of arguments to %s", name)
+	}
+
+	t := inst.Args[0].Type()
+	vt, isVector := t.(*types.VectorType)
+	if isVector {
+		t = vt.ElemType
+	}
+	it, ok := t.(*types.IntType)
+	if !ok {
+		return "", true, fmt.Errorf("unsupported type for %s: %v", name, inst.Args[0].Type())
+	}
+	helper, err := satHelper(fn[1:], it, fn[0] == 's')
+	if err != nil {
+		return "", true, err
+	}
+	x, err := FormatValue(inst.Args[0])
+	if err != nil {
+		return "", true, fmt.Errorf("error translating left operand (%v): %v", inst.Args[0], err)
+	}
+	y, err := FormatValue(inst.Args[1])
+	if err != nil {
+		return "", true, fmt.Errorf("error translating right operand (%v): %v", inst.Args[1], err)
+	}
+	r := VariableName(inst)
+	if isVector {
+		return fmt.Sprintf("for lane_i, lane_v := range %s { %s[lane_i] = %s(lane_v, %s[lane_i]) }", x, r, helper, y), true, nil
+	}
+	return fmt.Sprintf("%s = %s(%s, %s)", r, helper, x, y), true, nil
+}
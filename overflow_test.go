@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestOverflowIntrinsics(t *testing.T) {
+	t.Parallel()
+	// Each function is checked against math/big on values around the ends
+	// of its type's range.
+	src, checks := new(strings.Builder), new(strings.Builder)
+	for _, bits := range []int{8, 16, 32, 64} {
+		for _, op := range []string{"sadd", "ssub", "smul", "uadd", "usub", "umul"} {
+			name := fmt.Sprintf("%s%d", op, bits)
+			fmt.Fprintf(src, "declare { i%[1]d, i1 } @llvm.%[2]s.with.overflow.i%[1]d(i%[1]d, i%[1]d)\n\n", bits, op)
+			fmt.Fprintf(src, "define { i%[1]d, i1 } @%[3]s(i%[1]d %%x, i%[1]d %%y) {\n  %%r = call { i%[1]d, i1 } @llvm.%[2]s.with.overflow.i%[1]d(i%[1]d %%x, i%[1]d %%y)\n  ret { i%[1]d, i1 } %%r\n}\n\n", bits, op, name)
+			gt := fmt.Sprintf("int%d", bits)
+			if bits == 8 {
+				gt = "byte"
+			}
+			fmt.Fprintf(checks, "\tfor _, x := range values {\n\t\tfor _, y := range values {\n\t\t\tr := %s(%s(x), %s(y))\n\t\t\tcheck(%q, %d, x, y, int64(r.F0), r.F1)\n\t\t}\n\t}\n", name, gt, gt, name, bits)
+		}
+	}
+	src.WriteString(`
+declare { <2 x i32>, <2 x i1> } @llvm.uadd.with.overflow.v2i32(<2 x i32>, <2 x i32>)
+
+define { <2 x i32>, <2 x i1> } @uaddv(<2 x i32> %x, <2 x i32> %y) {
+  %r = call { <2 x i32>, <2 x i1> } @llvm.uadd.with.overflow.v2i32(<2 x i32> %x, <2 x i32> %y)
+  ret { <2 x i32>, <2 x i1> } %r
+}
+`)
+	mainSrc := `package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+var values = []int64{0, 1, 2, 3, -1, -2, 0x7f, 0x80, 0xff, 0x7fff, 0x8000, 0xffff, 0x7fffffff, -0x80000000, 0x10000, -1 << 63, 1<<63 - 1}
+
+var failures int
+
+// check compares r and overflow, the results of op on the low bits of x and
+// y, with the results of doing the operation with math/big.
+func check(name string, bits uint, x, y, r int64, overflow bool) {
+	signed := name[0] == 's'
+	operand := func(v int64) *big.Int {
+		n := new(big.Int).SetUint64(uint64(v) << (64 - bits) >> (64 - bits))
+		if signed && n.Bit(int(bits)-1) == 1 {
+			n.Sub(n, new(big.Int).Lsh(big.NewInt(1), bits))
+		}
+		return n
+	}
+	a, b := operand(x), operand(y)
+	z := new(big.Int)
+	switch name[1:4] {
+	case "add":
+		z.Add(a, b)
+	case "sub":
+		z.Sub(a, b)
+	case "mul":
+		z.Mul(a, b)
+	}
+	min, max := big.NewInt(0), new(big.Int).Lsh(big.NewInt(1), bits)
+	if signed {
+		min.Neg(new(big.Int).Lsh(big.NewInt(1), bits-1))
+		max.Lsh(big.NewInt(1), bits-1)
+	}
+	wantOverflow := z.Cmp(min) < 0 || z.Cmp(max) >= 0
+	mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits), big.NewInt(1))
+	want := new(big.Int).And(z, mask).Uint64()
+	got := uint64(r) << (64 - bits) >> (64 - bits)
+	if got != want || overflow != wantOverflow {
+		failures++
+		fmt.Println(name, a, b, "=", got, overflow, "want", want, wantOverflow)
+	}
+}
+
+func main() {
+` + checks.String() + `	fmt.Println(failures, "failures")
+	fmt.Println(uaddv([2]int32{-1, 1}, [2]int32{1, 1}))
+}
+`
+	checkProgram(t, src.String(), mainSrc, "0 failures\n{[0 2] [true false]}\n")
+}
+
+func TestSaturatingArithmetic(t *testing.T) {
+	t.Parallel()
+	// As in TestOverflowIntrinsics, each function is checked against
+	// math/big.
+	src, checks := new(strings.Builder), new(strings.Builder)
+	for _, bits := range []int{8, 16, 32, 64} {
+		for _, op := range []string{"sadd", "ssub", "uadd", "usub"} {
+			name := fmt.Sprintf("%s%d", op, bits)
+			fmt.Fprintf(src, "declare i%[1]d @llvm.%[2]s.sat.i%[1]d(i%[1]d, i%[1]d)\n\n", bits, op)
+			fmt.Fprintf(src, "define i%[1]d @%[3]s(i%[1]d %%x, i%[1]d %%y) {\n  %%r = call i%[1]d @llvm.%[2]s.sat.i%[1]d(i%[1]d %%x, i%[1]d %%y)\n  ret i%[1]d %%r\n}\n\n", bits, op, name)
+			gt := fmt.Sprintf("int%d", bits)
+			if bits == 8 {
+				gt = "byte"
+			}
+			fmt.Fprintf(checks, "\tfor _, x := range values {\n\t\tfor _, y := range values {\n\t\t\tcheck(%q, %d, x, y, int64(%s(%s(x), %s(y))))\n\t\t}\n\t}\n", name, bits, name, gt, gt)
+		}
+	}
+	src.WriteString(`
+declare <2 x i8> @llvm.usub.sat.v2i8(<2 x i8>, <2 x i8>)
+
+define <2 x i8> @usubv(<2 x i8> %x, <2 x i8> %y) {
+  %r = call <2 x i8> @llvm.usub.sat.v2i8(<2 x i8> %x, <2 x i8> %y)
+  ret <2 x i8> %r
+}
+`)
+	mainSrc := `package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+var values = []int64{0, 1, 2, -1, -2, 0x7f, 0x80, 0xff, 0x7fff, 0x8000, 0x7fffffff, -0x80000000, -1 << 63, 1<<63 - 1}
+
+var failures int
+
+// check compares r, the result of op on the low bits of x and y, with the
+// result of doing the operation with math/big and clamping it.
+func check(name string, bits uint, x, y, r int64) {
+	signed := name[0] == 's'
+	operand := func(v int64) *big.Int {
+		n := new(big.Int).SetUint64(uint64(v) << (64 - bits) >> (64 - bits))
+		if signed && n.Bit(int(bits)-1) == 1 {
+			n.Sub(n, new(big.Int).Lsh(big.NewInt(1), bits))
+		}
+		return n
+	}
+	a, b := operand(x), operand(y)
+	z := new(big.Int)
+	if name[1:4] == "add" {
+		z.Add(a, b)
+	} else {
+		z.Sub(a, b)
+	}
+	min, max := big.NewInt(0), new(big.Int).Lsh(big.NewInt(1), bits)
+	if signed {
+		min.Neg(new(big.Int).Lsh(big.NewInt(1), bits-1))
+		max.Lsh(big.NewInt(1), bits-1)
+	}
+	max.Sub(max, big.NewInt(1))
+	if z.Cmp(min) < 0 {
+		z = min
+	}
+	if z.Cmp(max) > 0 {
+		z = max
+	}
+	if got := operand(r); got.Cmp(z) != 0 {
+		failures++
+		fmt.Println(name, a, b, "=", got, "want", z)
+	}
+}
+
+func main() {
+` + checks.String() + `	fmt.Println(failures, "failures")
+	fmt.Println(usubv([2]byte{10, 10}, [2]byte{3, 30}))
+}
+`
+	checkProgram(t, src.String(), mainSrc, "0 failures\n[7 0]\n")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"sort"
+)
+
+// With -override, functions can be ported by hand while the rest of the
+// module is still translated automatically. An override file is a Go source
+// file (usually with a "//go:build ignore" line, so that it isn't compiled
+// along with the rest of the package). Each function declared in it replaces
+// leaven's translation of the function with the same Go name, or stands in for
+// one that leaven can't translate at all. (With -instance, they should be
+// methods on *State.)
+
+// overrides maps Go function names to the source of the hand-written
+// functions that replace them.
+var overrides = make(map[string]string)
+
+// overrideUsed records which overrides have been spliced into the output.
+var overrideUsed = make(map[string]bool)
+
+// LoadOverrides reads the function declarations from the Go source file file.
+func LoadOverrides(file string) error {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, src, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	for _, d := range f.Decls {
+		fd, ok := d.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		name := fd.Name.Name
+		if _, dup := overrides[name]; dup {
+			return fmt.Errorf("%v: duplicate override for %s", fset.Position(fd.Pos()), name)
+		}
+		start := fd.Pos()
+		if fd.Doc != nil {
+			start = fd.Doc.Pos()
+		}
+		overrides[name] = string(src[fset.Position(start).Offset:fset.Position(fd.End()).Offset])
+	}
+	return nil
+}
+
+// Override returns the hand-written replacement for the function whose Go name
+// is name, if there is one.
+func Override(name string) (string, bool) {
+	src, ok := overrides[name]
+	if ok {
+		overrideUsed[name] = true
+	}
+	return src, ok
+}
+
+// UnusedOverrides returns the names of the overrides that didn't match any
+// function in the module.
+func UnusedOverrides() []string {
+	var names []string
+	for name := range overrides {
+		if !overrideUsed[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOverride(t *testing.T) {
+	t.Parallel()
+	overrideSrc := `//go:build ignore
+
+package main
+
+// good is written by hand.
+func good(x int32) int32 {
+	return x * 100
+}
+
+func bad2(x int32) int32 {
+	return -x
+}
+
+func missing() {}
+`
+	code, output, ok := runLeaven(t, partlyUnsupported, map[string]string{"override.go": overrideSrc}, "-override=override.go", "-color=never")
+	if ok {
+		t.Fatal("leaven succeeded; want an error for bad1")
+	}
+	if !strings.Contains(output, "1 errors (in 1 functions)") {
+		t.Errorf("output doesn't report the error in bad1 alone:\n%s", output)
+	}
+	if strings.Contains(output, "@bad2") {
+		t.Errorf("output reports an error in the overridden bad2:\n%s", output)
+	}
+	if !strings.Contains(output, "warning: override for missing doesn't match any function") {
+		t.Errorf("output doesn't warn about the unused override:\n%s", output)
+	}
+	if !strings.Contains(code, "// good is written by hand.\nfunc good(") {
+		t.Errorf("doc comment not kept:\n%s", numberLines(code))
+	}
+	if strings.Contains(code, "func missing") {
+		t.Errorf("unused override included:\n%s", numberLines(code))
+	}
+	if got, want := runGo(t, code, mainCalling("good(3)", "bad2(4)")), "300\n-4\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
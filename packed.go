@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+)
+
+// In a packed struct (<{ ... }>), the fields have no padding between them, so
+// they may not be aligned, and the struct itself has an alignment of 1. Go
+// can't put a field at an offset that isn't a multiple of its alignment, so
+// such fields are declared as byte arrays of the same size, and accessed
+// through pointer conversions. A field that is aligned stays as it is, unless
+// that would make Go round the size of the struct up (because it would raise
+// the struct's alignment). That way the Go struct has the same size and field
+// offsets as the LLVM struct, as long as each field's Go type is the same size
+// as its LLVM type.
+//
+// A pointer in a byte array is invisible to the garbage collector, so a
+// warning is printed for each struct that needs one.
+
+// misalignedCache caches the results of misalignedFields, keyed by the LLVM
+// name or definition of the struct type.
+var misalignedCache = make(map[string][]bool)
+
+// misalignedFields reports which fields of t are stored as byte arrays. If
+// none of them are, it returns nil.
+func misalignedFields(t *types.StructType) []bool {
+	if !t.Packed {
+		return nil
+	}
+	key := t.String()
+	if m, ok := misalignedCache[key]; ok {
+		return m
+	}
+	misalignedCache[key] = nil
+	offsets, size, _, err := structLayout(t)
+	if err != nil {
+		// Leave the layout up to Go.
+		return nil
+	}
+	var m []bool
+	for i, f := range t.Fields {
+		_, align, err := arenaLayout(f)
+		if err != nil {
+			return nil
+		}
+		if offsets[i]%align != 0 || size%align != 0 {
+			if m == nil {
+				m = make([]bool, len(t.Fields))
+			}
+			m[i] = true
+			if containsPointer(f) {
+				Warnings = append(Warnings, fmt.Sprintf("%v has a misaligned pointer field, which the garbage collector won't see", t))
+			}
+		}
+	}
+	misalignedCache[key] = m
+	return m
+}
+
+// containsPointer reports whether a value of type t contains a pointer.
+func containsPointer(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.PointerType:
+		return true
+	case *types.ArrayType:
+		return containsPointer(t.ElemType)
+	case *types.VectorType:
+		return containsPointer(t.ElemType)
+	case *types.StructType:
+		for _, f := range t.Fields {
+			if containsPointer(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isMisaligned reports whether field i of t is stored as a byte array.
+func isMisaligned(t *types.StructType, i int) bool {
+	m := misalignedFields(t)
+	return m != nil && m[i]
+}
+
+// misalignedFieldDefinition returns the definition of field i of t, which is
+// stored as a byte array, with a comment giving its real type.
+func misalignedFieldDefinition(t *types.StructType, i int) (string, error) {
+	size, _, err := arenaLayout(t.Fields[i])
+	if err != nil {
+		return "", err
+	}
+	ft, err := TypeSpec(t.Fields[i])
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("[%d]byte // %s", size, ft), nil
+}
+
+// misalignedFieldPointer returns a pointer to field i of x (an addressable
+// struct of type t), which is stored as a byte array, converted to a pointer
+// to its real type.
+func misalignedFieldPointer(x string, t *types.StructType, i int) (string, error) {
+	ft, err := TypeSpec(t.Fields[i])
+	if err != nil {
+		return "", fmt.Errorf("error translating type of field %d (%v): %v", i, t.Fields[i], err)
+	}
+	return fmt.Sprintf("(*%s)(unsafe.Pointer(&%s.F%d))", ft, x, i), nil
+}
+
+// misalignedPath reports whether the value at indices in an aggregate of type
+// t (as used by extractvalue) is in a misaligned field, or in an aggregate
+// that is.
+func misalignedPath(t types.Type, indices []uint64) bool {
+	for _, index := range indices {
+		switch ct := t.(type) {
+		case *types.StructType:
+			if index >= uint64(len(ct.Fields)) {
+				return false
+			}
+			if isMisaligned(ct, int(index)) {
+				return true
+			}
+			t = ct.Fields[index]
+		case *types.ArrayType:
+			t = ct.ElemType
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// packedStructLiteral formats the constant c (of a packed struct type with
+// misaligned fields) as a function literal that fills in the fields, since a
+// composite literal can't convert them to bytes. Its result is called
+// packed_v, which is reserved, so that no name in the field values refers to
+// it.
+func packedStructLiteral(c *constant.Struct, t string) (string, error) {
+	st := c.Typ
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "func() (packed_v %s) {", t)
+	for i, f := range c.Fields {
+		e, err := FormatValue(f)
+		if err != nil {
+			return "", fmt.Errorf("error translating field %d (%v): %v", i, f, err)
+		}
+		if !isMisaligned(st, i) {
+			fmt.Fprintf(b, " packed_v.F%d = %s;", i, e)
+			continue
+		}
+		p, err := misalignedFieldPointer("packed_v", st, i)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(b, " *%s = %s;", p, e)
+	}
+	b.WriteString(" return }()")
+	return b.String(), nil
+}
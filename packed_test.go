@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const packedSource = `
+%rec = type <{ i8, i32, i16 }>
+
+; The global called packed_v doesn't clash with the name the translation of
+; the packed struct constants uses.
+@s = global %rec <{ i8 1, i32 100000, i16 -2 }>
+@packed_v = global i32 5
+
+define i32 @fromGlobal() {
+  %p = getelementptr %rec, %rec* @s, i32 0, i32 1
+  %x = load i32, i32* %p
+  %q = getelementptr %rec, %rec* @s, i32 0, i32 2
+  %y = load i16, i16* %q
+  %y32 = sext i16 %y to i32
+  %r = add i32 %x, %y32
+  ret i32 %r
+}
+
+define i32 @fromConstant() {
+  %x = extractvalue %rec <{ i8 7, i32 1000, i16 3 }>, 1
+  %y = extractvalue %rec <{ i8 7, i32 40, i16 3 }>, 2
+  %y32 = zext i16 %y to i32
+  %r = add i32 %x, %y32
+  ret i32 %r
+}
+
+define i32 @fromValue(%rec* %p, i32 %n) {
+  %v = load %rec, %rec* %p
+  %w = insertvalue %rec %v, i32 %n, 1
+  store %rec %w, %rec* %p
+  %x = extractvalue %rec %w, 1
+  %b = extractvalue %rec %w, 0
+  %b32 = zext i8 %b to i32
+  %r = add i32 %x, %b32
+  ret i32 %r
+}
+`
+
+func TestPackedStructs(t *testing.T) {
+	t.Parallel()
+	mainSrc := `package main
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+func main() {
+	fmt.Println(unsafe.Sizeof(s), unsafe.Offsetof(s.F2), fromGlobal(), fromConstant())
+	fmt.Println(fromValue(&s, 12345), fromGlobal(), _packed_v)
+}
+`
+	want := "7 5 99998 1003\n12346 12343 5\n"
+	for _, flags := range [][]string{nil, {"-inline"}} {
+		code, _ := translate(t, packedSource, flags...)
+		if strings.Contains(code, "}().F") {
+			t.Errorf("leaven %s: field of a function call's result is addressed:\n%s", strings.Join(flags, " "), numberLines(code))
+		}
+		if got := runGo(t, code, mainSrc); got != want {
+			t.Errorf("leaven %s: output: %q, want %q\ngenerated code:\n%s", strings.Join(flags, " "), got, want, numberLines(code))
+		}
+	}
+}
+
+func TestPackedPointerWarning(t *testing.T) {
+	t.Parallel()
+	src := `
+%node = type <{ i8, %node* }>
+
+define %node* @next(%node* %n) {
+  %p = getelementptr %node, %node* %n, i32 0, i32 1
+  %r = load %node*, %node** %p
+  ret %node* %r
+}
+`
+	code, output := translate(t, src, "-color=never")
+	if n := strings.Count(output, "misaligned pointer field"); n != 1 {
+		t.Errorf("%d warnings about the misaligned pointer, want 1:\n%s", n, output)
+	}
+	vetGo(t, code, "")
+}
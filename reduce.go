@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/types"
+)
+
+// reductionOps gives the operators (as assignment operators, like "+=") and
+// the identity values for the vector reductions that combine the elements
+// with arithmetic. The floating-point reductions have a start value instead
+// of an identity.
+var reductionOps = map[string]struct{ op, identity string }{
+	"add":  {"+=", "0"},
+	"and":  {"&=", "^%s(0)"},
+	"fadd": {"+=", ""},
+	"fmul": {"*=", ""},
+	"mul":  {"*=", "1"},
+	"or":   {"|=", "0"},
+	"xor":  {"^=", "0"},
+}
+
+// boolReductionOps gives the expressions (in terms of the result so far and
+// the element v) and identity values for the reductions of vectors of i1,
+// which are translated as bool.
+var boolReductionOps = map[string]struct{ expr, identity string }{
+	"add": {"%s != lane_v", "false"},
+	"and": {"%s && lane_v", "true"},
+	"or":  {"%s || lane_v", "false"},
+	"xor": {"%s != lane_v", "false"},
+}
+
+// reductionName returns the operation done by the vector reduction
+// intrinsic called name (such as "add" for llvm.vector.reduce.add.v4i32),
+// or the empty string if name isn't a vector reduction.
+func reductionName(name string) string {
+	for _, prefix := range []string{"llvm.vector.reduce.", "llvm.experimental.vector.reduce.v2.", "llvm.experimental.vector.reduce."} {
+		if strings.HasPrefix(name, prefix) {
+			name = name[len(prefix):]
+			if i := strings.Index(name, "."); i != -1 {
+				name = name[:i]
+			}
+			return name
+		}
+	}
+	return ""
+}
+
+// ReduceIntrinsic translates calls to the vector reduction intrinsics, as
+// loops over the elements of the vector. If name is not one of them, it
+// returns ok == false.
+func ReduceIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	op := reductionName(name)
+	if op == "" {
+		return "", false, nil
+	}
+	args := inst.Args
+	var start string
+	if op == "fadd" || op == "fmul" {
+		// The floating-point sums and products start with a value of their
+		// own, and add the elements in order.
+		if len(args) != 2 {
+			return "", true, fmt.Errorf("wrong number of arguments to %s: %d", name, len(args))
+		}
+		start, err = FormatValue(args[0])
+		if err != nil {
+			return "", true, fmt.Errorf("error translating start value (%v): %v", args[0], err)
+		}
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return "", true, fmt.Errorf("wrong number of arguments to %s: %d", name, len(inst.Args))
+	}
+	vt, ok := args[0].Type().(*types.VectorType)
+	if !ok || isHalf(vt.ElemType) {
+		// The elements of half vectors are only their bits.
+		return "", true, fmt.Errorf("unsupported type for %s: %v", name, args[0].Type())
+	}
+	x, err := FormatValue(args[0])
+	if err != nil {
+		return "", true, fmt.Errorf("error translating vector (%v): %v", args[0], err)
+	}
+	r := VariableName(inst)
+	t, err := TypeSpec(vt.ElemType)
+	if err != nil {
+		return "", true, fmt.Errorf("error translating type (%v): %v", vt.ElemType, err)
+	}
+	it, isInt := vt.ElemType.(*types.IntType)
+
+	if isInt && it.BitSize == 1 {
+		bo, ok := boolReductionOps[op]
+		if !ok {
+			return "", true, fmt.Errorf("unsupported type for %s: %v", name, args[0].Type())
+		}
+		return fmt.Sprintf("%s = %s; for _, lane_v := range %s { %s = %s }", r, bo.identity, x, r, fmt.Sprintf(bo.expr, r)), true, nil
+	}
+
+	if ro, ok := reductionOps[op]; ok {
+		init := start
+		if ro.identity != "" {
+			if !isInt {
+				return "", true, fmt.Errorf("unsupported type for %s: %v", name, args[0].Type())
+			}
+			init = ro.identity
+			if strings.Contains(init, "%s") {
+				init = fmt.Sprintf(init, t)
+			}
+		}
+		return fmt.Sprintf("%s = %s; for _, lane_v := range %s { %s %s lane_v }", r, init, x, r, ro.op), true, nil
+	}
+
+	// The rest choose one of the elements.
+	var cond string
+	switch op {
+	case "smax", "smin", "umax", "umin":
+		if !isInt {
+			return "", true, fmt.Errorf("unsupported type for %s: %v", name, args[0].Type())
+		}
+		v, cur := signedElem(it, "lane_v"), signedElem(it, r)
+		if op[0] == 'u' {
+			v, cur = unsignedElem(it, "lane_v"), unsignedElem(it, r)
+		}
+		cond = fmt.Sprintf("%s %s %s", v, intMinMax[op].op, cur)
+	case "fmax", "fmin":
+		// Like llvm.maxnum and llvm.minnum, these ignore NaNs.
+		cmp := ">"
+		if op == "fmin" {
+			cmp = "<"
+		}
+		cond = fmt.Sprintf("lane_v %s %s || %s != %s", cmp, r, r, r)
+	default:
+		return "", true, fmt.Errorf("unsupported vector reduction: %s", name)
+	}
+	return fmt.Sprintf("%s = %s[0]; for _, lane_v := range %s { if %s { %s = lane_v } }", r, parenthesize(x), x, cond, r), true, nil
+}
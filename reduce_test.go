@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestVectorReductions(t *testing.T) {
+	t.Parallel()
+	src := new(strings.Builder)
+	var exprs []string
+	for _, op := range []string{"add", "mul", "and", "or", "xor", "smax", "smin", "umax", "umin"} {
+		fmt.Fprintf(src, "declare i32 @llvm.vector.reduce.%[1]s.v4i32(<4 x i32>)\n\n", op)
+		fmt.Fprintf(src, "define i32 @reduce_%[1]s(<4 x i32> %%x) {\n  %%r = call i32 @llvm.vector.reduce.%[1]s.v4i32(<4 x i32> %%x)\n  ret i32 %%r\n}\n\n", op)
+		exprs = append(exprs, fmt.Sprintf("reduce_%s([4]int32{3, -6, 5, 12})", op))
+	}
+	src.WriteString(`
+declare i8 @llvm.vector.reduce.umax.v4i8(<4 x i8>)
+declare i8 @llvm.vector.reduce.smax.v4i8(<4 x i8>)
+declare i1 @llvm.vector.reduce.and.v3i1(<3 x i1>)
+declare i1 @llvm.vector.reduce.or.v3i1(<3 x i1>)
+declare i1 @llvm.vector.reduce.xor.v3i1(<3 x i1>)
+declare float @llvm.vector.reduce.fadd.v4f32(float, <4 x float>)
+declare double @llvm.vector.reduce.fmul.v2f64(double, <2 x double>)
+declare float @llvm.vector.reduce.fmax.v4f32(<4 x float>)
+declare i32 @llvm.experimental.vector.reduce.add.v2i32(<2 x i32>)
+
+define i8 @bytes(<4 x i8> %x) {
+  %u = call i8 @llvm.vector.reduce.umax.v4i8(<4 x i8> %x)
+  %s = call i8 @llvm.vector.reduce.smax.v4i8(<4 x i8> %x)
+  %r = sub i8 %u, %s
+  ret i8 %r
+}
+
+define i32 @bools(<3 x i1> %x) {
+  %a = call i1 @llvm.vector.reduce.and.v3i1(<3 x i1> %x)
+  %o = call i1 @llvm.vector.reduce.or.v3i1(<3 x i1> %x)
+  %x1 = call i1 @llvm.vector.reduce.xor.v3i1(<3 x i1> %x)
+  %a32 = zext i1 %a to i32
+  %o32 = zext i1 %o to i32
+  %x32 = zext i1 %x1 to i32
+  %ao = mul i32 %a32, 100
+  %oo = mul i32 %o32, 10
+  %s = add i32 %ao, %oo
+  %r = add i32 %s, %x32
+  ret i32 %r
+}
+
+define float @sum(<4 x float> %x) {
+  %r = call float @llvm.vector.reduce.fadd.v4f32(float 0.5, <4 x float> %x)
+  ret float %r
+}
+
+define double @product(<2 x double> %x) {
+  %r = call double @llvm.vector.reduce.fmul.v2f64(double 3.0, <2 x double> %x)
+  ret double %r
+}
+
+define float @largest(<4 x float> %x) {
+  %r = call float @llvm.vector.reduce.fmax.v4f32(<4 x float> %x)
+  ret float %r
+}
+
+define i32 @oldName(<2 x i32> %x) {
+  %r = call i32 @llvm.experimental.vector.reduce.add.v2i32(<2 x i32> %x)
+  ret i32 %r
+}
+`)
+	exprs = append(exprs,
+		"bytes([4]byte{1, 0x90, 0x7f, 2})",
+		"bools([3]bool{true, false, true}), bools([3]bool{true, true, true})",
+		"sum([4]float32{1, 2, 3, 4})",
+		"product([2]float64{2, 0.25})",
+		"largest([4]float32{float32(math.NaN()), 2, 7, -1})",
+		"oldName([2]int32{40, 2})",
+	)
+	mainSrc := strings.Replace(mainCalling(exprs...), `import "fmt"`, "import (\n\t\"fmt\"\n\t\"math\"\n)", 1)
+	want := "14\n-1080\n0\n-1\n-16\n12\n-6\n-6\n3\n" +
+		"17\n" +
+		"10 111\n" +
+		"10.5\n1.5\n7\n42\n"
+	checkProgram(t, src.String(), mainSrc, want)
+}
+
+func TestVectorReductionErrors(t *testing.T) {
+	t.Parallel()
+	src := `
+declare i1 @llvm.vector.reduce.smax.v4i1(<4 x i1>)
+
+define i1 @boolMax(<4 x i1> %x) {
+  %r = call i1 @llvm.vector.reduce.smax.v4i1(<4 x i1> %x)
+  ret i1 %r
+}
+`
+	output := translateError(t, src, "-color=never")
+	if !strings.Contains(output, "unsupported type for llvm.vector.reduce.smax.v4i1") {
+		t.Errorf("output doesn't report the unsupported reduction:\n%s", output)
+	}
+}
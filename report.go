@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/metadata"
+)
+
+// With -report=html, leaven writes an HTML page next to the generated code,
+// showing how far the translation got for each function: whether it
+// translated cleanly, which constructs it couldn't handle, and how much of it
+// uses package unsafe. The generated Go and the C source files (when they can
+// be found through the debug info) are included with line anchors, so that
+// each function links to its translation and its original source. It is meant
+// for people splitting up the work of porting a large library.
+
+// A FuncReport summarizes the translation of one function.
+type FuncReport struct {
+	Name   string // the LLVM name, without the @
+	GoName string
+
+	Statements int
+	Unsafe     int
+	Errors     []ReportError
+	Overridden bool // replaced by a hand-written function from -override
+
+	GoLine  int // line of the func declaration in the output, or 0
+	IRLine  int // line of the definition in the input, or 0
+	Source  *ReportSource
+	SrcLine int // line in Source where the function starts, or 0
+}
+
+// A ReportError is a construct that couldn't be translated.
+type ReportError struct {
+	Message string
+	IR      string
+	IRLine  int
+	Source  *ReportSource
+	SrcLine int
+}
+
+// A ReportSource is a C source file that the report links to.
+type ReportSource struct {
+	Name   string
+	Anchor string
+	Lines  []string
+}
+
+// A ModuleReport collects the information for -report as the module is
+// translated.
+type ModuleReport struct {
+	Input     string
+	Output    string
+	Funcs     []*FuncReport
+	GoLines   []string
+	Sources   []*ReportSource
+	sourceMap map[string]*ReportSource
+
+	diagnostics *Diagnostics
+}
+
+// Report is the report being assembled, or nil if none was requested.
+var Report *ModuleReport
+
+// NewModuleReport returns a ModuleReport for the translation of input into
+// output. d is used to find the IR and C source lines that errors refer to.
+func NewModuleReport(input, output string, d *Diagnostics) *ModuleReport {
+	return &ModuleReport{
+		Input:       input,
+		Output:      output,
+		sourceMap:   make(map[string]*ReportSource),
+		diagnostics: d,
+	}
+}
+
+// AddFunc records the translation of f. statements and unsafe are the number
+// of statements generated for it and how many of them use package unsafe;
+// errs are the errors encountered while translating it.
+func (r *ModuleReport) AddFunc(f *ir.Func, statements, unsafe int, errs []*TranslationError) {
+	fr := &FuncReport{
+		Name:       f.Name(),
+		GoName:     VariableName(f),
+		Statements: statements,
+		Unsafe:     unsafe,
+		IRLine:     r.diagnostics.findIRLine(&TranslationError{fn: f}) + 1,
+	}
+	if isMainFunc(f) {
+		fr.GoName = "main"
+	}
+	if sp, ok := attachment(f.Metadata, "dbg").(*metadata.DISubprogram); ok && sp.File != nil {
+		fr.Source = r.source(sp.File)
+		fr.SrcLine = int(sp.Line)
+	}
+	for _, e := range errs {
+		re := ReportError{
+			Message: e.Err.Error(),
+			IR:      strings.TrimSpace(e.Source),
+			IRLine:  r.diagnostics.findIRLine(e) + 1,
+		}
+		if dl := debugLocation(e.node); dl != nil {
+			if file := scopeFile(dl.Scope); file != nil {
+				re.Source = r.source(file)
+				re.SrcLine = int(dl.Line)
+			}
+		}
+		fr.Errors = append(fr.Errors, re)
+	}
+	r.Funcs = append(r.Funcs, fr)
+}
+
+// AddOverride records that f was replaced by a hand-written function.
+func (r *ModuleReport) AddOverride(f *ir.Func) {
+	r.AddFunc(f, 0, 0, nil)
+	r.Funcs[len(r.Funcs)-1].Overridden = true
+}
+
+// source returns the ReportSource for file, reading it if this is the first
+// reference to it.
+func (r *ModuleReport) source(file *metadata.DIFile) *ReportSource {
+	name := sourcePath(file)
+	if s, ok := r.sourceMap[name]; ok {
+		return s
+	}
+	s := &ReportSource{
+		Name:   file.Filename,
+		Anchor: fmt.Sprintf("src%d", len(r.Sources)),
+		Lines:  r.diagnostics.sourceLines(name),
+	}
+	r.sourceMap[name] = s
+	r.Sources = append(r.Sources, s)
+	return s
+}
+
+var funcDecl = regexp.MustCompile(`^func (?:\([^)]*\) )?(\w+)\(`)
+
+// Write reads the generated code back in, to find the lines where the
+// functions start, and writes the report to file.
+func (r *ModuleReport) Write(file string) error {
+	data, err := ioutil.ReadFile(r.Output)
+	if err != nil {
+		return err
+	}
+	r.GoLines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	funcLines := make(map[string]int)
+	for i, line := range r.GoLines {
+		if m := funcDecl.FindStringSubmatch(line); m != nil {
+			funcLines[m[1]] = i + 1
+		}
+	}
+	for _, f := range r.Funcs {
+		f.GoLine = funcLines[f.GoName]
+	}
+
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := reportTemplate.Execute(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Translated returns the number of functions that were translated without
+// errors.
+func (r *ModuleReport) Translated() int {
+	n := 0
+	for _, f := range r.Funcs {
+		if len(f.Errors) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Statements returns the total number of statements generated.
+func (r *ModuleReport) Statements() int {
+	n := 0
+	for _, f := range r.Funcs {
+		n += f.Statements
+	}
+	return n
+}
+
+// Unsafe returns the number of statements that use package unsafe.
+func (r *ModuleReport) Unsafe() int {
+	n := 0
+	for _, f := range r.Funcs {
+		n += f.Unsafe
+	}
+	return n
+}
+
+// A ConstructCount is the number of times a particular error occurred.
+type ConstructCount struct {
+	Message string
+	Count   int
+}
+
+// Unsupported returns the errors in the report, with the number of times each
+// one occurred, most frequent first.
+func (r *ModuleReport) Unsupported() []ConstructCount {
+	counts := make(map[string]int)
+	for _, f := range r.Funcs {
+		for _, e := range f.Errors {
+			counts[e.Message]++
+		}
+	}
+	list := make([]ConstructCount, 0, len(counts))
+	for m, n := range counts {
+		list = append(list, ConstructCount{m, n})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Message < list[j].Message
+	})
+	return list
+}
+
+// OutputName returns the base name of the generated file.
+func (r *ModuleReport) OutputName() string {
+	return filepath.Base(r.Output)
+}
+
+// checkReportFormat returns an error if format is not a valid value for the
+// -report flag.
+func checkReportFormat(format string) error {
+	switch format {
+	case "", "html":
+		return nil
+	}
+	return fmt.Errorf("invalid value for -report: %q (want html)", format)
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": func(n, total int) string {
+		if total == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+	},
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>leaven report: {{.Input}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; vertical-align: top; }
+td.num { text-align: right; }
+tr.ok td.status { color: #080; }
+tr.failed td.status { color: #c00; }
+ul.errors { margin: 0; padding-left: 1.2em; }
+code.ir { color: #555; }
+pre { background: #f6f6f6; padding: 0.5em; overflow-x: auto; }
+pre span { display: block; }
+pre span:target { background: #ff8; }
+pre a.ln { color: #999; display: inline-block; width: 4em; text-decoration: none; }
+</style>
+</head>
+<body>
+<h1>Translation of {{.Input}}</h1>
+<p>{{.Translated}} of {{len .Funcs}} functions translated without errors.
+{{.Unsafe}} of {{.Statements}} statements ({{percent .Unsafe .Statements}}) use package unsafe.</p>
+{{with .Unsupported}}
+<h2>Unsupported constructs</h2>
+<table>
+{{range .}}<tr><td class="num">{{.Count}}</td><td>{{.Message}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Functions</h2>
+
+<table>
+<tr><th>Function</th><th>Status</th><th>Statements</th><th>Unsafe</th><th>Go</th><th>Source</th><th>Unsupported</th></tr>
+{{range .Funcs}}
+<tr id="fn-{{.Name}}" class="{{if .Errors}}failed{{else}}ok{{end}}">
+<td><code>@{{.Name}}</code>{{if .IRLine}} <small>({{$.Input}}:{{.IRLine}})</small>{{end}}</td>
+<td class="status">{{if .Errors}}{{len .Errors}} errors{{else if .Overridden}}overridden{{else}}ok{{end}}</td>
+<td class="num">{{.Statements}}</td>
+<td class="num">{{.Unsafe}} <small>({{percent .Unsafe .Statements}})</small></td>
+<td>{{if .GoLine}}<a href="#go-L{{.GoLine}}">{{.GoName}}</a>{{else}}{{.GoName}}{{end}}</td>
+<td>{{if .Source}}<a href="#{{.Source.Anchor}}-L{{.SrcLine}}">{{.Source.Name}}:{{.SrcLine}}</a>{{end}}</td>
+<td>{{if .Errors}}<ul class="errors">{{range .Errors}}
+<li>{{.Message}}<br><code class="ir">{{.IR}}</code>{{if .IRLine}} <small>({{$.Input}}:{{.IRLine}})</small>{{end}}{{if .Source}} <a href="#{{.Source.Anchor}}-L{{.SrcLine}}">{{.Source.Name}}:{{.SrcLine}}</a>{{end}}</li>{{end}}
+</ul>{{end}}</td>
+</tr>
+{{end}}
+</table>
+
+<h2 id="go">{{.OutputName}}</h2>
+<pre>{{range $i, $line := .GoLines}}<span id="go-L{{inc $i}}"><a class="ln" href="#go-L{{inc $i}}">{{inc $i}}</a>{{$line}}</span>{{end}}</pre>
+
+{{range .Sources}}
+<h2 id="{{.Anchor}}">{{.Name}}</h2>
+{{if .Lines}}<pre>{{$src := .}}{{range $i, $line := .Lines}}<span id="{{$src.Anchor}}-L{{inc $i}}"><a class="ln" href="#{{$src.Anchor}}-L{{inc $i}}">{{inc $i}}</a>{{$line}}</span>{{end}}</pre>
+{{else}}<p>(The source file could not be read.)</p>{{end}}
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "leaven-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := strings.Replace(diagnosticsSource, "\n!llvm.dbg.cu", `
+define i32 @g(i32 %x) {
+  %y = mul i32 %x, 2
+  ret i32 %y
+}
+
+!llvm.dbg.cu`, 1)
+	outFile := filepath.Join(dir, "out.go")
+	_, output, ok := runLeaven(t, src, map[string]string{"f.c": diagnosticsC}, "-report=html", "-o="+outFile)
+	if ok {
+		t.Fatal("leaven succeeded; want an error")
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "out.html"))
+	if err != nil {
+		t.Fatalf("reading report: %v\n%s", err, output)
+	}
+	report := string(b)
+	for _, s := range []string{
+		"1 of 2 functions translated without errors.",
+		`<tr id="fn-f" class="failed">`,
+		`<tr id="fn-g" class="ok">`,
+		"<code class=\"ir\">%a = alloca &lt;vscale x 4 x i32&gt;",
+		`<h2 id="go">out.go</h2>`,
+		"svint32_t a;",
+	} {
+		if !strings.Contains(report, s) {
+			t.Errorf("report doesn't contain %q:\n%s", s, report)
+		}
+	}
+
+	// The Go code the report describes is still usable.
+	code, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := runGo(t, string(code), mainCalling("g(21)")); got != "42\n" {
+		t.Errorf("output: %q, want %q", got, "42\n")
+	}
+}
+
+func TestReportFormat(t *testing.T) {
+	t.Parallel()
+	output := translateError(t, "", "-report=pdf")
+	if !strings.Contains(output, "pdf") {
+		t.Errorf("error doesn't mention the format: %s", output)
+	}
+}
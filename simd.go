@@ -0,0 +1,382 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+)
+
+// Architecture-specific SIMD intrinsics (llvm.x86.*, llvm.aarch64.neon.*, and
+// llvm.arm.neon.*) show up in C libraries that use <emmintrin.h> or
+// <arm_neon.h> directly. Since vectors are translated as arrays, the ones
+// leaven knows about are lowered to loops that handle one lane at a time.
+// With -simd=error, they are reported as errors instead, for people who would
+// rather port the vectorized code by hand.
+
+// laneTypes describes the Go types used for the elements of a vector.
+type laneTypes struct {
+	elem     string // the element type itself
+	signed   string // the element type, viewed as signed
+	unsigned string // the element type, viewed as unsigned
+}
+
+// convert returns x (an expression of type from) converted to type to.
+func convert(to, from, x string) string {
+	if to == from {
+		return x
+	}
+	return fmt.Sprintf("%s(%s)", to, x)
+}
+
+// A simdOp generates the statement that computes a lane of the result r from
+// the corresponding lanes of the operands x and y.
+type simdOp func(lt laneTypes, r, x, y string) string
+
+func laneMax(signed, greater bool) simdOp {
+	op := "<"
+	if greater {
+		op = ">"
+	}
+	return func(lt laneTypes, r, x, y string) string {
+		view := lt.unsigned
+		if signed {
+			view = lt.signed
+		}
+		return fmt.Sprintf("if %s %s %s { %s = %s } else { %s = %s }", convert(view, lt.elem, x), op, convert(view, lt.elem, y), r, x, r, y)
+	}
+}
+
+func laneAbs(lt laneTypes, r, x, y string) string {
+	return fmt.Sprintf("if %s < 0 { %s = -%s } else { %s = %s }", convert(lt.signed, lt.elem, x), r, x, r, x)
+}
+
+func laneAvg(lt laneTypes, r, x, y string) string {
+	return fmt.Sprintf("%s = %s((uint32(%s) + uint32(%s) + 1) >> 1)", r, lt.elem, convert(lt.unsigned, lt.elem, x), convert(lt.unsigned, lt.elem, y))
+}
+
+func laneSqrt(lt laneTypes, r, x, y string) string {
+	return fmt.Sprintf("%s = %s(math.Sqrt(float64(%s)))", r, lt.elem, x)
+}
+
+func laneRcp(lt laneTypes, r, x, y string) string {
+	return fmt.Sprintf("%s = 1 / %s", r, x)
+}
+
+func laneRsqrt(lt laneTypes, r, x, y string) string {
+	return fmt.Sprintf("%s = %s(1 / math.Sqrt(float64(%s)))", r, lt.elem, x)
+}
+
+// laneSat adds or subtracts with saturation, working in int32 since the x86
+// instructions only saturate 8- and 16-bit lanes.
+func laneSat(signed, sub bool) simdOp {
+	op := "+"
+	if sub {
+		op = "-"
+	}
+	return func(lt laneTypes, r, x, y string) string {
+		view := lt.unsigned
+		if signed {
+			view = lt.signed
+		}
+		bits := uint(8)
+		if view == "int16" || view == "uint16" {
+			bits = 16
+		}
+		max, min := int64(1)<<bits-1, int64(0)
+		if signed {
+			max, min = int64(1)<<(bits-1)-1, -int64(1)<<(bits-1)
+		}
+		return fmt.Sprintf("{ sat_s := int32(%s) %s int32(%s); if sat_s > %d { sat_s = %d } else if sat_s < %d { sat_s = %d }; %s = %s(sat_s) }", convert(view, lt.elem, x), op, convert(view, lt.elem, y), max, max, min, min, r, lt.elem)
+	}
+}
+
+// laneShift shifts by a scalar count. The x86 instructions fill the lane with
+// zeros (or copies of the sign bit) when the count is at least the lane
+// width, which is what Go's shifts do too.
+func laneShift(op string, signed bool) simdOp {
+	return func(lt laneTypes, r, x, y string) string {
+		view := lt.unsigned
+		if signed {
+			view = lt.signed
+		}
+		return fmt.Sprintf("%s = %s(%s %s uint32(%s))", r, lt.elem, convert(view, lt.elem, x), op, y)
+	}
+}
+
+func laneFloatMax(fn string) simdOp {
+	return func(lt laneTypes, r, x, y string) string {
+		return fmt.Sprintf("%s = %s(math.%s(float64(%s), float64(%s)))", r, lt.elem, fn, x, y)
+	}
+}
+
+// simdIntrinsics maps intrinsic names to the operations they perform on each
+// lane. Names that are overloaded on the vector type (like
+// llvm.aarch64.neon.smax.v4i32) are listed without the type suffix.
+var simdIntrinsics = map[string]simdOp{
+	"llvm.x86.sse2.pmaxs.w":     laneMax(true, true),
+	"llvm.x86.sse2.pmins.w":     laneMax(true, false),
+	"llvm.x86.sse2.pmaxu.b":     laneMax(false, true),
+	"llvm.x86.sse2.pminu.b":     laneMax(false, false),
+	"llvm.x86.sse41.pmaxsb":     laneMax(true, true),
+	"llvm.x86.sse41.pmaxsd":     laneMax(true, true),
+	"llvm.x86.sse41.pminsb":     laneMax(true, false),
+	"llvm.x86.sse41.pminsd":     laneMax(true, false),
+	"llvm.x86.sse41.pmaxuw":     laneMax(false, true),
+	"llvm.x86.sse41.pmaxud":     laneMax(false, true),
+	"llvm.x86.sse41.pminuw":     laneMax(false, false),
+	"llvm.x86.sse41.pminud":     laneMax(false, false),
+	"llvm.x86.sse2.pavg.b":      laneAvg,
+	"llvm.x86.sse2.pavg.w":      laneAvg,
+	"llvm.x86.ssse3.pabs.b.128": laneAbs,
+	"llvm.x86.ssse3.pabs.w.128": laneAbs,
+	"llvm.x86.ssse3.pabs.d.128": laneAbs,
+	"llvm.x86.sse2.padds.b":     laneSat(true, false),
+	"llvm.x86.sse2.padds.w":     laneSat(true, false),
+	"llvm.x86.sse2.paddus.b":    laneSat(false, false),
+	"llvm.x86.sse2.paddus.w":    laneSat(false, false),
+	"llvm.x86.sse2.psubs.b":     laneSat(true, true),
+	"llvm.x86.sse2.psubs.w":     laneSat(true, true),
+	"llvm.x86.sse2.psubus.b":    laneSat(false, true),
+	"llvm.x86.sse2.psubus.w":    laneSat(false, true),
+	"llvm.x86.avx2.padds.b":     laneSat(true, false),
+	"llvm.x86.avx2.padds.w":     laneSat(true, false),
+	"llvm.x86.avx2.paddus.b":    laneSat(false, false),
+	"llvm.x86.avx2.paddus.w":    laneSat(false, false),
+	"llvm.x86.avx2.psubs.b":     laneSat(true, true),
+	"llvm.x86.avx2.psubs.w":     laneSat(true, true),
+	"llvm.x86.avx2.psubus.b":    laneSat(false, true),
+	"llvm.x86.avx2.psubus.w":    laneSat(false, true),
+	"llvm.x86.sse2.pslli.w":     laneShift("<<", false),
+	"llvm.x86.sse2.pslli.d":     laneShift("<<", false),
+	"llvm.x86.sse2.pslli.q":     laneShift("<<", false),
+	"llvm.x86.sse2.psrli.w":     laneShift(">>", false),
+	"llvm.x86.sse2.psrli.d":     laneShift(">>", false),
+	"llvm.x86.sse2.psrli.q":     laneShift(">>", false),
+	"llvm.x86.sse2.psrai.w":     laneShift(">>", true),
+	"llvm.x86.sse2.psrai.d":     laneShift(">>", true),
+	"llvm.x86.avx2.pslli.w":     laneShift("<<", false),
+	"llvm.x86.avx2.pslli.d":     laneShift("<<", false),
+	"llvm.x86.avx2.pslli.q":     laneShift("<<", false),
+	"llvm.x86.avx2.psrli.w":     laneShift(">>", false),
+	"llvm.x86.avx2.psrli.d":     laneShift(">>", false),
+	"llvm.x86.avx2.psrli.q":     laneShift(">>", false),
+	"llvm.x86.avx2.psrai.w":     laneShift(">>", true),
+	"llvm.x86.avx2.psrai.d":     laneShift(">>", true),
+
+	// The x86 min and max instructions return the second operand if either
+	// one is NaN, which is just what a plain comparison does.
+	"llvm.x86.sse.max.ps":     laneMax(true, true),
+	"llvm.x86.sse.min.ps":     laneMax(true, false),
+	"llvm.x86.sse2.max.pd":    laneMax(true, true),
+	"llvm.x86.sse2.min.pd":    laneMax(true, false),
+	"llvm.x86.avx.max.ps.256": laneMax(true, true),
+	"llvm.x86.avx.min.ps.256": laneMax(true, false),
+	"llvm.x86.avx.max.pd.256": laneMax(true, true),
+	"llvm.x86.avx.min.pd.256": laneMax(true, false),
+	"llvm.x86.sse.sqrt.ps":    laneSqrt,
+	"llvm.x86.sse2.sqrt.pd":   laneSqrt,
+	"llvm.x86.sse.rcp.ps":     laneRcp,
+	"llvm.x86.sse.rsqrt.ps":   laneRsqrt,
+
+	"llvm.aarch64.neon.smax":   laneMax(true, true),
+	"llvm.aarch64.neon.smin":   laneMax(true, false),
+	"llvm.aarch64.neon.umax":   laneMax(false, true),
+	"llvm.aarch64.neon.umin":   laneMax(false, false),
+	"llvm.aarch64.neon.abs":    laneAbs,
+	"llvm.aarch64.neon.urhadd": laneAvg,
+	"llvm.aarch64.neon.fmax":   laneFloatMax("Max"),
+	"llvm.aarch64.neon.fmin":   laneFloatMax("Min"),
+	"llvm.aarch64.neon.frecpe": laneRcp,
+	"llvm.arm.neon.vmaxs":      laneMax(true, true),
+	"llvm.arm.neon.vmins":      laneMax(true, false),
+	"llvm.arm.neon.vmaxu":      laneMax(false, true),
+	"llvm.arm.neon.vminu":      laneMax(false, false),
+	"llvm.arm.neon.vabs":       laneAbs,
+	"llvm.arm.neon.vrhaddu":    laneAvg,
+}
+
+// simdSpecial lists the intrinsics that don't work one lane at a time, with
+// what they do instead:
+//
+//	pairwise  add adjacent lanes of the concatenation of the operands
+//	compare   compare floating-point lanes by the predicate in the third
+//	          operand, setting all the bits of the lanes where it is true
+//	pshufb    select bytes (within each 16-byte half) by the indexes in the
+//	          second operand, or zero for indexes with the high bit set
+//	movemask  collect the sign bits of the lanes into an integer
+var simdSpecial = map[string]string{
+	"llvm.aarch64.neon.addp":     "pairwise",
+	"llvm.arm.neon.vpadd":        "pairwise",
+	"llvm.x86.sse.cmp.ps":        "compare",
+	"llvm.x86.sse2.cmp.pd":       "compare",
+	"llvm.x86.avx.cmp.ps.256":    "compare",
+	"llvm.x86.avx.cmp.pd.256":    "compare",
+	"llvm.x86.ssse3.pshuf.b.128": "pshufb",
+	"llvm.x86.avx2.pshuf.b":      "pshufb",
+	"llvm.x86.sse.movmsk.ps":     "movemask",
+	"llvm.x86.sse2.movmsk.pd":    "movemask",
+	"llvm.x86.sse2.pmovmskb.128": "movemask",
+	"llvm.x86.avx.movmsk.ps.256": "movemask",
+	"llvm.x86.avx.movmsk.pd.256": "movemask",
+	"llvm.x86.avx2.pmovmskb":     "movemask",
+}
+
+// x86Compares gives the conditions (in terms of the lanes x and y) for the
+// predicates of the x86 floating-point comparisons. AVX adds predicates 16
+// through 31, which give the same results as 0 through 15.
+var x86Compares = [16]string{
+	"%[1]s == %[2]s",
+	"%[1]s < %[2]s",
+	"%[1]s <= %[2]s",
+	"%[1]s != %[1]s || %[2]s != %[2]s",
+	"%[1]s != %[2]s",
+	"!(%[1]s < %[2]s)",
+	"!(%[1]s <= %[2]s)",
+	"%[1]s == %[1]s && %[2]s == %[2]s",
+	"!(%[1]s < %[2]s || %[1]s > %[2]s)",
+	"!(%[1]s >= %[2]s)",
+	"!(%[1]s > %[2]s)",
+	"false",
+	"%[1]s < %[2]s || %[1]s > %[2]s",
+	"%[1]s >= %[2]s",
+	"%[1]s > %[2]s",
+	"true",
+}
+
+// isArchSIMD reports whether name is an architecture-specific vector
+// intrinsic.
+func isArchSIMD(name string) bool {
+	return strings.HasPrefix(name, "llvm.x86.") || strings.HasPrefix(name, "llvm.aarch64.neon.") || strings.HasPrefix(name, "llvm.arm.neon.")
+}
+
+// lookupSIMD finds name in simdIntrinsics or simdSpecial, trying it both
+// with and without its last suffix.
+func lookupSIMD(name string) (op simdOp, special string, known bool) {
+	for {
+		if op, ok := simdIntrinsics[name]; ok {
+			return op, "", true
+		}
+		if special, ok := simdSpecial[name]; ok {
+			return nil, special, true
+		}
+		i := strings.LastIndex(name, ".")
+		if i == -1 || !strings.HasPrefix(name[i+1:], "v") {
+			return nil, "", false
+		}
+		name = name[:i]
+	}
+}
+
+// SIMDIntrinsic translates calls to architecture-specific vector intrinsics.
+// If name is not one, it returns ok == false.
+func SIMDIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	if !isArchSIMD(name) {
+		return "", false, nil
+	}
+	op, special, known := lookupSIMD(name)
+	vt, isVector := inst.Type().(*types.VectorType)
+	if special == "movemask" && len(inst.Args) == 1 {
+		// The result is an integer, so the vector is the argument.
+		vt, isVector = inst.Args[0].Type().(*types.VectorType)
+	}
+	if !isVector {
+		// Not a vector operation; it may be handled elsewhere.
+		return "", false, nil
+	}
+	if *simdMode == "error" {
+		return "", true, fmt.Errorf("SIMD intrinsic %s (scalar lowering is disabled by -simd=error)", name)
+	}
+	if !known {
+		return "", true, fmt.Errorf("unsupported SIMD intrinsic: %s", name)
+	}
+
+	lt, err := vectorLaneTypes(vt)
+	if err != nil {
+		return "", true, err
+	}
+	operands := make([]string, len(inst.Args))
+	for i, a := range inst.Args {
+		v, err := FormatValue(a)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating argument %d (%v): %v", i, a, err)
+		}
+		operands[i] = v
+	}
+	for len(operands) < 2 {
+		operands = append(operands, "")
+	}
+	r := VariableName(inst)
+
+	switch special {
+	case "pairwise":
+		half := vt.Len / 2
+		return fmt.Sprintf("for lane_i := 0; lane_i < %d; lane_i++ { %s[lane_i] = %s[2*lane_i] + %s[2*lane_i+1]; %s[%d+lane_i] = %s[2*lane_i] + %s[2*lane_i+1] }", half, r, operands[0], operands[0], r, half, operands[1], operands[1]), true, nil
+
+	case "compare":
+		if len(inst.Args) != 3 {
+			return "", true, fmt.Errorf("wrong number of arguments to %s: %d", name, len(inst.Args))
+		}
+		pred, ok := inst.Args[2].(*constant.Int)
+		if !ok || !pred.X.IsInt64() || pred.X.Int64() < 0 || pred.X.Int64() > 31 {
+			return "", true, fmt.Errorf("unsupported predicate for %s: %v", name, inst.Args[2])
+		}
+		cond := fmt.Sprintf(x86Compares[pred.X.Int64()%16], operands[0]+"[lane_i]", operands[1]+"[lane_i]")
+		ones := "math.Float32frombits(0xffffffff)"
+		if lt.elem == "float64" {
+			ones = "math.Float64frombits(0xffffffffffffffff)"
+		}
+		return fmt.Sprintf("for lane_i := range %s { if %s { %s[lane_i] = %s } else { %s[lane_i] = 0 } }", r, cond, r, ones, r), true, nil
+
+	case "pshufb":
+		return fmt.Sprintf("for lane_i, lane_v := range %s { if lane_v&0x80 != 0 { %s[lane_i] = 0 } else { %s[lane_i] = %s[lane_i&^15|int(lane_v&15)] } }", operands[1], r, r, operands[0]), true, nil
+
+	case "movemask":
+		sign := convert(lt.signed, lt.elem, "lane_v") + " < 0"
+		if _, ok := vt.ElemType.(*types.FloatType); ok {
+			sign = "math.Signbit(float64(lane_v))"
+		}
+		return fmt.Sprintf("%s = 0; for lane_i, lane_v := range %s { if %s { %s |= 1 << lane_i } }", r, operands[0], sign, r), true, nil
+	}
+
+	x := operands[0] + "[lane_i]"
+	y := operands[1]
+	if len(inst.Args) > 1 {
+		if _, ok := inst.Args[1].Type().(*types.VectorType); ok {
+			y += "[lane_i]"
+		}
+	}
+	return fmt.Sprintf("for lane_i := range %s { %s }", r, op(lt, r+"[lane_i]", x, y)), true, nil
+}
+
+// vectorLaneTypes returns the Go types for the lanes of vt.
+func vectorLaneTypes(vt *types.VectorType) (laneTypes, error) {
+	elem, err := TypeSpec(vt.ElemType)
+	if err != nil {
+		return laneTypes{}, fmt.Errorf("error translating type (%v): %v", vt.ElemType, err)
+	}
+	switch t := vt.ElemType.(type) {
+	case *types.IntType:
+		switch t.BitSize {
+		case 8:
+			return laneTypes{elem: elem, signed: "int8", unsigned: "byte"}, nil
+		case 16, 32, 64:
+			return laneTypes{elem: elem, signed: elem, unsigned: fmt.Sprintf("uint%d", t.BitSize)}, nil
+		}
+	case *types.FloatType:
+		return laneTypes{elem: elem, signed: elem, unsigned: elem}, nil
+	}
+	return laneTypes{}, fmt.Errorf("unsupported vector element type: %v", vt.ElemType)
+}
+
+// checkSIMDMode returns an error if mode is not a valid value for the -simd
+// flag.
+func checkSIMDMode(mode string) error {
+	switch mode {
+	case "scalar", "error":
+		return nil
+	}
+	return fmt.Errorf("invalid value for -simd: %q (want scalar or error)", mode)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const simdSource = `
+declare <8 x i16> @llvm.x86.sse2.pmaxs.w(<8 x i16>, <8 x i16>)
+declare <16 x i8> @llvm.x86.sse2.paddus.b(<16 x i8>, <16 x i8>)
+declare <16 x i8> @llvm.x86.sse2.psubs.b(<16 x i8>, <16 x i8>)
+declare <16 x i8> @llvm.x86.ssse3.pshuf.b.128(<16 x i8>, <16 x i8>)
+declare i32 @llvm.x86.sse.movmsk.ps(<4 x float>)
+declare <4 x float> @llvm.x86.sse.cmp.ps(<4 x float>, <4 x float>, i8)
+declare <4 x i32> @llvm.aarch64.neon.umin.v4i32(<4 x i32>, <4 x i32>)
+declare <4 x i32> @llvm.aarch64.neon.addp.v4i32(<4 x i32>, <4 x i32>)
+
+define <8 x i16> @maxs(<8 x i16> %a, <8 x i16> %b) {
+  %r = call <8 x i16> @llvm.x86.sse2.pmaxs.w(<8 x i16> %a, <8 x i16> %b)
+  ret <8 x i16> %r
+}
+
+define <16 x i8> @addus(<16 x i8> %a, <16 x i8> %b) {
+  %r = call <16 x i8> @llvm.x86.sse2.paddus.b(<16 x i8> %a, <16 x i8> %b)
+  ret <16 x i8> %r
+}
+
+define <16 x i8> @subs(<16 x i8> %a, <16 x i8> %b) {
+  %r = call <16 x i8> @llvm.x86.sse2.psubs.b(<16 x i8> %a, <16 x i8> %b)
+  ret <16 x i8> %r
+}
+
+define <16 x i8> @shuffle(<16 x i8> %a, <16 x i8> %b) {
+  %r = call <16 x i8> @llvm.x86.ssse3.pshuf.b.128(<16 x i8> %a, <16 x i8> %b)
+  ret <16 x i8> %r
+}
+
+define i32 @lessMask(<4 x float> %a, <4 x float> %b) {
+  %c = call <4 x float> @llvm.x86.sse.cmp.ps(<4 x float> %a, <4 x float> %b, i8 1)
+  %m = call i32 @llvm.x86.sse.movmsk.ps(<4 x float> %c)
+  ret i32 %m
+}
+
+define <4 x i32> @umin(<4 x i32> %a, <4 x i32> %b) {
+  %r = call <4 x i32> @llvm.aarch64.neon.umin.v4i32(<4 x i32> %a, <4 x i32> %b)
+  ret <4 x i32> %r
+}
+
+define <4 x i32> @addp(<4 x i32> %a, <4 x i32> %b) {
+  %r = call <4 x i32> @llvm.aarch64.neon.addp.v4i32(<4 x i32> %a, <4 x i32> %b)
+  ret <4 x i32> %r
+}
+`
+
+func TestSIMDIntrinsics(t *testing.T) {
+	t.Parallel()
+	mainSrc := mainCalling(
+		"maxs([8]int16{1, -2, 3, -4, 5, -6, 7, -8}, [8]int16{-1, 2, -3, 4, -5, 6, -7, 8})",
+		"addus([16]byte{250, 1, 2}, [16]byte{10, 1, 2})",
+		"subs([16]byte{0x80, 5}, [16]byte{1, 10})",
+		"shuffle([16]byte{10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25}, [16]byte{15, 0, 0x80, 1})",
+		"lessMask([4]float32{1, 5, 2, 8}, [4]float32{2, 4, 3, 1})",
+		"umin([4]int32{-1, 2, 3, 4}, [4]int32{1, 1, 5, -5})",
+		"addp([4]int32{1, 2, 3, 4}, [4]int32{10, 20, 30, 40})",
+	)
+	want := `[1 2 3 4 5 6 7 8]
+[255 2 4 0 0 0 0 0 0 0 0 0 0 0 0 0]
+[128 251 0 0 0 0 0 0 0 0 0 0 0 0 0 0]
+[25 10 0 11 10 10 10 10 10 10 10 10 10 10 10 10]
+5
+[1 1 3 4]
+[3 7 30 70]
+`
+	checkProgram(t, simdSource, mainSrc, want)
+
+	output := translateError(t, simdSource, "-simd=error", "-color=never")
+	if !strings.Contains(output, "8 errors") {
+		t.Errorf("-simd=error didn't report each intrinsic:\n%s", output)
+	}
+}
+
+func TestSIMDFallbacks(t *testing.T) {
+	t.Parallel()
+	src := `
+declare <8 x i16> @llvm.x86.sse2.padds.w(<8 x i16>, <8 x i16>)
+declare <8 x i16> @llvm.x86.sse2.psubus.w(<8 x i16>, <8 x i16>)
+declare <16 x i16> @llvm.x86.avx2.psubs.w(<16 x i16>, <16 x i16>)
+declare <4 x i32> @llvm.x86.sse2.pslli.d(<4 x i32>, i32)
+declare <8 x i16> @llvm.x86.sse2.psrli.w(<8 x i16>, i32)
+declare <8 x i32> @llvm.x86.avx2.psrai.d(<8 x i32>, i32)
+declare <2 x double> @llvm.x86.sse2.cmp.pd(<2 x double>, <2 x double>, i8)
+declare <4 x double> @llvm.x86.avx.cmp.pd.256(<4 x double>, <4 x double>, i8)
+declare i32 @llvm.x86.sse2.movmsk.pd(<2 x double>)
+declare i32 @llvm.x86.avx.movmsk.pd.256(<4 x double>)
+declare i32 @llvm.x86.sse2.pmovmskb.128(<16 x i8>)
+
+define <8 x i16> @adds(<8 x i16> %a, <8 x i16> %b) {
+  %r = call <8 x i16> @llvm.x86.sse2.padds.w(<8 x i16> %a, <8 x i16> %b)
+  ret <8 x i16> %r
+}
+
+define <8 x i16> @subus(<8 x i16> %a, <8 x i16> %b) {
+  %r = call <8 x i16> @llvm.x86.sse2.psubus.w(<8 x i16> %a, <8 x i16> %b)
+  ret <8 x i16> %r
+}
+
+define <16 x i16> @subs256(<16 x i16> %a, <16 x i16> %b) {
+  %r = call <16 x i16> @llvm.x86.avx2.psubs.w(<16 x i16> %a, <16 x i16> %b)
+  ret <16 x i16> %r
+}
+
+define <4 x i32> @shl(<4 x i32> %a, i32 %n) {
+  %r = call <4 x i32> @llvm.x86.sse2.pslli.d(<4 x i32> %a, i32 %n)
+  ret <4 x i32> %r
+}
+
+define <8 x i16> @shr(<8 x i16> %a, i32 %n) {
+  %r = call <8 x i16> @llvm.x86.sse2.psrli.w(<8 x i16> %a, i32 %n)
+  ret <8 x i16> %r
+}
+
+define <8 x i32> @sar(<8 x i32> %a, i32 %n) {
+  %r = call <8 x i32> @llvm.x86.avx2.psrai.d(<8 x i32> %a, i32 %n)
+  ret <8 x i32> %r
+}
+
+; unordered uses predicate 3, which is true if either lane is NaN.
+define i32 @unordered(<2 x double> %a, <2 x double> %b) {
+  %c = call <2 x double> @llvm.x86.sse2.cmp.pd(<2 x double> %a, <2 x double> %b, i8 3)
+  %m = call i32 @llvm.x86.sse2.movmsk.pd(<2 x double> %c)
+  ret i32 %m
+}
+
+; greaterEqual uses predicate 29 (_CMP_GE_OQ), which works like 13.
+define i32 @greaterEqual(<4 x double> %a, <4 x double> %b) {
+  %c = call <4 x double> @llvm.x86.avx.cmp.pd.256(<4 x double> %a, <4 x double> %b, i8 29)
+  %m = call i32 @llvm.x86.avx.movmsk.pd.256(<4 x double> %c)
+  ret i32 %m
+}
+
+define i32 @byteSigns(<16 x i8> %a) {
+  %m = call i32 @llvm.x86.sse2.pmovmskb.128(<16 x i8> %a)
+  ret i32 %m
+}
+`
+	mainSrc := strings.Replace(mainCalling(
+		"adds([8]int16{32000, -32000, 1, -1}, [8]int16{1000, -1000, 2, -2})",
+		"subus([8]int16{5, -1, 100}, [8]int16{10, 1, 1})",
+		"subs256([16]int16{-32768, 32767, 7}, [16]int16{1, -1, 3})",
+		"shl([4]int32{1, -1, 3, 4}, 4)",
+		"shl([4]int32{1, -1, 3, 4}, 32)",
+		"shr([8]int16{-1, 256}, 8)",
+		"sar([8]int32{-256, 256}, 4)",
+		"sar([8]int32{-256, 256}, 40)",
+		"unordered([2]float64{math.NaN(), 1}, [2]float64{0, 2})",
+		"greaterEqual([4]float64{1, 2, 3, math.NaN()}, [4]float64{2, 2, 2, 2})",
+		"byteSigns([16]byte{0x80, 1, 0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x90})",
+	), `import "fmt"`, "import (\n\t\"fmt\"\n\t\"math\"\n)", 1)
+	want := `[32767 -32768 3 -3 0 0 0 0]
+[0 -2 99 0 0 0 0 0]
+[-32768 32767 4 0 0 0 0 0 0 0 0 0 0 0 0 0]
+[16 -16 48 64]
+[0 0 0 0]
+[255 1 0 0 0 0 0 0]
+[-16 16 0 0 0 0 0 0]
+[-1 0 0 0 0 0 0 0]
+1
+6
+32773
+`
+	checkProgram(t, src, mainSrc, want)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+)
+
+// ModuleStats holds the statistics printed by the -stats flag.
+type ModuleStats struct {
+	Instructions map[string]int // counts by opcode
+	Intrinsics   map[string]int // call counts by intrinsic name
+	Externals    []string       // declared but not defined functions and globals
+
+	// Statements is the number of translated instructions, and Unsafe is
+	// how many of them use package unsafe.
+	Statements int
+	Unsafe     int
+}
+
+// Stats accumulates statistics as the module is translated.
+var Stats = ModuleStats{
+	Instructions: make(map[string]int),
+	Intrinsics:   make(map[string]int),
+}
+
+// CollectStats records the instruction counts, intrinsic usage, and external
+// symbols of m in Stats.
+func CollectStats(m *ir.Module) {
+	for _, f := range m.Funcs {
+		if f.Blocks == nil {
+			if !strings.HasPrefix(f.Name(), "llvm.") {
+				Stats.Externals = append(Stats.Externals, f.Ident())
+			}
+			continue
+		}
+		for _, b := range f.Blocks {
+			for _, inst := range b.Insts {
+				Stats.Instructions[opcode(inst)]++
+				if call, ok := inst.(*ir.InstCall); ok {
+					if callee, ok := call.Callee.(*ir.Func); ok && strings.HasPrefix(callee.Name(), "llvm.") {
+						Stats.Intrinsics[callee.Name()]++
+					}
+				}
+			}
+			Stats.Instructions[opcode(b.Term)]++
+		}
+	}
+	for _, g := range m.Globals {
+		if g.Init == nil {
+			Stats.Externals = append(Stats.Externals, g.Ident())
+		}
+	}
+	sort.Strings(Stats.Externals)
+}
+
+// CountStatement records a translated statement in Stats.
+func CountStatement(translated string) {
+	if translated == "" {
+		return
+	}
+	Stats.Statements++
+	if strings.Contains(translated, "unsafe.") {
+		Stats.Unsafe++
+	}
+}
+
+// opcode returns the LLVM opcode for an instruction or terminator, derived
+// from its type name.
+func opcode(x interface{}) string {
+	name := fmt.Sprintf("%T", x)
+	name = strings.TrimPrefix(name, "*ir.")
+	name = strings.TrimPrefix(name, "Inst")
+	name = strings.TrimPrefix(name, "Term")
+	return strings.ToLower(name)
+}
+
+// Print writes the statistics report to w.
+func (s *ModuleStats) Print(w io.Writer) {
+	fmt.Fprintln(w, "Instructions:")
+	printCounts(w, s.Instructions)
+
+	fmt.Fprintln(w, "\nIntrinsics:")
+	printCounts(w, s.Intrinsics)
+
+	fmt.Fprintln(w, "\nExternal symbols:")
+	for _, name := range s.Externals {
+		fmt.Fprintf(w, "\t%s\n", name)
+	}
+
+	fmt.Fprintln(w)
+	if s.Statements > 0 {
+		fmt.Fprintf(w, "Unsafe: %d of %d statements (%.1f%%)\n", s.Unsafe, s.Statements, 100*float64(s.Unsafe)/float64(s.Statements))
+	}
+}
+
+// printCounts prints counts in descending order, breaking ties by name.
+func printCounts(w io.Writer, counts map[string]int) {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		fmt.Fprintf(w, "\t%6d %s\n", counts[name], name)
+	}
+}
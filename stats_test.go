@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+	src := `
+@counter = external global i32
+
+declare i32 @puts(i8*)
+declare i32 @llvm.ctpop.i32(i32)
+
+define i32 @f(i32 %x, i32* %p) {
+  %a = add i32 %x, 1
+  %b = add i32 %a, 2
+  %c = call i32 @llvm.ctpop.i32(i32 %b)
+  %d = load i32, i32* %p
+  %e = add i32 %c, %d
+  ret i32 %e
+}
+`
+	code, output := translate(t, src, "-stats")
+	for _, s := range []string{
+		"Instructions:\n\t     3 add\n\t     1 call\n\t     1 load\n\t     1 ret\n",
+		"Intrinsics:\n\t     1 llvm.ctpop.i32\n",
+		"External symbols:\n\t@counter\n\t@puts\n",
+		"Unsafe: 0 of 5 statements (0.0%)\n",
+	} {
+		if !strings.Contains(output, s) {
+			t.Errorf("statistics don't contain %q:\n%s", s, output)
+		}
+	}
+	got := runGo(t, code, `package main
+
+import "fmt"
+
+var counter int32
+
+func puts(*byte) int32 { return 0 }
+
+func main() {
+	x := int32(4)
+	fmt.Println(f(4, &x))
+}
+`)
+	if got != "7\n" {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, "7\n", numberLines(code))
+	}
+}
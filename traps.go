@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/llir/llvm/ir"
+)
+
+// TrapIntrinsic translates calls to llvm.trap (which __builtin_trap and
+// abort paths compile to), llvm.debugtrap, and the intrinsics that backtrace
+// code uses, llvm.returnaddress and llvm.frameaddress. If name is none of
+// them, it returns ok == false.
+func TrapIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	switch intrinsicBase(name) {
+	case "trap":
+		result := fmt.Sprintf("panic(%q)", panicPrefix(inst)+"trap")
+		if !beforeUnreachable(inst) {
+			result = midBlockPanic(result)
+		}
+		return result, true, nil
+	case "debugtrap":
+		// Execution continues after the breakpoint if a debugger is
+		// attached.
+		return "runtime.Breakpoint()", true, nil
+
+	case "returnaddress", "frameaddress":
+		// Go has no way to get at these addresses (runtime.Caller's program
+		// counters aren't pointers), so the result is as if the address
+		// couldn't be determined, which LLVM allows for levels above 0.
+		if currentFunc != nil {
+			Warn(currentFunc, inst, "the address is always null")
+		}
+		zero, err := zeroValue(inst.Type())
+		if err != nil {
+			return "", true, err
+		}
+		return fmt.Sprintf("%s = %s", VariableName(inst), zero), true, nil
+	}
+	return "", false, nil
+}
+
+// beforeUnreachable reports whether inst is the last instruction of a block
+// (in the function being translated) that ends in unreachable.
+func beforeUnreachable(inst ir.Instruction) bool {
+	if currentFunc == nil {
+		return false
+	}
+	for _, b := range currentFunc.Blocks {
+		if len(b.Insts) > 0 && b.Insts[len(b.Insts)-1] == inst {
+			_, ok := b.Term.(*ir.TermUnreachable)
+			return ok
+		}
+	}
+	return false
+}
+
+// endsInTrap reports whether the last instruction in b is a call to
+// llvm.trap or a Zig panic handler, so that an unreachable terminator after it
+// needs no panic of its own.
+func endsInTrap(b *ir.Block) bool {
+	if len(b.Insts) == 0 {
+		return false
+	}
+	call, ok := b.Insts[len(b.Insts)-1].(*ir.InstCall)
+	if !ok {
+		return false
+	}
+	if isZigPanic(call) {
+		return true
+	}
+	f, ok := call.Callee.(*ir.Func)
+	return ok && intrinsicBase(f.Name()) == "trap"
+}
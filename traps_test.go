@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTrap(t *testing.T) {
+	t.Parallel()
+	src := `
+declare void @llvm.trap()
+declare void @llvm.debugtrap()
+
+define i32 @checked(i32 %x) {
+entry:
+  %bad = icmp slt i32 %x, 0
+  br i1 %bad, label %trap, label %ok
+
+trap:
+  call void @llvm.trap()
+  unreachable
+
+ok:
+  ret i32 %x
+}
+
+; continued traps in the middle of a block.
+define i32 @continued(i32 %x) {
+  call void @llvm.trap()
+  %y = add i32 %x, 1
+  ret i32 %y
+}
+
+define void @breakpoint(i1 %c) {
+entry:
+  br i1 %c, label %stop, label %done
+
+stop:
+  call void @llvm.debugtrap()
+  br label %done
+
+done:
+  ret void
+}
+`
+	code, _ := translate(t, src)
+	if strings.Contains(code, "unreachable code reached") {
+		t.Errorf("unreachable after llvm.trap gets its own panic:\n%s", numberLines(code))
+	}
+	if !strings.Contains(code, "runtime.Breakpoint()") {
+		t.Errorf("llvm.debugtrap isn't a breakpoint:\n%s", numberLines(code))
+	}
+	// Running into the breakpoint would stop the program, so it isn't called.
+	mainSrc := `package main
+
+import "fmt"
+
+func try(f func(int32) int32, x int32) (result interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = r
+		}
+	}()
+	return f(x)
+}
+
+func main() {
+	breakpoint(false)
+	fmt.Println(try(checked, 5))
+	fmt.Println(try(checked, -5))
+	fmt.Println(try(continued, 1))
+}
+`
+	if got, want := runGo(t, code, mainSrc), "5\ntrap\ntrap\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestReturnAddress(t *testing.T) {
+	t.Parallel()
+	src := `
+declare i8* @llvm.returnaddress(i32)
+declare i8* @llvm.frameaddress.p0i8(i32)
+
+; depth counts the frames that a backtrace would find, stopping at a null
+; address.
+define i32 @depth() {
+  %ra = call i8* @llvm.returnaddress(i32 0)
+  %fa = call i8* @llvm.frameaddress.p0i8(i32 1)
+  %noRA = icmp eq i8* %ra, null
+  %noFA = icmp eq i8* %fa, null
+  %a = zext i1 %noRA to i32
+  %b = zext i1 %noFA to i32
+  %r = add i32 %a, %b
+  ret i32 %r
+}
+`
+	code, output := translate(t, src)
+	if n := strings.Count(output, "the address is always null"); n != 2 {
+		t.Errorf("%d warnings, want 2:\n%s", n, output)
+	}
+	if got, want := runGo(t, code, mainCalling("depth()")), "2\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
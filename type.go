@@ -3,7 +3,6 @@ package main
 import (
 	"bytes"
 	"fmt"
-	"strings"
 
 	"github.com/llir/llvm/ir/types"
 )
@@ -20,9 +19,17 @@ func TypeDefinition(t types.Type) (string, error) {
 
 	case *types.FloatType:
 		switch t.Kind {
+		case types.FloatKindHalf:
+			return "libc.Float16", nil
 		case types.FloatKindFloat:
 			return "float32", nil
-		case types.FloatKindDouble, types.FloatKindX86_FP80:
+		case types.FloatKindDouble:
+			return "float64", nil
+		case types.FloatKindX86_FP80, types.FloatKindFP128:
+			if *longDouble == "big" {
+				return "libc.LongDouble", nil
+			}
+			warnLongDouble(t)
 			return "float64", nil
 		default:
 			return "", fmt.Errorf("unsupported floating-point type: %v", t.Kind)
@@ -58,8 +65,13 @@ func TypeDefinition(t types.Type) (string, error) {
 			return "bool", nil
 		case t.BitSize <= 8:
 			return "byte", nil
+		case t.BitSize == 128:
+			return "libc.Int128", nil
+		case t.BitSize > 64:
+			return "", fmt.Errorf("unsupported integer width: %v", t)
 		default:
-			return fmt.Sprintf("int%d", t.BitSize), nil
+			// Odd widths are held in the next larger type (see intwidth.go).
+			return fmt.Sprintf("int%d", intContainer(t.BitSize)), nil
 		}
 
 	case *types.PointerType:
@@ -67,6 +79,9 @@ func TypeDefinition(t types.Type) (string, error) {
 			// Translate a C function pointer type as a Go function type.
 			return TypeDefinition(t.ElemType)
 		}
+		if arenaMode() {
+			return "uintptr", nil
+		}
 		elemType, err := TypeSpec(t.ElemType)
 		if err != nil {
 			return "", err
@@ -74,10 +89,22 @@ func TypeDefinition(t types.Type) (string, error) {
 		return "*" + elemType, nil
 
 	case *types.StructType:
+		if t.Opaque {
+			// A struct that is declared but never defined, like FILE in
+			// C. It can only be used through pointers, so it doesn't matter
+			// that the Go type has no fields.
+			return "struct{}", nil
+		}
+		if recursiveTypes[t] {
+			return "", fmt.Errorf("%%%s contains itself (not through a pointer)", t.Name())
+		}
 		b := new(bytes.Buffer)
 		b.WriteString("struct {\n")
 		for i, field := range t.Fields {
 			fieldType, err := TypeSpec(field)
+			if err == nil && isMisaligned(t, i) {
+				fieldType, err = misalignedFieldDefinition(t, i)
+			}
 			if err != nil {
 				return "", fmt.Errorf("error converting type of field %d: %v", i, err)
 			}
@@ -87,6 +114,10 @@ func TypeDefinition(t types.Type) (string, error) {
 		return b.String(), nil
 
 	case *types.VectorType:
+		if t.Scalable {
+			// The length is only a minimum, so it can't be an array.
+			return "", fmt.Errorf("unsupported scalable vector type: %v", t)
+		}
 		elemType, err := TypeSpec(t.ElemType)
 		if err != nil {
 			return "", err
@@ -98,23 +129,123 @@ func TypeDefinition(t types.Type) (string, error) {
 	}
 }
 
+// typeSpecs caches the results of TypeSpec, keyed by the LLVM name or
+// definition of the type.
+var typeSpecs = make(map[string]string)
+
+// A TypeDecl is a Go type declaration to be included in the output.
+type TypeDecl struct {
+	Name       string
+	Definition string
+}
+
+// TypeDecls is the list of type declarations that the generated code needs,
+// in the order they were added.
+var TypeDecls []TypeDecl
+
 // TypeSpec returns the name (if it has one) or the definition of t.
+//
+// Literal struct and array types are given names of their own the first time
+// they are seen, and the declarations are added to TypeDecls.
 func TypeSpec(t types.Type) (string, error) {
+	key := t.String()
+	if spec, ok := typeSpecs[key]; ok {
+		return spec, nil
+	}
 	if name := TypeName(t); name != "" {
+		typeSpecs[key] = name
+		return name, nil
+	}
+
+	switch t.(type) {
+	case *types.StructType, *types.ArrayType:
+		name := uniquePackageName("anon")
+		// Record the name before translating the fields, in case they refer
+		// back to this type.
+		typeSpecs[key] = name
+		def, err := TypeDefinition(t)
+		if err != nil {
+			delete(typeSpecs, key)
+			return "", err
+		}
+		TypeDecls = append(TypeDecls, TypeDecl{Name: name, Definition: def})
 		return name, nil
 	}
-	return TypeDefinition(t)
+
+	spec, err := TypeDefinition(t)
+	if err != nil {
+		return "", err
+	}
+	typeSpecs[key] = spec
+	return spec, nil
 }
 
 // TypeName returns t's name, or the empty string if t is not a named type.
 func TypeName(t types.Type) string {
-	name := t.Name()
-	name = strings.TrimPrefix(name, "struct.")
-	name = strings.TrimPrefix(name, "union.")
-
-	if name == "anon" {
+	if t.Name() == "" {
 		return ""
 	}
+	if name, ok := typeNames[t.Name()]; ok {
+		return name
+	}
+	return typeName(t.Name())
+}
 
-	return name
+// TypeDefsInOrder returns the named types in defs, ordered so that the types
+// a struct contains (directly, or in arrays and vectors) are declared before
+// it. Types that are only pointed to don't count, so recursive types are
+// possible; otherwise the order of defs is kept. Structs that contain
+// themselves by value are recorded in recursiveTypes.
+func TypeDefsInOrder(defs []types.Type) []types.Type {
+	var ordered []types.Type
+	visited := make(map[types.Type]bool)
+	// path holds the structs that are being visited, outermost first.
+	var path []types.Type
+	var visit func(t types.Type)
+	visit = func(t types.Type) {
+		switch t := t.(type) {
+		case *types.ArrayType:
+			visit(t.ElemType)
+			return
+		case *types.VectorType:
+			visit(t.ElemType)
+			return
+		case *types.StructType:
+			if visited[t] {
+				for i := len(path) - 1; i >= 0; i-- {
+					if path[i] == t {
+						for _, s := range path[i:] {
+							recursiveTypes[s] = true
+						}
+						break
+					}
+				}
+				return
+			}
+			visited[t] = true
+			path = append(path, t)
+			for _, f := range t.Fields {
+				visit(f)
+			}
+			path = path[:len(path)-1]
+			if TypeName(t) != "" {
+				ordered = append(ordered, t)
+			}
+			return
+		}
+		if t.Name() != "" && !visited[t] {
+			visited[t] = true
+			ordered = append(ordered, t)
+		}
+	}
+	for _, t := range defs {
+		if TypeName(t) != "" {
+			visit(t)
+		}
+	}
+	return ordered
 }
+
+// recursiveTypes holds the struct types that contain themselves (not through
+// a pointer), which have no Go equivalent.
+var recursiveTypes = make(map[types.Type]bool)
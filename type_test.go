@@ -0,0 +1,172 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAnonymousTypes(t *testing.T) {
+	t.Parallel()
+	src := `
+@table = global [3 x i32] [i32 1, i32 2, i32 3]
+
+define i32 @second([3 x i32] %a) {
+  %x = extractvalue [3 x i32] %a, 1
+  ret i32 %x
+}
+
+define i32 @sum(i32 %anon) {
+  %p = alloca { i32, i32 }
+  %f0 = getelementptr { i32, i32 }, { i32, i32 }* %p, i32 0, i32 0
+  store i32 %anon, i32* %f0
+  %f1 = getelementptr { i32, i32 }, { i32, i32 }* %p, i32 0, i32 1
+  store i32 10, i32* %f1
+  %s = load { i32, i32 }, { i32, i32 }* %p
+  %a = extractvalue { i32, i32 } %s, 0
+  %b = extractvalue { i32, i32 } %s, 1
+  %r = add i32 %a, %b
+  ret i32 %r
+}
+`
+	code, _ := translate(t, src)
+	// The literal types are declared with names of their own, which don't
+	// clash with the parameter called anon.
+	for _, re := range []string{`(?m)^type anon(_\d+)? \[3\]int32$`, `(?m)^type anon_\d+ struct \{`} {
+		if !regexp.MustCompile(re).MatchString(code) {
+			t.Errorf("no match for %s in generated code:\n%s", re, numberLines(code))
+		}
+	}
+	if got := runGo(t, code, mainCalling("second(table)", "sum(5)", "second([3]int32{4, 5, 6})")); got != "2\n15\n5\n" {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, "2\n15\n5\n", numberLines(code))
+	}
+}
+
+func TestTypeDefsInOrder(t *testing.T) {
+	t.Parallel()
+	// The parser lists the types in alphabetical order, which is the reverse
+	// of the order they are needed in.
+	src := `
+%a = type { %b, [2 x %c], %list* }
+%b = type { <2 x i32>, %c }
+%c = type { i32, i8 }
+%list = type { i32, %list* }
+
+@o = global %a { %b { <2 x i32> <i32 1, i32 2>, %c { i32 3, i8 4 } }, [2 x %c] [%c { i32 5, i8 6 }, %c { i32 7, i8 8 }], %list* @l }
+@l = global %list { i32 9, %list* null }
+
+define i32 @sum() {
+  %pa = getelementptr %a, %a* @o, i32 0, i32 0, i32 1, i32 0
+  %pb = getelementptr %a, %a* @o, i32 0, i32 1, i32 1, i32 0
+  %pp = getelementptr %a, %a* @o, i32 0, i32 2
+  %p = load %list*, %list** %pp
+  %pc = getelementptr %list, %list* %p, i32 0, i32 0
+  %x = load i32, i32* %pa
+  %y = load i32, i32* %pb
+  %z = load i32, i32* %pc
+  %s = add i32 %x, %y
+  %r = add i32 %s, %z
+  ret i32 %r
+}
+`
+	code, _ := translate(t, src)
+	var last int
+	for _, name := range []string{"c", "b", "a"} {
+		loc := regexp.MustCompile(`(?m)^type _?` + name + ` struct`).FindStringIndex(code)
+		if loc == nil {
+			t.Fatalf("type %s isn't declared:\n%s", name, numberLines(code))
+		}
+		if loc[0] < last {
+			t.Errorf("type %s is declared before a type it contains:\n%s", name, numberLines(code))
+		}
+		last = loc[0]
+	}
+	if got, want := runGo(t, code, mainCalling("sum()")), "19\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestOpaqueStructs(t *testing.T) {
+	t.Parallel()
+	src := `
+%struct.FILE = type opaque
+%struct.handle = type { %struct.FILE*, i32 }
+
+declare %struct.FILE* @open_file()
+
+define i32 @use(%struct.handle* %h) {
+  %fp = getelementptr %struct.handle, %struct.handle* %h, i32 0, i32 0
+  %f = load %struct.FILE*, %struct.FILE** %fp
+  %isNull = icmp eq %struct.FILE* %f, null
+  %np = getelementptr %struct.handle, %struct.handle* %h, i32 0, i32 1
+  %n = load i32, i32* %np
+  %r = select i1 %isNull, i32 -1, i32 %n
+  ret i32 %r
+}
+`
+	code, _ := translate(t, src)
+	if !regexp.MustCompile(`(?m)^type FILE struct\{\}$`).MatchString(code) {
+		t.Errorf("opaque struct isn't declared as an empty struct:\n%s", numberLines(code))
+	}
+	mainSrc := `package main
+
+import "fmt"
+
+func main() {
+	var f FILE
+	fmt.Println(use(&handle{nil, 3}), use(&handle{&f, 3}))
+}
+`
+	if got, want := runGo(t, code, mainSrc), "-1 3\n"; got != want {
+		t.Errorf("output: %q, want %q\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
+
+func TestRecursiveTypes(t *testing.T) {
+	t.Parallel()
+	src := `
+%a = type { i32, %a }
+%b = type { [2 x %c] }
+%c = type { %b, i8 }
+
+define i32 @size(%a* %p, %b* %q) {
+  ret i32 0
+}
+`
+	for _, flags := range [][]string{nil, {"-memory=arena"}} {
+		output := translateError(t, src, append(flags, "-color=never")...)
+		for _, name := range []string{"%a", "%b", "%c"} {
+			if !strings.Contains(output, "error generating type definition: "+name+" contains itself (not through a pointer)") {
+				t.Errorf("%v: output doesn't report %s:\n%s", flags, name, output)
+			}
+		}
+	}
+
+	// A type that refers to itself through a pointer is fine.
+	listSrc := `
+%list = type { i32, %list* }
+
+define i32 @sum(%list* %l) {
+entry:
+  br label %loop
+
+loop:
+  %p = phi %list* [ %l, %entry ], [ %next, %body ]
+  %total = phi i32 [ 0, %entry ], [ %total1, %body ]
+  %done = icmp eq %list* %p, null
+  br i1 %done, label %exit, label %body
+
+body:
+  %vp = getelementptr %list, %list* %p, i32 0, i32 0
+  %v = load i32, i32* %vp
+  %total1 = add i32 %total, %v
+  %np = getelementptr %list, %list* %p, i32 0, i32 1
+  %next = load %list*, %list** %np
+  br label %loop
+
+exit:
+  ret i32 %total
+}
+`
+	checkProgram(t, listSrc, mainCalling("sum(&list{1, &list{2, &list{3, nil}}})"), "6\n")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/metadata"
+	"github.com/llir/llvm/ir/types"
+)
+
+// A typedefAlias is a Go type alias standing in for a C typedef.
+type typedefAlias struct {
+	name string
+	spec string // the Go type it is an alias for
+}
+
+var typedefAliases = make(map[*metadata.DIDerivedType]*typedefAlias)
+
+// TypedefSpec returns the name of a Go type alias for the C typedef that t
+// (a debug type) refers to, declaring the alias if necessary. The alias is for
+// the Go translation of llType. If t is not a typedef, or the typedef has
+// already been used with a different LLVM type, it returns the empty string.
+func TypedefSpec(t metadata.Field, llType types.Type) string {
+	// Don't look through typedefs here; we want the outermost one.
+	for {
+		dt, ok := t.(*metadata.DIDerivedType)
+		if !ok || dt.Tag != enum.DwarfTagConstType && dt.Tag != enum.DwarfTagVolatileType {
+			break
+		}
+		t = dt.BaseType
+	}
+	td, ok := t.(*metadata.DIDerivedType)
+	if !ok || td.Tag != enum.DwarfTagTypedef || td.Name == "" {
+		return ""
+	}
+
+	spec, err := TypeSpec(llType)
+	if err != nil {
+		return ""
+	}
+
+	if a, ok := typedefAliases[td]; ok {
+		if a.spec != spec {
+			return ""
+		}
+		return a.name
+	}
+
+	if valueName(td.Name) == spec {
+		// Something like "typedef struct foo foo".
+		return ""
+	}
+	a := &typedefAlias{
+		name: uniquePackageName(valueName(td.Name)),
+		spec: spec,
+	}
+	typedefAliases[td] = a
+	TypeDecls = append(TypeDecls, TypeDecl{Name: a.name, Definition: "= " + spec})
+	return a.name
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTypedefAliases(t *testing.T) {
+	t.Parallel()
+	src := `
+define i64 @twice(i64 %n, i32 %h) !dbg !6 {
+  %x = mul i64 %n, 2
+  %y = sext i32 %h to i64
+  %r = add i64 %x, %y
+  ret i64 %r
+}
+
+!llvm.dbg.cu = !{!0}
+!llvm.module.flags = !{!3, !4}
+
+!0 = distinct !DICompileUnit(language: DW_LANG_C99, file: !1, producer: "clang", isOptimized: false, runtimeVersion: 0, emissionKind: FullDebug, enums: !2)
+!1 = !DIFile(filename: "size.c", directory: "/tmp")
+!2 = !{}
+!3 = !{i32 2, !"Dwarf Version", i32 4}
+!4 = !{i32 2, !"Debug Info Version", i32 3}
+!6 = distinct !DISubprogram(name: "twice", scope: !1, file: !1, line: 3, type: !7, scopeLine: 3, flags: DIFlagPrototyped, spFlags: DISPFlagDefinition, unit: !0, retainedNodes: !2)
+!7 = !DISubroutineType(types: !8)
+!8 = !{!9, !9, !12}
+!9 = !DIDerivedType(tag: DW_TAG_typedef, name: "size_t", file: !1, line: 1, baseType: !10)
+!10 = !DIBasicType(name: "unsigned long", size: 64, encoding: DW_ATE_unsigned)
+!11 = !DIDerivedType(tag: DW_TAG_typedef, name: "handle_t", file: !1, line: 2, baseType: !13)
+!12 = !DIDerivedType(tag: DW_TAG_const_type, baseType: !11)
+!13 = !DIBasicType(name: "int", size: 32, encoding: DW_ATE_signed)
+`
+	code, _ := translate(t, src)
+	for _, s := range []string{"type size_t = int64", "type handle_t = int32", "func twice(n size_t, h handle_t) size_t {"} {
+		if !strings.Contains(code, s) {
+			t.Errorf("generated code doesn't contain %q:\n%s", s, numberLines(code))
+		}
+	}
+	got := runGo(t, code, mainCalling("twice(20, 2)", "twice(size_t(1), handle_t(-2))"))
+	if want := "42\n0\n"; got != want {
+		t.Errorf("output:\n%s\nwant:\n%s\ngenerated code:\n%s", got, want, numberLines(code))
+	}
+}
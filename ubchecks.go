@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// The -ub-checks flag makes the generated code panic when it detects
+// undefined behavior: signed overflow in arithmetic marked nsw, loads and
+// stores through nil or misaligned pointers, and inbounds getelementptr on a
+// nil pointer or outside its object. The pointer arithmetic done by the first
+// index is only checked when the size of the object is known (see
+// objectLength); out-of-bounds indexes into arrays are caught by Go's own
+// bounds checking.
+
+func hasNSW(flags []enum.OverflowFlag) bool {
+	for _, f := range flags {
+		if f == enum.OverflowFlagNSW {
+			return true
+		}
+	}
+	return false
+}
+
+// overflowConditions are the conditions (in terms of x, y, and the result z)
+// under which signed arithmetic overflows.
+var overflowConditions = map[string]string{
+	"add": "(y > 0 && z < x) || (y < 0 && z > x)",
+	"sub": "(y > 0 && z > x) || (y < 0 && z < x)",
+	"mul": "x != 0 && (z/x != y || (x == -1 && y != 0 && y == z))",
+}
+
+var overflowOperators = map[string]string{
+	"add": "+",
+	"sub": "-",
+	"mul": "*",
+}
+
+// CheckedArithmetic translates an add, sub, or mul instruction with the nsw
+// flag as a call to a helper function that panics on signed overflow. The
+// helper's last argument is the C source location to put in the panic
+// message. If t is not a scalar integer type, it returns the empty string.
+func CheckedArithmetic(inst value.Named, op string, t types.Type, x, y value.Value) (string, error) {
+	it, ok := t.(*types.IntType)
+	if !ok || it.BitSize != 8 && it.BitSize != 16 && it.BitSize != 32 && it.BitSize != 64 {
+		return "", nil
+	}
+	xs, err := FormatValue(x)
+	if err != nil {
+		return "", fmt.Errorf("error translating left operand (%v): %v", x, err)
+	}
+	ys, err := FormatValue(y)
+	if err != nil {
+		return "", fmt.Errorf("error translating right operand (%v): %v", y, err)
+	}
+
+	name := fmt.Sprintf("nsw%s%s%d", strings.ToUpper(op[:1]), op[1:], it.BitSize)
+	var src string
+	if it.BitSize == 8 {
+		// Do the arithmetic as int8, since i8 is translated as byte.
+		src = fmt.Sprintf(`func %s(a, b byte, where string) byte {
+	x, y := int8(a), int8(b)
+	z := x %s y
+	if %s {
+		panic(where + "signed overflow in %s")
+	}
+	return byte(z)
+}
+`, name, overflowOperators[op], overflowConditions[op], op)
+	} else {
+		src = fmt.Sprintf(`func %s(x, y int%d, where string) int%d {
+	z := x %s y
+	if %s {
+		panic(where + "signed overflow in %s")
+	}
+	return z
+}
+`, name, it.BitSize, it.BitSize, overflowOperators[op], overflowConditions[op], op)
+	}
+	var where string
+	if node, ok := inst.(llNode); ok {
+		where = panicPrefix(node)
+	}
+	return fmt.Sprintf("%s = %s(%s, %s, %q)", VariableName(inst), UseHelper(name, src), xs, ys, where), nil
+}
+
+// PointerChecks returns statements to be inserted before inst to check for
+// undefined behavior in its use of pointers.
+func PointerChecks(inst ir.Instruction) (string, error) {
+	var ptr value.Value
+	var align ir.Align
+	var what string
+	var bounds string
+	switch inst := inst.(type) {
+	case *ir.InstLoad:
+		ptr, align, what = inst.Src, inst.Align, "load from"
+	case *ir.InstStore:
+		ptr, align, what = inst.Dst, inst.Align, "store to"
+	case *ir.InstGetElementPtr:
+		if !inst.InBounds {
+			return "", nil
+		}
+		ptr, what = inst.Src, "inbounds getelementptr on"
+		var err error
+		bounds, err = boundsCheck(inst)
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", nil
+	}
+
+	p, err := FormatValue(ptr)
+	if err != nil {
+		return "", fmt.Errorf("error translating pointer (%v): %v", ptr, err)
+	}
+	if strings.HasPrefix(p, "&") {
+		// The address of a variable is never nil, and Go takes care of the
+		// alignment.
+		return bounds, nil
+	}
+
+	where := panicPrefix(inst)
+	null, addr := "nil", fmt.Sprintf("uintptr(unsafe.Pointer(%s))", p)
+	if arenaMode() {
+		null, addr = "0", p
+	}
+	checks := fmt.Sprintf("if %s == %s { panic(%q) }; ", p, null, where+what+" nil pointer")
+	if align > 1 {
+		checks += fmt.Sprintf("if %s%%%d != 0 { panic(%q) }; ", addr, align, where+what+" misaligned pointer")
+	}
+	return checks + bounds, nil
+}
+
+// boundsCheck returns a statement that checks that the first index of inst
+// (an inbounds getelementptr) stays within the object its source points to,
+// or one past the end of it. It returns the empty string if the length of the
+// object isn't known, or if the index is a constant that is in range.
+func boundsCheck(inst *ir.InstGetElementPtr) (string, error) {
+	n, ok := objectLength(inst.Src, inst.ElemType)
+	if !ok {
+		return "", nil
+	}
+	index := inst.Indices[0]
+	if ci, ok := index.(*constant.Index); ok {
+		index = ci.Constant
+	}
+	if c, ok := index.(*constant.Int); ok {
+		if nc, ok := n.(*constant.Int); ok && c.X.Sign() >= 0 && c.X.Cmp(nc.X) <= 0 {
+			return "", nil
+		}
+	}
+	i, err := FormatValue(index)
+	if err != nil {
+		return "", fmt.Errorf("error translating index (%v): %v", index, err)
+	}
+	length, err := FormatValue(n)
+	if err != nil {
+		return "", fmt.Errorf("error translating length (%v): %v", n, err)
+	}
+	return fmt.Sprintf("if int64(%s) < 0 || int64(%s) > int64(%s) { panic(%q) }; ", i, i, length, panicPrefix(inst)+"inbounds getelementptr out of bounds"), nil
+}
+
+// objectLength returns the number of values of type t in the object that ptr
+// points to the start of, if it is known: ptr is an alloca or global of type t,
+// or the address of the first element of an array that is one.
+func objectLength(ptr value.Value, t types.Type) (value.Value, bool) {
+	switch p := ptr.(type) {
+	case *ir.InstAlloca:
+		if !types.Equal(p.ElemType, t) {
+			return nil, false
+		}
+		if p.NElems == nil {
+			return constant.NewInt(types.I64, 1), true
+		}
+		return p.NElems, true
+	case *ir.Global:
+		if !types.Equal(p.ContentType, t) {
+			return nil, false
+		}
+		return constant.NewInt(types.I64, 1), true
+	case *ir.InstGetElementPtr:
+		return arrayStartLength(p.ElemType, p.Src, p.Indices, t)
+	case *constant.ExprGetElementPtr:
+		indices := make([]value.Value, len(p.Indices))
+		for i, index := range p.Indices {
+			indices[i] = index
+		}
+		return arrayStartLength(p.ElemType, p.Src, indices, t)
+	}
+	return nil, false
+}
+
+// arrayStartLength handles the case of objectLength where ptr is
+// getelementptr elemType, src, 0, 0, pointing to the first element of an
+// array of type t.
+func arrayStartLength(elemType types.Type, src value.Value, indices []value.Value, t types.Type) (value.Value, bool) {
+	at, ok := elemType.(*types.ArrayType)
+	if !ok || len(indices) != 2 || !types.Equal(at.ElemType, t) {
+		return nil, false
+	}
+	for _, index := range indices {
+		if ci, ok := index.(*constant.Index); ok {
+			index = ci.Constant
+		}
+		if c, ok := index.(*constant.Int); !ok || c.X.Sign() != 0 {
+			return nil, false
+		}
+	}
+	if n, ok := objectLength(src, elemType); !ok || !isOne(n) {
+		return nil, false
+	}
+	return constant.NewInt(types.I64, int64(at.Len)), true
+}
+
+func isOne(v value.Value) bool {
+	c, ok := v.(*constant.Int)
+	return ok && c.X.IsInt64() && c.X.Int64() == 1
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+)
+
+const ubSource = `
+@table = global [10 x i32] zeroinitializer
+
+define i32 @add(i32 %a, i32 %b) {
+  %r = add nsw i32 %a, %b
+  ret i32 %r
+}
+
+define i32 @deref(i32* %p) {
+  %x = load i32, i32* %p, align 4
+  ret i32 %x
+}
+
+define i32 @local(i64 %i) {
+  %a = alloca i32, i64 4
+  %p = getelementptr inbounds i32, i32* %a, i64 %i
+  %q = getelementptr inbounds i32, i32* %a, i64 4
+  store i32 7, i32* %a
+  ret i32 7
+}
+
+define i32* @elem(i64 %i) {
+  %base = getelementptr inbounds [10 x i32], [10 x i32]* @table, i64 0, i64 0
+  %p = getelementptr inbounds i32, i32* %base, i64 %i
+  ret i32* %p
+}
+`
+
+const ubMain = `package main
+
+import "fmt"
+
+func try(f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+		}
+	}()
+	f()
+}
+
+func main() {
+	try(func() { fmt.Println(add(1, 2)) })
+	try(func() { fmt.Println(add(2147483647, 1)) })
+	try(func() { x := int32(5); fmt.Println(deref(&x)) })
+	try(func() { fmt.Println(deref(nil)) })
+	try(func() { fmt.Println(local(3)) })
+	try(func() { fmt.Println(local(5)) })
+	try(func() { fmt.Println(elem(10) != nil) })
+	try(func() { fmt.Println(elem(11) != nil) })
+	try(func() { fmt.Println(elem(-1) != nil) })
+}
+`
+
+func TestUBChecks(t *testing.T) {
+	t.Parallel()
+	want := `3
+signed overflow in add
+5
+load from nil pointer
+7
+inbounds getelementptr out of bounds
+true
+inbounds getelementptr out of bounds
+inbounds getelementptr out of bounds
+`
+	checkProgram(t, ubSource, ubMain, want, "-ub-checks")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/metadata"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+var (
+	valueType    = reflect.TypeOf((*value.Value)(nil)).Elem()
+	typeType     = reflect.TypeOf((*types.Type)(nil)).Elem()
+	metadataType = reflect.TypeOf(ir.Metadata{})
+	mdNodeType   = reflect.TypeOf((*metadata.Node)(nil)).Elem()
+)
+
+// References returns the values that x (an instruction, terminator, or
+// constant) refers to. Constant expressions are searched for the values they
+// refer to in turn, but other values (such as instructions and globals) are
+// returned without looking inside them. If x is itself a global or function,
+// the result is just x.
+func References(x interface{}) []value.Value {
+	if v, ok := x.(value.Value); ok && isGlobalValue(v) {
+		return []value.Value{v}
+	}
+	var refs []value.Value
+	var walk func(v reflect.Value, top bool)
+	walk = func(v reflect.Value, top bool) {
+		switch v.Kind() {
+		case reflect.Interface:
+			if v.IsNil() {
+				return
+			}
+			if !top && v.Type().Implements(typeType) && !v.Type().Implements(valueType) {
+				return
+			}
+			walk(v.Elem(), false)
+
+		case reflect.Ptr:
+			if v.IsNil() {
+				return
+			}
+			if !top && v.Type().Implements(valueType) {
+				val := v.Interface().(value.Value)
+				if _, ok := val.(constant.Constant); !ok || isGlobalValue(val) {
+					refs = append(refs, val)
+					return
+				}
+			}
+			if !top && v.Type().Implements(typeType) && !v.Type().Implements(valueType) {
+				return
+			}
+			walk(v.Elem(), false)
+
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				if v.Type().Field(i).PkgPath != "" {
+					// unexported
+					continue
+				}
+				f := v.Field(i)
+				if f.Type() == typeType || f.Type() == metadataType || f.Type() == mdNodeType {
+					continue
+				}
+				walk(f, false)
+			}
+
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				walk(v.Index(i), false)
+			}
+		}
+	}
+	walk(reflect.ValueOf(x), true)
+	return refs
+}
+
+// isGlobalValue reports whether v is a global variable or function (which are
+// constants in LLVM's type system, but aren't part of the expression).
+func isGlobalValue(v value.Value) bool {
+	switch v.(type) {
+	case *ir.Global, *ir.Func, *ir.Alias, *ir.IFunc:
+		return true
+	}
+	return false
+}
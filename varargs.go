@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/llir/llvm/ir"
+)
+
+// VAIntrinsic translates calls to llvm.va_start, llvm.va_copy, and
+// llvm.va_end. Their arguments point to the storage for a va_list (which may
+// be bigger than a pointer, like x86-64's __va_list_tag array), and a
+// translated va_list is the same pointer to a []interface{} that
+// leaven_va_start produces (see libc.VAArg), stored at the beginning of
+// that space. If name is none of them, it returns ok == false.
+func VAIntrinsic(inst *ir.InstCall, name string) (result string, ok bool, err error) {
+	base := intrinsicBase(name)
+	var nArgs int
+	switch base {
+	case "va_start", "va_end":
+		nArgs = 1
+	case "va_copy":
+		nArgs = 2
+	default:
+		return "", false, nil
+	}
+	if len(inst.Args) != nArgs {
+		return "", true, fmt.Errorf("wrong number of arguments to %s: %d", name, len(inst.Args))
+	}
+	if base == "va_end" {
+		// The garbage collector cleans up the va_list.
+		return "", true, nil
+	}
+	if arenaMode() {
+		return "", true, fmt.Errorf("%s isn't supported with -memory=arena", name)
+	}
+	args := make([]string, nArgs)
+	for i, a := range inst.Args {
+		v, err := FormatValue(a)
+		if err != nil {
+			return "", true, fmt.Errorf("error translating argument %d (%v): %v", i, a, err)
+		}
+		args[i] = fmt.Sprintf("*(**byte)(unsafe.Pointer(%s))", v)
+	}
+	if base == "va_start" {
+		return fmt.Sprintf("%s = libc.VAStart(varargs)", args[0]), true, nil
+	}
+	return fmt.Sprintf("%s = libc.VACopy(%s)", args[0], args[1]), true, nil
+}
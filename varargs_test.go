@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const vaSource = `
+declare void @llvm.va_start(i8*)
+declare void @llvm.va_copy(i8*, i8*)
+declare void @llvm.va_end(i8*)
+
+; sumTwice adds up its n variadic ints twice: once from the original list,
+; and once from a copy made before the first pass. Then it starts over and
+; returns the first argument, to show that starting again begins at the
+; beginning.
+define i32 @sumTwice(i32 %n, ...) {
+entry:
+  %ap = alloca i8*
+  %aq = alloca i8*
+  %ap8 = bitcast i8** %ap to i8*
+  %aq8 = bitcast i8** %aq to i8*
+  call void @llvm.va_start(i8* %ap8)
+  call void @llvm.va_copy(i8* %aq8, i8* %ap8)
+  br label %loop
+
+loop:
+  %i = phi i32 [ 0, %entry ], [ %i1, %body ]
+  %sum = phi i32 [ 0, %entry ], [ %sum2, %body ]
+  %more = icmp slt i32 %i, %n
+  br i1 %more, label %body, label %done
+
+body:
+  %x = va_arg i8** %ap, i32
+  %y = va_arg i8** %aq, i32
+  %sum1 = add i32 %sum, %x
+  %sum2 = add i32 %sum1, %y
+  %i1 = add i32 %i, 1
+  br label %loop
+
+done:
+  call void @llvm.va_end(i8* %aq8)
+  call void @llvm.va_end(i8* %ap8)
+  call void @llvm.va_start(i8* %ap8)
+  %first = va_arg i8** %ap, i32
+  call void @llvm.va_end(i8* %ap8)
+  %r = mul i32 %sum, 100
+  %r1 = add i32 %r, %first
+  ret i32 %r1
+}
+`
+
+func TestVAIntrinsics(t *testing.T) {
+	t.Parallel()
+	mainSrc := mainCalling("sumTwice(3, int32(1), int32(2), int32(3))", "sumTwice(1, int32(5))")
+	checkProgram(t, vaSource, mainSrc, "1201\n1005\n")
+
+	output := translateError(t, vaSource, "-color=never", "-memory=arena")
+	if !strings.Contains(output, "llvm.va_start isn't supported with -memory=arena") {
+		t.Errorf("output doesn't mention -memory=arena:\n%s", output)
+	}
+}
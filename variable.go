@@ -3,7 +3,7 @@ package main
 import (
 	"bytes"
 	"fmt"
-	"strings"
+	"strconv"
 
 	"github.com/llir/llvm/ir"
 	"github.com/llir/llvm/ir/constant"
@@ -11,52 +11,22 @@ import (
 	"github.com/llir/llvm/ir/value"
 )
 
-// VariableName returns the name to use for a local variable or parameter.
-func VariableName(v value.Named) string {
-	name := v.Name()
-	if name == "" {
-		return "v" + strings.TrimPrefix(v.Ident(), "%")
-	}
-	if c := name[0]; '0' <= c && c <= '9' {
-		name = "v" + name
-	}
-	name = strings.Replace(name, ".", "_", -1)
-	if invalidNames[name] {
-		name = "_" + name
-	}
-	return name
-}
-
-func BlockName(v value.Value) string {
-	block := v.(*ir.Block)
-	name := block.Name()
-	if name == "" {
-		return "block" + strings.TrimPrefix(block.Ident(), "%")
-	}
-	if c := name[0]; '0' <= c && c <= '9' {
-		name = "block" + name
-	}
-	name = strings.Replace(name, ".", "_", -1)
-	if invalidNames[name] {
-		name = "_" + name
-	}
-	return name
-}
-
-var invalidNames = map[string]bool{
-	"return": true,
-}
-
 // FormatValue formats a constant or variable as it should appear in an expression.
 func FormatValue(v value.Value) (string, error) {
 	switch v := v.(type) {
 	case *ir.Global:
-		if types.IsFunc(v.ContentType) {
-			return VariableName(v), nil
+		if types.IsFunc(v.ContentType) || arenaMode() {
+			return GlobalRef(v), nil
 		}
-		return "&" + VariableName(v), nil
+		return "&" + GlobalRef(v), nil
+
+	case *ir.Func:
+		return GlobalRef(v), nil
 
 	case value.Named:
+		if expr, ok := inlinedExprs[v]; ok {
+			return parenthesize(expr), nil
+		}
 		return VariableName(v), nil
 
 	case *ir.Arg:
@@ -103,6 +73,9 @@ func FormatValue(v value.Value) (string, error) {
 		}
 		return b.String(), nil
 
+	case *constant.BlockAddress:
+		return BlockAddress(v)
+
 	case *constant.CharArray:
 		t, err := TypeSpec(v.Typ)
 		if err != nil {
@@ -136,37 +109,78 @@ func FormatValue(v value.Value) (string, error) {
 		}
 		return b.String(), nil
 
+	case *constant.ExprAddrSpaceCast:
+		return AddrSpaceCast(v.From, v.To)
+
 	case *constant.ExprBitCast:
+		if arenaMode() && isDataPointer(v.From.Type()) && isDataPointer(v.To) || types.Equal(v.From.Type(), v.To) {
+			return FormatValue(v.From)
+		}
 		from, err := FormatValue(v.From)
 		if err != nil {
 			return "", fmt.Errorf("error translating source (%v): %v", v.From, err)
 		}
+		if result, ok, err := funcPointerCast(from, v.From.Type(), v.To); ok {
+			return result, err
+		}
 		to, err := TypeSpec(v.To)
 		if err != nil {
 			return "", fmt.Errorf("error translating type (%v): %v", v.To, err)
 		}
 		return fmt.Sprintf("(%s)(unsafe.Pointer(%s))", to, from), nil
 
+	case *constant.ExprExtractElement:
+		return formatExtractElement(v)
+
+	case *constant.ExprInsertElement:
+		return formatVectorExpr(v)
+
+	case *constant.ExprIntToPtr:
+		return IntToPtr(v.From, v.To)
+
 	case *constant.ExprGetElementPtr:
 		indices := make([]value.Value, len(v.Indices))
 		for i, index := range v.Indices {
 			indices[i] = index
 		}
+		if arenaMode() {
+			return ArenaGEP(v.ElemType, v.Src, indices)
+		}
 		return GetElementPtr(v.ElemType, v.Src, indices)
 
+	case *constant.ExprShuffleVector:
+		return formatVectorExpr(v)
+
 	case *constant.Float:
-		result := v.X.String()
-		special := false
-		switch result {
-		case "+Inf":
-			result = "math.Inf(1)"
-			special = true
-		case "-Inf":
-			result = "math.Inf(-1)"
-			special = true
-		case "NaN":
+		if v.Typ.Kind == types.FloatKindHalf {
+			return halfConstant(v), nil
+		}
+		v = fixFP128Constant(v)
+		if prec, ok := bigLongDouble(v.Typ); ok {
+			return longDoubleConstant(v, prec), nil
+		}
+		var result string
+		special := true
+		switch {
+		case v.NaN:
 			result = "math.NaN()"
-			special = true
+		case v.X.IsInf():
+			result = fmt.Sprintf("math.Inf(%d)", v.X.Sign())
+		case v.X.Sign() == 0 && v.X.Signbit():
+			// A Go constant can't be negative zero.
+			result = "math.Copysign(0, -1)"
+		default:
+			special = false
+			switch v.Typ.Kind {
+			case types.FloatKindFloat:
+				f, _ := v.X.Float32()
+				result = strconv.FormatFloat(float64(f), 'g', -1, 32)
+			case types.FloatKindDouble:
+				f, _ := v.X.Float64()
+				result = strconv.FormatFloat(f, 'g', -1, 64)
+			default:
+				result = v.X.Text('g', -1)
+			}
 		}
 		if special && v.Typ.Kind == types.FloatKindFloat {
 			result = fmt.Sprintf("float32(%s)", result)
@@ -177,6 +191,16 @@ func FormatValue(v value.Value) (string, error) {
 		return FormatValue(v.Constant)
 
 	case *constant.Int:
+		if v.Typ.BitSize == 128 {
+			return int128Literal(v), nil
+		}
+		if it, ok := oddWidth(v.Typ); ok {
+			// Normalize the constant like the variables.
+			if it.BitSize < 8 {
+				return fmt.Sprint(uint64(sextInt64(v)) & oddMask(it)), nil
+			}
+			return fmt.Sprint(sextInt64(v)), nil
+		}
 		var value int64
 		switch {
 		case v.X.IsInt64():
@@ -204,6 +228,9 @@ func FormatValue(v value.Value) (string, error) {
 		}
 
 	case *constant.Null:
+		if arenaMode() && isDataPointer(v.Typ) {
+			return "0", nil
+		}
 		return "nil", nil
 
 	case *constant.Struct:
@@ -211,6 +238,9 @@ func FormatValue(v value.Value) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("error translating type (%v): %v", v.Typ, err)
 		}
+		if misalignedFields(v.Typ) != nil {
+			return packedStructLiteral(v, t)
+		}
 		b := new(bytes.Buffer)
 		b.WriteString(t)
 		b.WriteByte('{')
@@ -228,20 +258,7 @@ func FormatValue(v value.Value) (string, error) {
 		return b.String(), nil
 
 	case *constant.Undef:
-		switch v.Typ.(type) {
-		case *types.ArrayType, *types.StructType, *types.VectorType:
-			t, err := TypeSpec(v.Typ)
-			if err != nil {
-				return "", fmt.Errorf("error translating type (%v): %v", v.Typ, err)
-			}
-			return t + "{}", nil
-		case *types.IntType, *types.FloatType:
-			return "0", nil
-		case *types.PointerType:
-			return "nil", nil
-		default:
-			return "", fmt.Errorf("unsupported type for undefined constant: %v", v.Typ)
-		}
+		return zeroValue(v.Typ)
 
 	case *constant.Vector:
 		t, err := TypeSpec(v.Typ)
@@ -265,18 +282,46 @@ func FormatValue(v value.Value) (string, error) {
 		return b.String(), nil
 
 	case *constant.ZeroInitializer:
-		t, err := TypeSpec(v.Typ)
-		if err != nil {
-			return "", fmt.Errorf("error translating type (%v): %v", v.Typ, err)
-		}
-		return t + "{}", nil
+		return zeroValue(v.Typ)
 
 	default:
 		return "", fmt.Errorf("unsupported type of value to translate: %T", v)
 	}
 }
 
-// FormatSigned is like FormatValue, except that it converts "byte" to "int8".
+// zeroValue returns the zero value of type t, which is also used for undef.
+func zeroValue(t types.Type) (string, error) {
+	switch t := t.(type) {
+	case *types.ArrayType, *types.StructType, *types.VectorType:
+		ts, err := TypeSpec(t)
+		if err != nil {
+			return "", fmt.Errorf("error translating type (%v): %v", t, err)
+		}
+		return ts + "{}", nil
+	case *types.IntType:
+		switch t.BitSize {
+		case 1:
+			return "false", nil
+		case 128:
+			return "libc.Int128{}", nil
+		}
+		return "0", nil
+	case *types.FloatType:
+		if _, ok := bigLongDouble(t); ok {
+			return "libc.LongDouble{}", nil
+		}
+		return "0", nil
+	case *types.PointerType:
+		if arenaMode() && isDataPointer(t) {
+			return "0", nil
+		}
+		return "nil", nil
+	}
+	return "", fmt.Errorf("unsupported type for zero value: %v", t)
+}
+
+// FormatSigned is like FormatValue, except that it converts "byte" to "int8"
+// (sign-extending odd widths held in a byte).
 func FormatSigned(v value.Value) (string, error) {
 	result, err := FormatValue(v)
 	if err != nil {
@@ -284,14 +329,22 @@ func FormatSigned(v value.Value) (string, error) {
 	}
 
 	if ci, ok := v.(*constant.Int); ok {
-		if ci.Typ.BitSize == 8 {
+		switch {
+		case ci.Typ.BitSize == 8:
 			return fmt.Sprint(int8(ci.X.Int64())), nil
+		case ci.Typ.BitSize < 8 && ci.Typ.BitSize > 1:
+			return fmt.Sprint(sextInt64(ci)), nil
 		}
 		return result, nil
 	}
 
-	if t, ok := v.Type().(*types.IntType); ok && t.BitSize == 8 {
-		return fmt.Sprintf("int8(%s)", result), nil
+	if t, ok := v.Type().(*types.IntType); ok {
+		switch {
+		case t.BitSize == 8:
+			return fmt.Sprintf("int8(%s)", result), nil
+		case t.BitSize < 8 && t.BitSize > 1:
+			return fmt.Sprintf("(int8(%s<<%d) >> %d)", result, 8-t.BitSize, 8-t.BitSize), nil
+		}
 	}
 	return result, nil
 }
@@ -305,6 +358,16 @@ func FormatUnsigned(v value.Value) (string, error) {
 	}
 
 	if ci, ok := v.(*constant.Int); ok {
+		if ci.Typ.BitSize == 128 {
+			return result, nil
+		}
+		if it, ok := oddWidth(ci.Typ); ok {
+			u := uint64(sextInt64(ci)) & oddMask(it)
+			if it.BitSize < 8 {
+				return fmt.Sprint(u), nil
+			}
+			return fmt.Sprintf("uint%d(%d)", intContainer(it.BitSize), u), nil
+		}
 		var value uint64
 		switch {
 		case ci.X.IsUint64():
@@ -342,7 +405,10 @@ func FormatUnsigned(v value.Value) (string, error) {
 		}
 	}
 
-	if t, ok := v.Type().(*types.IntType); ok && t.BitSize > 8 {
+	if t, ok := v.Type().(*types.IntType); ok && t.BitSize > 8 && t.BitSize != 128 {
+		if it, ok := oddWidth(t); ok {
+			return fmt.Sprintf("(uint%d(%s) & %#x)", intContainer(it.BitSize), result, oddMask(it)), nil
+		}
 		return fmt.Sprintf("uint%d(%s)", t.BitSize, result), nil
 	}
 	return result, nil
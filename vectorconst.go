@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+)
+
+// Vector constants can be written as constant expressions built with
+// insertelement and shufflevector, instead of as element lists. (Before LLVM
+// added the splat syntax, that was how a splat of a constant that isn't
+// known until link time, like the address of a global, was written: a
+// shufflevector of an insertelement, with a zeroinitializer mask.) Go has no
+// operations on array constants, so they are folded into element lists.
+
+// vectorElements returns the elements of the constant vector c, folding
+// insertelement and shufflevector expressions.
+func vectorElements(c constant.Constant) ([]constant.Constant, error) {
+	vt, ok := c.Type().(*types.VectorType)
+	if !ok {
+		return nil, fmt.Errorf("not a vector: %v", c)
+	}
+	switch c := c.(type) {
+	case *constant.Vector:
+		return c.Elems, nil
+
+	case *constant.ZeroInitializer, *constant.Undef:
+		elems := make([]constant.Constant, vt.Len)
+		for i := range elems {
+			if _, ok := c.(*constant.Undef); ok {
+				elems[i] = constant.NewUndef(vt.ElemType)
+			} else {
+				elems[i] = constant.NewZeroInitializer(vt.ElemType)
+			}
+		}
+		return elems, nil
+
+	case *constant.ExprInsertElement:
+		elems, err := vectorElements(c.X)
+		if err != nil {
+			return nil, err
+		}
+		index, ok := c.Index.(*constant.Int)
+		if !ok {
+			return nil, fmt.Errorf("unsupported index for insertelement: %v", c.Index)
+		}
+		result := make([]constant.Constant, len(elems))
+		copy(result, elems)
+		if i := unsignedConstant(index); i.IsUint64() && i.Uint64() < uint64(len(result)) {
+			result[i.Uint64()] = c.Elem
+		}
+		// An index that is out of range gives poison, so leaving the
+		// vector unchanged is as good as anything.
+		return result, nil
+
+	case *constant.ExprShuffleVector:
+		x, err := vectorElements(c.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := vectorElements(c.Y)
+		if err != nil {
+			return nil, err
+		}
+		mask, err := vectorElements(c.Mask)
+		if err != nil {
+			return nil, err
+		}
+		both := append(append([]constant.Constant(nil), x...), y...)
+		result := make([]constant.Constant, len(mask))
+		for i, m := range mask {
+			switch m := m.(type) {
+			case *constant.Int:
+				j := unsignedConstant(m)
+				if !j.IsUint64() || j.Uint64() >= uint64(len(both)) {
+					return nil, fmt.Errorf("shufflevector mask index out of range: %v", m)
+				}
+				result[i] = both[j.Uint64()]
+			case *constant.ZeroInitializer:
+				result[i] = both[0]
+			case *constant.Undef:
+				result[i] = constant.NewUndef(vt.ElemType)
+			default:
+				return nil, fmt.Errorf("unsupported shufflevector mask element: %v", m)
+			}
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("unsupported vector constant: %v", c)
+}
+
+// formatVectorExpr formats an insertelement or shufflevector constant
+// expression as an element list.
+func formatVectorExpr(c constant.Constant) (string, error) {
+	elems, err := vectorElements(c)
+	if err != nil {
+		return "", err
+	}
+	return FormatValue(&constant.Vector{Typ: c.Type().(*types.VectorType), Elems: elems})
+}
+
+// formatExtractElement formats an extractelement constant expression. If the
+// vector can be folded, the element is used directly.
+func formatExtractElement(c *constant.ExprExtractElement) (string, error) {
+	if index, ok := c.Index.(*constant.Int); ok {
+		if elems, err := vectorElements(c.X); err == nil {
+			if i := unsignedConstant(index); i.IsUint64() && i.Uint64() < uint64(len(elems)) {
+				return FormatValue(elems[i.Uint64()])
+			}
+			// An index that is out of range gives poison.
+			return zeroValue(c.Type())
+		}
+	}
+	x, err := FormatValue(c.X)
+	if err != nil {
+		return "", fmt.Errorf("error translating vector (%v): %v", c.X, err)
+	}
+	index, err := FormatValue(c.Index)
+	if err != nil {
+		return "", fmt.Errorf("error translating index (%v): %v", c.Index, err)
+	}
+	return fmt.Sprintf("%s[%s]", parenthesize(x), index), nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestVectorConstantExprs(t *testing.T) {
+	t.Parallel()
+	src := `
+@g = global i32 7
+@h = global i32 9
+
+; The splat of @g, written the way LLVM did before the splat syntax.
+@ptrs = global <2 x i32*> shufflevector (<2 x i32*> insertelement (<2 x i32*> undef, i32* @g, i32 0), <2 x i32*> undef, <2 x i32> zeroinitializer)
+
+define i32 @sumSplat() {
+  %v = load <2 x i32*>, <2 x i32*>* @ptrs
+  %p0 = extractelement <2 x i32*> %v, i32 0
+  %p1 = extractelement <2 x i32*> %v, i32 1
+  %a = load i32, i32* %p0
+  %b = load i32, i32* %p1
+  %r = add i32 %a, %b
+  ret i32 %r
+}
+
+define <4 x i32> @shuffled() {
+  ret <4 x i32> shufflevector (<2 x i32> <i32 1, i32 2>, <2 x i32> <i32 3, i32 4>, <4 x i32> <i32 3, i32 0, i32 2, i32 1>)
+}
+
+define <3 x i32> @inserted() {
+  ret <3 x i32> insertelement (<3 x i32> zeroinitializer, i32 5, i32 1)
+}
+
+define i32 @second() {
+  %p = extractelement <2 x i32*> insertelement (<2 x i32*> insertelement (<2 x i32*> undef, i32* @g, i32 0), i32* @h, i32 1), i32 1
+  %x = load i32, i32* %p
+  ret i32 %x
+}
+`
+	mainSrc := mainCalling("sumSplat()", "shuffled()", "inserted()", "second()")
+	checkProgram(t, src, mainSrc, "14\n[4 1 3 2]\n[0 5 0]\n9\n")
+}